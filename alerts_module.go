@@ -0,0 +1,466 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/SpirentOrion/httprouter"
+	log "github.com/SpirentOrion/logrus"
+	"github.com/SpirentOrion/luddite"
+	"golang.org/x/net/context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Alert struct {
+	Key        string     `json:"key,required"`
+	Rule       string     `json:"rule,required"`
+	Type       string     `json:"type,required"`
+	Severity   string     `json:"severity,required"`
+	Status     string     `json:"status,required"`
+	Cloud      string     `json:"cloud,required"`
+	Hypervisor string     `json:"hypervisor,omitempty"`
+	Target     string     `json:"target,required"`
+	Message    string     `json:"message,required"`
+	Value      float64    `json:"value,omitempty"`
+	StartsAt   time.Time  `json:"starts_at,required"`
+	EndsAt     *time.Time `json:"ends_at,omitempty"`
+}
+
+type Alerts struct {
+	Alerts []Alert `json:"alerts,required"`
+}
+
+type AlertRules struct {
+	Rules []AlertRule `json:"rules,required"`
+}
+
+type alertInstancePlacement struct {
+	Name       string
+	Hypervisor string
+	HostIP     string
+}
+
+const (
+	alertStatusFiring   = "firing"
+	alertStatusResolved = "resolved"
+)
+
+const alertRulesStoreName = "alert_rules.json"
+
+var alertRuleTypes = map[string]bool{
+	"hypervisor_down":    true,
+	"instance_missing":   true,
+	"instance_migrated":  true,
+	"patch_peer_missing": true,
+	"drop_rate":          true,
+}
+
+var alertRules []AlertRule
+var alertActive map[string]Alert = make(map[string]Alert)
+var alertInstances map[string]map[string]alertInstancePlacement = make(map[string]map[string]alertInstancePlacement)
+var alertLock sync.Mutex
+
+// alertRetryBackoff is the wait before the first retry of a notification,
+// doubling with each further retry.
+var alertRetryBackoff = time.Second
+
+func alertGetRules() []AlertRule {
+	alertLock.Lock()
+	defer alertLock.Unlock()
+
+	rules := make([]AlertRule, len(alertRules))
+	copy(rules, alertRules)
+	return rules
+}
+
+func alertValidateRule(rule AlertRule) error {
+	if len(rule.Name) == 0 {
+		return fmt.Errorf("Alert rule name is required")
+	}
+	if !alertRuleTypes[rule.Type] {
+		return fmt.Errorf("Unknown alert rule type %s", rule.Type)
+	}
+	if rule.Type == "drop_rate" && rule.Threshold <= 0 {
+		return fmt.Errorf("Alert rule %s requires a positive threshold", rule.Name)
+	}
+	return nil
+}
+
+func alertNewAlert(rule AlertRule, cloudName string, hypervisor string, target string, message string) Alert {
+	severity := rule.Severity
+	if len(severity) == 0 {
+		severity = "warning"
+	}
+	return Alert{
+		Key:        rule.Name + "/" + cloudName + "/" + hypervisor + "/" + target,
+		Rule:       rule.Name,
+		Type:       rule.Type,
+		Severity:   severity,
+		Status:     alertStatusFiring,
+		Cloud:      cloudName,
+		Hypervisor: hypervisor,
+		Target:     target,
+		Message:    message,
+		StartsAt:   time.Now(),
+	}
+}
+
+// alertCheckInstances compares the current libvirt placement of every domain
+// with the placement seen on the previous evaluation. It returns the current
+// placements, the domains that moved and the ones no longer running anywhere.
+func alertCheckInstances(cloudInfo *CloudInfo) (map[string]alertInstancePlacement, map[string]alertInstancePlacement, map[string]alertInstancePlacement) {
+	current := make(map[string]alertInstancePlacement)
+	for _, hypervisor := range cloudGetHypervisorList(cloudInfo) {
+		for _, instance := range libvirtGetDomainInstances(hypervisor.HostIP) {
+			current[instance.UUID] = alertInstancePlacement{
+				Name:       instance.InstanceName,
+				Hypervisor: hypervisor.Name,
+				HostIP:     hypervisor.HostIP,
+			}
+		}
+	}
+	novaInstances := make(map[string]bool)
+	for _, instance := range cloudGetIntanceList(cloudInfo) {
+		novaInstances[instance.ID] = true
+	}
+
+	previous := alertInstances[cloudInfo.Name]
+	moved := make(map[string]alertInstancePlacement)
+	missing := make(map[string]alertInstancePlacement)
+	known := make(map[string]alertInstancePlacement)
+	for uuid, placement := range current {
+		known[uuid] = placement
+		if prev, ok := previous[uuid]; ok && prev.HostIP != placement.HostIP {
+			moved[uuid] = prev
+		}
+	}
+	for uuid, placement := range previous {
+		if _, ok := current[uuid]; ok {
+			continue
+		}
+		// Instances deleted through Nova are gone on purpose; forget them.
+		if novaInstances[uuid] {
+			missing[uuid] = placement
+			known[uuid] = placement
+		}
+	}
+	alertInstances[cloudInfo.Name] = known
+	return current, moved, missing
+}
+
+func alertEvaluateCloud(cloudInfo *CloudInfo, rules []AlertRule, conditions map[string]Alert, events *[]Alert) {
+	current, moved, missing := alertCheckInstances(cloudInfo)
+	for _, rule := range rules {
+		if len(rule.Cloud) > 0 && rule.Cloud != cloudInfo.Name {
+			continue
+		}
+		switch rule.Type {
+		case "hypervisor_down":
+			for _, hypervisor := range cloudGetHypervisorList(cloudInfo) {
+				if hypervisor.State == "down" {
+					alert := alertNewAlert(rule, cloudInfo.Name, hypervisor.Name, hypervisor.Name,
+						"Hypervisor "+hypervisor.Name+" is down")
+					conditions[alert.Key] = alert
+				}
+			}
+		case "instance_missing":
+			for uuid, placement := range missing {
+				alert := alertNewAlert(rule, cloudInfo.Name, placement.Hypervisor, uuid,
+					"Instance "+placement.Name+" disappeared from hypervisor "+placement.Hypervisor)
+				conditions[alert.Key] = alert
+			}
+		case "instance_migrated":
+			for uuid, from := range moved {
+				to := current[uuid]
+				alert := alertNewAlert(rule, cloudInfo.Name, to.Hypervisor, uuid,
+					"Instance "+to.Name+" moved from hypervisor "+from.Hypervisor+" to "+to.Hypervisor)
+				*events = append(*events, alert)
+			}
+		case "patch_peer_missing":
+			for _, hypervisor := range cloudGetHypervisorList(cloudInfo) {
+				for _, bc := range ovsGetBridgeConnections(hypervisor.HostIP) {
+					if len(bc.TargetInterface.Name) > 0 && len(bc.TargetBridge.Name) > 0 {
+						continue
+					}
+					alert := alertNewAlert(rule, cloudInfo.Name, hypervisor.Name, bc.SourceInterface.Name,
+						"Patch port "+bc.SourceInterface.Name+" on bridge "+bc.SourceBridge.Name+" has no peer "+bc.SourceInterface.Options["peer"])
+					conditions[alert.Key] = alert
+				}
+			}
+		case "drop_rate":
+			for _, hypervisor := range cloudGetHypervisorList(cloudInfo) {
+				for _, rates := range statsGetHypervisorRates(hypervisor.HostIP) {
+					dropRate := rates.RxDropRate + rates.TxDropRate
+					if dropRate <= rule.Threshold {
+						continue
+					}
+					alert := alertNewAlert(rule, cloudInfo.Name, hypervisor.Name, rates.Source+"/"+rates.Name,
+						fmt.Sprintf("Interface %s drop rate %.1f/s exceeds %.1f/s", rates.Name, dropRate, rule.Threshold))
+					alert.Value = dropRate
+					conditions[alert.Key] = alert
+				}
+			}
+		}
+	}
+}
+
+func alertEvaluate() {
+	if !cfg.Alerts.Enabled {
+		return
+	}
+
+	alertLock.Lock()
+	rules := make([]AlertRule, len(alertRules))
+	copy(rules, alertRules)
+
+	conditions := make(map[string]Alert)
+	var notifications []Alert
+	cloudList := cloudGetCloudList()
+	for _, cloudInfo := range cloudList {
+		alertEvaluateCloud(&cloudInfo, rules, conditions, &notifications)
+	}
+
+	for key, alert := range conditions {
+		if _, ok := alertActive[key]; ok {
+			continue
+		}
+		alertActive[key] = alert
+		notifications = append(notifications, alert)
+	}
+	for key, alert := range alertActive {
+		if _, ok := conditions[key]; ok {
+			continue
+		}
+		delete(alertActive, key)
+		alert.Status = alertStatusResolved
+		endsAt := time.Now()
+		alert.EndsAt = &endsAt
+		notifications = append(notifications, alert)
+	}
+	alertLock.Unlock()
+
+	for _, alert := range notifications {
+		logFields := log.Fields{
+			"Rule":   alert.Rule,
+			"Status": alert.Status,
+			"Target": alert.Target,
+		}
+		service.Logger().WithFields(logFields).Info(alert.Message)
+		alertNotify(alert)
+	}
+}
+
+func alertNotify(alert Alert) {
+	for _, sink := range cfg.Alerts.Sinks {
+		go alertSend(sink, alert)
+	}
+}
+
+func alertSend(sink AlertSink, alert Alert) error {
+	body, err := json.Marshal(Alerts{[]Alert{alert}})
+	if err != nil {
+		return err
+	}
+	timeout := time.Duration(sink.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	client := &http.Client{Timeout: timeout}
+
+	backoff := alertRetryBackoff
+	for attempt := 0; attempt <= sink.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		var resp *http.Response
+		resp, err = client.Post(sink.Url, "application/json", bytes.NewReader(body))
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode < 300 {
+				return nil
+			}
+			err = fmt.Errorf("webhook returned status %d", resp.StatusCode)
+		}
+		logFields := log.Fields{
+			"Sink":    sink.Name,
+			"Url":     sink.Url,
+			"Attempt": attempt + 1,
+			"Error":   err.Error(),
+		}
+		service.Logger().WithFields(logFields).Error("Error delivering alert notification")
+	}
+	return err
+}
+
+// alertConfigured reports whether a rule comes from the config, which the
+// API may not change.
+func alertConfigured(name string) bool {
+	for _, rule := range cfg.Alerts.Rules {
+		if rule.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func alertSaveRules() error {
+	alertLock.Lock()
+	var apiRules []AlertRule
+	for _, rule := range alertRules {
+		if !alertConfigured(rule.Name) {
+			apiRules = append(apiRules, rule)
+		}
+	}
+	alertLock.Unlock()
+
+	return storeSave(alertRulesStoreName, apiRules)
+}
+
+func alertLoadRules() error {
+	var apiRules []AlertRule
+	err := storeLoad(alertRulesStoreName, &apiRules)
+
+	alertLock.Lock()
+	defer alertLock.Unlock()
+
+	alertRules = append(alertRules, cfg.Alerts.Rules...)
+	for _, rule := range apiRules {
+		if alertValidateRule(rule) == nil && !alertConfigured(rule.Name) {
+			alertRules = append(alertRules, rule)
+		}
+	}
+	return err
+}
+
+func GetAlertRules(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	rules := AlertRules{alertGetRules()}
+	luddite.WriteResponse(rw, http.StatusOK, rules)
+}
+
+func CreateAlertRule(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	var rule AlertRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		apiError := APIError{http.StatusBadRequest, "Invalid alert rule: " + err.Error()}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	if err := alertValidateRule(rule); err != nil {
+		apiError := APIError{http.StatusBadRequest, err.Error()}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	auditNote(r, rule.Name, map[string]string{"type": rule.Type, "cloud": rule.Cloud, "severity": rule.Severity})
+	if alertConfigured(rule.Name) {
+		apiError := APIError{http.StatusConflict, "Alert rule " + rule.Name + " is defined in the config"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+
+	alertLock.Lock()
+	replaced := false
+	for i := range alertRules {
+		if alertRules[i].Name == rule.Name {
+			alertRules[i] = rule
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		alertRules = append(alertRules, rule)
+	}
+	alertLock.Unlock()
+
+	if err := alertSaveRules(); err != nil {
+		apiError := APIError{http.StatusInternalServerError, "Error saving alert rules: " + err.Error()}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	luddite.WriteResponse(rw, http.StatusOK, rule)
+}
+
+func DeleteAlertRule(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	ruleName := httprouter.ContextParams(ctx).ByName("rule_name")
+	if alertConfigured(ruleName) {
+		apiError := APIError{http.StatusConflict, "Alert rule " + ruleName + " is defined in the config"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+
+	alertLock.Lock()
+	found := false
+	for i := range alertRules {
+		if alertRules[i].Name == ruleName {
+			alertRules = append(alertRules[:i], alertRules[i+1:]...)
+			found = true
+			break
+		}
+	}
+	alertLock.Unlock()
+
+	if !found {
+		apiError := APIError{http.StatusNotFound, "Alert rule " + ruleName + " Not found"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	if err := alertSaveRules(); err != nil {
+		apiError := APIError{http.StatusInternalServerError, "Error saving alert rules: " + err.Error()}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	apiError := APIError{http.StatusOK, "OK"}
+	luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+}
+
+func GetActiveAlerts(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	alertLock.Lock()
+	alertList := make([]Alert, 0, len(alertActive))
+	for _, alert := range alertActive {
+		if cloudInfo := cloudGetCloudInfo(alert.Cloud); cloudInfo != nil && !authCloudVisible(r, cloudInfo) {
+			continue
+		}
+		alertList = append(alertList, alert)
+	}
+	alertLock.Unlock()
+
+	sort.Slice(alertList, func(i, j int) bool {
+		return alertList[i].Key < alertList[j].Key
+	})
+	alerts := Alerts{alertList}
+	luddite.WriteResponse(rw, http.StatusOK, alerts)
+}
+
+func TestAlertSinks(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	alert := Alert{
+		Key:      "test",
+		Rule:     "test",
+		Type:     "test",
+		Severity: "info",
+		Status:   alertStatusFiring,
+		Target:   "topology",
+		Message:  "Test notification from topology service",
+		StartsAt: time.Now(),
+	}
+	for _, sink := range cfg.Alerts.Sinks {
+		if err := alertSend(sink, alert); err != nil {
+			apiError := APIError{http.StatusBadGateway, "Sink " + sink.Name + ": " + err.Error()}
+			luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+			return
+		}
+	}
+	apiError := APIError{http.StatusOK, "OK"}
+	luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+}
+
+func InitAlerts(router *httprouter.Router) {
+	router.GET("/topology/alerts/rules", authorize(authRoleViewer, GetAlertRules))
+	router.POST("/topology/alerts/rules", authorize(authRoleAdmin, audited(auditActionAlertRuleCreate, CreateAlertRule)))
+	router.DELETE("/topology/alerts/rules/:rule_name", authorize(authRoleAdmin, audited(auditActionAlertRuleDelete, DeleteAlertRule)))
+	router.GET("/topology/alerts/active", authorize(authRoleViewer, GetActiveAlerts))
+	router.POST("/topology/alerts/test", authorize(authRoleAdmin, audited(auditActionAlertTest, TestAlertSinks)))
+
+	alertLoadRules()
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/SpirentOrion/httprouter"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// alertTestSink collects the notifications a webhook receives, answering
+// the first failures of them with 503.
+type alertTestSink struct {
+	sync.Mutex
+	failures int
+	attempts int
+	bodies   chan []byte
+}
+
+func (s *alertTestSink) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	s.Lock()
+	s.attempts++
+	fail := s.attempts <= s.failures
+	s.Unlock()
+	if fail {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	s.bodies <- body
+}
+
+func (s *alertTestSink) next(t *testing.T) (Alert, map[string]interface{}) {
+	select {
+	case body := <-s.bodies:
+		var alerts Alerts
+		var raw struct {
+			Alerts []map[string]interface{} `json:"alerts"`
+		}
+		if err := json.Unmarshal(body, &alerts); err != nil || len(alerts.Alerts) != 1 {
+			t.Fatalf("notification %s, want one alert", body)
+		}
+		json.Unmarshal(body, &raw)
+		return alerts.Alerts[0], raw.Alerts[0]
+	case <-time.After(5 * time.Second):
+		t.Fatal("no notification delivered")
+	}
+	return Alert{}, nil
+}
+
+func (s *alertTestSink) none(t *testing.T) {
+	select {
+	case body := <-s.bodies:
+		t.Errorf("unexpected notification %s", body)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func alertTestSetup(sink *alertTestSink, retries int) (*httptest.Server, func()) {
+	restoreFixture := testFixture()
+	server := httptest.NewServer(sink)
+	enabled, sinks, backoff := cfg.Alerts.Enabled, cfg.Alerts.Sinks, alertRetryBackoff
+	cfg.Alerts.Enabled = true
+	cfg.Alerts.Sinks = []AlertSink{{Name: "test", Url: server.URL, Retries: retries}}
+	alertRetryBackoff = time.Millisecond
+	alertRules = []AlertRule{{Name: "down", Type: "hypervisor_down"}}
+	return server, func() {
+		server.Close()
+		cfg.Alerts.Enabled, cfg.Alerts.Sinks, alertRetryBackoff = enabled, sinks, backoff
+		alertRules = nil
+		restoreFixture()
+	}
+}
+
+func TestAlertEvaluateNotifiesOnceAndResolves(t *testing.T) {
+	sink := &alertTestSink{bodies: make(chan []byte, 10)}
+	_, restore := alertTestSetup(sink, 0)
+	defer restore()
+
+	alertEvaluate()
+	alert, raw := sink.next(t)
+	if alert.Status != alertStatusFiring || alert.Target != "hv3" || alert.Key != "down/c1/hv3/hv3" {
+		t.Errorf("firing notification = %+v, want hv3 down", alert)
+	}
+	if _, ok := raw["ends_at"]; ok {
+		t.Errorf("firing notification carries ends_at %v", raw["ends_at"])
+	}
+
+	alertEvaluate()
+	sink.none(t)
+	if len(alertActive) != 1 {
+		t.Errorf("%d active alerts, want 1", len(alertActive))
+	}
+
+	cloudHypervisors["c1"][2].State = "up"
+	alertEvaluate()
+	alert, _ = sink.next(t)
+	if alert.Status != alertStatusResolved || alert.EndsAt == nil || alert.EndsAt.Before(alert.StartsAt) {
+		t.Errorf("resolved notification = %+v, want it resolved after it started", alert)
+	}
+	if len(alertActive) != 0 {
+		t.Errorf("%d active alerts after resolving, want none", len(alertActive))
+	}
+}
+
+func TestAlertSendRetriesServerErrors(t *testing.T) {
+	sink := &alertTestSink{failures: 2, bodies: make(chan []byte, 10)}
+	_, restore := alertTestSetup(sink, 2)
+	defer restore()
+
+	start := time.Now()
+	if err := alertSend(cfg.Alerts.Sinks[0], Alert{Key: "k", Status: alertStatusFiring}); err != nil {
+		t.Fatalf("alertSend after two 503s = %v, want delivery on the third attempt", err)
+	}
+	if sink.attempts != 3 {
+		t.Errorf("%d attempts, want 3", sink.attempts)
+	}
+	if elapsed := time.Since(start); elapsed < 3*time.Millisecond {
+		t.Errorf("retries took %v, want at least the 1ms and 2ms backoffs", elapsed)
+	}
+	sink.next(t)
+}
+
+func TestAlertSendGivesUpAfterRetries(t *testing.T) {
+	sink := &alertTestSink{failures: 5, bodies: make(chan []byte, 10)}
+	_, restore := alertTestSetup(sink, 1)
+	defer restore()
+
+	if err := alertSend(cfg.Alerts.Sinks[0], Alert{Key: "k"}); err == nil {
+		t.Error("alertSend succeeded with every attempt failing")
+	}
+	if sink.attempts != 2 {
+		t.Errorf("%d attempts, want 2", sink.attempts)
+	}
+}
+
+func TestAlertRulesFromConfigAreReadOnly(t *testing.T) {
+	defer testFixture()()
+	configRules := cfg.Alerts.Rules
+	defer func() {
+		cfg.Alerts.Rules = configRules
+		alertRules = nil
+	}()
+	cfg.Alerts.Rules = []AlertRule{{Name: "down", Type: "hypervisor_down"}}
+	storeSave(alertRulesStoreName, []AlertRule{{Name: "down", Type: "instance_migrated"}, {Name: "moved", Type: "instance_migrated"}})
+	alertRules = nil
+	router := httprouter.New()
+	InitAlerts(router)
+
+	serve := func(method string, path string, body string) int {
+		r, _ := http.NewRequest(method, "http://topology"+path, strings.NewReader(body))
+		rw := httptest.NewRecorder()
+		router.ServeHTTP(rw, r)
+		return rw.Code
+	}
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"POST", "/topology/alerts/rules", `{"name":"down","type":"instance_migrated"}`, http.StatusConflict},
+		{"DELETE", "/topology/alerts/rules/down", "", http.StatusConflict},
+		{"POST", "/topology/alerts/rules", `{"name":"added","type":"hypervisor_down"}`, http.StatusOK},
+		{"DELETE", "/topology/alerts/rules/moved", "", http.StatusOK},
+	}
+	for _, test := range tests {
+		if status := serve(test.method, test.path, test.body); status != test.status {
+			t.Errorf("%s %s = %d, want %d", test.method, test.path, status, test.status)
+		}
+	}
+
+	alertRules = nil
+	alertLoadRules()
+	var names []string
+	for _, rule := range alertRules {
+		names = append(names, rule.Name+":"+rule.Type)
+	}
+	if got := strings.Join(names, ","); got != "down:hypervisor_down,added:hypervisor_down" {
+		t.Errorf("rules after a restart = %s, want down:hypervisor_down,added:hypervisor_down", got)
+	}
+}
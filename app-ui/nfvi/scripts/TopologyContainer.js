@@ -220,7 +220,8 @@ nx.graphic.Icons.registerIcon("port", document.baseURI + "/nfvi/images/icon_ethe
                             linkType: 'parallel',
                             label: 'model.name',
                             color: 'model.color',
-                            width: 'model.width'
+                            width: 'model.width',
+                            dotted: 'model.dotted'
                         },
                         tooltipManagerConfig: {
                             nodeTooltipContentClass: 'TopologyContainerNodeTooltipContent',
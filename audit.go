@@ -0,0 +1,410 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/SpirentOrion/httprouter"
+	log "github.com/SpirentOrion/logrus"
+	"github.com/SpirentOrion/luddite"
+	"golang.org/x/net/context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	auditStoreName          = "audit.json"
+	auditProvidersStoreName = "audit_providers.json"
+	auditSecretStoreName    = "audit_secret.json"
+	auditSecretSize         = 32
+	auditEntryKey           = authContextKey("audit")
+	auditSystemUser         = "system"
+	auditResultSuccess      = "success"
+	auditResultFailure      = "failure"
+	auditDefaultRetention   = 30 * 24 * 3600
+	auditDefaultMaxEntries  = 10000
+	auditDefaultLimit       = 100
+)
+
+const (
+	auditActionDiscover        = "discover"
+	auditActionDiscoverCloud   = "discover_cloud"
+	auditActionAlertRuleCreate = "alert_rule_create"
+	auditActionAlertRuleDelete = "alert_rule_delete"
+	auditActionAlertTest       = "alert_test"
+	auditActionTestBedCreate   = "testbed_create"
+	auditActionTestBedUpdate   = "testbed_update"
+	auditActionTestBedDelete   = "testbed_delete"
+	auditActionLayoutSave      = "layout_save"
+	auditActionLayoutDelete    = "layout_delete"
+	auditActionProviderAdd     = "provider_add"
+	auditActionProviderChange  = "provider_change"
+	auditActionProviderRemove  = "provider_remove"
+)
+
+// AuditEntry records one action: who took it, on what, and how it ended.
+// Duration is in milliseconds.
+type AuditEntry struct {
+	Time     time.Time         `json:"time,required"`
+	User     string            `json:"user,omitempty"`
+	Role     string            `json:"role,omitempty"`
+	Remote   string            `json:"remote,omitempty"`
+	Action   string            `json:"action,required"`
+	Cloud    string            `json:"cloud,omitempty"`
+	Target   string            `json:"target,omitempty"`
+	Params   map[string]string `json:"params,omitempty"`
+	Result   string            `json:"result,required"`
+	Status   int               `json:"status,omitempty"`
+	Error    string            `json:"error,omitempty"`
+	Duration int64             `json:"duration_ms"`
+}
+
+type AuditLog struct {
+	Entries []AuditEntry `json:"entries,required"`
+}
+
+var auditEntries []AuditEntry
+var auditLock sync.Mutex
+
+func auditRetention() time.Duration {
+	if cfg.Audit.Retention > 0 {
+		return time.Duration(cfg.Audit.Retention) * time.Second
+	}
+	return auditDefaultRetention * time.Second
+}
+
+func auditMaxEntries() int {
+	if cfg.Audit.MaxEntries > 0 {
+		return cfg.Audit.MaxEntries
+	}
+	return auditDefaultMaxEntries
+}
+
+// auditPrune drops the entries older than the retention period and the
+// oldest ones beyond the maximum count. The caller holds auditLock.
+func auditPrune() {
+	cutoff := time.Now().Add(-auditRetention())
+	i := 0
+	for i < len(auditEntries) && auditEntries[i].Time.Before(cutoff) {
+		i++
+	}
+	if excess := len(auditEntries) - i - auditMaxEntries(); excess > 0 {
+		i += excess
+	}
+	if i > 0 {
+		auditEntries = append([]AuditEntry(nil), auditEntries[i:]...)
+	}
+}
+
+// auditRecord appends an entry to the audit trail and saves it.
+func auditRecord(entry AuditEntry) {
+	if !cfg.Audit.Enabled {
+		return
+	}
+	auditLock.Lock()
+	auditEntries = append(auditEntries, entry)
+	auditPrune()
+	err := storeSave(auditStoreName, auditEntries)
+	auditLock.Unlock()
+
+	if err != nil {
+		logFields := log.Fields{
+			"Path":  storePath(auditStoreName),
+			"Error": err.Error(),
+		}
+		service.Logger().WithFields(logFields).Error("Error saving audit log")
+	}
+}
+
+func auditLoad() error {
+	auditLock.Lock()
+	defer auditLock.Unlock()
+
+	if err := storeLoad(auditStoreName, &auditEntries); err != nil {
+		logFields := log.Fields{
+			"Path":  storePath(auditStoreName),
+			"Error": err.Error(),
+		}
+		service.Logger().WithFields(logFields).Error("Error loading audit log")
+		return err
+	}
+	sort.SliceStable(auditEntries, func(i, j int) bool { return auditEntries[i].Time.Before(auditEntries[j].Time) })
+	auditPrune()
+	return nil
+}
+
+// auditNote adds the target and parameters a handler knows about to the
+// entry being recorded for its request, if any.
+func auditNote(r *http.Request, target string, params map[string]string) {
+	entry, _ := r.Context().Value(auditEntryKey).(*AuditEntry)
+	if entry == nil {
+		return
+	}
+	if len(target) > 0 {
+		entry.Target = target
+	}
+	for k, v := range params {
+		if len(v) > 0 {
+			entry.Params[k] = v
+		}
+	}
+}
+
+type auditResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *auditResponseWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *auditResponseWriter) Write(data []byte) (int, error) {
+	if w.status >= http.StatusBadRequest && w.body.Len() < 4096 {
+		w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// audited records each request a route handles in the audit trail, with the
+// principal authorize found, the route and query parameters, and the status
+// and error message of the response. The target is the last route parameter
+// unless the handler notes another.
+func audited(action string, handle httprouter.Handle) httprouter.Handle {
+	return func(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+		if !cfg.Audit.Enabled {
+			handle(ctx, rw, r)
+			return
+		}
+		start := time.Now()
+		entry := &AuditEntry{
+			Time:   start.UTC(),
+			Remote: r.RemoteAddr,
+			Action: action,
+			Params: make(map[string]string),
+		}
+		if principal := authPrincipal(r); principal != nil {
+			entry.User = principal.User
+			entry.Role = principal.Role
+		}
+		for _, param := range httprouter.ContextParams(ctx) {
+			entry.Params[param.Key] = param.Value
+			entry.Target = param.Value
+		}
+		for k, v := range r.URL.Query() {
+			entry.Params[k] = strings.Join(v, ",")
+		}
+		entry.Cloud = entry.Params["cloud_name"]
+
+		recorder := &auditResponseWriter{ResponseWriter: rw, status: http.StatusOK}
+		handle(ctx, recorder, r.WithContext(context.WithValue(r.Context(), auditEntryKey, entry)))
+
+		entry.Duration = int64(time.Since(start) / time.Millisecond)
+		entry.Status = recorder.status
+		entry.Result = auditResultSuccess
+		if recorder.status >= http.StatusBadRequest {
+			entry.Result = auditResultFailure
+			var apiError APIError
+			if json.Unmarshal(recorder.body.Bytes(), &apiError) == nil {
+				entry.Error = apiError.ErrorMessage
+			}
+		}
+		if len(entry.Params) == 0 {
+			entry.Params = nil
+		}
+		auditRecord(*entry)
+	}
+}
+
+// auditSecret returns the random key this install hashes provider passwords
+// with, creating it on first use. created is true when it did not exist yet.
+func auditSecret() (secret []byte, created bool, err error) {
+	var encoded string
+	if err = storeLoad(auditSecretStoreName, &encoded); err != nil {
+		return nil, false, err
+	}
+	if secret, err = hex.DecodeString(encoded); err == nil && len(secret) == auditSecretSize {
+		return secret, false, nil
+	}
+	secret = make([]byte, auditSecretSize)
+	if _, err = rand.Read(secret); err != nil {
+		return nil, false, err
+	}
+	if err = storeSavePrivate(auditSecretStoreName, hex.EncodeToString(secret)); err != nil {
+		return nil, false, err
+	}
+	return secret, true, nil
+}
+
+// auditProviderFingerprint identifies a provider definition without keeping
+// its password, which is only kept as an HMAC under the install's secret.
+func auditProviderFingerprint(provider CloudProvider, secret []byte) map[string]string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(provider.Password))
+	return map[string]string{
+		"auth_url": provider.AuthUrl,
+		"user":     provider.User,
+		"password": hex.EncodeToString(mac.Sum(nil)),
+		"tenant":   provider.Tenant,
+		"provider": provider.Provider,
+	}
+}
+
+// auditProviders records the cloud provider definitions added, changed or
+// removed in the config since the service last started.
+func auditProviders() {
+	secret, created, err := auditSecret()
+	if err != nil {
+		logFields := log.Fields{
+			"Path":  storePath(auditSecretStoreName),
+			"Error": err.Error(),
+		}
+		service.Logger().WithFields(logFields).Error("Error loading audit secret")
+		return
+	}
+
+	var previous map[string]map[string]string
+	if err := storeLoad(auditProvidersStoreName, &previous); err != nil {
+		logFields := log.Fields{
+			"Path":  storePath(auditProvidersStoreName),
+			"Error": err.Error(),
+		}
+		service.Logger().WithFields(logFields).Error("Error loading audited cloud providers")
+		return
+	}
+
+	current := make(map[string]map[string]string)
+	for _, provider := range cfg.CloudProviders.Providers {
+		current[provider.Name] = auditProviderFingerprint(provider, secret)
+	}
+	if previous != nil {
+		var names []string
+		for name := range current {
+			names = append(names, name)
+		}
+		for name := range previous {
+			if _, ok := current[name]; !ok {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			entry := AuditEntry{
+				Time:   time.Now().UTC(),
+				User:   auditSystemUser,
+				Cloud:  name,
+				Target: name,
+				Result: auditResultSuccess,
+			}
+			before, existed := previous[name]
+			after, exists := current[name]
+			switch {
+			case !existed:
+				entry.Action = auditActionProviderAdd
+			case !exists:
+				entry.Action = auditActionProviderRemove
+			default:
+				var changed []string
+				for _, field := range []string{"auth_url", "user", "password", "tenant", "provider"} {
+					// Fingerprints taken under an earlier secret cannot be compared.
+					if field == "password" && created {
+						continue
+					}
+					if before[field] != after[field] {
+						changed = append(changed, field)
+					}
+				}
+				if len(changed) == 0 {
+					continue
+				}
+				entry.Action = auditActionProviderChange
+				entry.Params = map[string]string{"changed": strings.Join(changed, ",")}
+			}
+			if exists {
+				if entry.Params == nil {
+					entry.Params = make(map[string]string)
+				}
+				for _, field := range []string{"auth_url", "tenant", "provider"} {
+					if len(after[field]) > 0 {
+						entry.Params[field] = after[field]
+					}
+				}
+			}
+			auditRecord(entry)
+		}
+	}
+	if err := storeSavePrivate(auditProvidersStoreName, current); err != nil {
+		logFields := log.Fields{
+			"Path":  storePath(auditProvidersStoreName),
+			"Error": err.Error(),
+		}
+		service.Logger().WithFields(logFields).Error("Error saving audited cloud providers")
+	}
+}
+
+// auditQuery returns the entries from since to until, oldest first, that
+// match the user, action and cloud given, keeping the newest limit of them.
+func auditQuery(since time.Time, until time.Time, user string, action string, cloud string, limit int) []AuditEntry {
+	auditLock.Lock()
+	defer auditLock.Unlock()
+
+	entries := make([]AuditEntry, 0)
+	for _, entry := range auditEntries {
+		if entry.Time.Before(since) || entry.Time.After(until) {
+			continue
+		}
+		if (len(user) > 0 && entry.User != user) || (len(action) > 0 && entry.Action != action) || (len(cloud) > 0 && entry.Cloud != cloud) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	return entries
+}
+
+func GetAuditLog(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	until, err := parseTimeParam(query.Get("until"), time.Now())
+	if err != nil {
+		apiError := APIError{http.StatusBadRequest, "Invalid until time " + query.Get("until")}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	since, err := parseTimeParam(query.Get("since"), until.Add(-24*time.Hour))
+	if err != nil {
+		apiError := APIError{http.StatusBadRequest, "Invalid since time " + query.Get("since")}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	limit := auditDefaultLimit
+	if len(query.Get("limit")) > 0 {
+		if limit, err = strconv.Atoi(query.Get("limit")); err != nil || limit < 0 {
+			apiError := APIError{http.StatusBadRequest, "Invalid limit " + query.Get("limit")}
+			luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+			return
+		}
+	}
+
+	auditLog := AuditLog{auditQuery(since, until, query.Get("user"), query.Get("action"), query.Get("cloud"), limit)}
+	luddite.WriteResponse(rw, http.StatusOK, auditLog)
+}
+
+func InitAudit(router *httprouter.Router) {
+	router.GET("/topology/audit", authorize(authRoleAdmin, GetAuditLog))
+
+	if cfg.Audit.Enabled {
+		auditLoad()
+		auditProviders()
+	}
+}
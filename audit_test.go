@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/SpirentOrion/httprouter"
+	"github.com/SpirentOrion/luddite"
+	"golang.org/x/net/context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// auditTestSetup enables the audit trail on an empty store.
+func auditTestSetup() func() {
+	restoreFixture := testFixture()
+	audit := cfg.Audit
+	cfg.Audit.Enabled = true
+	auditEntries = nil
+	return func() {
+		cfg.Audit = audit
+		auditEntries = nil
+		restoreFixture()
+	}
+}
+
+func TestAuditedRecordsRequests(t *testing.T) {
+	defer auditTestSetup()()
+	router := httprouter.New()
+	router.POST("/topology/testbeds/:name", audited(auditActionTestBedUpdate, func(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+		auditNote(r, "lab-renamed", map[string]string{"cloud_name": "c1", "empty": ""})
+		apiError := APIError{http.StatusConflict, "Test bed lab is locked"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+	}))
+
+	r, _ := http.NewRequest("POST", "http://topology/topology/testbeds/lab?force=1&tag=a&tag=b", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+
+	if len(auditEntries) != 1 {
+		t.Fatalf("%d audit entries, want 1", len(auditEntries))
+	}
+	entry := auditEntries[0]
+	if entry.Action != auditActionTestBedUpdate || entry.Target != "lab-renamed" || entry.Result != auditResultFailure || entry.Status != http.StatusConflict {
+		t.Errorf("entry %+v, want a failed update of lab-renamed", entry)
+	}
+	if entry.Error != "Test bed lab is locked" {
+		t.Errorf("entry error %q, want the API error message", entry.Error)
+	}
+	if entry.Params["name"] != "lab" || entry.Params["force"] != "1" || entry.Params["tag"] != "a,b" || entry.Params["cloud_name"] != "c1" {
+		t.Errorf("entry params %v, want route, query and noted parameters", entry.Params)
+	}
+	if _, ok := entry.Params["empty"]; ok {
+		t.Error("an empty noted parameter was recorded")
+	}
+
+	var stored []AuditEntry
+	storeLoad(auditStoreName, &stored)
+	if len(stored) != 1 || stored[0].Action != auditActionTestBedUpdate {
+		t.Errorf("stored entries %+v, want the recorded one", stored)
+	}
+}
+
+func TestAuditPruneAndQuery(t *testing.T) {
+	defer auditTestSetup()()
+	cfg.Audit.Retention = 3600
+	cfg.Audit.MaxEntries = 3
+	now := time.Now().UTC()
+
+	auditRecord(AuditEntry{Time: now.Add(-2 * time.Hour), User: "root", Action: auditActionDiscover})
+	if len(auditEntries) != 0 {
+		t.Errorf("kept %d entries older than the retention", len(auditEntries))
+	}
+	for i, user := range []string{"root", "ops", "root", "ops"} {
+		auditRecord(AuditEntry{Time: now.Add(time.Duration(i-4) * time.Minute), User: user, Action: auditActionDiscoverCloud, Cloud: "c1"})
+	}
+	if len(auditEntries) != 3 || auditEntries[0].User != "ops" {
+		t.Errorf("entries %+v, want the newest 3", auditEntries)
+	}
+
+	if entries := auditQuery(now.Add(-time.Hour), now, "ops", "", "c1", 0); len(entries) != 2 {
+		t.Errorf("%d entries of ops, want 2", len(entries))
+	}
+	entries := auditQuery(now.Add(-time.Hour), now, "", auditActionDiscoverCloud, "", 1)
+	if len(entries) != 1 || !entries[0].Time.Equal(now.Add(-time.Minute)) {
+		t.Errorf("entries %+v, want the newest one", entries)
+	}
+	if entries := auditQuery(now.Add(-time.Hour), now, "", "", "c2", 0); len(entries) != 0 {
+		t.Errorf("%d entries of c2, want none", len(entries))
+	}
+}
+
+func TestAuditProvidersKeepPasswordsPrivate(t *testing.T) {
+	defer auditTestSetup()()
+	providers := cfg.CloudProviders.Providers
+	defer func() { cfg.CloudProviders.Providers = providers }()
+	cfg.CloudProviders.Providers = []CloudProvider{{Name: "c1", AuthUrl: "http://a:5000/v3", User: "admin", Password: "secret", Tenant: "admin", Provider: "openstack"}}
+
+	auditProviders()
+	var stored map[string]map[string]string
+	storeLoad(auditProvidersStoreName, &stored)
+	sum := sha256.Sum256([]byte("secret"))
+	if password := stored["c1"]["password"]; len(password) == 0 || password == hex.EncodeToString(sum[:]) {
+		t.Errorf("stored password fingerprint %q, want a keyed hash", password)
+	}
+	for _, name := range []string{auditProvidersStoreName, auditSecretStoreName} {
+		if info, err := os.Stat(storePath(name)); err != nil || info.Mode().Perm() != 0600 {
+			t.Errorf("%s mode %v (%v), want 0600", name, info.Mode().Perm(), err)
+		}
+	}
+
+	auditEntries = nil
+	auditProviders()
+	if len(auditEntries) != 0 {
+		t.Errorf("entries %+v for unchanged providers, want none", auditEntries)
+	}
+	cfg.CloudProviders.Providers[0].Password = "changed"
+	auditProviders()
+	if len(auditEntries) != 1 || auditEntries[0].Action != auditActionProviderChange || auditEntries[0].Params["changed"] != "password" {
+		t.Errorf("entries %+v, want a password change of c1", auditEntries)
+	}
+}
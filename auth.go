@@ -0,0 +1,338 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"github.com/SpirentOrion/httprouter"
+	log "github.com/SpirentOrion/logrus"
+	"github.com/SpirentOrion/luddite"
+	"golang.org/x/net/context"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	authRoleViewer        = "viewer"
+	authRoleOperator      = "operator"
+	authRoleAdmin         = "admin"
+	authAllTenants        = "*"
+	authDefaultCacheTTL   = 60
+	headerAuthToken       = "X-Auth-Token"
+	headerSubjectToken    = "X-Subject-Token"
+	headerAuthorization   = "Authorization"
+	authBearerPrefix      = "Bearer "
+	authKeystoneTimeout   = 10 * time.Second
+	authPrincipalKey      = authContextKey("principal")
+	authKeystoneTokenPath = "/auth/tokens"
+)
+
+// authRoles orders the roles, each granting what the ones before it do.
+var authRoles = []string{authRoleViewer, authRoleOperator, authRoleAdmin}
+
+type authContextKey string
+
+// AuthPrincipal is the user a request was authenticated as, with the role
+// and tenants its token grants.
+type AuthPrincipal struct {
+	User    string   `json:"user,required"`
+	Role    string   `json:"role,required"`
+	Tenants []string `json:"tenants,omitempty"`
+	Source  string   `json:"source,required"`
+	expires time.Time
+}
+
+func authRoleRank(role string) int {
+	for i, r := range authRoles {
+		if r == role {
+			return i
+		}
+	}
+	return -1
+}
+
+func (p *AuthPrincipal) allows(role string) bool {
+	return authRoleRank(p.Role) >= authRoleRank(role)
+}
+
+// sees reports whether the principal may see the clouds of a tenant.
+func (p *AuthPrincipal) sees(tenant string) bool {
+	if p.allows(authRoleAdmin) {
+		return true
+	}
+	return queryContains(p.Tenants, authAllTenants) || queryContains(p.Tenants, tenant)
+}
+
+// seesCloud reports whether the principal may see a cloud, either all of
+// it by the tenant its provider is configured with, or the projects it is a
+// member of.
+func (p *AuthPrincipal) seesCloud(cloudInfo *CloudInfo) bool {
+	if p.sees(cloudInfo.Tenant) {
+		return true
+	}
+	for _, project := range cloudGetProjectList(cloudInfo) {
+		if graphProjectSelected(project, p.Tenants) {
+			return true
+		}
+	}
+	return false
+}
+
+var authTokenCache map[string]*AuthPrincipal = make(map[string]*AuthPrincipal)
+var authTokenLock sync.Mutex
+
+func authCacheTTL() time.Duration {
+	if cfg.Auth.Keystone.CacheTTL > 0 {
+		return time.Duration(cfg.Auth.Keystone.CacheTTL) * time.Second
+	}
+	return authDefaultCacheTTL * time.Second
+}
+
+// authRequestToken reads the token from X-Auth-Token or a bearer
+// Authorization header.
+func authRequestToken(r *http.Request) string {
+	if token := r.Header.Get(headerAuthToken); len(token) > 0 {
+		return token
+	}
+	if authorization := r.Header.Get(headerAuthorization); strings.HasPrefix(authorization, authBearerPrefix) {
+		return strings.TrimSpace(strings.TrimPrefix(authorization, authBearerPrefix))
+	}
+	return ""
+}
+
+func authStaticToken(token string) *AuthPrincipal {
+	for _, t := range cfg.Auth.Tokens {
+		if len(t.Token) > 0 && subtle.ConstantTimeCompare([]byte(t.Token), []byte(token)) == 1 {
+			return &AuthPrincipal{User: t.User, Role: t.Role, Tenants: t.Tenants, Source: "static"}
+		}
+	}
+	return nil
+}
+
+type keystoneToken struct {
+	Token struct {
+		ExpiresAt time.Time `json:"expires_at"`
+		User      struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"user"`
+		Project struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"project"`
+		Roles []struct {
+			Name string `json:"name"`
+		} `json:"roles"`
+	} `json:"token"`
+}
+
+// authKeystoneToken validates a token against the Keystone v3 identity API.
+// A token may validate itself, so no service credentials are needed. The
+// highest role mapped from the token's Keystone roles is granted.
+func authKeystoneToken(token string) (*AuthPrincipal, error) {
+	authUrl := strings.TrimSuffix(cfg.Auth.Keystone.AuthUrl, "/")
+	req, err := http.NewRequest("GET", authUrl+authKeystoneTokenPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(headerAuthToken, token)
+	req.Header.Set(headerSubjectToken, token)
+	client := &http.Client{Timeout: authKeystoneTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("Keystone rejected token: " + resp.Status)
+	}
+
+	var kt keystoneToken
+	if err = json.NewDecoder(resp.Body).Decode(&kt); err != nil {
+		return nil, err
+	}
+	principal := &AuthPrincipal{
+		User:    kt.Token.User.Name,
+		Source:  "keystone",
+		expires: kt.Token.ExpiresAt,
+	}
+	if len(kt.Token.Project.ID) > 0 {
+		principal.Tenants = []string{kt.Token.Project.ID, kt.Token.Project.Name}
+	}
+	for _, role := range kt.Token.Roles {
+		if mapped, ok := cfg.Auth.Keystone.Roles[role.Name]; ok && authRoleRank(mapped) > authRoleRank(principal.Role) {
+			principal.Role = mapped
+		}
+	}
+	return principal, nil
+}
+
+// authAuthenticate finds the principal for a token, checking the static
+// tokens first and caching what Keystone validates.
+func authAuthenticate(token string) (*AuthPrincipal, error) {
+	if principal := authStaticToken(token); principal != nil {
+		return principal, nil
+	}
+	if len(cfg.Auth.Keystone.AuthUrl) == 0 {
+		return nil, errors.New("Invalid token")
+	}
+
+	authTokenLock.Lock()
+	principal, ok := authTokenCache[token]
+	if ok && time.Now().After(principal.expires) {
+		delete(authTokenCache, token)
+		ok = false
+	}
+	authTokenLock.Unlock()
+	if ok {
+		return principal, nil
+	}
+
+	principal, err := authKeystoneToken(token)
+	if err != nil {
+		logFields := log.Fields{
+			"AuthUrl": cfg.Auth.Keystone.AuthUrl,
+			"Error":   err.Error(),
+		}
+		service.Logger().WithFields(logFields).Warn("Keystone token validation failed")
+		return nil, errors.New("Invalid token")
+	}
+	if expires := time.Now().Add(authCacheTTL()); principal.expires.IsZero() || expires.Before(principal.expires) {
+		principal.expires = expires
+	}
+	authTokenLock.Lock()
+	authTokenCache[token] = principal
+	authTokenLock.Unlock()
+	return principal, nil
+}
+
+// authPrincipal returns who a request was authenticated as, or nil when
+// authentication is disabled.
+func authPrincipal(r *http.Request) *AuthPrincipal {
+	principal, _ := r.Context().Value(authPrincipalKey).(*AuthPrincipal)
+	return principal
+}
+
+// authAllowed reports whether the request may use what a role grants.
+func authAllowed(r *http.Request, role string) bool {
+	principal := authPrincipal(r)
+	return principal == nil || principal.allows(role)
+}
+
+// authCloudVisible reports whether the request may see a cloud, or some of
+// its projects.
+func authCloudVisible(r *http.Request, cloudInfo *CloudInfo) bool {
+	principal := authPrincipal(r)
+	return principal == nil || principal.seesCloud(cloudInfo)
+}
+
+// authProjects returns the projects the request is limited to in a cloud,
+// or nil when it may see all of it.
+func authProjects(r *http.Request, cloudInfo *CloudInfo) []string {
+	principal := authPrincipal(r)
+	if principal == nil || principal.sees(cloudInfo.Tenant) {
+		return nil
+	}
+	return append([]string{}, principal.Tenants...)
+}
+
+// authProjectGraph returns the graph of a cloud limited to the projects the
+// request may see, or nil when it may see all of the cloud.
+func authProjectGraph(r *http.Request, cloudInfo *CloudInfo) *TopologyGraph {
+	projects := authProjects(r, cloudInfo)
+	if projects == nil {
+		return nil
+	}
+	return graphGet(cloudInfo).SelectProjects(projects)
+}
+
+// authRedacted reports whether infrastructure is hidden from the request.
+func authRedacted(r *http.Request) bool {
+	return cfg.Auth.RedactInfrastructure && !authAllowed(r, authRoleAdmin)
+}
+
+// authCloudList returns the clouds the request may see.
+func authCloudList(r *http.Request) []CloudInfo {
+	var cloudList []CloudInfo
+	for _, cloudInfo := range cloudGetCloudList() {
+		if authCloudVisible(r, &cloudInfo) {
+			cloudList = append(cloudList, cloudInfo)
+		}
+	}
+	return cloudList
+}
+
+// authScope identifies what a request may see, and whose layouts, for the
+// view cache.
+func authScope(r *http.Request) string {
+	principal := authPrincipal(r)
+	if principal == nil {
+		return ""
+	}
+	tenants := append([]string(nil), principal.Tenants...)
+	sort.Strings(tenants)
+	return principal.Role + "/" + principal.User + "/" + strings.Join(tenants, ",")
+}
+
+// authorize authenticates a request and lets it through when its role is
+// at least the one given and it may see the cloud the route names. Clouds
+// it may not see are reported as not discovered.
+func authorize(role string, handle httprouter.Handle) httprouter.Handle {
+	return func(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+		if !cfg.Auth.Enabled {
+			handle(ctx, rw, r)
+			return
+		}
+		token := authRequestToken(r)
+		if len(token) == 0 {
+			apiError := APIError{http.StatusUnauthorized, "Authentication required"}
+			luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+			return
+		}
+		principal, err := authAuthenticate(token)
+		if err != nil {
+			apiError := APIError{http.StatusUnauthorized, err.Error()}
+			luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+			return
+		}
+		if !principal.allows(role) {
+			apiError := APIError{http.StatusForbidden, "Role " + role + " required"}
+			luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+			return
+		}
+		if cloudName := httprouter.ContextParams(ctx).ByName("cloud_name"); len(cloudName) > 0 {
+			if cloudInfo := cloudGetCloudInfo(cloudName); cloudInfo != nil && !principal.seesCloud(cloudInfo) {
+				apiError := APIError{http.StatusNotFound, "Cloud " + cloudName + " Not discovered"}
+				luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+				return
+			}
+		}
+		ctx = context.WithValue(ctx, authPrincipalKey, principal)
+		handle(ctx, rw, r.WithContext(context.WithValue(r.Context(), authPrincipalKey, principal)))
+	}
+}
+
+func GetAuthPrincipal(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	principal := authPrincipal(r)
+	if principal == nil {
+		principal = &AuthPrincipal{Role: authRoleAdmin, Source: "disabled"}
+	}
+	luddite.WriteResponse(rw, http.StatusOK, principal)
+}
+
+func InitAuth(router *httprouter.Router) {
+	router.GET("/topology/auth/whoami", authorize(authRoleViewer, GetAuthPrincipal))
+
+	for _, t := range cfg.Auth.Tokens {
+		if authRoleRank(t.Role) < 0 {
+			logFields := log.Fields{
+				"User": t.User,
+				"Role": t.Role,
+			}
+			service.Logger().WithFields(logFields).Warn("API token has an unknown role and grants nothing")
+		}
+	}
+}
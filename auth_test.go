@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/SpirentOrion/httprouter"
+	"golang.org/x/net/context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// authTestSetup enables authentication with an admin, an operator of tenant
+// admin and a viewer of tenant other, and returns a router with a viewer
+// route per cloud and an admin route.
+func authTestSetup() (*httprouter.Router, func()) {
+	restoreFixture := testFixture()
+	auth := cfg.Auth
+	cfg.Auth.Enabled = true
+	cfg.Auth.Tokens = []AuthToken{
+		{Token: "t-admin", User: "root", Role: authRoleAdmin},
+		{Token: "t-operator", User: "ops", Role: authRoleOperator, Tenants: []string{"admin"}},
+		{Token: "t-viewer", User: "guest", Role: authRoleViewer, Tenants: []string{"other"}},
+	}
+	authTokenCache = make(map[string]*AuthPrincipal)
+
+	ok := func(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte(authScope(r)))
+	}
+	router := httprouter.New()
+	router.GET("/topology/cloudTopology/:cloud_name", authorize(authRoleViewer, ok))
+	router.POST("/topology/discovery/discover", authorize(authRoleAdmin, ok))
+	return router, func() {
+		cfg.Auth = auth
+		authTokenCache = make(map[string]*AuthPrincipal)
+		restoreFixture()
+	}
+}
+
+func authTestRequest(router *httprouter.Router, method string, path string, header string, token string) *httptest.ResponseRecorder {
+	r, _ := http.NewRequest(method, "http://topology"+path, nil)
+	if len(header) > 0 {
+		r.Header.Set(header, token)
+	}
+	rw := httptest.NewRecorder()
+	router.ServeHTTP(rw, r)
+	return rw
+}
+
+func TestAuthorizeRolesAndTenants(t *testing.T) {
+	router, restore := authTestSetup()
+	defer restore()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header string
+		token  string
+		status int
+	}{
+		{"no token", "GET", "/topology/cloudTopology/c1", "", "", http.StatusUnauthorized},
+		{"unknown token", "GET", "/topology/cloudTopology/c1", headerAuthToken, "t-bogus", http.StatusUnauthorized},
+		{"viewer of its tenant", "GET", "/topology/cloudTopology/c2", headerAuthToken, "t-viewer", http.StatusOK},
+		{"viewer of another tenant", "GET", "/topology/cloudTopology/c1", headerAuthToken, "t-viewer", http.StatusNotFound},
+		{"viewer on an admin route", "POST", "/topology/discovery/discover", headerAuthToken, "t-viewer", http.StatusForbidden},
+		{"operator by bearer token", "GET", "/topology/cloudTopology/c1", headerAuthorization, authBearerPrefix + "t-operator", http.StatusOK},
+		{"operator on an admin route", "POST", "/topology/discovery/discover", headerAuthToken, "t-operator", http.StatusForbidden},
+		{"admin of every tenant", "GET", "/topology/cloudTopology/c2", headerAuthToken, "t-admin", http.StatusOK},
+		{"admin on an admin route", "POST", "/topology/discovery/discover", headerAuthToken, "t-admin", http.StatusOK},
+		{"undiscovered cloud", "GET", "/topology/cloudTopology/c9", headerAuthToken, "t-viewer", http.StatusOK},
+	}
+	for _, test := range tests {
+		if rw := authTestRequest(router, test.method, test.path, test.header, test.token); rw.Code != test.status {
+			t.Errorf("%s: %s %s = %d %s, want %d", test.name, test.method, test.path, rw.Code, rw.Body.String(), test.status)
+		}
+	}
+
+	if rw := authTestRequest(router, "GET", "/topology/cloudTopology/c2", headerAuthToken, "t-viewer"); rw.Body.String() != "viewer/guest/other" {
+		t.Errorf("viewer scope = %q, want viewer/guest/other", rw.Body.String())
+	}
+}
+
+func TestAuthorizeKeystoneToken(t *testing.T) {
+	router, restore := authTestSetup()
+	defer restore()
+
+	validations := 0
+	keystone := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		validations++
+		if r.URL.Path != "/v3"+authKeystoneTokenPath || r.Header.Get(headerSubjectToken) != "k-member" {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write([]byte(`{"token":{"expires_at":"2999-01-01T00:00:00Z","user":{"id":"u1","name":"kate"},"project":{"id":"p1","name":"admin"},"roles":[{"name":"member"},{"name":"reader"}]}}`))
+	}))
+	defer keystone.Close()
+	cfg.Auth.Keystone.AuthUrl = keystone.URL + "/v3"
+	cfg.Auth.Keystone.Roles = map[string]string{"reader": authRoleViewer, "member": authRoleOperator}
+
+	for i := 0; i < 2; i++ {
+		rw := authTestRequest(router, "GET", "/topology/cloudTopology/c1", headerAuthToken, "k-member")
+		if rw.Code != http.StatusOK || rw.Body.String() != "operator/kate/admin,p1" {
+			t.Errorf("Keystone member = %d %q, want 200 as operator/kate/admin,p1", rw.Code, rw.Body.String())
+		}
+	}
+	if validations != 1 {
+		t.Errorf("Keystone validated the token %d times, want once then cached", validations)
+	}
+	if rw := authTestRequest(router, "GET", "/topology/cloudTopology/c1", headerAuthToken, "k-expired"); rw.Code != http.StatusUnauthorized {
+		t.Errorf("token Keystone rejects = %d, want 401", rw.Code)
+	}
+}
+
+func TestAuthLimitsInstanceDataToProjects(t *testing.T) {
+	_, restore := authTestSetup()
+	defer restore()
+	cfg.Auth.Tokens = append(cfg.Auth.Tokens, AuthToken{Token: "t-member", User: "kate", Role: authRoleViewer, Tenants: []string{"p-b"}})
+	cloudProjects["c1"] = []CloudProjectInfo{{"p-a", "proj-a"}, {"p-b", "proj-b"}}
+	for i := range cloudInstances["c1"] {
+		cloudInstances["c1"][i].ProjectID = "p-a"
+	}
+	cloudInstances["c1"][1].ProjectID = "p-b"
+	graphInvalidate()
+	for _, uuid := range []string{"u1", "u2"} {
+		placementHistory[uuid] = &InstancePlacementHistory{UUID: uuid, Cloud: "c1", InstanceName: uuid, Placements: []InstancePlacement{
+			{Hypervisor: "hv2", HostIP: "10.0.0.2", Source: placementSourceDiscovery, Since: time.Now().Add(-2 * time.Minute)},
+			{Hypervisor: "hv1", HostIP: "10.0.0.1", Source: placementSourceDiscovery, Since: time.Now().Add(-time.Minute)},
+		}}
+	}
+	testFixtureStats()
+
+	router := httprouter.New()
+	InitReport(router)
+	InitPlacement(router)
+	InitHistory(router)
+	InitStats(router)
+
+	statusTests := []struct {
+		path   string
+		status int
+	}{
+		{"/topology/placement/history/c1/u1", http.StatusNotFound},
+		{"/topology/placement/history/c1/u2", http.StatusOK},
+		{"/topology/history/instanceInterface/c1/hv1/vRouter1/tap1", http.StatusNotFound},
+		{"/topology/history/ovsInterface/c1/hv1/qvo1", http.StatusNotFound},
+		{"/topology/history/ovsInterface/c1/hv1/dpdk0", http.StatusOK},
+		{"/topology/stats/rates/c1/hv2", http.StatusNotFound},
+	}
+	for _, test := range statusTests {
+		if rw := authTestRequest(router, "GET", test.path, headerAuthToken, "t-member"); rw.Code != test.status {
+			t.Errorf("GET %s = %d %s, want %d", test.path, rw.Code, rw.Body.String(), test.status)
+		}
+		if rw := authTestRequest(router, "GET", test.path, headerAuthToken, "t-admin"); rw.Code != http.StatusOK {
+			t.Errorf("GET %s as admin = %d %s, want %d", test.path, rw.Code, rw.Body.String(), http.StatusOK)
+		}
+	}
+
+	var migrations InstanceMigrations
+	rw := authTestRequest(router, "GET", "/topology/placement/migrations/c1", headerAuthToken, "t-member")
+	if err := json.Unmarshal(rw.Body.Bytes(), &migrations); err != nil || len(migrations.Migrations) != 1 || migrations.Migrations[0].UUID != "u2" {
+		t.Errorf("migrations %s, want only those of u2", rw.Body.String())
+	}
+
+	var rates HypervisorInterfaceRates
+	rw = authTestRequest(router, "GET", "/topology/stats/rates/c1/hv1", headerAuthToken, "t-member")
+	if err := json.Unmarshal(rw.Body.Bytes(), &rates); err != nil || len(rates.Interfaces) != 1 || rates.Interfaces[0].Name != "dpdk0" {
+		t.Errorf("rates %s, want only the dpdk0 uplink", rw.Body.String())
+	}
+
+	var report TopTalkersReport
+	rw = authTestRequest(router, "GET", "/topology/report/topTalkers/c1?entity=interface&metric=throughput&n=50", headerAuthToken, "t-member")
+	if err := json.Unmarshal(rw.Body.Bytes(), &report); err != nil || len(report.Items) == 0 {
+		t.Fatalf("top talkers %s", rw.Body.String())
+	}
+	for _, item := range report.Items {
+		if item.Hypervisor != "hv1" || item.Instance == "vRouter1" || item.Name == "qvo1" {
+			t.Errorf("top talker %s %s on %s outside project p-b", item.Name, item.Instance, item.Hypervisor)
+		}
+	}
+}
+
+func TestSelectProjectsDropsOtherProjectsPortsAndNetworks(t *testing.T) {
+	defer testFixture()()
+	cloudProjects["c1"] = []CloudProjectInfo{{"p-a", "proj-a"}, {"p-b", "proj-b"}}
+	for i := range cloudInstances["c1"] {
+		cloudInstances["c1"][i].ProjectID = "p-a"
+	}
+	cloudInstances["c1"][1].ProjectID = "p-b"
+	cloudNetworks["c1"][1].ProjectID = "p-a"
+	cloudNetworks["c1"][2].ProjectID = "p-b"
+	graphInvalidate()
+	defer graphInvalidate()
+
+	s := graphGet(&clouds[0]).SelectProjects([]string{"p-b"})
+	tests := []struct {
+		key  string
+		kept bool
+	}{
+		{graphNetworkKey("c1", "n1"), true},
+		{graphNetworkKey("c1", "n2"), false},
+		{graphNetworkKey("c1", "n4"), true},
+		{graphPortKey("10.0.0.1", "10.0.0.1p1"), false},
+		{graphPortKey("10.0.0.1", "10.0.0.1p7"), false},
+		{graphPortKey("10.0.0.1", "10.0.0.1p10"), false},
+		{graphPortKey("10.0.0.1", "10.0.0.1p2"), true},
+		{graphHypervisorKey("10.0.0.2"), false},
+	}
+	for _, test := range tests {
+		if kept := s.Entity(test.key) != nil; kept != test.kept {
+			t.Errorf("%s kept = %v, want %v", test.key, kept, test.kept)
+		}
+	}
+	if !s.HasInstance("u2") || s.HasInstance("u1") {
+		t.Error("instances of other projects kept or the selected project's dropped")
+	}
+}
@@ -0,0 +1,648 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/SpirentOrion/httprouter"
+	"github.com/SpirentOrion/luddite"
+	"golang.org/x/net/context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/user"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+type cliCommand struct {
+	run   func(args []string) int
+	usage string
+}
+
+var cliCommands map[string]cliCommand
+
+func init() {
+	cliCommands = map[string]cliCommand{
+		"render":   {cliRender, "render [-format ascii] [-layout hierarchical] [-server host:port] [-o file] <view path | url | file | ->"},
+		"discover": {cliDiscover, "discover [-c topology.yaml | -server host:port] [-token token] [cloud]"},
+		"show":     {cliShow, "show [-format ascii] [-layers ovs,physical] [-c topology.yaml | -server host:port] [-token token] cloud <cloud> | hypervisor|instance|network <cloud> <name>"},
+		"path":     {cliPath, "path [-format ascii] [-c topology.yaml | -server host:port] [-token token] <cloud> <instance> <instance>"},
+		"export":   {cliExport, "export [-format json] [-layout hierarchical] [-o file] [-c topology.yaml | -server host:port] [-token token] [cloud]"},
+		"audit":    {cliAudit, "audit [-since 24h] [-until time] [-user name] [-action name] [-cloud name] [-limit 100] [-json] [-c topology.yaml | -server host:port] [-token token]"},
+	}
+}
+
+func cliNames() []string {
+	var names []string
+	for name := range cliCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// cliReadTopology loads a view from a running service (a /topology/... path
+// or full URL), a saved JSON file, or stdin.
+func cliReadTopology(server string, source string) (*TopologyData, error) {
+	var body []byte
+	var err error
+	switch {
+	case source == "-":
+		body, err = ioutil.ReadAll(os.Stdin)
+	case strings.HasPrefix(source, "/topology/"):
+		body, err = cliGet("http://" + server + source)
+	case strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://"):
+		body, err = cliGet(source)
+	default:
+		body, err = ioutil.ReadFile(source)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var data TopologyData
+	if err = json.Unmarshal(body, &data); err != nil {
+		return nil, errors.New("Invalid topology " + source + ": " + err.Error())
+	}
+	return &data, nil
+}
+
+func cliGet(url string) ([]byte, error) {
+	return cliRequest("GET", url, "")
+}
+
+// cliRequest calls the REST API of a running service, sending the token
+// when one is given.
+func cliRequest(method string, url string, token string) ([]byte, error) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if len(token) > 0 {
+		req.Header.Set(headerAuthToken, token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return cliResponse(url, resp.StatusCode, body)
+}
+
+func cliResponse(url string, status int, body []byte) ([]byte, error) {
+	if status != http.StatusOK {
+		var apiError APIError
+		if json.Unmarshal(body, &apiError) == nil && len(apiError.ErrorMessage) > 0 {
+			return nil, errors.New(apiError.ErrorMessage)
+		}
+		return nil, fmt.Errorf("%s returned status %d", url, status)
+	}
+	return body, nil
+}
+
+func cliRender(args []string) int {
+	var format, layout, server, output string
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	fs.StringVar(&format, "format", exportFormatAscii, "Output format: "+strings.Join(exportFormats, ", "))
+	fs.StringVar(&layout, "layout", "", "Image layout: "+strings.Join(layoutNames, ", ")+", node coordinates by default")
+	fs.StringVar(&server, "server", "localhost:9192", "Topology service address for view paths")
+	fs.StringVar(&output, "o", "", "Output file, stdout by default")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s %s\n", os.Args[0], cliCommands["render"].usage)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || !queryContains(exportFormats, format) {
+		fs.Usage()
+		return 2
+	}
+
+	data, err := cliReadTopology(server, fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return cliWriteTopology(data, format, layout, output)
+}
+
+// cliWriteTopology lays out a view when a layout is given and writes it in
+// a format to a file or stdout.
+func cliWriteTopology(data *TopologyData, format string, layout string, output string) int {
+	var err error
+	if len(layout) > 0 {
+		if err = layoutCompute(data, layout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+	var body []byte
+	if encoder, ok := exportEncoders[format]; ok {
+		body, err = encoder(data)
+	} else {
+		body, err = json.MarshalIndent(data, "", "  ")
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return cliWrite(body, output)
+}
+
+func cliWrite(body []byte, output string) int {
+	var w io.Writer = os.Stdout
+	if len(output) > 0 {
+		f, err := os.Create(output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+	if _, err := w.Write(body); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// cliTarget is where a command gets its data: the REST API of a running
+// service, or the clouds of a config discovered in this process.
+type cliTarget struct {
+	server string
+	token  string
+	config string
+}
+
+func (t *cliTarget) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&t.server, "server", "localhost:9192", "Topology service address")
+	fs.StringVar(&t.token, "token", os.Getenv("TOPOLOGY_TOKEN"), "API token for the service, $TOPOLOGY_TOKEN by default")
+	fs.StringVar(&t.config, "c", "", "Config file to discover from in this process instead of calling the service")
+}
+
+func (t *cliTarget) local() bool {
+	return len(t.config) > 0
+}
+
+// open reads the config when running in process, and discovers the clouds
+// when the command needs them.
+func (t *cliTarget) open(discover bool) error {
+	if !t.local() {
+		return nil
+	}
+	var err error
+	if err = luddite.ReadConfig(t.config, &cfg); err != nil {
+		return err
+	}
+	if service, err = luddite.NewService(&cfg.Service); err != nil {
+		return err
+	}
+	if cfg.Audit.Enabled {
+		auditLoad()
+	}
+	// Discovery saves the placement history it records over the service's.
+	if err = placementLoad(); err != nil {
+		return err
+	}
+	if discover {
+		cloudLoadCloudInfo()
+		for _, cloudInfo := range cloudGetCloudList() {
+			discoverHypervisors(cloudInfo)
+		}
+	}
+	return nil
+}
+
+// cliLocalRoutes are the routes the commands call in process. None take
+// route parameters.
+var cliLocalRoutes = map[string]httprouter.Handle{
+	"/topology/cloudsTopology": CloudsTopology,
+	"/topology/query":          QueryTopology,
+	"/topology/audit":          GetAuditLog,
+}
+
+// get calls a route of the service, or its handler in process.
+func (t *cliTarget) get(path string, values url.Values) ([]byte, error) {
+	if len(values) > 0 {
+		path += "?" + values.Encode()
+	}
+	if !t.local() {
+		return cliRequest("GET", "http://"+t.server+path, t.token)
+	}
+	req, err := http.NewRequest("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	handle, ok := cliLocalRoutes[req.URL.Path]
+	if !ok {
+		return nil, errors.New(req.URL.Path + " cannot be called in process")
+	}
+	rw := httptest.NewRecorder()
+	rw.Header().Set(luddite.HeaderContentType, "application/json")
+	handle(context.Background(), rw, req)
+	return cliResponse(path, rw.Code, rw.Body.Bytes())
+}
+
+func (t *cliTarget) getTopology(path string, values url.Values) (*TopologyData, error) {
+	body, err := t.get(path, values)
+	if err != nil {
+		return nil, err
+	}
+	var data TopologyData
+	if err = json.Unmarshal(body, &data); err != nil {
+		return nil, errors.New("Invalid topology " + path + ": " + err.Error())
+	}
+	return &data, nil
+}
+
+// cliUser names who ran a command in process, for the audit trail.
+func cliUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+func cliUsage(fs *flag.FlagSet, name string) func() {
+	return func() {
+		fmt.Fprintf(os.Stderr, "usage: %s %s\n", os.Args[0], cliCommands[name].usage)
+		fs.PrintDefaults()
+	}
+}
+
+func cliDiscover(args []string) int {
+	var target cliTarget
+	fs := flag.NewFlagSet("discover", flag.ExitOnError)
+	target.addFlags(fs)
+	fs.Usage = cliUsage(fs, "discover")
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return 2
+	}
+	cloudName := fs.Arg(0)
+
+	if !target.local() {
+		path := "/topology/discovery/discover"
+		if len(cloudName) > 0 {
+			path += "/" + url.PathEscape(cloudName)
+		}
+		body, err := cliRequest("POST", "http://"+target.server+path, target.token)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		var apiError APIError
+		json.Unmarshal(body, &apiError)
+		fmt.Println(apiError.ErrorMessage)
+		return 0
+	}
+
+	if err := target.open(false); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	start := time.Now()
+	entry := AuditEntry{
+		Time:   start.UTC(),
+		User:   cliUser(),
+		Remote: "cli",
+		Action: auditActionDiscover,
+		Result: auditResultSuccess,
+	}
+	cloudLoadCloudInfo()
+	cloudList := cloudGetCloudList()
+	if len(cloudName) > 0 {
+		cloudInfo := cloudGetCloudInfo(cloudName)
+		if cloudInfo == nil {
+			fmt.Fprintln(os.Stderr, "Cloud "+cloudName+" Not discovered")
+			return 1
+		}
+		cloudList = []CloudInfo{*cloudInfo}
+		entry.Action = auditActionDiscoverCloud
+		entry.Cloud = cloudName
+		entry.Target = cloudName
+	}
+	discovered := 0
+	var failed []string
+	for _, cloudInfo := range cloudList {
+		n, cloudFailed := discoverHypervisors(cloudInfo)
+		fmt.Printf("%s: %d hypervisors discovered", cloudInfo.Name, n)
+		if len(cloudFailed) > 0 {
+			fmt.Printf(", failed on %s", strings.Join(cloudFailed, ", "))
+		}
+		fmt.Println()
+		discovered += n
+		failed = append(failed, cloudFailed...)
+	}
+	entry.Params = discoveryAuditParams(discovered, failed)
+	if len(entry.Params["failed"]) == 0 {
+		delete(entry.Params, "failed")
+	}
+	entry.Duration = int64(time.Since(start) / time.Millisecond)
+	auditRecord(entry)
+	if len(failed) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// cliShowParams are the query parameters that select each kind of element.
+var cliShowParams = map[string]string{
+	"hypervisor": "hypervisors",
+	"instance":   "instances",
+	"network":    "networks",
+}
+
+func cliShow(args []string) int {
+	var target cliTarget
+	var format, layers string
+	fs := flag.NewFlagSet("show", flag.ExitOnError)
+	fs.StringVar(&format, "format", exportFormatAscii, "Output format: "+strings.Join(exportFormats, ", "))
+	fs.StringVar(&layers, "layers", "", "Layers to show: "+strings.Join(queryLayers, ", ")+", the query default otherwise")
+	target.addFlags(fs)
+	fs.Usage = cliUsage(fs, "show")
+	fs.Parse(args)
+	kind := fs.Arg(0)
+	param, ok := cliShowParams[kind]
+	if !queryContains(exportFormats, format) || !((kind == "cloud" && fs.NArg() == 2) || (ok && fs.NArg() == 3)) {
+		fs.Usage()
+		return 2
+	}
+
+	values := url.Values{}
+	values.Set("cloud", fs.Arg(1))
+	if ok {
+		values.Set(param, fs.Arg(2))
+	}
+	if len(layers) > 0 {
+		values.Set("layers", layers)
+	}
+	if err := target.open(true); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	data, err := target.getTopology("/topology/query", values)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return cliWriteTopology(data, format, "", "")
+}
+
+// cliPathNode finds the node of an instance by name or UUID.
+func cliPathNode(data *TopologyData, instance string) (int, bool) {
+	for _, node := range data.Nodes {
+		if strings.HasPrefix(node.Key, graphEntityInstance+"/") && (node.Name == instance || strings.HasSuffix(node.Key, "/"+instance)) {
+			return node.ID, true
+		}
+	}
+	return 0, false
+}
+
+// cliShortestPath returns the links of the shortest path between two nodes,
+// going through no node that skip reports.
+func cliShortestPath(data *TopologyData, from int, to int, skip func(node TopologyNode) bool) []TopologyLink {
+	nodes := make(map[int]TopologyNode)
+	for _, node := range data.Nodes {
+		nodes[node.ID] = node
+	}
+	adjacent := make(map[int][]TopologyLink)
+	for _, link := range data.Links {
+		adjacent[link.Source] = append(adjacent[link.Source], link)
+		adjacent[link.Target] = append(adjacent[link.Target], link)
+	}
+	via := map[int]TopologyLink{from: {}}
+	queue := []int{from}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if id == to {
+			var path []TopologyLink
+			for id != from {
+				link := via[id]
+				path = append([]TopologyLink{link}, path...)
+				if link.Source == id {
+					id = link.Target
+				} else {
+					id = link.Source
+				}
+			}
+			return path
+		}
+		for _, link := range adjacent[id] {
+			next := link.Target
+			if next == id {
+				next = link.Source
+			}
+			if _, seen := via[next]; seen {
+				continue
+			}
+			if next != to && skip(nodes[next]) {
+				continue
+			}
+			via[next] = link
+			queue = append(queue, next)
+		}
+	}
+	return nil
+}
+
+// cliFindPath returns the nodes and links of a view that connect two
+// instances. The path through the vNICs, bridges and physical ports of the
+// hypervisors is preferred; instances that only meet on a network, as on
+// different hypervisors, are shown joined through it.
+func cliFindPath(data *TopologyData, cloudName string, from string, to string) (*TopologyData, error) {
+	fromID, ok := cliPathNode(data, from)
+	if !ok {
+		return nil, errors.New("Instance " + from + " for cloud " + cloudName + " Not discovered")
+	}
+	toID, ok := cliPathNode(data, to)
+	if !ok {
+		return nil, errors.New("Instance " + to + " for cloud " + cloudName + " Not discovered")
+	}
+
+	hasKind := func(node TopologyNode, kinds ...string) bool {
+		for _, kind := range kinds {
+			if strings.HasPrefix(node.Key, kind+"/") {
+				return true
+			}
+		}
+		return false
+	}
+	path := cliShortestPath(data, fromID, toID, func(node TopologyNode) bool {
+		return hasKind(node, graphEntityInstance, graphEntityHypervisor, graphEntityNetwork)
+	})
+	if path == nil {
+		path = cliShortestPath(data, fromID, toID, func(node TopologyNode) bool {
+			return hasKind(node, graphEntityInstance, graphEntityHypervisor)
+		})
+	}
+	if path == nil && fromID != toID {
+		return nil, errors.New("No path between " + from + " and " + to)
+	}
+
+	onPath := map[int]bool{fromID: true, toID: true}
+	for _, link := range path {
+		onPath[link.Source] = true
+		onPath[link.Target] = true
+	}
+	pathData := &TopologyData{
+		Title:    cloudName + " " + from + " to " + to + " Path",
+		Nodes:    make([]TopologyNode, 0),
+		Links:    make([]TopologyLink, 0),
+		NodeSets: make([]TopologyNodeSet, 0),
+		Groups:   make([]TopologyGroup, 0),
+		Views:    make(map[string]string),
+	}
+	for _, node := range data.Nodes {
+		if onPath[node.ID] {
+			pathData.Nodes = append(pathData.Nodes, node)
+		}
+	}
+	pathData.Links = append(pathData.Links, path...)
+	return pathData, nil
+}
+
+func cliPath(args []string) int {
+	var target cliTarget
+	var format string
+	fs := flag.NewFlagSet("path", flag.ExitOnError)
+	fs.StringVar(&format, "format", exportFormatAscii, "Output format: "+strings.Join(exportFormats, ", "))
+	target.addFlags(fs)
+	fs.Usage = cliUsage(fs, "path")
+	fs.Parse(args)
+	if fs.NArg() != 3 || !queryContains(exportFormats, format) {
+		fs.Usage()
+		return 2
+	}
+	cloudName, from, to := fs.Arg(0), fs.Arg(1), fs.Arg(2)
+
+	values := url.Values{}
+	values.Set("cloud", cloudName)
+	values.Set("instances", from+","+to)
+	values.Set("layers", strings.Join(queryLayers, ","))
+	if err := target.open(true); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	data, err := target.getTopology("/topology/query", values)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	pathData, err := cliFindPath(data, cloudName, from, to)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return cliWriteTopology(pathData, format, layoutLayered, "")
+}
+
+func cliExport(args []string) int {
+	var target cliTarget
+	var format, layout, output string
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	fs.StringVar(&format, "format", exportFormatJson, "Output format: "+strings.Join(exportFormats, ", "))
+	fs.StringVar(&layout, "layout", "", "Image layout: "+strings.Join(layoutNames, ", ")+", node coordinates by default")
+	fs.StringVar(&output, "o", "", "Output file, stdout by default")
+	target.addFlags(fs)
+	fs.Usage = cliUsage(fs, "export")
+	fs.Parse(args)
+	if fs.NArg() > 1 || !queryContains(exportFormats, format) {
+		fs.Usage()
+		return 2
+	}
+
+	if err := target.open(true); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	var data *TopologyData
+	var err error
+	if fs.NArg() == 0 {
+		data, err = target.getTopology("/topology/cloudsTopology", nil)
+	} else {
+		values := url.Values{}
+		values.Set("cloud", fs.Arg(0))
+		values.Set("layers", strings.Join(queryLayers, ","))
+		values.Set("title", fs.Arg(0)+" Topology")
+		data, err = target.getTopology("/topology/query", values)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return cliWriteTopology(data, format, layout, output)
+}
+
+func cliAudit(args []string) int {
+	var target cliTarget
+	var since, until, userName, action, cloud string
+	var limit int
+	var raw bool
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	fs.StringVar(&since, "since", "", "Start as a duration ago, unix time or RFC3339 time, 24 hours before until by default")
+	fs.StringVar(&until, "until", "", "End, now by default")
+	fs.StringVar(&userName, "user", "", "Only actions by this user")
+	fs.StringVar(&action, "action", "", "Only this action")
+	fs.StringVar(&cloud, "cloud", "", "Only actions on this cloud")
+	fs.IntVar(&limit, "limit", auditDefaultLimit, "Most recent entries to list, 0 for all")
+	fs.BoolVar(&raw, "json", false, "Write the entries as JSON")
+	target.addFlags(fs)
+	fs.Usage = cliUsage(fs, "audit")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+
+	values := url.Values{}
+	for k, v := range map[string]string{"since": since, "until": until, "user": userName, "action": action, "cloud": cloud} {
+		if len(v) > 0 {
+			values.Set(k, v)
+		}
+	}
+	values.Set("limit", strconv.Itoa(limit))
+	if err := target.open(false); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	body, err := target.get("/topology/audit", values)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if raw {
+		return cliWrite(body, "")
+	}
+
+	var auditLog AuditLog
+	if err = json.Unmarshal(body, &auditLog); err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid audit log: "+err.Error())
+		return 1
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tUSER\tACTION\tCLOUD\tTARGET\tRESULT\tDURATION")
+	for _, entry := range auditLog.Entries {
+		result := entry.Result
+		if len(entry.Error) > 0 {
+			result += ": " + entry.Error
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%dms\n", entry.Time.Local().Format(time.RFC3339), entry.User, entry.Action, entry.Cloud, entry.Target, result, entry.Duration)
+	}
+	w.Flush()
+	return 0
+}
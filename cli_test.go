@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/SpirentOrion/httprouter"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestCliOpenLoadsPlacementHistory(t *testing.T) {
+	defer testFixture()()
+	placementHistory["u1"] = &InstancePlacementHistory{UUID: "u1", Cloud: "c1", InstanceName: "vRouter1", Placements: []InstancePlacement{
+		{Hypervisor: "hv2", HostIP: "10.0.0.2", Source: placementSourceDiscovery, Since: testFixtureTime},
+	}}
+	placementSave()
+	placementHistory = make(map[string]*InstancePlacementHistory)
+
+	config := filepath.Join(cfg.Store.Path, "topology.yaml")
+	if err := ioutil.WriteFile(config, []byte("store:\n  path: "+cfg.Store.Path+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	target := cliTarget{config: config}
+	if err := target.open(false); err != nil {
+		t.Fatal(err)
+	}
+	if history := placementHistory["u1"]; history == nil || len(history.Placements) != 1 {
+		t.Errorf("placement history %+v, want the saved one loaded before discovery records over it", history)
+	}
+}
+
+// cliTestData builds a view of the nodes with the given keys linked by pairs
+// of node IDs, naming each node after the last part of its key.
+func cliTestData(keys []string, links [][2]int) *TopologyData {
+	data := &TopologyData{}
+	for i, key := range keys {
+		data.Nodes = append(data.Nodes, TopologyNode{ID: i, Key: key, Name: key[strings.LastIndex(key, "/")+1:]})
+	}
+	for _, link := range links {
+		data.Links = append(data.Links, TopologyLink{Source: link[0], Target: link[1]})
+	}
+	return data
+}
+
+func cliTestPathKeys(data *TopologyData) string {
+	var keys []string
+	for _, node := range data.Nodes {
+		keys = append(keys, node.Key)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, " ")
+}
+
+func TestCliShortestPath(t *testing.T) {
+	// 0 - 1 - 2 - 3 and 0 - 4 - 3, with 5 on its own.
+	data := cliTestData([]string{"a", "b", "c", "d", "e", "f"}, [][2]int{{0, 1}, {1, 2}, {3, 2}, {0, 4}, {4, 3}})
+	never := func(node TopologyNode) bool { return false }
+	tests := []struct {
+		from, to int
+		skip     func(node TopologyNode) bool
+		path     [][2]int
+	}{
+		{0, 3, never, [][2]int{{0, 4}, {4, 3}}},
+		{0, 3, func(node TopologyNode) bool { return node.Name == "e" }, [][2]int{{0, 1}, {1, 2}, {3, 2}}},
+		{0, 4, func(node TopologyNode) bool { return node.Name == "e" }, [][2]int{{0, 4}}},
+		{2, 2, never, nil},
+		{0, 5, never, nil},
+	}
+	for _, test := range tests {
+		var path [][2]int
+		for _, link := range cliShortestPath(data, test.from, test.to, test.skip) {
+			path = append(path, [2]int{link.Source, link.Target})
+		}
+		if len(path) != len(test.path) {
+			t.Errorf("path from %d to %d = %v, want %v", test.from, test.to, path, test.path)
+			continue
+		}
+		for i := range path {
+			if path[i] != test.path[i] {
+				t.Errorf("path from %d to %d = %v, want %v", test.from, test.to, path, test.path)
+				break
+			}
+		}
+	}
+}
+
+func TestCliFindPathPrefersDataPath(t *testing.T) {
+	keys := []string{"instance/c1/a", "vnic/c1/a/0", "bridge/10.0.0.1/br-int", "vnic/c1/b/0", "instance/c1/b", "network/c1/n1", "hypervisor/c1/1", "instance/c1/c"}
+	bridged := [][2]int{{0, 1}, {1, 2}, {2, 3}, {3, 4}}
+	networked := [][2]int{{0, 1}, {1, 5}, {5, 3}, {3, 4}}
+	hosted := [][2]int{{6, 0}, {6, 7}}
+	tests := []struct {
+		links [][2]int
+		from  string
+		to    string
+		keys  string
+	}{
+		{append(bridged, networked[1:3]...), "a", "b", "bridge/10.0.0.1/br-int instance/c1/a instance/c1/b vnic/c1/a/0 vnic/c1/b/0"},
+		{networked, "a", "b", "instance/c1/a instance/c1/b network/c1/n1 vnic/c1/a/0 vnic/c1/b/0"},
+		{hosted, "a", "c", ""},
+		{hosted, "a", "a", "instance/c1/a"},
+		{hosted, "a", "ghost", ""},
+	}
+	for _, test := range tests {
+		pathData, err := cliFindPath(cliTestData(keys, test.links), "c1", test.from, test.to)
+		if len(test.keys) == 0 {
+			if err == nil {
+				t.Errorf("path from %s to %s = %s, want an error", test.from, test.to, cliTestPathKeys(pathData))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("path from %s to %s: %v", test.from, test.to, err)
+			continue
+		}
+		if keys := cliTestPathKeys(pathData); keys != test.keys {
+			t.Errorf("path from %s to %s = %s, want %s", test.from, test.to, keys, test.keys)
+		}
+	}
+}
+
+func TestCliFindPathInQueryView(t *testing.T) {
+	defer testFixture()()
+	router := httprouter.New()
+	InitQuery(router)
+	r, _ := http.NewRequest("GET", "http://topology/topology/query?cloud=c1&layers="+strings.Join(queryLayers, ",")+"&instances=vRouter1,u3", nil)
+	rw := httptest.NewRecorder()
+	router.ServeHTTP(rw, r)
+	var data TopologyData
+	if err := json.Unmarshal(rw.Body.Bytes(), &data); err != nil {
+		t.Fatal(err)
+	}
+
+	pathData, err := cliFindPath(&data, "c1", "vRouter1", "u3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pathData.Title != "c1 vRouter1 to u3 Path" {
+		t.Errorf("title %q, want c1 vRouter1 to u3 Path", pathData.Title)
+	}
+	// The instances are on different hypervisors with no tunnel between
+	// them, so they meet on net-a.
+	want := "instance/c1/u1 instance/c1/u3 network/c1/n1 vnic/c1/u1/fa:16:00:00:00:01 vnic/c1/u3/fa:16:00:00:00:05"
+	if keys := cliTestPathKeys(pathData); keys != want {
+		t.Errorf("path nodes %s, want %s", keys, want)
+	}
+	if len(pathData.Links) != 4 {
+		t.Errorf("%d path links, want 4", len(pathData.Links))
+	}
+}
@@ -33,9 +33,11 @@ type CloudInstances struct {
 }
 
 type CloudInstanceInfo struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
-	HostName string `json:"host_name"`
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	HostName    string `json:"host_name"`
+	ProjectID   string `json:"project_id"`
+	ProjectName string `json:"project_name"`
 }
 
 type CloudNetworks struct {
@@ -43,8 +45,10 @@ type CloudNetworks struct {
 }
 
 type CloudNetworkInfo struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	ProjectID   string `json:"project_id"`
+	ProjectName string `json:"project_name"`
 }
 
 type CloudNetworkPorts struct {
@@ -56,6 +60,19 @@ type CloudNetworkPortInfo struct {
 	Name        string `json:"name"`
 	MacAddress  string `json:"mac_address,required"`
 	NetworkName string `json:"network_name,required"`
+	ProjectID   string `json:"project_id"`
+	ProjectName string `json:"project_name"`
+}
+
+type CloudProjects struct {
+	Projects []CloudProjectInfo `json:"projects,required"`
+}
+
+// CloudProjectInfo is a Keystone project (tenant) owning instances,
+// networks and ports.
+type CloudProjectInfo struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
 }
 
 var clouds []CloudInfo
@@ -64,6 +81,7 @@ var cloudHypervisors map[string][]CloudHypervisorInfo = make(map[string][]CloudH
 var cloudInstances map[string][]CloudInstanceInfo = make(map[string][]CloudInstanceInfo)
 var cloudNetworks map[string][]CloudNetworkInfo = make(map[string][]CloudNetworkInfo)
 var cloudNetworkPorts map[string][]CloudNetworkPortInfo = make(map[string][]CloudNetworkPortInfo)
+var cloudProjects map[string][]CloudProjectInfo = make(map[string][]CloudProjectInfo)
 
 var cloudHypervisorNames map[string]map[string]string = make(map[string]map[string]string)
 var cloudInstanceNames map[string]map[string]string = make(map[string]map[string]string)
@@ -96,6 +114,8 @@ func cloudLoadCloudInfo() error {
 		cloudLoadInstances(cloudInfo)
 		cloudLoadNetworks(cloudInfo)
 		cloudLoadNetworkPorts(cloudInfo)
+		cloudLoadProjects(cloudInfo)
+		cloudResolveProjectNames(cloudInfo)
 	}
 
 	return nil
@@ -375,6 +395,104 @@ func cloudLoadNetworkPorts(cloudInfo CloudInfo) error {
 	return nil
 }
 
+func cloudLoadProjects(cloudInfo CloudInfo) error {
+	cmd := exec.Command("./glimpse",
+		"-auth-url", cloudInfo.AuthUrl,
+		"-user", cloudInfo.User,
+		"-pass", cloudInfo.Password,
+		"-tenant", cloudInfo.Tenant,
+		"-provider", cloudInfo.Provider,
+		"list", "projects")
+
+	logFields := log.Fields{
+		"Name": cloudInfo.Name,
+	}
+
+	service.Logger().WithFields(logFields).Info("Loading project list")
+
+	cmdReader, err := cmd.StdoutPipe()
+	if err != nil {
+		logFields = log.Fields{
+			"Name":  cloudInfo.Name,
+			"Error": err.Error(),
+		}
+		service.Logger().WithFields(logFields).Error("Error creating StdoutPipe for glimpse to list projects")
+		return err
+	}
+	// read the data from stdout
+	buf := bufio.NewReader(cmdReader)
+
+	if err = cmd.Start(); err != nil {
+		logFields = log.Fields{
+			"Name":  cloudInfo.Name,
+			"Error": err.Error(),
+		}
+		service.Logger().WithFields(logFields).Error("Error starting glimpse to list projects")
+		return err
+	}
+
+	output, _ := buf.ReadString('\n')
+	if err = cmd.Wait(); err != nil {
+		logFields = log.Fields{
+			"Name":  cloudInfo.Name,
+			"Error": err.Error(),
+		}
+		service.Logger().WithFields(logFields).Error("Error returned from glimpse to list projects")
+		return err
+	}
+
+	var projects CloudProjects
+	json.Unmarshal([]byte(output), &projects)
+
+	cloudProjects[cloudInfo.Name] = projects.Projects
+
+	service.Logger().WithFields(logFields).Info("Sucessfully loaded project list")
+
+	return nil
+}
+
+// cloudResolveProjectNames names the projects of instances, networks and
+// ports that were listed by project ID only.
+func cloudResolveProjectNames(cloudInfo CloudInfo) {
+	projectNames := make(map[string]string)
+	for _, project := range cloudProjects[cloudInfo.Name] {
+		projectNames[project.ID] = project.Name
+	}
+	for i, instance := range cloudInstances[cloudInfo.Name] {
+		if len(instance.ProjectName) == 0 {
+			cloudInstances[cloudInfo.Name][i].ProjectName = projectNames[instance.ProjectID]
+		}
+	}
+	for i, network := range cloudNetworks[cloudInfo.Name] {
+		if len(network.ProjectName) == 0 {
+			cloudNetworks[cloudInfo.Name][i].ProjectName = projectNames[network.ProjectID]
+		}
+	}
+	for i, networkPort := range cloudNetworkPorts[cloudInfo.Name] {
+		if len(networkPort.ProjectName) == 0 {
+			cloudNetworkPorts[cloudInfo.Name][i].ProjectName = projectNames[networkPort.ProjectID]
+		}
+	}
+
+	// Without a project list, the projects are those that own something.
+	if len(cloudProjects[cloudInfo.Name]) > 0 {
+		return
+	}
+	seen := make(map[string]bool)
+	add := func(id string, name string) {
+		if len(id) > 0 && !seen[id] {
+			seen[id] = true
+			cloudProjects[cloudInfo.Name] = append(cloudProjects[cloudInfo.Name], CloudProjectInfo{id, name})
+		}
+	}
+	for _, instance := range cloudInstances[cloudInfo.Name] {
+		add(instance.ProjectID, instance.ProjectName)
+	}
+	for _, network := range cloudNetworks[cloudInfo.Name] {
+		add(network.ProjectID, network.ProjectName)
+	}
+}
+
 func cloudGetCloudList() []CloudInfo {
 	var cloudList []CloudInfo
 	for _, cloudInfo := range clouds {
@@ -515,6 +633,27 @@ func cloudGetNetworkPortList(cloudInfo *CloudInfo) []CloudNetworkPortInfo {
 	return npList
 }
 
+func cloudGetProjectList(cloudInfo *CloudInfo) []CloudProjectInfo {
+	if pList, ok := cloudProjects[cloudInfo.Name]; ok == true {
+		return pList
+	}
+	var pList []CloudProjectInfo
+	return pList
+}
+
+// cloudGetProjectInfo finds a project by ID or name.
+func cloudGetProjectInfo(cloudName string, project string) *CloudProjectInfo {
+	cloudInfo := cloudGetCloudInfo(cloudName)
+	if cloudInfo != nil {
+		for _, projectInfo := range cloudGetProjectList(cloudInfo) {
+			if projectInfo.ID == project || projectInfo.Name == project {
+				return &projectInfo
+			}
+		}
+	}
+	return nil
+}
+
 func resolveHypervisorName(cloudInfo *CloudInfo, ipAddress string) string {
 	if hypervisorNames, ok := cloudHypervisorNames[cloudInfo.Name]; ok {
 		if hypervisorName, ok := hypervisorNames[ipAddress]; ok {
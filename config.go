@@ -13,6 +13,52 @@ type CloudProvider struct {
 	Provider string `yaml:"provider"`
 }
 
+type StatsThreshold struct {
+	Utilization float64 `yaml:"utilization"`
+	Color       string  `yaml:"color"`
+	Width       int     `yaml:"width"`
+}
+
+type AlertRule struct {
+	Name      string  `yaml:"name" json:"name,required"`
+	Type      string  `yaml:"type" json:"type,required"`
+	Cloud     string  `yaml:"cloud" json:"cloud,omitempty"`
+	Severity  string  `yaml:"severity" json:"severity,omitempty"`
+	Threshold float64 `yaml:"threshold" json:"threshold,omitempty"`
+}
+
+type AlertSink struct {
+	Name    string `yaml:"name"`
+	Url     string `yaml:"url"`
+	Retries int    `yaml:"retries"`
+	Timeout int    `yaml:"timeout"`
+}
+
+type BridgeFilterRule struct {
+	Name          string   `yaml:"name" json:"name,required"`
+	BridgeName    string   `yaml:"bridge_name" json:"bridge_name,omitempty"`
+	DatapathType  string   `yaml:"datapath_type" json:"datapath_type,omitempty"`
+	InterfaceType string   `yaml:"interface_type" json:"interface_type,omitempty"`
+	PortPrefixes  []string `yaml:"port_prefixes" json:"port_prefixes,omitempty"`
+}
+
+type CloudBridgeFilter struct {
+	Cloud string             `yaml:"cloud"`
+	Rules []BridgeFilterRule `yaml:"rules"`
+}
+
+type HistoryRetention struct {
+	Resolution int `yaml:"resolution"`
+	Retention  int `yaml:"retention"`
+}
+
+type AuthToken struct {
+	Token   string   `yaml:"token"`
+	User    string   `yaml:"user"`
+	Role    string   `yaml:"role"`
+	Tenants []string `yaml:"tenants"`
+}
+
 // Config is a struct that holds config values relevant to the service framework.
 type Config struct {
 	Service luddite.ServiceConfig
@@ -23,4 +69,53 @@ type Config struct {
 	CloudProviders struct {
 		Providers []CloudProvider `yaml:"providers"`
 	}
+	Store struct {
+		Path string `yaml:"path"`
+	}
+	Stats struct {
+		Enabled         bool             `yaml:"enabled"`
+		PollInterval    int              `yaml:"poll_interval"`
+		PollConcurrency int              `yaml:"poll_concurrency"`
+		Samples         int              `yaml:"samples"`
+		LinkSpeedMbps   float64          `yaml:"link_speed_mbps"`
+		Thresholds      []StatsThreshold `yaml:"thresholds"`
+	}
+	History struct {
+		Enabled       bool               `yaml:"enabled"`
+		FlushInterval int                `yaml:"flush_interval"`
+		Retention     []HistoryRetention `yaml:"retention"`
+	}
+	Alerts struct {
+		Enabled bool        `yaml:"enabled"`
+		Rules   []AlertRule `yaml:"rules"`
+		Sinks   []AlertSink `yaml:"sinks"`
+	}
+	Placement struct {
+		Events       bool `yaml:"events"`
+		RecentWindow int  `yaml:"recent_window"`
+		MaxEntries   int  `yaml:"max_entries"`
+	}
+	Filters struct {
+		Rules  []BridgeFilterRule  `yaml:"rules"`
+		Clouds []CloudBridgeFilter `yaml:"clouds"`
+	}
+	ViewCache struct {
+		Size   int `yaml:"size"`
+		MaxAge int `yaml:"max_age"`
+	}
+	Auth struct {
+		Enabled              bool        `yaml:"enabled"`
+		Tokens               []AuthToken `yaml:"tokens"`
+		RedactInfrastructure bool        `yaml:"redact_infrastructure"`
+		Keystone             struct {
+			AuthUrl  string            `yaml:"auth_url"`
+			CacheTTL int               `yaml:"cache_ttl"`
+			Roles    map[string]string `yaml:"roles"`
+		}
+	}
+	Audit struct {
+		Enabled    bool `yaml:"enabled"`
+		Retention  int  `yaml:"retention"`
+		MaxEntries int  `yaml:"max_entries"`
+	}
 }
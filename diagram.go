@@ -0,0 +1,410 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type diagramGroup struct {
+	label string
+	nodes []int
+}
+
+// diagramGroups assigns nodes to the hypervisor they belong to. Hosts and
+// nodes tagged with their hypervisor seed the groups, which then spread over
+// links; networks and clouds stay outside. The second result maps a node
+// index to its group or -1.
+func diagramGroups(data *TopologyData, index map[int]int) ([]diagramGroup, []int) {
+	nodeGroup := make([]int, len(data.Nodes))
+	groupByName := make(map[string]int)
+	groupByIP := make(map[string]int)
+	var groups []diagramGroup
+	for i := range nodeGroup {
+		nodeGroup[i] = -1
+	}
+	for i, node := range data.Nodes {
+		if node.DeviceType != "host" {
+			continue
+		}
+		ip, _ := node.Props["ip_address"].(string)
+		label := node.Name
+		if len(ip) > 0 {
+			label += " (" + ip + ")"
+		}
+		groupByName[node.Name] = len(groups)
+		groupByIP[ip] = len(groups)
+		nodeGroup[i] = len(groups)
+		groups = append(groups, diagramGroup{label: label})
+	}
+	for i, node := range data.Nodes {
+		if name, ok := node.Props["hypervisor name"].(string); ok {
+			if g, ok := groupByName[name]; ok {
+				nodeGroup[i] = g
+			}
+		}
+		if ip, ok := node.Props["hypervisor_ip"].(string); ok {
+			if g, ok := groupByIP[ip]; ok {
+				nodeGroup[i] = g
+			}
+		}
+	}
+
+	ungroupable := func(i int) bool {
+		return data.Nodes[i].DeviceType == "router" || data.Nodes[i].DeviceType == "cloud"
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, link := range data.Links {
+			s, sok := index[link.Source]
+			t, tok := index[link.Target]
+			if !sok || !tok {
+				continue
+			}
+			if nodeGroup[s] >= 0 && nodeGroup[t] < 0 && !ungroupable(t) {
+				nodeGroup[t] = nodeGroup[s]
+				changed = true
+			}
+			if nodeGroup[t] >= 0 && nodeGroup[s] < 0 && !ungroupable(s) {
+				nodeGroup[s] = nodeGroup[t]
+				changed = true
+			}
+		}
+	}
+	for i, g := range nodeGroup {
+		if g >= 0 {
+			groups[g].nodes = append(groups[g].nodes, i)
+		}
+	}
+	return groups, nodeGroup
+}
+
+func diagramIndex(data *TopologyData) map[int]int {
+	index := make(map[int]int)
+	for i, node := range data.Nodes {
+		index[node.ID] = i
+	}
+	return index
+}
+
+func diagramFloat(v interface{}) (float64, bool) {
+	switch value := v.(type) {
+	case float64:
+		return value, true
+	case int64:
+		return float64(value), true
+	case int:
+		return float64(value), true
+	}
+	return 0, false
+}
+
+func diagramScaled(v float64, unit string) string {
+	for _, scale := range []struct {
+		factor float64
+		prefix string
+	}{{1e9, "G"}, {1e6, "M"}, {1e3, "k"}} {
+		if v >= scale.factor {
+			return strconv.FormatFloat(v/scale.factor, 'f', 1, 64) + scale.prefix + unit
+		}
+	}
+	return strconv.FormatFloat(v, 'f', 0, 64) + unit
+}
+
+// diagramLinkLabel names the interfaces a link runs through and its key
+// counters: rates when stats are polled, raw counters otherwise.
+func diagramLinkLabel(link *TopologyLink) string {
+	var parts []string
+	if len(link.Name) > 0 {
+		parts = append(parts, link.Name)
+	}
+	source, _ := link.Props["source_interface"].(string)
+	target, _ := link.Props["target_interface"].(string)
+	switch {
+	case len(source) > 0 && len(target) > 0:
+		parts = append(parts, source+" > "+target)
+	case len(source) > 0:
+		parts = append(parts, source)
+	case len(target) > 0:
+		parts = append(parts, target)
+	}
+
+	if rx, ok := diagramFloat(link.Props["rx_bps"]); ok {
+		tx, _ := diagramFloat(link.Props["tx_bps"])
+		parts = append(parts, "rx "+diagramScaled(rx, "b/s")+" tx "+diagramScaled(tx, "b/s"))
+	} else if rx, ok := diagramFloat(link.Props["rx_packets"]); ok {
+		tx, _ := diagramFloat(link.Props["tx_packets"])
+		parts = append(parts, "rx "+diagramScaled(rx, "p")+" tx "+diagramScaled(tx, "p"))
+	} else if tx, ok := diagramFloat(link.Props["tx_packets"]); ok {
+		parts = append(parts, "tx "+diagramScaled(tx, "p"))
+	}
+	drops := 0.0
+	for _, k := range []string{"rx_drop_rate", "tx_drop_rate"} {
+		if v, ok := diagramFloat(link.Props[k]); ok {
+			drops += v
+		}
+	}
+	if drops > 0 {
+		parts = append(parts, "drops "+strconv.FormatFloat(drops, 'f', 1, 64)+"/s")
+	}
+	return strings.Join(parts, ", ")
+}
+
+func diagramNodeName(node *TopologyNode) string {
+	if len(node.Name) == 0 {
+		return "(unnamed " + node.DeviceType + ")"
+	}
+	return node.Name
+}
+
+func mermaidText(s string) string {
+	return strings.Replace(s, "\"", "#quot;", -1)
+}
+
+func mermaidNode(node *TopologyNode) string {
+	id := "n" + strconv.Itoa(node.ID)
+	text := "\"" + mermaidText(diagramNodeName(node)) + "\""
+	switch node.DeviceType {
+	case "host":
+		return id + "[" + text + "]"
+	case "server":
+		return id + "(" + text + ")"
+	case "switch":
+		return id + "[[" + text + "]]"
+	case "router":
+		return id + "{{" + text + "}}"
+	case "cloud":
+		return id + "((" + text + "))"
+	}
+	return id + "[/" + text + "/]"
+}
+
+func exportMermaid(data *TopologyData) ([]byte, error) {
+	index := diagramIndex(data)
+	groups, nodeGroup := diagramGroups(data, index)
+
+	var buf bytes.Buffer
+	buf.WriteString("---\ntitle: " + mermaidText(data.Title) + "\n---\nflowchart LR\n")
+	for g, group := range groups {
+		buf.WriteString("  subgraph g" + strconv.Itoa(g) + "[\"" + mermaidText(group.label) + "\"]\n")
+		for _, i := range group.nodes {
+			buf.WriteString("    " + mermaidNode(&data.Nodes[i]) + "\n")
+		}
+		buf.WriteString("  end\n")
+	}
+	for i := range data.Nodes {
+		if nodeGroup[i] < 0 {
+			buf.WriteString("  " + mermaidNode(&data.Nodes[i]) + "\n")
+		}
+	}
+
+	var styles []string
+	linkCount := 0
+	for i := range data.Links {
+		link := &data.Links[i]
+		if _, ok := index[link.Source]; !ok {
+			continue
+		}
+		if _, ok := index[link.Target]; !ok {
+			continue
+		}
+		arrow := "-->"
+		if link.Dotted {
+			arrow = "-.->"
+		}
+		if label := diagramLinkLabel(link); len(label) > 0 {
+			arrow += "|\"" + mermaidText(label) + "\"|"
+		}
+		buf.WriteString(fmt.Sprintf("  n%d %s n%d\n", link.Source, arrow, link.Target))
+		if len(link.Color) > 0 {
+			styles = append(styles, fmt.Sprintf("  linkStyle %d stroke:%s", linkCount, link.Color))
+		}
+		linkCount++
+	}
+	for i := range data.Nodes {
+		if len(data.Nodes[i].Color) > 0 {
+			styles = append(styles, fmt.Sprintf("  style n%d stroke:%s", data.Nodes[i].ID, data.Nodes[i].Color))
+		}
+	}
+	for _, style := range styles {
+		buf.WriteString(style + "\n")
+	}
+	return buf.Bytes(), nil
+}
+
+func plantUMLText(s string) string {
+	return strings.Replace(s, "\"", "'", -1)
+}
+
+func plantUMLNode(node *TopologyNode) string {
+	element := "rectangle"
+	switch node.DeviceType {
+	case "host":
+		element = "node"
+	case "server":
+		element = "component"
+	case "router", "cloud":
+		element = "cloud"
+	case "port":
+		element = "interface"
+	}
+	line := element + " \"" + plantUMLText(diagramNodeName(node)) + "\" <<" + node.DeviceType + ">> as n" + strconv.Itoa(node.ID)
+	if len(node.Color) > 0 {
+		line += " " + node.Color
+	}
+	return line
+}
+
+func exportPlantUML(data *TopologyData) ([]byte, error) {
+	index := diagramIndex(data)
+	groups, nodeGroup := diagramGroups(data, index)
+
+	var buf bytes.Buffer
+	buf.WriteString("@startuml\ntitle " + plantUMLText(data.Title) + "\n")
+	for g, group := range groups {
+		buf.WriteString("frame \"" + plantUMLText(group.label) + "\" as g" + strconv.Itoa(g) + " {\n")
+		for _, i := range group.nodes {
+			buf.WriteString("  " + plantUMLNode(&data.Nodes[i]) + "\n")
+		}
+		buf.WriteString("}\n")
+	}
+	for i := range data.Nodes {
+		if nodeGroup[i] < 0 {
+			buf.WriteString(plantUMLNode(&data.Nodes[i]) + "\n")
+		}
+	}
+	for i := range data.Links {
+		link := &data.Links[i]
+		if _, ok := index[link.Source]; !ok {
+			continue
+		}
+		if _, ok := index[link.Target]; !ok {
+			continue
+		}
+		var style []string
+		if len(link.Color) > 0 {
+			style = append(style, link.Color)
+		}
+		if link.Dotted {
+			style = append(style, "dashed")
+		}
+		arrow := "-->"
+		if len(style) > 0 {
+			arrow = "-[" + strings.Join(style, ",") + "]->"
+		}
+		line := fmt.Sprintf("n%d %s n%d", link.Source, arrow, link.Target)
+		if label := diagramLinkLabel(link); len(label) > 0 {
+			line += " : " + plantUMLText(label)
+		}
+		buf.WriteString(line + "\n")
+	}
+	buf.WriteString("@enduml\n")
+	return buf.Bytes(), nil
+}
+
+type asciiEdge struct {
+	peer int
+	link int
+}
+
+// exportAscii prints one spanning tree per hypervisor group, then the nodes
+// outside any group, then the links the trees did not use.
+func exportAscii(data *TopologyData) ([]byte, error) {
+	index := diagramIndex(data)
+	groups, nodeGroup := diagramGroups(data, index)
+
+	edges := make(map[int][]asciiEdge)
+	for l, link := range data.Links {
+		s, sok := index[link.Source]
+		t, tok := index[link.Target]
+		if !sok || !tok || s == t {
+			continue
+		}
+		edges[s] = append(edges[s], asciiEdge{t, l})
+		edges[t] = append(edges[t], asciiEdge{s, l})
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(data.Title + "\n")
+	printed := make([]bool, len(data.Nodes))
+	treeLinks := make(map[int]bool)
+	var printTree func(i int, group int, prefix string)
+	printTree = func(i int, group int, prefix string) {
+		var children []asciiEdge
+		for _, edge := range edges[i] {
+			if !printed[edge.peer] && nodeGroup[edge.peer] == group {
+				printed[edge.peer] = true
+				treeLinks[edge.link] = true
+				children = append(children, edge)
+			}
+		}
+		for c, edge := range children {
+			connector, indent := "├── ", "│   "
+			if c == len(children)-1 {
+				connector, indent = "└── ", "    "
+			}
+			line := prefix + connector + asciiNode(&data.Nodes[edge.peer])
+			if label := diagramLinkLabel(&data.Links[edge.link]); len(label) > 0 {
+				line += "  (" + label + ")"
+			}
+			buf.WriteString(line + "\n")
+			printTree(edge.peer, group, prefix+indent)
+		}
+	}
+
+	for g, group := range groups {
+		buf.WriteString("\n[" + group.label + "]\n")
+		for _, i := range group.nodes {
+			if printed[i] {
+				continue
+			}
+			printed[i] = true
+			buf.WriteString(asciiNode(&data.Nodes[i]) + "\n")
+			printTree(i, g, "")
+		}
+	}
+	var others []int
+	for i := range data.Nodes {
+		if !printed[i] && nodeGroup[i] < 0 {
+			others = append(others, i)
+		}
+	}
+	if len(others) > 0 {
+		buf.WriteString("\n[other]\n")
+		for _, i := range others {
+			if printed[i] {
+				continue
+			}
+			printed[i] = true
+			buf.WriteString(asciiNode(&data.Nodes[i]) + "\n")
+			printTree(i, -1, "")
+		}
+	}
+
+	var crossLinks []string
+	for l := range data.Links {
+		link := &data.Links[l]
+		s, sok := index[link.Source]
+		t, tok := index[link.Target]
+		if treeLinks[l] || !sok || !tok {
+			continue
+		}
+		line := diagramNodeName(&data.Nodes[s]) + " -> " + diagramNodeName(&data.Nodes[t])
+		if label := diagramLinkLabel(link); len(label) > 0 {
+			line += "  (" + label + ")"
+		}
+		crossLinks = append(crossLinks, line)
+	}
+	if len(crossLinks) > 0 {
+		buf.WriteString("\n[links]\n")
+		for _, line := range crossLinks {
+			buf.WriteString(line + "\n")
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func asciiNode(node *TopologyNode) string {
+	return diagramNodeName(node) + " [" + node.DeviceType + "]"
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDiagramFormats(t *testing.T) {
+	defer testFixture()()
+	linkLine := map[string]*regexp.Regexp{
+		exportFormatMermaid:  regexp.MustCompile(`(?m)^  n\d+ -`),
+		exportFormatPlantUML: regexp.MustCompile(`(?m)^n\d+ -`),
+		exportFormatAscii:    regexp.MustCompile(`(?m)(├── |└── | -> )`),
+	}
+
+	for _, format := range []string{exportFormatMermaid, exportFormatPlantUML, exportFormatAscii} {
+		rw, data := exportTestGet(t, "", exportContentTypes[format])
+		if contentType := rw.Header().Get("Content-Type"); contentType != exportContentTypes[format] {
+			t.Errorf("%s Content-Type = %s, want %s", format, contentType, exportContentTypes[format])
+		}
+		body := rw.Body.String()
+		switch format {
+		case exportFormatMermaid:
+			if !strings.HasPrefix(body, "---\ntitle: "+data.Title+"\n---\nflowchart LR\n") {
+				t.Errorf("mermaid starts %.60q, want a flowchart titled %s", body, data.Title)
+			}
+		case exportFormatPlantUML:
+			if !strings.HasPrefix(body, "@startuml\ntitle "+data.Title+"\n") || !strings.HasSuffix(body, "@enduml\n") {
+				t.Errorf("plantuml %.60q, want a diagram titled %s between @startuml and @enduml", body, data.Title)
+			}
+		case exportFormatAscii:
+			if !strings.HasPrefix(body, data.Title+"\n") {
+				t.Errorf("ascii starts %.60q, want the title %s", body, data.Title)
+			}
+		}
+		for _, node := range data.Nodes {
+			id := strconv.Itoa(node.ID)
+			var declared bool
+			switch format {
+			case exportFormatMermaid:
+				declared = regexp.MustCompile(`(?m)^ +n` + id + `[\[\({]`).MatchString(body)
+			case exportFormatPlantUML:
+				declared = regexp.MustCompile(`(?m) as n` + id + `( |$)`).MatchString(body)
+			case exportFormatAscii:
+				declared = strings.Contains(body, asciiNode(&node))
+			}
+			if !declared {
+				t.Errorf("%s lacks node %d %s", format, node.ID, node.Name)
+			}
+		}
+		if links := len(linkLine[format].FindAllString(body, -1)); links != len(data.Links) {
+			t.Errorf("%s draws %d links, want %d", format, links, len(data.Links))
+		}
+	}
+}
+
+func TestDiagramQuotesNames(t *testing.T) {
+	data := TopologyData{
+		Title: `say "hi"`,
+		Nodes: []TopologyNode{{ID: 0, Name: `vm "a"`, DeviceType: "server"}, {ID: 1, DeviceType: "switch"}},
+		Links: []TopologyLink{{Source: 0, Target: 1, Dotted: true}},
+	}
+	tests := []struct {
+		encode exportEncoder
+		want   []string
+	}{
+		{exportMermaid, []string{`title: say #quot;hi#quot;`, `n0("vm #quot;a#quot;")`, `n1[["(unnamed switch)"]]`, "n0 -.-> n1"}},
+		{exportPlantUML, []string{`title say 'hi'`, `component "vm 'a'" <<server>> as n0`, "n0 -[dashed]-> n1"}},
+		{exportAscii, []string{`vm "a" [server]`, "└── (unnamed switch) [switch]"}},
+	}
+	for _, test := range tests {
+		body, err := test.encode(&data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range test.want {
+			if !strings.Contains(string(body), want) {
+				t.Errorf("%s lacks %s", body, want)
+			}
+		}
+	}
+}
@@ -5,24 +5,51 @@ import (
 	"github.com/SpirentOrion/luddite"
 	"golang.org/x/net/context"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
+// discoverHypervisors loads libvirt and OVS from the hypervisors of a cloud
+// that are up, returning how many were and the ones that failed.
+func discoverHypervisors(cloudInfo CloudInfo) (int, []string) {
+	discovered := 0
+	var failed []string
+	for _, hypervisor := range cloudGetHypervisorList(&cloudInfo) {
+		if hypervisor.State == "up" {
+			discovered++
+			libvirtErr := libvirtLoadInfo(cloudInfo, hypervisor.HostIP)
+			ovsErr := ovsLoadInfo(cloudInfo, hypervisor.HostIP)
+			if libvirtErr != nil || ovsErr != nil {
+				failed = append(failed, hypervisor.Name)
+			}
+		}
+	}
+	return discovered, failed
+}
+
+func discoveryAuditParams(discovered int, failed []string) map[string]string {
+	return map[string]string{
+		"hypervisors": strconv.Itoa(discovered),
+		"failed":      strings.Join(failed, ","),
+	}
+}
+
 func Discover(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
 	service.Logger().Infof("Discovery started")
 
 	cloudLoadCloudInfo()
-	cloudList := cloudGetCloudList()
-	for _, cloudInfo := range cloudList {
-		hypervisorList := cloudGetHypervisorList(&cloudInfo)
-		for _, hypervisor := range hypervisorList {
-			if hypervisor.State == "up" {
-				libvirtLoadInfo(cloudInfo, hypervisor.HostIP)
-				ovsLoadInfo(cloudInfo, hypervisor.HostIP)
-			}
-		}
+	discovered := 0
+	var failed []string
+	for _, cloudInfo := range cloudGetCloudList() {
+		n, cloudFailed := discoverHypervisors(cloudInfo)
+		discovered += n
+		failed = append(failed, cloudFailed...)
 	}
 
+	graphInvalidate()
 	service.Logger().Infof("Discovery completed")
+	alertEvaluate()
+	auditNote(r, "", discoveryAuditParams(discovered, failed))
 
 	apiError := APIError{http.StatusOK, "OK"}
 	luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
@@ -38,14 +65,11 @@ func DiscoverCloud(ctx context.Context, rw http.ResponseWriter, r *http.Request)
 	}
 	service.Logger().Infof("Discovery started for cloud %s", cloudName)
 
-	hypervisorList := cloudGetHypervisorList(cloudInfo)
-	for _, hypervisor := range hypervisorList {
-		if hypervisor.State == "up" {
-			libvirtLoadInfo(*cloudInfo, hypervisor.HostIP)
-			ovsLoadInfo(*cloudInfo, hypervisor.HostIP)
-		}
-	}
+	discovered, failed := discoverHypervisors(*cloudInfo)
+	graphInvalidate()
 	service.Logger().Infof("Discovery completed for cloud %s", cloudName)
+	alertEvaluate()
+	auditNote(r, "", discoveryAuditParams(discovered, failed))
 
 	apiError := APIError{http.StatusOK, "OK"}
 	luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
@@ -84,15 +108,24 @@ func GetInstancesForHypervisor(ctx context.Context, rw http.ResponseWriter, r *h
 	}
 
 	intanceList := cloudGetIntanceListForHypervisor(cloudInfo, hostName)
+	if projects := authProjects(r, cloudInfo); projects != nil {
+		var projectInstances []CloudInstanceInfo
+		for _, instance := range intanceList {
+			if graphProjectSelected(CloudProjectInfo{instance.ProjectID, instance.ProjectName}, projects) {
+				projectInstances = append(projectInstances, instance)
+			}
+		}
+		intanceList = projectInstances
+	}
 
 	instances := CloudInstances{intanceList}
 	luddite.WriteResponse(rw, http.StatusOK, instances)
 }
 
 func InitDiscovery(router *httprouter.Router) {
-	router.POST("/topology/discovery/discover", Discover)
-	router.POST("/topology/discovery/discover/:cloud_name", DiscoverCloud)
-	router.GET("/topology/discovery/hypervisors/:cloud_name", GetHypervisors)
-	router.GET("/topology/discovery/instances/:cloud_name/:host_name", GetInstancesForHypervisor)
+	router.POST("/topology/discovery/discover", authorize(authRoleAdmin, audited(auditActionDiscover, Discover)))
+	router.POST("/topology/discovery/discover/:cloud_name", authorize(authRoleOperator, audited(auditActionDiscoverCloud, DiscoverCloud)))
+	router.GET("/topology/discovery/hypervisors/:cloud_name", authorize(authRoleViewer, GetHypervisors))
+	router.GET("/topology/discovery/instances/:cloud_name/:host_name", authorize(authRoleViewer, GetInstancesForHypervisor))
 }
 
@@ -0,0 +1,2 @@
+#!/bin/bash
+curl -i -X POST -H "Accept: application/json" -H "Content-Type: application/json" -d '{"name": "high_drops", "type": "drop_rate", "severity": "critical", "threshold": 1000}' "http://$1:9192/topology/alerts/rules"
@@ -0,0 +1,6 @@
+#!/bin/bash
+# Usage: audit_log.sh <host> <token> [since] [user] [action]
+# Lists the audit trail of discovery runs, API changes and cloud provider config changes.
+# since is a duration (24h), a unix time or an RFC3339 time; until, cloud and limit may also be given.
+curl -s -G -H "X-Auth-Token: $2" "http://$1:9192/topology/audit" \
+  --data-urlencode "since=${3:-24h}" --data-urlencode "user=$4" --data-urlencode "action=$5"
@@ -0,0 +1,5 @@
+#!/bin/bash
+# Usage: auth_whoami.sh <host> <token>
+# Shows the user, role and tenants a static API token or Keystone token is granted.
+# Send the same X-Auth-Token (or "Authorization: Bearer <token>") header to any other endpoint.
+curl -s -H "X-Auth-Token: $2" "http://$1:9192/topology/auth/whoami"
@@ -0,0 +1,2 @@
+#!/bin/bash
+curl -i -G -H "Accept: application/json" "http://$1:9192/topology/placement/history/$2/$3"
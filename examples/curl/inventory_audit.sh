@@ -0,0 +1,8 @@
+#!/bin/bash
+# Usage: inventory_audit.sh <host> <cloud> [view]
+# Cross-checks Nova, libvirt, Neutron and OVS; "view" returns the topology with the offenders highlighted.
+if [ "$3" == "view" ]; then
+  curl -s "http://$1:9192/topology/cloudInventoryAuditTopology/$2"
+else
+  curl -s "http://$1:9192/topology/inventory/audit/$2"
+fi
@@ -0,0 +1,5 @@
+#!/bin/bash
+# Usage: layouts.sh <host> <cloud> <user> <hypervisor id>
+curl -i -X PUT -H "Content-Type: application/json" -H "Accept: application/json" -d "{\"view\":\"/topology/cloudOvsNetworkTopology/$2\",\"user\":\"$3\",\"positions\":{\"hypervisor/$2/$4\":{\"x\":100,\"y\":100}}}" http://$1:9192/topology/layout
+curl -i -H "Accept: application/json" "http://$1:9192/topology/layouts?user=$3"
+curl -i -H "Accept: application/json" "http://$1:9192/topology/cloudOvsNetworkTopology/$2?user=$3"
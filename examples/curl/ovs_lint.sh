@@ -0,0 +1,4 @@
+#!/bin/bash
+# Usage: ovs_lint.sh <host> <cloud>
+# Lists dangling or asymmetric patch ports, ports on no bridge, failed interfaces and bridges with no uplink.
+curl -s "http://$1:9192/topology/lint/$2"
@@ -0,0 +1,9 @@
+#!/bin/bash
+# Usage: project_topology.sh <host> <cloud> [project]
+# Without a project lists the cloud's projects; with one shows its instances, networks and the infrastructure they use.
+# Any other topology view takes ?project=<id or name> to the same effect.
+if [ -z "$3" ]; then
+  curl -s "http://$1:9192/topology/projects/$2"
+else
+  curl -s "http://$1:9192/topology/cloudProjectTopology/$2/$3"
+fi
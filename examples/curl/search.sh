@@ -0,0 +1,4 @@
+#!/bin/bash
+# Usage: search.sh <host> <query> [type,...] [exact|prefix|fuzzy]
+# e.g. search.sh localhost fa:16:3e:12 neutron_port,ovs_interface prefix
+curl -s -G "http://$1:9192/topology/search" --data-urlencode "q=$2" ${3:+--data-urlencode "type=$3"} ${4:+--data-urlencode "match=$4"}
@@ -0,0 +1,5 @@
+#!/bin/bash
+curl -i -X POST -H "Content-Type: application/json" -H "Accept: application/json" -d "{\"name\":\"$3\",\"cloud\":\"$2\",\"hypervisor_instances\":[{\"host_name\":\"$4\"}]}" http://$1:9192/topology/testbeds
+curl -i -H "Accept: application/json" http://$1:9192/topology/testbeds
+curl -i -H "Accept: application/json" http://$1:9192/topology/testbedTopology/$3
+curl -i -H "Accept: application/json" "http://$1:9192/topology/cloudHypervisorTopology/$2?testbed=$3"
@@ -0,0 +1,2 @@
+#!/bin/bash
+curl -i -G -H "Accept: application/json" "http://$1:9192/topology/report/topTalkers/$2?entity=$3&metric=$4&n=10&window=15m"
@@ -0,0 +1,6 @@
+#!/bin/bash
+# Usage: topology_conditional.sh <host> <cloud>
+# Fetches a view, then fetches it again with its ETag, expecting 304 until discovery or the next stats poll changes it.
+url="http://$1:9192/topology/cloudOvsNetworkTopology/$2"
+etag=$(curl -s -o /dev/null -D - "$url" | tr -d '\r' | sed -n 's/^ETag: //Ip')
+curl -s -o /dev/null -w "%{http_code}\n" -H "If-None-Match: $etag" "$url"
@@ -0,0 +1,3 @@
+#!/bin/bash
+# Usage: topology_diagram.sh <host> <cloud> [mermaid|plantuml|ascii]
+curl -s "http://$1:9192/topology/cloudHypervisorsExpandedFilteredOvsNetworkTopology/$2?format=${3:-ascii}"
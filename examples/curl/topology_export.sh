@@ -0,0 +1,3 @@
+#!/bin/bash
+# Usage: topology_export.sh <host> <cloud> [graphml|gexf|dot|cytoscape|nodelink]
+curl -s "http://$1:9192/topology/cloudOvsNetworkTopology/$2?format=${3:-graphml}"
@@ -0,0 +1,4 @@
+#!/bin/bash
+curl -i -H "Accept: application/json" http://$1:9192/topology/filters/$2
+curl -i -G -H "Accept: application/json" "http://$1:9192/topology/cloudHypervisorsCollapsedFilteredOvsNetworkTopology/$2?filter_bridge_name=^br-(tun|ex)&filter_datapath_type=netdev"
+curl -i -G -H "Accept: application/json" "http://$1:9192/topology/query?cloud=$2&layers=ovs,linux_bridge&filter_interface_type=patch&filter_port_prefixes=patch-"
@@ -0,0 +1,2 @@
+#!/bin/bash
+curl -i -H "Accept: application/json" "http://$1:9192/topology/cloudHypervisorsCollapsedFilteredOvsNetworkTopology/$2?hypervisor_instances=$3"
@@ -0,0 +1,2 @@
+#!/bin/bash
+curl -i -G -H "Accept: application/json" "http://$1:9192/topology/cloudNeighborhoodTopology/$2" --data-urlencode "entity=$3" --data-urlencode "hops=${4:-1}" --data-urlencode "relations=${5:-contains,patch,attachment,uplink,network}"
@@ -0,0 +1,2 @@
+#!/bin/bash
+curl -i -G -H "Accept: application/json" "http://$1:9192/topology/query?cloud=$2&layers=ovs,linux_bridge,physical&exclude_bridges=br-tun,br-ex&collapse=bridges"
@@ -0,0 +1,3 @@
+#!/bin/bash
+# Usage: topology_render.sh <host> <cloud> [svg|png] [layered|grid|radial|hierarchical|force] > topology.svg
+curl -s "http://$1:9192/topology/cloudHypervisorsExpandedFilteredOvsNetworkTopology/$2?format=${3:-svg}&layout=${4:-layered}"
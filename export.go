@@ -0,0 +1,478 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/SpirentOrion/luddite"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	exportFormatJson      = "json"
+	exportFormatGraphML   = "graphml"
+	exportFormatGexf      = "gexf"
+	exportFormatDot       = "dot"
+	exportFormatCytoscape = "cytoscape"
+	exportFormatNodeLink  = "nodelink"
+	exportFormatMermaid   = "mermaid"
+	exportFormatPlantUML  = "plantuml"
+	exportFormatAscii     = "ascii"
+	exportFormatSvg       = "svg"
+	exportFormatPng       = "png"
+)
+
+// exportContentTypes maps each format to the media type it is written with
+// and accepted as.
+var exportContentTypes = map[string]string{
+	exportFormatGraphML:   "application/graphml+xml",
+	exportFormatGexf:      "application/gexf+xml",
+	exportFormatDot:       "text/vnd.graphviz",
+	exportFormatCytoscape: "application/vnd.cytoscape+json",
+	exportFormatNodeLink:  "application/vnd.node-link+json",
+	exportFormatMermaid:   "text/vnd.mermaid",
+	exportFormatPlantUML:  "text/vnd.plantuml",
+	exportFormatAscii:     "text/plain",
+	exportFormatSvg:       "image/svg+xml",
+	exportFormatPng:       "image/png",
+}
+
+var exportFormats = []string{exportFormatJson, exportFormatGraphML, exportFormatGexf, exportFormatDot, exportFormatCytoscape, exportFormatNodeLink, exportFormatMermaid, exportFormatPlantUML, exportFormatAscii, exportFormatSvg, exportFormatPng}
+
+type exportEncoder func(data *TopologyData) ([]byte, error)
+
+var exportEncoders = map[string]exportEncoder{
+	exportFormatGraphML:   exportGraphML,
+	exportFormatGexf:      exportGexf,
+	exportFormatDot:       exportDot,
+	exportFormatCytoscape: exportCytoscape,
+	exportFormatNodeLink:  exportNodeLink,
+	exportFormatMermaid:   exportMermaid,
+	exportFormatPlantUML:  exportPlantUML,
+	exportFormatAscii:     exportAscii,
+	exportFormatSvg:       exportSvg,
+	exportFormatPng:       exportPng,
+}
+
+// exportFormat picks the output format from ?format= or, failing that, the
+// first Accept media type that names one. The NeXt JSON is the default.
+func exportFormat(r *http.Request) (string, error) {
+	if format := r.URL.Query().Get("format"); len(format) > 0 {
+		if !queryContains(exportFormats, format) {
+			return "", fmt.Errorf("Invalid format %s, expected one of %s", format, strings.Join(exportFormats, ", "))
+		}
+		return format, nil
+	}
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType := strings.TrimSpace(strings.Split(accept, ";")[0])
+		for format, contentType := range exportContentTypes {
+			if mediaType == contentType {
+				return format, nil
+			}
+		}
+	}
+	return exportFormatJson, nil
+}
+
+// topologyWrite lays out a topology, by ?layout= or the view's default,
+// merges the layout saved by the user or test bed and writes it in the
+// negotiated format.
+func topologyWrite(rw http.ResponseWriter, r *http.Request, data TopologyData) {
+	format, err := exportFormat(r)
+	if err != nil {
+		apiError := APIError{http.StatusBadRequest, err.Error()}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	if format != exportFormatJson && !authAllowed(r, authRoleOperator) {
+		apiError := APIError{http.StatusForbidden, "Role " + authRoleOperator + " required to export " + format}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	layout := r.URL.Query().Get("layout")
+	if len(layout) == 0 {
+		layout = data.layout
+	}
+	if len(layout) > 0 {
+		if err = layoutCompute(&data, layout); err != nil {
+			apiError := APIError{http.StatusBadRequest, err.Error()}
+			luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+			return
+		}
+	}
+	savedLayoutApply(r, &data)
+	encoder, ok := exportEncoders[format]
+	if !ok {
+		luddite.WriteResponse(rw, http.StatusOK, data)
+		return
+	}
+	body, err := encoder(&data)
+	if err != nil {
+		apiError := APIError{http.StatusInternalServerError, "Error exporting topology: " + err.Error()}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	rw.Header().Set(luddite.HeaderContentType, exportContentTypes[format])
+	rw.WriteHeader(http.StatusOK)
+	rw.Write(body)
+}
+
+// exportValue renders a prop as text for the attribute based formats.
+func exportValue(v interface{}) string {
+	switch value := v.(type) {
+	case string:
+		return value
+	case time.Time:
+		return value.Format(time.RFC3339)
+	case bool, int, int64, float64:
+		return fmt.Sprint(value)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+func exportNodeAttributes(node *TopologyNode) map[string]interface{} {
+	attributes := map[string]interface{}{
+		"name":        node.Name,
+		"device_type": node.DeviceType,
+		"color":       node.Color,
+		"x":           node.X,
+		"y":           node.Y,
+	}
+	for k, v := range node.Props {
+		if _, ok := attributes[k]; !ok {
+			attributes[k] = v
+		}
+	}
+	return attributes
+}
+
+func exportLinkAttributes(link *TopologyLink) map[string]interface{} {
+	attributes := map[string]interface{}{
+		"name":   link.Name,
+		"color":  link.Color,
+		"width":  link.Width,
+		"dotted": link.Dotted,
+	}
+	for k, v := range link.Props {
+		if _, ok := attributes[k]; !ok {
+			attributes[k] = v
+		}
+	}
+	return attributes
+}
+
+func exportSortedKeys(attributes map[string]interface{}) []string {
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// exportAttributeNames collects the attribute names used by all nodes and
+// all links so the XML formats can declare them up front.
+func exportAttributeNames(data *TopologyData) ([]string, []string) {
+	nodeNames := make(map[string]interface{})
+	for i := range data.Nodes {
+		for k, v := range exportNodeAttributes(&data.Nodes[i]) {
+			nodeNames[k] = v
+		}
+	}
+	linkNames := make(map[string]interface{})
+	for i := range data.Links {
+		for k, v := range exportLinkAttributes(&data.Links[i]) {
+			linkNames[k] = v
+		}
+	}
+	return exportSortedKeys(nodeNames), exportSortedKeys(linkNames)
+}
+
+type graphMLKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	ID     string        `xml:"id,attr"`
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Data        []graphMLData `xml:"data"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLDocument struct {
+	XMLName xml.Name     `xml:"graphml"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+func exportGraphML(data *TopologyData) ([]byte, error) {
+	nodeNames, linkNames := exportAttributeNames(data)
+	doc := graphMLDocument{
+		Xmlns: "http://graphml.graphdrawing.org/xmlns",
+		Keys:  []graphMLKey{{"g_title", "graph", "title", "string"}},
+		Graph: graphMLGraph{
+			ID:          "G",
+			EdgeDefault: "directed",
+			Data:        []graphMLData{{"g_title", data.Title}},
+		},
+	}
+	nodeKeys := make(map[string]string)
+	for i, name := range nodeNames {
+		nodeKeys[name] = "n_" + strconv.Itoa(i)
+		doc.Keys = append(doc.Keys, graphMLKey{nodeKeys[name], "node", name, "string"})
+	}
+	linkKeys := make(map[string]string)
+	for i, name := range linkNames {
+		linkKeys[name] = "e_" + strconv.Itoa(i)
+		doc.Keys = append(doc.Keys, graphMLKey{linkKeys[name], "edge", name, "string"})
+	}
+
+	for i := range data.Nodes {
+		attributes := exportNodeAttributes(&data.Nodes[i])
+		node := graphMLNode{ID: "n" + strconv.Itoa(data.Nodes[i].ID)}
+		for _, k := range exportSortedKeys(attributes) {
+			node.Data = append(node.Data, graphMLData{nodeKeys[k], exportValue(attributes[k])})
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, node)
+	}
+	for i := range data.Links {
+		attributes := exportLinkAttributes(&data.Links[i])
+		edge := graphMLEdge{
+			ID:     "e" + strconv.Itoa(i),
+			Source: "n" + strconv.Itoa(data.Links[i].Source),
+			Target: "n" + strconv.Itoa(data.Links[i].Target),
+		}
+		for _, k := range exportSortedKeys(attributes) {
+			edge.Data = append(edge.Data, graphMLData{linkKeys[k], exportValue(attributes[k])})
+		}
+		doc.Graph.Edges = append(doc.Graph.Edges, edge)
+	}
+	return exportXml(doc)
+}
+
+type gexfAttribute struct {
+	ID    string `xml:"id,attr"`
+	Title string `xml:"title,attr"`
+	Type  string `xml:"type,attr"`
+}
+
+type gexfAttributes struct {
+	Class      string          `xml:"class,attr"`
+	Attributes []gexfAttribute `xml:"attribute"`
+}
+
+type gexfAttValue struct {
+	For   string `xml:"for,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type gexfNode struct {
+	ID        string         `xml:"id,attr"`
+	Label     string         `xml:"label,attr"`
+	AttValues []gexfAttValue `xml:"attvalues>attvalue"`
+}
+
+type gexfEdge struct {
+	ID        string         `xml:"id,attr"`
+	Source    string         `xml:"source,attr"`
+	Target    string         `xml:"target,attr"`
+	Label     string         `xml:"label,attr,omitempty"`
+	AttValues []gexfAttValue `xml:"attvalues>attvalue"`
+}
+
+type gexfGraph struct {
+	Mode            string           `xml:"mode,attr"`
+	DefaultEdgeType string           `xml:"defaultedgetype,attr"`
+	Attributes      []gexfAttributes `xml:"attributes"`
+	Nodes           []gexfNode       `xml:"nodes>node"`
+	Edges           []gexfEdge       `xml:"edges>edge"`
+}
+
+type gexfDocument struct {
+	XMLName     xml.Name  `xml:"gexf"`
+	Xmlns       string    `xml:"xmlns,attr"`
+	Version     string    `xml:"version,attr"`
+	Description string    `xml:"meta>description"`
+	Graph       gexfGraph `xml:"graph"`
+}
+
+func exportGexf(data *TopologyData) ([]byte, error) {
+	nodeNames, linkNames := exportAttributeNames(data)
+	doc := gexfDocument{
+		Xmlns:       "http://www.gexf.net/1.2draft",
+		Version:     "1.2",
+		Description: data.Title,
+		Graph: gexfGraph{
+			Mode:            "static",
+			DefaultEdgeType: "directed",
+		},
+	}
+	nodeIds := make(map[string]string)
+	nodeAttributes := gexfAttributes{Class: "node"}
+	for i, name := range nodeNames {
+		nodeIds[name] = strconv.Itoa(i)
+		nodeAttributes.Attributes = append(nodeAttributes.Attributes, gexfAttribute{nodeIds[name], name, "string"})
+	}
+	linkIds := make(map[string]string)
+	linkAttributes := gexfAttributes{Class: "edge"}
+	for i, name := range linkNames {
+		linkIds[name] = strconv.Itoa(i)
+		linkAttributes.Attributes = append(linkAttributes.Attributes, gexfAttribute{linkIds[name], name, "string"})
+	}
+	doc.Graph.Attributes = []gexfAttributes{nodeAttributes, linkAttributes}
+
+	for i := range data.Nodes {
+		attributes := exportNodeAttributes(&data.Nodes[i])
+		node := gexfNode{ID: strconv.Itoa(data.Nodes[i].ID), Label: data.Nodes[i].Name}
+		for _, k := range exportSortedKeys(attributes) {
+			node.AttValues = append(node.AttValues, gexfAttValue{nodeIds[k], exportValue(attributes[k])})
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, node)
+	}
+	for i := range data.Links {
+		attributes := exportLinkAttributes(&data.Links[i])
+		edge := gexfEdge{
+			ID:     strconv.Itoa(i),
+			Source: strconv.Itoa(data.Links[i].Source),
+			Target: strconv.Itoa(data.Links[i].Target),
+			Label:  data.Links[i].Name,
+		}
+		for _, k := range exportSortedKeys(attributes) {
+			edge.AttValues = append(edge.AttValues, gexfAttValue{linkIds[k], exportValue(attributes[k])})
+		}
+		doc.Graph.Edges = append(doc.Graph.Edges, edge)
+	}
+	return exportXml(doc)
+}
+
+func exportXml(doc interface{}) ([]byte, error) {
+	body, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(body, '\n')...), nil
+}
+
+func exportDotAttributes(buf *bytes.Buffer, attributes map[string]interface{}) {
+	buf.WriteString(" [")
+	for i, k := range exportSortedKeys(attributes) {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(strconv.Quote(k) + "=" + strconv.Quote(exportValue(attributes[k])))
+	}
+	buf.WriteString("];\n")
+}
+
+func exportDot(data *TopologyData) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("digraph " + strconv.Quote(data.Title) + " {\n")
+	buf.WriteString("  label=" + strconv.Quote(data.Title) + ";\n")
+	for i := range data.Nodes {
+		attributes := exportNodeAttributes(&data.Nodes[i])
+		attributes["label"] = data.Nodes[i].Name
+		buf.WriteString("  " + strconv.Quote(strconv.Itoa(data.Nodes[i].ID)))
+		exportDotAttributes(&buf, attributes)
+	}
+	for i := range data.Links {
+		attributes := exportLinkAttributes(&data.Links[i])
+		if len(data.Links[i].Name) > 0 {
+			attributes["label"] = data.Links[i].Name
+		}
+		if data.Links[i].Dotted {
+			attributes["style"] = "dotted"
+		}
+		buf.WriteString("  " + strconv.Quote(strconv.Itoa(data.Links[i].Source)) + " -> " + strconv.Quote(strconv.Itoa(data.Links[i].Target)))
+		exportDotAttributes(&buf, attributes)
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes(), nil
+}
+
+type cytoscapeElement struct {
+	Data map[string]interface{} `json:"data"`
+}
+
+type cytoscapeDocument struct {
+	Data     map[string]interface{} `json:"data"`
+	Elements struct {
+		Nodes []cytoscapeElement `json:"nodes"`
+		Edges []cytoscapeElement `json:"edges"`
+	} `json:"elements"`
+}
+
+func exportCytoscape(data *TopologyData) ([]byte, error) {
+	var doc cytoscapeDocument
+	doc.Data = map[string]interface{}{"title": data.Title}
+	doc.Elements.Nodes = make([]cytoscapeElement, 0, len(data.Nodes))
+	doc.Elements.Edges = make([]cytoscapeElement, 0, len(data.Links))
+	for i := range data.Nodes {
+		attributes := exportNodeAttributes(&data.Nodes[i])
+		attributes["id"] = strconv.Itoa(data.Nodes[i].ID)
+		doc.Elements.Nodes = append(doc.Elements.Nodes, cytoscapeElement{attributes})
+	}
+	for i := range data.Links {
+		attributes := exportLinkAttributes(&data.Links[i])
+		attributes["id"] = "e" + strconv.Itoa(i)
+		attributes["source"] = strconv.Itoa(data.Links[i].Source)
+		attributes["target"] = strconv.Itoa(data.Links[i].Target)
+		doc.Elements.Edges = append(doc.Elements.Edges, cytoscapeElement{attributes})
+	}
+	return json.Marshal(doc)
+}
+
+// exportNodeLink follows the node-link layout read by networkx and d3.
+func exportNodeLink(data *TopologyData) ([]byte, error) {
+	nodes := make([]map[string]interface{}, 0, len(data.Nodes))
+	for i := range data.Nodes {
+		attributes := exportNodeAttributes(&data.Nodes[i])
+		attributes["id"] = data.Nodes[i].ID
+		nodes = append(nodes, attributes)
+	}
+	links := make([]map[string]interface{}, 0, len(data.Links))
+	for i := range data.Links {
+		attributes := exportLinkAttributes(&data.Links[i])
+		attributes["source"] = data.Links[i].Source
+		attributes["target"] = data.Links[i].Target
+		attributes["key"] = i
+		links = append(links, attributes)
+	}
+	return json.Marshal(map[string]interface{}{
+		"directed":   true,
+		"multigraph": true,
+		"graph":      map[string]interface{}{"title": data.Title},
+		"nodes":      nodes,
+		"links":      links,
+	})
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"github.com/SpirentOrion/httprouter"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// exportTestView is the view the format tests export.
+const exportTestView = "/topology/cloudHypervisorOvsNetworkTopology/c1/hv1"
+
+// exportTestGet fetches the test view with the query and Accept header
+// given, and the view as NeXt JSON to compare it with.
+func exportTestGet(t *testing.T, query string, accept string) (*httptest.ResponseRecorder, TopologyData) {
+	router := httprouter.New()
+	InitTopology(router)
+	get := func(path string, accept string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("GET", "http://topology"+path, nil)
+		if len(accept) > 0 {
+			r.Header.Set("Accept", accept)
+		}
+		rw := httptest.NewRecorder()
+		router.ServeHTTP(rw, r)
+		return rw
+	}
+
+	var data TopologyData
+	if err := json.Unmarshal(get(exportTestView, "").Body.Bytes(), &data); err != nil {
+		t.Fatal(err)
+	}
+	rw := get(exportTestView+query, accept)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("GET %s (Accept %s) = %d, want %d: %s", exportTestView+query, accept, rw.Code, http.StatusOK, rw.Body.String())
+	}
+	return rw, data
+}
+
+func TestExportFormatNegotiation(t *testing.T) {
+	tests := []struct {
+		query  string
+		accept string
+		format string
+		valid  bool
+	}{
+		{"", "", exportFormatJson, true},
+		{"", "application/json", exportFormatJson, true},
+		{"", "text/html, application/graphml+xml;q=0.9", exportFormatGraphML, true},
+		{"", "image/png", exportFormatPng, true},
+		{"?format=dot", "image/png", exportFormatDot, true},
+		{"?format=visio", "", "", false},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", "http://topology"+exportTestView+test.query, nil)
+		r.Header.Set("Accept", test.accept)
+		format, err := exportFormat(r)
+		if (err == nil) != test.valid || format != test.format {
+			t.Errorf("exportFormat(%q, Accept %q) = %q, %v, want %q", test.query, test.accept, format, err, test.format)
+		}
+	}
+}
+
+func TestExportGraphFormats(t *testing.T) {
+	defer testFixture()()
+
+	for _, format := range []string{exportFormatGraphML, exportFormatGexf, exportFormatDot, exportFormatCytoscape, exportFormatNodeLink} {
+		rw, data := exportTestGet(t, "?format="+format, "")
+		if contentType := rw.Header().Get("Content-Type"); contentType != exportContentTypes[format] {
+			t.Errorf("%s Content-Type = %s, want %s", format, contentType, exportContentTypes[format])
+		}
+
+		var nodes, links int
+		var err error
+		switch format {
+		case exportFormatGraphML:
+			var doc graphMLDocument
+			err = xml.Unmarshal(rw.Body.Bytes(), &doc)
+			nodes, links = len(doc.Graph.Nodes), len(doc.Graph.Edges)
+		case exportFormatGexf:
+			var doc gexfDocument
+			err = xml.Unmarshal(rw.Body.Bytes(), &doc)
+			nodes, links = len(doc.Graph.Nodes), len(doc.Graph.Edges)
+		case exportFormatDot:
+			body := rw.Body.String()
+			if !strings.HasPrefix(body, "digraph "+`"`+data.Title+`"`) {
+				t.Errorf("dot starts %.40q, want a digraph titled %s", body, data.Title)
+			}
+			links = strings.Count(body, " -> ")
+			nodes = strings.Count(body, "\n  \"") - links
+		case exportFormatCytoscape:
+			var doc cytoscapeDocument
+			err = json.Unmarshal(rw.Body.Bytes(), &doc)
+			nodes, links = len(doc.Elements.Nodes), len(doc.Elements.Edges)
+		case exportFormatNodeLink:
+			var doc struct {
+				Nodes []map[string]interface{} `json:"nodes"`
+				Links []map[string]interface{} `json:"links"`
+			}
+			err = json.Unmarshal(rw.Body.Bytes(), &doc)
+			nodes, links = len(doc.Nodes), len(doc.Links)
+		}
+		if err != nil {
+			t.Errorf("%s: %v", format, err)
+			continue
+		}
+		if nodes != len(data.Nodes) || links != len(data.Links) {
+			t.Errorf("%s has %d nodes and %d links, want %d and %d", format, nodes, links, len(data.Nodes), len(data.Links))
+		}
+	}
+}
+
+func TestExportRequiresOperator(t *testing.T) {
+	_, restore := authTestSetup()
+	defer restore()
+	cfg.Auth.Tokens = append(cfg.Auth.Tokens, AuthToken{Token: "t-admin-viewer", User: "ann", Role: authRoleViewer, Tenants: []string{"admin"}})
+	router := httprouter.New()
+	InitTopology(router)
+
+	for _, test := range []struct {
+		token  string
+		status int
+	}{
+		{"t-admin-viewer", http.StatusForbidden},
+		{"t-operator", http.StatusOK},
+	} {
+		if rw := authTestRequest(router, "GET", exportTestView+"?format=dot", headerAuthToken, test.token); rw.Code != test.status {
+			t.Errorf("GET ?format=dot with %s = %d, want %d", test.token, rw.Code, test.status)
+		}
+	}
+}
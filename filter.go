@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"github.com/SpirentOrion/httprouter"
+	"github.com/SpirentOrion/luddite"
+	"golang.org/x/net/context"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	filterKindBridge     = "bridge"
+	filterKindPatch      = "patch"
+	filterKindAttachment = "attachment"
+	filterKindUplink     = "uplink"
+)
+
+// filterQueryRuleName names the rule built from the filter_* URL parameters.
+const filterQueryRuleName = "query"
+
+type TopologyFilterMatch struct {
+	Rule   string `json:"rule,required"`
+	Kind   string `json:"kind,required"`
+	Name   string `json:"name,required"`
+	HostIP string `json:"host_ip,omitempty"`
+}
+
+type BridgeFilterRules struct {
+	Cloud string             `json:"cloud,required"`
+	Rules []BridgeFilterRule `json:"rules,required"`
+}
+
+// The filtered views used to hide these two bridges by name, and the patch
+// links of the tunnel bridge; they remain the rules of clouds that configure
+// none.
+var filterDefaultRules = []BridgeFilterRule{
+	{Name: "tunnel-bridge", BridgeName: "^br-tun$"},
+	{Name: "external-bridge", BridgeName: "^br-ex$"},
+	{Name: "tunnel-bridge-patches", BridgeName: "^br-tun$", InterfaceType: "patch"},
+}
+
+// bridgeFilter is a compiled BridgeFilterRule. A rule with interface
+// criteria hides patch, attachment and uplink connections on the bridges its
+// bridge criteria match; a rule with bridge criteria only hides the bridges.
+type bridgeFilter struct {
+	rule       BridgeFilterRule
+	bridgeName *regexp.Regexp
+}
+
+func filterGetRules(cloudName string) []BridgeFilterRule {
+	for _, cloudFilter := range cfg.Filters.Clouds {
+		if cloudFilter.Cloud == cloudName {
+			return cloudFilter.Rules
+		}
+	}
+	if len(cfg.Filters.Rules) > 0 {
+		return cfg.Filters.Rules
+	}
+	return filterDefaultRules
+}
+
+func filterCompile(rules []BridgeFilterRule) ([]bridgeFilter, error) {
+	var filters []bridgeFilter
+	for _, rule := range rules {
+		if len(rule.Name) == 0 {
+			return nil, errors.New("Filter rule name is required")
+		}
+		filter := bridgeFilter{rule: rule}
+		if len(rule.BridgeName) > 0 {
+			re, err := regexp.Compile(rule.BridgeName)
+			if err != nil {
+				return nil, errors.New("Invalid bridge_name " + rule.BridgeName + " in filter rule " + rule.Name)
+			}
+			filter.bridgeName = re
+		}
+		if !filter.hasBridgeCriteria() && !filter.hasInterfaceCriteria() {
+			return nil, errors.New("Filter rule " + rule.Name + " has no criteria")
+		}
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
+
+// filterParseValues builds a rule from the filter_* parameters, if any.
+func filterParseValues(values url.Values) []BridgeFilterRule {
+	rule := BridgeFilterRule{
+		Name:          filterQueryRuleName,
+		BridgeName:    values.Get("filter_bridge_name"),
+		DatapathType:  values.Get("filter_datapath_type"),
+		InterfaceType: values.Get("filter_interface_type"),
+		PortPrefixes:  queryList(values["filter_port_prefixes"]),
+	}
+	if len(rule.BridgeName) == 0 && len(rule.DatapathType) == 0 && len(rule.InterfaceType) == 0 && len(rule.PortPrefixes) == 0 {
+		return nil
+	}
+	return []BridgeFilterRule{rule}
+}
+
+func (f *bridgeFilter) hasBridgeCriteria() bool {
+	return f.bridgeName != nil || len(f.rule.DatapathType) > 0
+}
+
+func (f *bridgeFilter) hasInterfaceCriteria() bool {
+	return len(f.rule.InterfaceType) > 0 || len(f.rule.PortPrefixes) > 0
+}
+
+func (f *bridgeFilter) matchBridge(bridge OvsBridge) bool {
+	if f.bridgeName != nil && !f.bridgeName.MatchString(bridge.Name) {
+		return false
+	}
+	return len(f.rule.DatapathType) == 0 || f.rule.DatapathType == bridge.DatapathType
+}
+
+func (f *bridgeFilter) matchInterface(iface OvsInterface, port OvsPort) bool {
+	if len(f.rule.InterfaceType) > 0 && f.rule.InterfaceType != iface.Type {
+		return false
+	}
+	if len(f.rule.PortPrefixes) == 0 {
+		return true
+	}
+	name := port.Name
+	if len(name) == 0 {
+		name = iface.Name
+	}
+	for _, prefix := range f.rule.PortPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterBridge returns the rule hiding the bridge, or "".
+func filterBridge(filters []bridgeFilter, bridge OvsBridge) string {
+	for i := range filters {
+		if !filters[i].hasInterfaceCriteria() && filters[i].matchBridge(bridge) {
+			return filters[i].rule.Name
+		}
+	}
+	return ""
+}
+
+// filterInterface returns the rule hiding the connection through iface on
+// bridge, or "".
+func filterInterface(filters []bridgeFilter, bridge OvsBridge, iface OvsInterface, port OvsPort) string {
+	for i := range filters {
+		if filters[i].hasInterfaceCriteria() && filters[i].matchBridge(bridge) && filters[i].matchInterface(iface, port) {
+			return filters[i].rule.Name
+		}
+	}
+	return ""
+}
+
+func (b *topologyBuilder) addFiltered(rule string, kind string, name string, hostIP string) {
+	b.filtered = append(b.filtered, TopologyFilterMatch{rule, kind, name, hostIP})
+}
+
+func GetBridgeFilterRules(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	cloudName := httprouter.ContextParams(ctx).ByName("cloud_name")
+	if cloudGetCloudInfo(cloudName) == nil {
+		apiError := APIError{http.StatusNotFound, "Cloud " + cloudName + " Not discovered"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	rules := BridgeFilterRules{cloudName, filterGetRules(cloudName)}
+	luddite.WriteResponse(rw, http.StatusOK, rules)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestFilterCompileRejectsBadRules(t *testing.T) {
+	tests := []struct {
+		name string
+		rule BridgeFilterRule
+	}{
+		{"no name", BridgeFilterRule{BridgeName: "^br-ex$"}},
+		{"bad regexp", BridgeFilterRule{Name: "r", BridgeName: "br-("}},
+		{"no criteria", BridgeFilterRule{Name: "r"}},
+	}
+	for _, test := range tests {
+		if _, err := filterCompile([]BridgeFilterRule{test.rule}); err == nil {
+			t.Errorf("%s: filterCompile accepted %+v", test.name, test.rule)
+		}
+	}
+}
+
+func TestFilterBridgeAndInterface(t *testing.T) {
+	filters, err := filterCompile([]BridgeFilterRule{
+		{Name: "netdev", DatapathType: "netdev"},
+		{Name: "tunnels", BridgeName: "^br-tun$", InterfaceType: "vxlan"},
+		{Name: "taps", PortPrefixes: []string{"tap", "qvo"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bridgeTests := []struct {
+		bridge OvsBridge
+		rule   string
+	}{
+		{OvsBridge{Name: "br-phy", DatapathType: "netdev"}, "netdev"},
+		{OvsBridge{Name: "br-tun", DatapathType: "system"}, ""},
+	}
+	for _, test := range bridgeTests {
+		if rule := filterBridge(filters, test.bridge); rule != test.rule {
+			t.Errorf("bridge %s hidden by %q, want %q", test.bridge.Name, rule, test.rule)
+		}
+	}
+
+	tun := OvsBridge{Name: "br-tun"}
+	integration := OvsBridge{Name: "br-int"}
+	interfaceTests := []struct {
+		bridge OvsBridge
+		iface  OvsInterface
+		port   OvsPort
+		rule   string
+	}{
+		{tun, OvsInterface{Name: "vxlan-0a000002", Type: "vxlan"}, OvsPort{Name: "vxlan-0a000002"}, "tunnels"},
+		{integration, OvsInterface{Name: "vxlan-0a000002", Type: "vxlan"}, OvsPort{Name: "vxlan-0a000002"}, ""},
+		{tun, OvsInterface{Name: "patch-int", Type: "patch"}, OvsPort{Name: "patch-int"}, ""},
+		{integration, OvsInterface{Name: "qvo1"}, OvsPort{Name: "qvo1"}, "taps"},
+		{integration, OvsInterface{Name: "tap3"}, OvsPort{}, "taps"},
+	}
+	for _, test := range interfaceTests {
+		if rule := filterInterface(filters, test.bridge, test.iface, test.port); rule != test.rule {
+			t.Errorf("%s on %s hidden by %q, want %q", test.iface.Name, test.bridge.Name, rule, test.rule)
+		}
+	}
+}
+
+func TestFilterGetRulesFallsBack(t *testing.T) {
+	filters := cfg.Filters
+	defer func() { cfg.Filters = filters }()
+	perCloud := []BridgeFilterRule{{Name: "c1-only", BridgeName: "^br-phy$"}}
+	global := []BridgeFilterRule{{Name: "global", BridgeName: "^br-ex$"}}
+
+	if rules := filterGetRules("c1"); len(rules) != len(filterDefaultRules) || rules[0].Name != filterDefaultRules[0].Name {
+		t.Errorf("rules without configuration %+v, want the defaults", rules)
+	}
+	cfg.Filters.Rules = global
+	cfg.Filters.Clouds = []CloudBridgeFilter{{Cloud: "c1", Rules: perCloud}}
+	if rules := filterGetRules("c1"); len(rules) != 1 || rules[0].Name != "c1-only" {
+		t.Errorf("c1 rules %+v, want its own", rules)
+	}
+	if rules := filterGetRules("c2"); len(rules) != 1 || rules[0].Name != "global" {
+		t.Errorf("c2 rules %+v, want the global ones", rules)
+	}
+}
+
+func TestFilterParseValues(t *testing.T) {
+	if rules := filterParseValues(url.Values{"name": {"x"}}); rules != nil {
+		t.Errorf("rules %+v without filter_* parameters, want none", rules)
+	}
+	rules := filterParseValues(url.Values{"filter_bridge_name": {"^br-ex$"}, "filter_port_prefixes": {"tap,qvo"}})
+	if len(rules) != 1 || rules[0].Name != filterQueryRuleName || rules[0].BridgeName != "^br-ex$" || len(rules[0].PortPrefixes) != 2 {
+		t.Errorf("rules %+v, want one query rule", rules)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"github.com/SpirentOrion/luddite"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// testFixtureTime is when the fixture's counter samples were taken.
+var testFixtureTime = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// testFixture replaces what discovery would have loaded with two clouds.
+// Cloud c1 has hypervisors hv1 and hv2 that are up and hv3 that is down;
+// hv1 has the host name the first filtered views were written against.
+// Both up hypervisors have br-int, br-tun, br-ex and br-phy, with br-ex
+// holding a patch port whose peer does not exist. On hv1, vRouter1 has a
+// vNIC behind a linux bridge, a vhostuser vNIC and a tap on br-int, and vm2
+// has a vNIC behind a linux bridge. On hv2, net-a has a vNIC behind a linux
+// bridge. The returned function removes the store directory.
+func testFixture() func() {
+	if service == nil {
+		service, _ = luddite.NewService(&cfg.Service)
+	}
+	storePath, _ := ioutil.TempDir("", "topology")
+	cfg.Store.Path = storePath
+	cfg.Stats.LinkSpeedMbps = 10000
+	cfg.Stats.Samples = 6
+	cfg.Stats.Thresholds = []StatsThreshold{{0, "#00CC00", 1}, {0.00001, "#FFCC00", 3}, {0.8, "#FF0000", 5}}
+	cfg.Placement.RecentWindow = 1 << 31
+
+	clouds = []CloudInfo{
+		{Name: "c1", AuthUrl: "http://a:5000/v3", Tenant: "admin", Provider: "openstack"},
+		{Name: "c2", AuthUrl: "http://b:5000/v3", Tenant: "other", Provider: "openstack"},
+	}
+	cloudHypervisors = map[string][]CloudHypervisorInfo{
+		"c1": {
+			{ID: "1", Name: "hv1", HostIP: "10.0.0.1", HostName: "compute-node.spirent.com", State: "up"},
+			{ID: "2", Name: "hv2", HostIP: "10.0.0.2", HostName: "hv2.local", State: "up"},
+			{ID: "3", Name: "hv3", HostIP: "10.0.0.3", HostName: "hv3.local", State: "down"},
+		},
+	}
+	cloudHypervisorNames = map[string]map[string]string{
+		"c1": {"10.0.0.1": "hv1", "10.0.0.2": "hv2", "10.0.0.3": "hv3"},
+	}
+	cloudInstances = map[string][]CloudInstanceInfo{
+		"c1": {
+			{ID: "u1", Name: "vRouter1", HostName: "compute-node.spirent.com"},
+			{ID: "u2", Name: "vm2", HostName: "compute-node.spirent.com"},
+			{ID: "u3", Name: "net-a", HostName: "hv2.local"},
+		},
+	}
+	cloudNetworks = map[string][]CloudNetworkInfo{
+		"c1": {{ID: "n1", Name: "net-a"}, {ID: "n2", Name: "net-b"}, {ID: "n4", Name: "unused"}},
+	}
+	cloudNetworkPorts = make(map[string][]CloudNetworkPortInfo)
+	cloudProjects = make(map[string][]CloudProjectInfo)
+
+	libvirtDomainInstances = map[string][]LibvirtDomainInstance{
+		"10.0.0.1": {
+			{UUID: "u1", Name: "instance-1", InstanceName: "vRouter1", HypervisorName: "hv1", Interfaces: []LibvirtDomainInterface{
+				{MacAddress: "fa:16:00:00:00:01", Type: "bridge", DevName: "tap1", BridgeName: "qbr1", NetworkName: "net-a"},
+				{MacAddress: "fa:16:00:00:00:02", Type: "vhostuser", NetworkName: "net-b"},
+				{MacAddress: "fa:16:00:00:00:03", Type: "bridge", DevName: "tap3", BridgeName: "br-int", NetworkName: "net-a"},
+			}},
+			{UUID: "u2", Name: "instance-2", InstanceName: "vm2", HypervisorName: "hv1", Interfaces: []LibvirtDomainInterface{
+				{MacAddress: "fa:16:00:00:00:04", Type: "bridge", DevName: "tap4", BridgeName: "qbr4", NetworkName: "net-a"},
+			}},
+		},
+		"10.0.0.2": {
+			{UUID: "u3", Name: "instance-3", InstanceName: "net-a", HypervisorName: "hv2", Interfaces: []LibvirtDomainInterface{
+				{MacAddress: "fa:16:00:00:00:05", Type: "bridge", DevName: "tap5", BridgeName: "qbr5", NetworkName: "net-a"},
+			}},
+		},
+	}
+	libvirtPhysicalInterfaces = map[string][]LibvirtPhysicalInterface{
+		"10.0.0.1": {{Name: "eth0", MacAddress: "00:00:00:00:00:e0"}, {Name: "eth1", MacAddress: "00:00:00:00:00:e1"}},
+		"10.0.0.2": {{Name: "eth0", MacAddress: "00:00:00:00:01:e0"}},
+	}
+
+	ovsBridges = make(map[string][]OvsBridge)
+	ovsPorts = make(map[string][]OvsPort)
+	ovsInterfaces = make(map[string][]OvsInterface)
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2"} {
+		ovsBridges[ip] = []OvsBridge{
+			{UUID: ip + "b1", Name: "br-int", PortUUIDs: []string{ip + "p1", ip + "p2", ip + "p3", ip + "p7"}},
+			{UUID: ip + "b2", Name: "br-tun", PortUUIDs: []string{ip + "p4"}},
+			{UUID: ip + "b3", Name: "br-ex", PortUUIDs: []string{ip + "p5"}},
+			{UUID: ip + "b4", Name: "br-phy", PortUUIDs: []string{ip + "p6", ip + "p8", ip + "p9"}},
+		}
+		ovsPorts[ip] = []OvsPort{
+			{UUID: ip + "p1", Name: "qvo1", InterfaceUUIDs: []string{ip + "i1"}},
+			{UUID: ip + "p2", Name: "patch-tun", InterfaceUUIDs: []string{ip + "i2"}},
+			{UUID: ip + "p3", Name: "int-br-phy", InterfaceUUIDs: []string{ip + "i3"}},
+			{UUID: ip + "p4", Name: "patch-int", InterfaceUUIDs: []string{ip + "i4"}},
+			{UUID: ip + "p5", Name: "ex-dangling", InterfaceUUIDs: []string{ip + "i5"}},
+			{UUID: ip + "p6", Name: "phy-br-int", InterfaceUUIDs: []string{ip + "i6"}},
+			{UUID: ip + "p7", Name: "tap3", InterfaceUUIDs: []string{ip + "i7"}},
+			{UUID: ip + "p8", Name: "dpdk0", InterfaceUUIDs: []string{ip + "i8"}},
+			{UUID: ip + "p9", Name: "eth0", InterfaceUUIDs: []string{ip + "i9"}},
+		}
+		ovsInterfaces[ip] = []OvsInterface{
+			{UUID: ip + "i1", Name: "qvo1", ExternalIDs: map[string]string{"attached-mac": "fa:16:00:00:00:01"}},
+			{UUID: ip + "i2", Name: "patch-tun", Type: "patch", Options: map[string]string{"peer": "patch-int"}},
+			{UUID: ip + "i3", Name: "int-br-phy", Type: "patch", Options: map[string]string{"peer": "phy-br-int"}},
+			{UUID: ip + "i4", Name: "patch-int", Type: "patch", Options: map[string]string{"peer": "patch-tun"}},
+			{UUID: ip + "i5", Name: "ex-dangling", Type: "patch", Options: map[string]string{"peer": "missing"}},
+			{UUID: ip + "i6", Name: "phy-br-int", Type: "patch", Options: map[string]string{"peer": "int-br-phy"}},
+			{UUID: ip + "i7", Name: "tap3", ExternalIDs: map[string]string{"attached-mac": "fa:16:00:00:00:03"}},
+			{UUID: ip + "i8", Name: "dpdk0", Type: "dpdk", MacAddressInUse: "00:00:00:00:00:d0"},
+			{UUID: ip + "i9", Name: "eth0", MacAddressInUse: "00:00:00:00:00:e0"},
+		}
+	}
+	ovsBridges["10.0.0.1"][0].PortUUIDs = append(ovsBridges["10.0.0.1"][0].PortUUIDs, "10.0.0.1p10")
+	ovsPorts["10.0.0.1"] = append(ovsPorts["10.0.0.1"], OvsPort{UUID: "10.0.0.1p10", Name: "vhu2", InterfaceUUIDs: []string{"10.0.0.1i10"}})
+	ovsInterfaces["10.0.0.1"] = append(ovsInterfaces["10.0.0.1"], OvsInterface{UUID: "10.0.0.1i10", Name: "vhu2", Type: "dpdkvhostuserclient", ExternalIDs: map[string]string{"attached-mac": "fa:16:00:00:00:02"}})
+
+	statsSamples = make(map[string][]StatsSample)
+	historySeries = make(map[string][]HistoryTier)
+	placementHistory = make(map[string]*InstancePlacementHistory)
+	alertActive = make(map[string]Alert)
+	alertInstances = make(map[string]map[string]alertInstancePlacement)
+	savedLayouts = make(map[string]SavedLayout)
+	testBeds = make(map[string]TestBed)
+	graphInvalidate()
+
+	return func() {
+		os.RemoveAll(storePath)
+	}
+}
+
+// testFixtureStats records two counter samples ten seconds apart: 800 kb/s
+// received on the tap1 vNIC and the qvo1 port behind it, 10 drops a second
+// on qvo1 and 80 b/s sent on dpdk0, all on hv1.
+func testFixtureStats() {
+	t0 := testFixtureTime
+	t1 := t0.Add(10 * time.Second)
+	statsRecordLibvirtSample("10.0.0.1", "tap1", map[string]int64{"rx_bytes": 0}, t0)
+	statsRecordLibvirtSample("10.0.0.1", "tap1", map[string]int64{"rx_bytes": 1000000}, t1)
+	statsRecordOvsSample("10.0.0.1", "qvo1", map[string]float64{"rx_bytes": 0, "rx_dropped": 0}, t0)
+	statsRecordOvsSample("10.0.0.1", "qvo1", map[string]float64{"rx_bytes": 1000000, "rx_dropped": 100}, t1)
+	statsRecordOvsSample("10.0.0.1", "dpdk0", map[string]float64{"tx_bytes": 0}, t0)
+	statsRecordOvsSample("10.0.0.1", "dpdk0", map[string]float64{"tx_bytes": 100}, t1)
+}
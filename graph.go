@@ -0,0 +1,641 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	graphEntityCloud        = "cloud"
+	graphEntityHypervisor   = "hypervisor"
+	graphEntityInstance     = "instance"
+	graphEntityVnic         = "vnic"
+	graphEntityBridge       = "bridge"
+	graphEntityPort         = "port"
+	graphEntityInterface    = "interface"
+	graphEntityNetwork      = "network"
+	graphEntityPhysicalNic  = "physical_nic"
+	graphRelationContains   = "contains"
+	graphRelationPatch      = "patch"
+	graphRelationAttachment = "attachment"
+	graphRelationUplink     = "uplink"
+	graphRelationNetwork    = "network"
+)
+
+// GraphEntity is one discovered object. Only the field matching Kind is set,
+// and Project for instances and networks. Key addresses it within the graph;
+// UID names it across requests and clouds by the identifiers the cloud,
+// libvirt and OVSDB assign.
+type GraphEntity struct {
+	Key      string
+	UID      string
+	Kind     string
+	Name     string
+	HostIP   string
+	Parent   string
+	Children []string
+
+	Cloud       CloudInfo
+	Hypervisor  CloudHypervisorInfo
+	Instance    LibvirtDomainInstance
+	Vnic        LibvirtDomainInterface
+	Network     CloudNetworkInfo
+	Bridge      OvsBridge
+	Port        OvsPort
+	Interface   OvsInterface
+	PhysicalNic LibvirtPhysicalInterface
+	Project     CloudProjectInfo
+}
+
+// GraphRelation links two entities. OVS relations end on bridges and keep
+// the connection they were resolved from; Target is empty for a patch whose
+// peer was not found.
+type GraphRelation struct {
+	Kind       string
+	Source     string
+	Target     string
+	HostIP     string
+	Connection *OvsBridgeConnection
+}
+
+// TopologyGraph is the entity/relationship model of one cloud, built once
+// per discovery snapshot. Views are projections over it.
+type TopologyGraph struct {
+	Cloud     CloudInfo
+	Root      string
+	Entities  map[string]*GraphEntity
+	Relations []GraphRelation
+	outgoing  map[string][]int
+	uids      map[string]bool
+	lint      *WiringLint
+	projects  []string
+}
+
+var graphCache map[string]*TopologyGraph = make(map[string]*TopologyGraph)
+var graphLock sync.Mutex
+
+func graphCloudKey(cloudName string) string {
+	return graphEntityCloud + "/" + cloudName
+}
+
+func graphHypervisorKey(ipAddress string) string {
+	return graphEntityHypervisor + "/" + ipAddress
+}
+
+func graphInstanceKey(ipAddress string, uuid string) string {
+	return graphEntityInstance + "/" + ipAddress + "/" + uuid
+}
+
+func graphVnicKey(ipAddress string, uuid string, index int) string {
+	return graphEntityVnic + "/" + ipAddress + "/" + uuid + "/" + strconv.Itoa(index)
+}
+
+func graphBridgeKey(ipAddress string, name string) string {
+	return graphEntityBridge + "/" + ipAddress + "/" + name
+}
+
+func graphPortKey(ipAddress string, uuid string) string {
+	return graphEntityPort + "/" + ipAddress + "/" + uuid
+}
+
+func graphInterfaceKey(ipAddress string, name string) string {
+	return graphEntityInterface + "/" + ipAddress + "/" + name
+}
+
+func graphNetworkKey(cloudName string, id string) string {
+	return graphEntityNetwork + "/" + cloudName + "/" + id
+}
+
+func graphPhysicalNicKey(ipAddress string, name string) string {
+	return graphEntityPhysicalNic + "/" + ipAddress + "/" + name
+}
+
+// graphEntityUID derives the UID from the cloud and the entity's own id:
+// Nova hypervisor ids, libvirt domain UUIDs, OVSDB _uuids and Neutron ids.
+// vNICs and physical NICs have none and go by their MAC address or name
+// under their instance or hypervisor.
+func graphEntityUID(cloudName string, e *GraphEntity, parent *GraphEntity) string {
+	id := ""
+	switch e.Kind {
+	case graphEntityCloud:
+		return graphCloudKey(cloudName)
+	case graphEntityHypervisor:
+		id = e.Hypervisor.ID
+	case graphEntityInstance:
+		id = e.Instance.UUID
+	case graphEntityVnic:
+		if parent != nil && len(parent.Instance.UUID) > 0 && len(e.Vnic.MacAddress) > 0 {
+			id = parent.Instance.UUID + "/" + e.Vnic.MacAddress
+		}
+	case graphEntityBridge:
+		id = e.Bridge.UUID
+	case graphEntityPort:
+		id = e.Port.UUID
+	case graphEntityInterface:
+		id = e.Interface.UUID
+	case graphEntityNetwork:
+		id = e.Network.ID
+	case graphEntityPhysicalNic:
+		if parent != nil && len(parent.Hypervisor.ID) > 0 {
+			id = parent.Hypervisor.ID + "/" + e.PhysicalNic.Name
+		}
+	}
+	if len(id) == 0 {
+		// Fall back on the host scoped key.
+		id = strings.TrimPrefix(e.Key, e.Kind+"/")
+	}
+	return e.Kind + "/" + cloudName + "/" + id
+}
+
+func (g *TopologyGraph) addEntity(parent string, entity GraphEntity) *GraphEntity {
+	// Discovery can report the same name twice (e.g. a DPDK port that is
+	// also a libvirt interface); keep both so the views match the data.
+	key := entity.Key
+	for i := 2; g.Entities[key] != nil; i++ {
+		key = entity.Key + "#" + strconv.Itoa(i)
+	}
+	entity.Key = key
+	entity.Parent = parent
+	uid := graphEntityUID(g.Cloud.Name, &entity, g.Entities[parent])
+	entity.UID = uid
+	for i := 2; g.uids[entity.UID]; i++ {
+		entity.UID = uid + "#" + strconv.Itoa(i)
+	}
+	g.uids[entity.UID] = true
+	e := &entity
+	g.Entities[key] = e
+	if p, ok := g.Entities[parent]; ok {
+		p.Children = append(p.Children, key)
+		g.addRelation(GraphRelation{
+			Kind:   graphRelationContains,
+			Source: parent,
+			Target: key,
+			HostIP: entity.HostIP,
+		})
+	}
+	return e
+}
+
+func (g *TopologyGraph) addRelation(relation GraphRelation) {
+	g.Relations = append(g.Relations, relation)
+	g.outgoing[relation.Source] = append(g.outgoing[relation.Source], len(g.Relations)-1)
+}
+
+func (g *TopologyGraph) Entity(key string) *GraphEntity {
+	return g.Entities[key]
+}
+
+// Children returns the children of key of the given kind in discovery order.
+func (g *TopologyGraph) Children(key string, kind string) []*GraphEntity {
+	var children []*GraphEntity
+	if e, ok := g.Entities[key]; ok {
+		for _, childKey := range e.Children {
+			if child := g.Entities[childKey]; child.Kind == kind {
+				children = append(children, child)
+			}
+		}
+	}
+	return children
+}
+
+// Outgoing returns the first relation of the given kind leaving key.
+func (g *TopologyGraph) Outgoing(key string, kind string) *GraphRelation {
+	for _, i := range g.outgoing[key] {
+		if g.Relations[i].Kind == kind {
+			return &g.Relations[i]
+		}
+	}
+	return nil
+}
+
+// HostRelations returns the relations of the given kind on one hypervisor
+// in discovery order.
+func (g *TopologyGraph) HostRelations(ipAddress string, kind string) []GraphRelation {
+	var relations []GraphRelation
+	for _, relation := range g.Relations {
+		if relation.Kind == kind && relation.HostIP == ipAddress {
+			relations = append(relations, relation)
+		}
+	}
+	return relations
+}
+
+func (g *TopologyGraph) Hypervisors() []*GraphEntity {
+	return g.Children(g.Root, graphEntityHypervisor)
+}
+
+func (g *TopologyGraph) Networks() []*GraphEntity {
+	return g.Children(g.Root, graphEntityNetwork)
+}
+
+func (g *TopologyGraph) FindHypervisor(name string) *GraphEntity {
+	for _, hypervisor := range g.Hypervisors() {
+		if hypervisor.Hypervisor.Name == name {
+			return hypervisor
+		}
+	}
+	return nil
+}
+
+func (g *TopologyGraph) FindHypervisorByHostName(hostName string) *GraphEntity {
+	for _, hypervisor := range g.Hypervisors() {
+		if hypervisor.Hypervisor.HostName == hostName {
+			return hypervisor
+		}
+	}
+	return nil
+}
+
+func (g *TopologyGraph) FindInstance(hypervisor *GraphEntity, instanceName string) *GraphEntity {
+	for _, instance := range g.Children(hypervisor.Key, graphEntityInstance) {
+		if instance.Instance.InstanceName == instanceName {
+			return instance
+		}
+	}
+	return nil
+}
+
+func (g *TopologyGraph) FindNetwork(name string) *GraphEntity {
+	for _, network := range g.Networks() {
+		if network.Network.Name == name {
+			return network
+		}
+	}
+	return nil
+}
+
+// Select returns the subgraph limited to the selected hypervisors and
+// instances. A host without instance names keeps all of its instances;
+// networks are kept whatever is selected.
+func (g *TopologyGraph) Select(selections []HypervisorInstanceNames) *TopologyGraph {
+	dropped := make(map[string]bool)
+	for _, hypervisor := range g.Hypervisors() {
+		var selection *HypervisorInstanceNames
+		for i := range selections {
+			if selections[i].HostName == hypervisor.Hypervisor.HostName {
+				selection = &selections[i]
+				break
+			}
+		}
+		if selection == nil {
+			g.dropSubtree(dropped, hypervisor.Key)
+			continue
+		}
+		if len(selection.InstanceNames) == 0 {
+			continue
+		}
+		for _, instance := range g.Children(hypervisor.Key, graphEntityInstance) {
+			if !queryContains(selection.InstanceNames, instance.Name) {
+				g.dropSubtree(dropped, instance.Key)
+			}
+		}
+	}
+
+	return g.without(dropped)
+}
+
+// SelectProjects limits the graph to the instances and networks of the
+// projects, named by ID or name, and the infrastructure they touch: the
+// networks their vNICs are on, and the hypervisors they run on without the
+// OVS ports of other projects' instances.
+func (g *TopologyGraph) SelectProjects(projects []string) *TopologyGraph {
+	dropped := make(map[string]bool)
+	droppedUUIDs := make(map[string]bool)
+	droppedMacs := make(map[string]bool)
+	usedNetworks := make(map[string]bool)
+	for _, hypervisor := range g.Hypervisors() {
+		kept := false
+		for _, instance := range g.Children(hypervisor.Key, graphEntityInstance) {
+			if graphProjectSelected(instance.Project, projects) {
+				kept = true
+				for _, vnic := range g.Children(instance.Key, graphEntityVnic) {
+					if relation := g.Outgoing(vnic.Key, graphRelationNetwork); relation != nil {
+						usedNetworks[relation.Target] = true
+					}
+				}
+				continue
+			}
+			droppedUUIDs[instance.Instance.UUID] = true
+			for _, vnic := range g.Children(instance.Key, graphEntityVnic) {
+				droppedMacs[strings.ToLower(vnic.Vnic.MacAddress)] = true
+			}
+			g.dropSubtree(dropped, instance.Key)
+		}
+		if !kept {
+			g.dropSubtree(dropped, hypervisor.Key)
+		}
+	}
+	for _, network := range g.Networks() {
+		if !usedNetworks[network.Key] && !graphProjectSelected(network.Project, projects) {
+			dropped[network.Key] = true
+		}
+	}
+	for _, hypervisor := range g.Hypervisors() {
+		if dropped[hypervisor.Key] {
+			continue
+		}
+		for _, bridge := range g.Children(hypervisor.Key, graphEntityBridge) {
+			for _, port := range g.Children(bridge.Key, graphEntityPort) {
+				for _, iface := range g.Children(port.Key, graphEntityInterface) {
+					externalIDs := iface.Interface.ExternalIDs
+					if droppedUUIDs[externalIDs["vm-uuid"]] || droppedMacs[strings.ToLower(externalIDs["attached-mac"])] {
+						g.dropSubtree(dropped, port.Key)
+						break
+					}
+				}
+			}
+		}
+	}
+	s := g.without(dropped)
+	s.projects = projects
+	return s
+}
+
+// HasInterface reports whether the graph keeps the OVS interface or the
+// instance vNIC a statistics source names on a host.
+func (g *TopologyGraph) HasInterface(ipAddress string, source string, name string) bool {
+	if source == statsSourceOvs {
+		return g.Entity(graphInterfaceKey(ipAddress, name)) != nil
+	}
+	for _, instance := range g.Children(graphHypervisorKey(ipAddress), graphEntityInstance) {
+		for _, vnic := range g.Children(instance.Key, graphEntityVnic) {
+			if len(vnic.Vnic.DevName) > 0 && vnic.Vnic.DevName == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HasInstance reports whether the cloud lists an instance in the selected
+// projects, running or not.
+func (g *TopologyGraph) HasInstance(uuid string) bool {
+	for _, instance := range g.NovaInstances() {
+		if instance.ID == uuid {
+			return true
+		}
+	}
+	return false
+}
+
+// NovaInstances returns the instances the cloud lists, limited to the
+// selected projects.
+func (g *TopologyGraph) NovaInstances() []CloudInstanceInfo {
+	var instances []CloudInstanceInfo
+	for _, instance := range cloudGetIntanceList(&g.Cloud) {
+		if g.projects == nil || graphProjectSelected(CloudProjectInfo{instance.ProjectID, instance.ProjectName}, g.projects) {
+			instances = append(instances, instance)
+		}
+	}
+	return instances
+}
+
+// NetworkPorts returns the Neutron ports the cloud lists, limited to the
+// selected projects.
+func (g *TopologyGraph) NetworkPorts() []CloudNetworkPortInfo {
+	var ports []CloudNetworkPortInfo
+	for _, port := range cloudGetNetworkPortList(&g.Cloud) {
+		if g.projects == nil || graphProjectSelected(CloudProjectInfo{port.ProjectID, port.ProjectName}, g.projects) {
+			ports = append(ports, port)
+		}
+	}
+	return ports
+}
+
+func graphProjectSelected(project CloudProjectInfo, projects []string) bool {
+	return (len(project.ID) > 0 && queryContains(projects, project.ID)) || (len(project.Name) > 0 && queryContains(projects, project.Name))
+}
+
+// without copies the graph leaving out the dropped entities and their
+// relations.
+func (g *TopologyGraph) without(dropped map[string]bool) *TopologyGraph {
+	s := &TopologyGraph{
+		Cloud:    g.Cloud,
+		Root:     g.Root,
+		Entities: make(map[string]*GraphEntity, len(g.Entities)),
+		outgoing: make(map[string][]int),
+		uids:     make(map[string]bool),
+	}
+	for key, entity := range g.Entities {
+		if dropped[key] {
+			continue
+		}
+		e := *entity
+		e.Children = nil
+		for _, childKey := range entity.Children {
+			if !dropped[childKey] {
+				e.Children = append(e.Children, childKey)
+			}
+		}
+		s.Entities[key] = &e
+	}
+	for _, relation := range g.Relations {
+		if !dropped[relation.Source] && !dropped[relation.Target] {
+			s.addRelation(relation)
+		}
+	}
+	s.lint = lintWiring(s)
+	s.projects = g.projects
+	return s
+}
+
+func (g *TopologyGraph) dropSubtree(dropped map[string]bool, key string) {
+	dropped[key] = true
+	for _, childKey := range g.Entities[key].Children {
+		g.dropSubtree(dropped, childKey)
+	}
+}
+
+func graphBuild(cloudInfo *CloudInfo) *TopologyGraph {
+	g := &TopologyGraph{
+		Cloud:    *cloudInfo,
+		Root:     graphCloudKey(cloudInfo.Name),
+		Entities: make(map[string]*GraphEntity),
+		outgoing: make(map[string][]int),
+		uids:     make(map[string]bool),
+	}
+	g.addEntity("", GraphEntity{
+		Key:   g.Root,
+		Kind:  graphEntityCloud,
+		Name:  cloudInfo.Name,
+		Cloud: *cloudInfo,
+	})
+
+	for _, network := range cloudGetNetworkList(cloudInfo) {
+		g.addEntity(g.Root, GraphEntity{
+			Key:     graphNetworkKey(cloudInfo.Name, network.ID),
+			Kind:    graphEntityNetwork,
+			Name:    network.Name,
+			Network: network,
+			Project: CloudProjectInfo{network.ProjectID, network.ProjectName},
+		})
+	}
+
+	for _, hypervisor := range cloudGetHypervisorList(cloudInfo) {
+		hypervisorKey := g.addEntity(g.Root, GraphEntity{
+			Key:        graphHypervisorKey(hypervisor.HostIP),
+			Kind:       graphEntityHypervisor,
+			Name:       hypervisor.Name,
+			HostIP:     hypervisor.HostIP,
+			Hypervisor: hypervisor,
+		}).Key
+		graphBuildOvs(g, hypervisorKey, hypervisor.HostIP)
+		graphBuildInstances(g, hypervisorKey, hypervisor.HostIP)
+
+		for _, iface := range libvirtGetPhysicalInterfaces(hypervisor.HostIP) {
+			nicKey := g.addEntity(hypervisorKey, GraphEntity{
+				Key:         graphPhysicalNicKey(hypervisor.HostIP, iface.Name),
+				Kind:        graphEntityPhysicalNic,
+				Name:        iface.Name,
+				HostIP:      hypervisor.HostIP,
+				PhysicalNic: iface,
+			}).Key
+			if bc := ovsGetPhysicalPortConnection(hypervisor.HostIP, iface.Name, iface.MacAddress); bc != nil {
+				g.addRelation(GraphRelation{
+					Kind:       graphRelationUplink,
+					Source:     nicKey,
+					Target:     graphBridgeKey(hypervisor.HostIP, bc.SourceBridge.Name),
+					HostIP:     hypervisor.HostIP,
+					Connection: bc,
+				})
+			}
+		}
+	}
+	g.lint = lintWiring(g)
+	return g
+}
+
+func graphBuildOvs(g *TopologyGraph, hypervisorKey string, ipAddress string) {
+	ports := ovsGetPorts(ipAddress)
+	interfaces := ovsGetInterfaces(ipAddress)
+	for _, bridge := range ovsGetBridges(ipAddress) {
+		bridgeKey := g.addEntity(hypervisorKey, GraphEntity{
+			Key:    graphBridgeKey(ipAddress, bridge.Name),
+			Kind:   graphEntityBridge,
+			Name:   bridge.Name,
+			HostIP: ipAddress,
+			Bridge: bridge,
+		}).Key
+		for _, portUUID := range bridge.PortUUIDs {
+			for _, port := range ports {
+				if port.UUID != portUUID {
+					continue
+				}
+				portKey := g.addEntity(bridgeKey, GraphEntity{
+					Key:    graphPortKey(ipAddress, port.UUID),
+					Kind:   graphEntityPort,
+					Name:   port.Name,
+					HostIP: ipAddress,
+					Port:   port,
+				}).Key
+				for _, iface := range interfaces {
+					if !graphPortHasInterface(port, iface) {
+						continue
+					}
+					g.addEntity(portKey, GraphEntity{
+						Key:       graphInterfaceKey(ipAddress, iface.Name),
+						Kind:      graphEntityInterface,
+						Name:      iface.Name,
+						HostIP:    ipAddress,
+						Interface: iface,
+					})
+				}
+				break
+			}
+		}
+	}
+
+	for _, bc := range ovsGetBridgeConnections(ipAddress) {
+		conn := bc
+		relation := GraphRelation{
+			Kind:       graphRelationPatch,
+			Source:     graphBridgeKey(ipAddress, bc.SourceBridge.Name),
+			HostIP:     ipAddress,
+			Connection: &conn,
+		}
+		if len(bc.TargetBridge.Name) > 0 {
+			relation.Target = graphBridgeKey(ipAddress, bc.TargetBridge.Name)
+		}
+		g.addRelation(relation)
+	}
+}
+
+func graphPortHasInterface(port OvsPort, iface OvsInterface) bool {
+	for _, uuid := range port.InterfaceUUIDs {
+		if uuid == iface.UUID {
+			return true
+		}
+	}
+	return len(port.InterfaceUUIDs) == 0 && port.Name == iface.Name
+}
+
+func graphBuildInstances(g *TopologyGraph, hypervisorKey string, ipAddress string) {
+	for _, instance := range libvirtGetDomainInstances(ipAddress) {
+		instanceKey := g.addEntity(hypervisorKey, GraphEntity{
+			Key:      graphInstanceKey(ipAddress, instance.UUID),
+			Kind:     graphEntityInstance,
+			Name:     instance.InstanceName,
+			HostIP:   ipAddress,
+			Instance: instance,
+			Project:  graphInstanceProject(g, instance.UUID),
+		}).Key
+		for i, iface := range instance.Interfaces {
+			vnicKey := g.addEntity(instanceKey, GraphEntity{
+				Key:    graphVnicKey(ipAddress, instance.UUID, i),
+				Kind:   graphEntityVnic,
+				Name:   iface.DevName,
+				HostIP: ipAddress,
+				Vnic:   iface,
+			}).Key
+			if network := g.FindNetwork(iface.NetworkName); network != nil {
+				g.addRelation(GraphRelation{
+					Kind:   graphRelationNetwork,
+					Source: vnicKey,
+					Target: network.Key,
+					HostIP: ipAddress,
+				})
+			}
+			if bc := ovsGetBridgeConnection(ipAddress, iface.MacAddress); bc != nil {
+				g.addRelation(GraphRelation{
+					Kind:       graphRelationAttachment,
+					Source:     vnicKey,
+					Target:     graphBridgeKey(ipAddress, bc.TargetBridge.Name),
+					HostIP:     ipAddress,
+					Connection: bc,
+				})
+			}
+		}
+	}
+}
+
+// graphInstanceProject returns the project Nova reports an instance in.
+func graphInstanceProject(g *TopologyGraph, uuid string) CloudProjectInfo {
+	for _, instance := range cloudGetIntanceList(&g.Cloud) {
+		if instance.ID == uuid {
+			return CloudProjectInfo{instance.ProjectID, instance.ProjectName}
+		}
+	}
+	return CloudProjectInfo{}
+}
+
+// graphGet returns the cached graph of a cloud, building it on first use
+// after discovery changed the underlying data.
+func graphGet(cloudInfo *CloudInfo) *TopologyGraph {
+	graphLock.Lock()
+	defer graphLock.Unlock()
+
+	if g, ok := graphCache[cloudInfo.Name]; ok {
+		return g
+	}
+	g := graphBuild(cloudInfo)
+	graphCache[cloudInfo.Name] = g
+	return g
+}
+
+func graphInvalidate() {
+	graphLock.Lock()
+	graphCache = make(map[string]*TopologyGraph)
+	graphLock.Unlock()
+	viewCacheInvalidate()
+}
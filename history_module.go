@@ -0,0 +1,397 @@
+package main
+
+import (
+	"github.com/SpirentOrion/httprouter"
+	log "github.com/SpirentOrion/logrus"
+	"github.com/SpirentOrion/luddite"
+	"golang.org/x/net/context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type HistoryPoint struct {
+	Time     time.Time          `json:"time,required"`
+	Samples  int                `json:"samples,required"`
+	Counters map[string]float64 `json:"counters,required"`
+	Rates    map[string]float64 `json:"rates,required"`
+}
+
+type HistoryTier struct {
+	Resolution int            `json:"resolution,required"`
+	Retention  int            `json:"retention,required"`
+	Points     []HistoryPoint `json:"points,required"`
+}
+
+type InterfaceHistory struct {
+	Cloud      string         `json:"cloud,required"`
+	Hypervisor string         `json:"hypervisor,required"`
+	Source     string         `json:"source,required"`
+	Name       string         `json:"name,required"`
+	Resolution int            `json:"resolution,required"`
+	Start      time.Time      `json:"start,required"`
+	End        time.Time      `json:"end,required"`
+	Points     []HistoryPoint `json:"points,required"`
+}
+
+const historyStoreName = "history.json"
+
+var historySeries map[string][]HistoryTier = make(map[string][]HistoryTier)
+var historyLock sync.RWMutex
+
+func historyRetention() []HistoryRetention {
+	if len(cfg.History.Retention) > 0 {
+		return cfg.History.Retention
+	}
+	return []HistoryRetention{
+		{Resolution: 10, Retention: 3600},
+		{Resolution: 60, Retention: 86400},
+		{Resolution: 900, Retention: 604800},
+	}
+}
+
+func historyRatesMap(rates InterfaceRates) map[string]float64 {
+	return map[string]float64{
+		"rx_bps":        rates.RxBps,
+		"tx_bps":        rates.TxBps,
+		"rx_pps":        rates.RxPps,
+		"tx_pps":        rates.TxPps,
+		"rx_drop_rate":  rates.RxDropRate,
+		"tx_drop_rate":  rates.TxDropRate,
+		"rx_error_rate": rates.RxErrorRate,
+		"tx_error_rate": rates.TxErrorRate,
+		"utilization":   rates.Utilization,
+	}
+}
+
+func historyRecord(key string, t time.Time, counters map[string]float64, rates InterfaceRates) {
+	if !cfg.History.Enabled {
+		return
+	}
+	rateMap := historyRatesMap(rates)
+
+	historyLock.Lock()
+	defer historyLock.Unlock()
+
+	tiers, ok := historySeries[key]
+	if !ok {
+		for _, r := range historyRetention() {
+			tiers = append(tiers, HistoryTier{Resolution: r.Resolution, Retention: r.Retention})
+		}
+	}
+	for i := range tiers {
+		tier := &tiers[i]
+		bucket := t.Truncate(time.Duration(tier.Resolution) * time.Second)
+		n := len(tier.Points)
+		if n > 0 && tier.Points[n-1].Time.Equal(bucket) {
+			// Average rates into the open bucket and keep the newest counters.
+			point := &tier.Points[n-1]
+			for k, v := range rateMap {
+				point.Rates[k] = (point.Rates[k]*float64(point.Samples) + v) / float64(point.Samples+1)
+			}
+			point.Counters = historyCopyMap(counters)
+			point.Samples++
+		} else {
+			point := HistoryPoint{
+				Time:     bucket,
+				Samples:  1,
+				Counters: historyCopyMap(counters),
+				Rates:    historyCopyMap(rateMap),
+			}
+			tier.Points = append(tier.Points, point)
+		}
+		historyTrimTier(tier, t)
+	}
+	historySeries[key] = tiers
+}
+
+func historyCopyMap(m map[string]float64) map[string]float64 {
+	c := make(map[string]float64, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// historyTrimTier drops the points of a tier older than its retention.
+func historyTrimTier(tier *HistoryTier, now time.Time) {
+	cutoff := now.Add(-time.Duration(tier.Retention) * time.Second)
+	j := 0
+	for j < len(tier.Points) && tier.Points[j].Time.Before(cutoff) {
+		j++
+	}
+	tier.Points = tier.Points[j:]
+}
+
+// historyTrim trims every series, dropping those left without points, so
+// interfaces that are gone do not keep their history. The caller holds the
+// write lock.
+func historyTrim(now time.Time) {
+	for key, tiers := range historySeries {
+		empty := true
+		for i := range tiers {
+			historyTrimTier(&tiers[i], now)
+			if len(tiers[i].Points) > 0 {
+				empty = false
+			}
+		}
+		if empty {
+			delete(historySeries, key)
+		}
+	}
+}
+
+func historyGetSeries(key string, start time.Time, end time.Time, resolution int) (int, []HistoryPoint) {
+	historyLock.RLock()
+	defer historyLock.RUnlock()
+
+	tiers := historySeries[key]
+	if len(tiers) == 0 {
+		return 0, make([]HistoryPoint, 0)
+	}
+
+	// Use the finest tier that still covers the start of the range, unless
+	// the caller asked for a specific resolution.
+	tier := &tiers[len(tiers)-1]
+	for i := range tiers {
+		if resolution > 0 {
+			if tiers[i].Resolution >= resolution {
+				tier = &tiers[i]
+				break
+			}
+			continue
+		}
+		if !start.Before(time.Now().Add(-time.Duration(tiers[i].Retention) * time.Second)) {
+			tier = &tiers[i]
+			break
+		}
+	}
+
+	// The points are copied since the open bucket keeps being updated after
+	// the lock is released.
+	points := make([]HistoryPoint, 0)
+	for _, point := range tier.Points {
+		if point.Time.Before(start) || point.Time.After(end) {
+			continue
+		}
+		point.Counters = historyCopyMap(point.Counters)
+		point.Rates = historyCopyMap(point.Rates)
+		points = append(points, point)
+	}
+	return tier.Resolution, points
+}
+
+func historyAverageRates(key string, start time.Time, end time.Time) (map[string]float64, bool) {
+	_, points := historyGetSeries(key, start, end, 0)
+	if len(points) == 0 {
+		return nil, false
+	}
+	rates := make(map[string]float64)
+	samples := 0
+	for _, point := range points {
+		for k, v := range point.Rates {
+			rates[k] += v * float64(point.Samples)
+		}
+		samples += point.Samples
+	}
+	for k := range rates {
+		rates[k] /= float64(samples)
+	}
+	return rates, true
+}
+
+func historyLoad() error {
+	historyLock.Lock()
+	defer historyLock.Unlock()
+
+	if err := storeLoad(historyStoreName, &historySeries); err != nil {
+		logFields := log.Fields{
+			"Path":  storePath(historyStoreName),
+			"Error": err.Error(),
+		}
+		service.Logger().WithFields(logFields).Error("Error loading interface statistics history")
+		return err
+	}
+	if historySeries == nil {
+		historySeries = make(map[string][]HistoryTier)
+	}
+	historyTrim(time.Now())
+	return nil
+}
+
+func historyFlush() error {
+	if !cfg.History.Enabled {
+		return nil
+	}
+	historyLock.Lock()
+	defer historyLock.Unlock()
+
+	historyTrim(time.Now())
+	if err := storeSave(historyStoreName, historySeries); err != nil {
+		logFields := log.Fields{
+			"Path":  storePath(historyStoreName),
+			"Error": err.Error(),
+		}
+		service.Logger().WithFields(logFields).Error("Error saving interface statistics history")
+		return err
+	}
+	return nil
+}
+
+func historyFlushLoop() {
+	interval := time.Duration(cfg.History.FlushInterval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+	for !shutdown {
+		time.Sleep(interval)
+		historyFlush()
+	}
+}
+
+func parseTimeParam(value string, defaultTime time.Time) (time.Time, error) {
+	if len(value) == 0 {
+		return defaultTime, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func writeInterfaceHistory(rw http.ResponseWriter, r *http.Request, cloudName string, hypervisor *CloudHypervisorInfo, source string, name string) {
+	if scope := authProjectGraph(r, cloudGetCloudInfo(cloudName)); scope != nil && !scope.HasInterface(hypervisor.HostIP, source, name) {
+		apiError := APIError{http.StatusNotFound, "Interface " + name + " for hypervisor " + hypervisor.Name + " Not discovered"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	query := r.URL.Query()
+	end, err := parseTimeParam(query.Get("end"), time.Now())
+	if err != nil {
+		apiError := APIError{http.StatusBadRequest, "Invalid end time " + query.Get("end")}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	start, err := parseTimeParam(query.Get("start"), end.Add(-time.Hour))
+	if err != nil {
+		apiError := APIError{http.StatusBadRequest, "Invalid start time " + query.Get("start")}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	resolution := 0
+	if len(query.Get("resolution")) > 0 {
+		resolution, err = strconv.Atoi(query.Get("resolution"))
+		if err != nil {
+			apiError := APIError{http.StatusBadRequest, "Invalid resolution " + query.Get("resolution")}
+			luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+			return
+		}
+	}
+
+	resolution, points := historyGetSeries(statsKey(source, hypervisor.HostIP, name), start, end, resolution)
+	interfaceHistory := InterfaceHistory{
+		Cloud:      cloudName,
+		Hypervisor: hypervisor.Name,
+		Source:     source,
+		Name:       name,
+		Resolution: resolution,
+		Start:      start,
+		End:        end,
+		Points:     points,
+	}
+	luddite.WriteResponse(rw, http.StatusOK, interfaceHistory)
+}
+
+func GetInstanceInterfaceHistory(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	cloudName := httprouter.ContextParams(ctx).ByName("cloud_name")
+	hypervisorName := httprouter.ContextParams(ctx).ByName("hypervisor_name")
+	instanceName := httprouter.ContextParams(ctx).ByName("instance_name")
+	interfaceName := httprouter.ContextParams(ctx).ByName("interface_name")
+	hypervisor := cloudGetHypervisorInfo(cloudName, hypervisorName)
+	if hypervisor == nil {
+		apiError := APIError{http.StatusNotFound, "Hypervisor " + hypervisorName + " for cloud " + cloudName + " Not discovered"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	instance := libvirtGetDomainInstance(hypervisor.HostIP, instanceName)
+	if instance == nil {
+		apiError := APIError{http.StatusNotFound, "Instance " + instanceName + " for hypervisor " + hypervisorName + " and cloud " + cloudName + " Not discovered"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	for _, iface := range instance.Interfaces {
+		if len(iface.DevName) > 0 && (iface.DevName == interfaceName || iface.MacAddress == interfaceName) {
+			writeInterfaceHistory(rw, r, cloudName, hypervisor, statsSourceLibvirt, iface.DevName)
+			return
+		}
+	}
+	apiError := APIError{http.StatusNotFound, "Interface " + interfaceName + " for instance " + instanceName + " Not discovered"}
+	luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+}
+
+func GetOvsInterfaceHistory(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	cloudName := httprouter.ContextParams(ctx).ByName("cloud_name")
+	hypervisorName := httprouter.ContextParams(ctx).ByName("hypervisor_name")
+	interfaceName := httprouter.ContextParams(ctx).ByName("interface_name")
+	hypervisor := cloudGetHypervisorInfo(cloudName, hypervisorName)
+	if hypervisor == nil {
+		apiError := APIError{http.StatusNotFound, "Hypervisor " + hypervisorName + " for cloud " + cloudName + " Not discovered"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	for _, iface := range ovsGetInterfaces(hypervisor.HostIP) {
+		if iface.Name == interfaceName {
+			writeInterfaceHistory(rw, r, cloudName, hypervisor, statsSourceOvs, iface.Name)
+			return
+		}
+	}
+	apiError := APIError{http.StatusNotFound, "OVS interface " + interfaceName + " for hypervisor " + hypervisorName + " Not discovered"}
+	luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+}
+
+// GetPhysicalInterfaceHistory serves the history of a physical NIC. Only OVS
+// and libvirt counters are polled, so the history is that of the OVS
+// interface of the same name, a system or dpdk port, and the response has
+// source "ovs". NICs not attached to OVS have none.
+func GetPhysicalInterfaceHistory(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	cloudName := httprouter.ContextParams(ctx).ByName("cloud_name")
+	hypervisorName := httprouter.ContextParams(ctx).ByName("hypervisor_name")
+	interfaceName := httprouter.ContextParams(ctx).ByName("interface_name")
+	hypervisor := cloudGetHypervisorInfo(cloudName, hypervisorName)
+	if hypervisor == nil {
+		apiError := APIError{http.StatusNotFound, "Hypervisor " + hypervisorName + " for cloud " + cloudName + " Not discovered"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	for _, iface := range libvirtGetPhysicalInterfaces(hypervisor.HostIP) {
+		if iface.Name != interfaceName {
+			continue
+		}
+		for _, ovsIface := range ovsGetInterfaces(hypervisor.HostIP) {
+			if ovsIface.Name == iface.Name {
+				writeInterfaceHistory(rw, r, cloudName, hypervisor, statsSourceOvs, iface.Name)
+				return
+			}
+		}
+		apiError := APIError{http.StatusNotFound, "Physical interface " + interfaceName + " for hypervisor " + hypervisorName + " is not attached to OVS and has no history"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	apiError := APIError{http.StatusNotFound, "Physical interface " + interfaceName + " for hypervisor " + hypervisorName + " Not discovered"}
+	luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+}
+
+func InitHistory(router *httprouter.Router) {
+	router.GET("/topology/history/instanceInterface/:cloud_name/:hypervisor_name/:instance_name/:interface_name", authorize(authRoleViewer, GetInstanceInterfaceHistory))
+	router.GET("/topology/history/ovsInterface/:cloud_name/:hypervisor_name/:interface_name", authorize(authRoleViewer, GetOvsInterfaceHistory))
+	router.GET("/topology/history/physicalInterface/:cloud_name/:hypervisor_name/:interface_name", authorize(authRoleViewer, GetPhysicalInterfaceHistory))
+
+	if cfg.History.Enabled {
+		historyLoad()
+		go historyFlushLoop()
+	}
+}
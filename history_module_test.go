@@ -0,0 +1,108 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// historyTestSetup enables history with two short tiers and returns a
+// function restoring the config.
+func historyTestSetup() func() {
+	enabled, retention := cfg.History.Enabled, cfg.History.Retention
+	cfg.History.Enabled = true
+	cfg.History.Retention = []HistoryRetention{
+		{Resolution: 10, Retention: 60},
+		{Resolution: 60, Retention: 3600},
+	}
+	historySeries = make(map[string][]HistoryTier)
+	return func() {
+		cfg.History.Enabled, cfg.History.Retention = enabled, retention
+		historySeries = make(map[string][]HistoryTier)
+	}
+}
+
+func TestHistoryRecordAveragesIntoBuckets(t *testing.T) {
+	defer historyTestSetup()()
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	historyRecord("k", t0, map[string]float64{"rx_bytes": 1}, InterfaceRates{RxBps: 100})
+	historyRecord("k", t0.Add(5*time.Second), map[string]float64{"rx_bytes": 2}, InterfaceRates{RxBps: 300})
+	historyRecord("k", t0.Add(15*time.Second), map[string]float64{"rx_bytes": 3}, InterfaceRates{RxBps: 600})
+
+	tiers := historySeries["k"]
+	if len(tiers) != 2 {
+		t.Fatalf("got %d tiers, want 2", len(tiers))
+	}
+	fine := tiers[0].Points
+	if len(fine) != 2 {
+		t.Fatalf("got %d points in the 10s tier, want 2", len(fine))
+	}
+	if fine[0].Samples != 2 || fine[0].Rates["rx_bps"] != 200 || fine[0].Counters["rx_bytes"] != 2 {
+		t.Errorf("first 10s bucket = %d samples, rx_bps %v, rx_bytes %v; want 2, 200, 2", fine[0].Samples, fine[0].Rates["rx_bps"], fine[0].Counters["rx_bytes"])
+	}
+	coarse := tiers[1].Points
+	if len(coarse) != 1 || coarse[0].Samples != 3 || coarse[0].Rates["rx_bps"] != 1000.0/3 {
+		t.Errorf("60s tier = %+v, want one bucket of 3 samples averaging 333.3", coarse)
+	}
+}
+
+func TestHistoryRecordTrimsRetention(t *testing.T) {
+	defer historyTestSetup()()
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	historyRecord("k", t0, nil, InterfaceRates{})
+	historyRecord("k", t0.Add(2*time.Minute), nil, InterfaceRates{})
+
+	tiers := historySeries["k"]
+	if len(tiers[0].Points) != 1 || !tiers[0].Points[0].Time.Equal(t0.Add(2*time.Minute)) {
+		t.Errorf("10s tier kept %d points, want only the newest", len(tiers[0].Points))
+	}
+	if len(tiers[1].Points) != 2 {
+		t.Errorf("60s tier kept %d points, want 2", len(tiers[1].Points))
+	}
+}
+
+func TestHistoryGetSeriesPicksTier(t *testing.T) {
+	defer historyTestSetup()()
+	now := time.Now()
+	historyRecord("k", now.Add(-20*time.Second), nil, InterfaceRates{RxBps: 1})
+	historyRecord("k", now, nil, InterfaceRates{RxBps: 1})
+
+	if resolution, points := historyGetSeries("k", now.Add(-30*time.Second), now, 0); resolution != 10 || len(points) == 0 {
+		t.Errorf("recent range got resolution %d with %d points, want 10", resolution, len(points))
+	}
+	if resolution, _ := historyGetSeries("k", now.Add(-2*time.Hour), now, 0); resolution != 60 {
+		t.Errorf("range older than the 10s retention got resolution %d, want 60", resolution)
+	}
+	if resolution, _ := historyGetSeries("k", now.Add(-30*time.Second), now, 30); resolution != 60 {
+		t.Errorf("requested resolution 30 got %d, want 60", resolution)
+	}
+	if resolution, points := historyGetSeries("missing", now.Add(-time.Hour), now, 0); resolution != 0 || points == nil || len(points) != 0 {
+		t.Errorf("unknown key got resolution %d and %v, want 0 and no points", resolution, points)
+	}
+}
+
+func TestHistoryGetSeriesCopiesPoints(t *testing.T) {
+	defer historyTestSetup()()
+	t0 := time.Now().Truncate(10 * time.Second)
+	historyRecord("k", t0, map[string]float64{"rx_bytes": 1}, InterfaceRates{RxBps: 100})
+	_, points := historyGetSeries("k", t0.Add(-time.Second), t0.Add(time.Second), 10)
+	historyRecord("k", t0.Add(time.Second), map[string]float64{"rx_bytes": 2}, InterfaceRates{RxBps: 300})
+
+	if len(points) != 1 || points[0].Rates["rx_bps"] != 100 || points[0].Counters["rx_bytes"] != 1 {
+		t.Errorf("returned point changed with the open bucket: %+v", points)
+	}
+}
+
+func TestHistoryTrimDropsStaleSeries(t *testing.T) {
+	defer historyTestSetup()()
+	now := time.Now()
+	historyRecord("gone", now.Add(-2*time.Hour), nil, InterfaceRates{})
+	historyRecord("live", now, nil, InterfaceRates{})
+
+	historyTrim(now)
+	if _, ok := historySeries["gone"]; ok {
+		t.Error("series with only expired points was kept")
+	}
+	if len(historySeries["live"]) != 2 {
+		t.Error("live series was dropped")
+	}
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"github.com/SpirentOrion/httprouter"
+	"github.com/SpirentOrion/luddite"
+	"golang.org/x/net/context"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	inventoryCheckNovaLibvirt = "nova_libvirt"
+	inventoryCheckNeutronVnic = "neutron_vnic"
+	inventoryCheckNeutronOvs  = "neutron_ovs"
+	inventoryCheckVhostUser   = "vhostuser"
+	inventoryCheckTap         = "tap"
+	inventoryOrphan           = "orphan"
+	inventoryMissing          = "missing"
+	inventoryMismatched       = "mismatched"
+	inventoryColor            = "#FF0000"
+)
+
+var inventoryStatuses = []string{inventoryOrphan, inventoryMissing, inventoryMismatched}
+
+// InventoryFinding is one item the cloud, libvirt and OVSDB disagree on.
+// Key is the UID of the offending item, whether or not it was discovered.
+type InventoryFinding struct {
+	Check      string `json:"check,required"`
+	Status     string `json:"status,required"`
+	Name       string `json:"name,required"`
+	Key        string `json:"key,omitempty"`
+	Host       string `json:"host,omitempty"`
+	Instance   string `json:"instance,omitempty"`
+	MacAddress string `json:"mac_address,omitempty"`
+	Message    string `json:"message,required"`
+	entity     string
+}
+
+type InventoryAudit struct {
+	Cloud    string             `json:"cloud,required"`
+	Summary  map[string]int     `json:"summary,required"`
+	Findings []InventoryFinding `json:"findings,required"`
+}
+
+func (a *InventoryAudit) add(finding InventoryFinding) {
+	a.Summary[finding.Status]++
+	a.Findings = append(a.Findings, finding)
+}
+
+// inventoryHostInterfaces returns the OVS interfaces of a hypervisor.
+func inventoryHostInterfaces(g *TopologyGraph, hypervisor *GraphEntity) []*GraphEntity {
+	var interfaces []*GraphEntity
+	for _, bridge := range g.Children(hypervisor.Key, graphEntityBridge) {
+		for _, port := range g.Children(bridge.Key, graphEntityPort) {
+			interfaces = append(interfaces, g.Children(port.Key, graphEntityInterface)...)
+		}
+	}
+	return interfaces
+}
+
+func inventoryFindInterface(interfaces []*GraphEntity, match func(iface OvsInterface) bool) *GraphEntity {
+	for _, iface := range interfaces {
+		if match(iface.Interface) {
+			return iface
+		}
+	}
+	return nil
+}
+
+// inventoryCheckPlug looks for the OVS port of a vhostuser socket or of a tap
+// device, plugged directly into OVS or through a hybrid qbr linux bridge.
+func inventoryCheckPlug(a *InventoryAudit, g *TopologyGraph, hypervisor *GraphEntity, instance *GraphEntity, vnic *GraphEntity, interfaces []*GraphEntity) {
+	finding := InventoryFinding{
+		Status:     inventoryMissing,
+		Name:       vnic.Name,
+		Key:        vnic.UID,
+		Host:       hypervisor.Name,
+		Instance:   instance.Name,
+		MacAddress: vnic.Vnic.MacAddress,
+		entity:     vnic.Key,
+	}
+	switch {
+	case vnic.Vnic.Type == "vhostuser" && len(vnic.Vnic.BridgeName) > 0:
+		socket := vnic.Vnic.BridgeName
+		plugged := inventoryFindInterface(interfaces, func(iface OvsInterface) bool {
+			return iface.Name == socket || strings.HasSuffix(iface.Options["vhost-server-path"], "/"+socket)
+		})
+		if plugged == nil {
+			finding.Check = inventoryCheckVhostUser
+			finding.Name = socket
+			finding.Message = "vhostuser socket " + socket + " of " + instance.Name + " has no OVS port on " + hypervisor.Name
+			a.add(finding)
+		}
+	case vnic.Vnic.Type == "bridge" && len(vnic.Vnic.DevName) > 0:
+		name := vnic.Vnic.DevName
+		if strings.HasPrefix(vnic.Vnic.BridgeName, "qbr") {
+			name = "qvo" + strings.TrimPrefix(vnic.Vnic.DevName, "tap")
+		} else if g.Entity(graphBridgeKey(hypervisor.HostIP, vnic.Vnic.BridgeName)) == nil {
+			return
+		}
+		plugged := inventoryFindInterface(interfaces, func(iface OvsInterface) bool {
+			return iface.Name == name
+		})
+		if plugged == nil {
+			finding.Check = inventoryCheckTap
+			finding.Message = "Tap device " + vnic.Vnic.DevName + " of " + instance.Name + " has no OVS port " + name + " on " + hypervisor.Name
+			a.add(finding)
+		}
+	}
+}
+
+// inventoryAudit cross-checks Nova instances against libvirt domains, and
+// Neutron ports against libvirt vNICs and OVS interfaces by MAC address.
+func inventoryAudit(g *TopologyGraph) *InventoryAudit {
+	a := &InventoryAudit{
+		Cloud:    g.Cloud.Name,
+		Summary:  make(map[string]int),
+		Findings: make([]InventoryFinding, 0),
+	}
+	for _, status := range inventoryStatuses {
+		a.Summary[status] = 0
+	}
+
+	novaInstances := make(map[string]CloudInstanceInfo)
+	for _, instance := range g.NovaInstances() {
+		novaInstances[instance.ID] = instance
+	}
+	neutronPorts := make(map[string]CloudNetworkPortInfo)
+	for _, port := range g.NetworkPorts() {
+		neutronPorts[strings.ToLower(port.MacAddress)] = port
+	}
+	domains := make(map[string]*GraphEntity)
+	vnics := make(map[string]*GraphEntity)
+	attached := make(map[string]bool)
+	for _, hypervisor := range g.Hypervisors() {
+		for _, instance := range g.Children(hypervisor.Key, graphEntityInstance) {
+			domains[instance.Instance.UUID] = instance
+			for _, vnic := range g.Children(instance.Key, graphEntityVnic) {
+				vnics[strings.ToLower(vnic.Vnic.MacAddress)] = vnic
+			}
+		}
+		for _, iface := range inventoryHostInterfaces(g, hypervisor) {
+			if mac := iface.Interface.ExternalIDs["attached-mac"]; len(mac) > 0 {
+				attached[strings.ToLower(mac)] = true
+			}
+		}
+	}
+
+	for _, nova := range g.NovaInstances() {
+		finding := InventoryFinding{
+			Check:    inventoryCheckNovaLibvirt,
+			Name:     nova.Name,
+			Key:      graphEntityInstance + "/" + g.Cloud.Name + "/" + nova.ID,
+			Instance: nova.Name,
+		}
+		hypervisor := g.FindHypervisorByHostName(nova.HostName)
+		if hypervisor != nil {
+			finding.Host = hypervisor.Name
+		}
+		domain, ok := domains[nova.ID]
+		switch {
+		case ok && hypervisor != nil && domain.Parent == hypervisor.Key:
+			continue
+		case ok:
+			running := g.Entity(domain.Parent).Name
+			finding.Status = inventoryMismatched
+			finding.Host = running
+			finding.Message = "Nova places " + nova.Name + " on " + nova.HostName + ", libvirt runs it on " + running
+			finding.entity = domain.Key
+		case hypervisor == nil:
+			finding.Status = inventoryMissing
+			finding.Message = "Nova places " + nova.Name + " on undiscovered host " + nova.HostName
+		default:
+			finding.Status = inventoryMissing
+			finding.Message = "Nova instance " + nova.Name + " has no libvirt domain on " + hypervisor.Name
+			finding.entity = hypervisor.Key
+		}
+		a.add(finding)
+	}
+
+	for _, hypervisor := range g.Hypervisors() {
+		interfaces := inventoryHostInterfaces(g, hypervisor)
+		for _, instance := range g.Children(hypervisor.Key, graphEntityInstance) {
+			if _, ok := novaInstances[instance.Instance.UUID]; !ok {
+				a.add(InventoryFinding{
+					Check:    inventoryCheckNovaLibvirt,
+					Status:   inventoryOrphan,
+					Name:     instance.Name,
+					Key:      instance.UID,
+					Host:     hypervisor.Name,
+					Instance: instance.Name,
+					Message:  "libvirt domain " + instance.Name + " on " + hypervisor.Name + " is not known to Nova",
+					entity:   instance.Key,
+				})
+			}
+			for _, vnic := range g.Children(instance.Key, graphEntityVnic) {
+				if len(vnic.Vnic.MacAddress) == 0 {
+					continue
+				}
+				finding := InventoryFinding{
+					Name:       vnic.Name,
+					Key:        vnic.UID,
+					Host:       hypervisor.Name,
+					Instance:   instance.Name,
+					MacAddress: vnic.Vnic.MacAddress,
+					entity:     vnic.Key,
+				}
+				if len(finding.Name) == 0 {
+					finding.Name = vnic.Vnic.MacAddress
+				}
+				if _, ok := neutronPorts[strings.ToLower(vnic.Vnic.MacAddress)]; !ok {
+					finding.Check = inventoryCheckNeutronVnic
+					finding.Status = inventoryOrphan
+					finding.Message = "vNIC " + vnic.Vnic.MacAddress + " of " + instance.Name + " has no Neutron port"
+					a.add(finding)
+				}
+				plugged := inventoryFindInterface(interfaces, func(iface OvsInterface) bool {
+					return strings.EqualFold(iface.ExternalIDs["attached-mac"], vnic.Vnic.MacAddress)
+				})
+				if plugged == nil {
+					finding.Check = inventoryCheckNeutronOvs
+					finding.Status = inventoryMissing
+					finding.Message = "vNIC " + vnic.Vnic.MacAddress + " of " + instance.Name + " has no OVS interface on " + hypervisor.Name
+					a.add(finding)
+				}
+				inventoryCheckPlug(a, g, hypervisor, instance, vnic, interfaces)
+			}
+		}
+
+		for _, iface := range interfaces {
+			mac := iface.Interface.ExternalIDs["attached-mac"]
+			if len(mac) == 0 {
+				continue
+			}
+			finding := InventoryFinding{
+				Check:      inventoryCheckNeutronOvs,
+				Name:       iface.Name,
+				Key:        iface.UID,
+				Host:       hypervisor.Name,
+				MacAddress: mac,
+				entity:     iface.Key,
+			}
+			port, ok := neutronPorts[strings.ToLower(mac)]
+			if !ok {
+				finding.Status = inventoryOrphan
+				finding.Message = "OVS interface " + iface.Name + " on " + hypervisor.Name + " is attached to " + mac + " which has no Neutron port"
+				a.add(finding)
+				continue
+			}
+			if ifaceID := iface.Interface.ExternalIDs["iface-id"]; len(ifaceID) > 0 && ifaceID != port.ID {
+				finding.Status = inventoryMismatched
+				finding.Message = "OVS interface " + iface.Name + " on " + hypervisor.Name + " has iface-id " + ifaceID + ", Neutron port of " + mac + " is " + port.ID
+				a.add(finding)
+			}
+			vnic, ok := vnics[strings.ToLower(mac)]
+			if !ok {
+				continue
+			}
+			owner := g.Entity(vnic.Parent)
+			if vmUUID := iface.Interface.ExternalIDs["vm-uuid"]; len(vmUUID) > 0 && vmUUID != owner.Instance.UUID {
+				finding.Status = inventoryMismatched
+				finding.Instance = owner.Name
+				finding.Message = "OVS interface " + iface.Name + " on " + hypervisor.Name + " has vm-uuid " + vmUUID + ", " + mac + " belongs to " + owner.Name + " (" + owner.Instance.UUID + ")"
+				a.add(finding)
+			}
+		}
+	}
+
+	for _, port := range g.NetworkPorts() {
+		mac := strings.ToLower(port.MacAddress)
+		if _, ok := vnics[mac]; ok || attached[mac] {
+			continue
+		}
+		finding := InventoryFinding{
+			Check:      inventoryCheckNeutronOvs,
+			Status:     inventoryMissing,
+			Name:       port.Name,
+			Key:        searchTypeNeutronPort + "/" + g.Cloud.Name + "/" + port.ID,
+			MacAddress: port.MacAddress,
+			Message:    "Neutron port " + port.ID + " (" + port.MacAddress + ") on " + port.NetworkName + " is not plugged on any host",
+		}
+		if len(finding.Name) == 0 {
+			finding.Name = port.ID
+		}
+		if network := g.FindNetwork(port.NetworkName); network != nil {
+			finding.entity = network.Key
+		}
+		a.add(finding)
+	}
+	return a
+}
+
+// addInventoryFindings marks the offenders, or the nearest entity above
+// them that the view shows, and adds the Nova instances libvirt lacks.
+func (b *topologyBuilder) addInventoryFindings(g *TopologyGraph, a *InventoryAudit) {
+	for _, finding := range a.Findings {
+		key := finding.entity
+		if finding.Check == inventoryCheckNovaLibvirt && finding.Status == inventoryMissing && len(key) > 0 {
+			hypervisorId, hypervisorName, ok := b.findByKey(key)
+			if !ok {
+				continue
+			}
+			props := make(map[string]interface{})
+			props["audit"] = []string{finding.Message}
+			node := b.addNode(finding.Key, TopologyNode{
+				Name:       finding.Name,
+				DeviceType: "server",
+				Color:      inventoryColor,
+				Props:      props,
+			})
+			link := topologyLink(hypervisorId, hypervisorName, node.ID, node.Name, inventoryColor)
+			link.Dotted = true
+			b.addLink(link)
+			continue
+		}
+		for len(key) > 0 {
+			if i, ok := b.keyIds[key]; ok {
+				node := &b.nodes[i]
+				node.Color = inventoryColor
+				messages, _ := node.Props["audit"].([]string)
+				node.Props["audit"] = append(messages, finding.Message)
+				break
+			}
+			key = g.Entity(key).Parent
+		}
+	}
+}
+
+func GetInventoryAudit(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	cloudName := httprouter.ContextParams(ctx).ByName("cloud_name")
+	g := topologyGetGraph(rw, r, cloudName)
+	if g == nil {
+		return
+	}
+	luddite.WriteResponse(rw, http.StatusOK, inventoryAudit(g))
+}
+
+func CloudInventoryAuditTopology(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	cloudName := httprouter.ContextParams(ctx).ByName("cloud_name")
+	g := topologyGetGraph(rw, r, cloudName)
+	if g == nil {
+		return
+	}
+	q := TopologyQuery{
+		Cloud:        cloudName,
+		Layers:       []string{queryLayerOvs, queryLayerLinuxBridge, queryLayerPhysical, queryLayerL3},
+		noStatistics: true,
+	}
+	selections, apiError := queryResolve(g, &q)
+	if apiError != nil {
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	a := inventoryAudit(g)
+	b := newGraphTopologyBuilder(r, g)
+	b.layout = layoutLayered
+	b.addQuery(g, &q, selections)
+	b.addInventoryFindings(g, a)
+
+	views := b.cloudViews(cloudName, false)
+	views["Audit Report"] = b.viewUrl("inventory/audit", cloudName)
+	title := cloudName + " Inventory Audit (" + strconv.Itoa(len(a.Findings)) + " findings)"
+	topologyWrite(rw, r, b.data(title, views))
+}
+
+func InitInventory(router *httprouter.Router) {
+	router.GET("/topology/inventory/audit/:cloud_name", authorize(authRoleViewer, viewCached(GetInventoryAudit)))
+	router.GET("/topology/cloudInventoryAuditTopology/:cloud_name", authorize(authRoleViewer, viewCachedStats(CloudInventoryAuditTopology)))
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/SpirentOrion/httprouter"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// inventoryTestFixture makes the fixture disagree with itself: Nova places
+// vm2 on hv2 and knows an instance libvirt lacks, libvirt runs a domain
+// Nova lacks, Neutron has no port for tap5 and one plugged nowhere, and
+// the OVS interfaces of vRouter1 carry the wrong iface-id and vm-uuid.
+func inventoryTestFixture() {
+	cloudInstances["c1"][1].HostName = "hv2.local"
+	cloudInstances["c1"] = append(cloudInstances["c1"], CloudInstanceInfo{ID: "u9", Name: "ghost", HostName: "hv2.local"})
+	libvirtDomainInstances["10.0.0.2"] = append(libvirtDomainInstances["10.0.0.2"], LibvirtDomainInstance{UUID: "u8", Name: "instance-8", InstanceName: "stray", HypervisorName: "hv2"})
+	cloudNetworkPorts["c1"] = []CloudNetworkPortInfo{
+		{ID: "port1", MacAddress: "fa:16:00:00:00:01", NetworkName: "net-a"},
+		{ID: "port2", MacAddress: "fa:16:00:00:00:02", NetworkName: "net-b"},
+		{ID: "port3", MacAddress: "fa:16:00:00:00:03", NetworkName: "net-a"},
+		{ID: "port4", MacAddress: "fa:16:00:00:00:04", NetworkName: "net-a"},
+		{ID: "port9", Name: "unplugged", MacAddress: "fa:16:00:00:00:09", NetworkName: "net-b"},
+	}
+	ovsInterfaces["10.0.0.1"][0].ExternalIDs["iface-id"] = "port9"
+	ovsInterfaces["10.0.0.1"][6].ExternalIDs["vm-uuid"] = "u2"
+	graphInvalidate()
+}
+
+func TestInventoryAuditFindings(t *testing.T) {
+	defer testFixture()()
+	inventoryTestFixture()
+	defer graphInvalidate()
+
+	a := inventoryAudit(graphGet(&clouds[0]))
+	var findings []string
+	for _, finding := range a.Findings {
+		findings = append(findings, finding.Check+" "+finding.Status+" "+finding.Name)
+	}
+	sort.Strings(findings)
+	want := []string{
+		"neutron_ovs mismatched qvo1",
+		"neutron_ovs mismatched tap3",
+		"neutron_ovs missing tap4",
+		"neutron_ovs missing tap5",
+		"neutron_ovs missing unplugged",
+		"neutron_vnic orphan tap5",
+		"nova_libvirt mismatched vm2",
+		"nova_libvirt missing ghost",
+		"nova_libvirt orphan stray",
+		"tap missing tap4",
+		"tap missing tap5",
+	}
+	if strings.Join(findings, "\n") != strings.Join(want, "\n") {
+		t.Errorf("findings\n%s\nwant\n%s", strings.Join(findings, "\n"), strings.Join(want, "\n"))
+	}
+	if a.Summary[inventoryOrphan] != 2 || a.Summary[inventoryMissing] != 6 || a.Summary[inventoryMismatched] != 3 {
+		t.Errorf("summary %v, want 2 orphans, 6 missing and 3 mismatched", a.Summary)
+	}
+}
+
+func TestInventoryAuditTopologyMarksOffenders(t *testing.T) {
+	defer testFixture()()
+	inventoryTestFixture()
+	defer graphInvalidate()
+	router := httprouter.New()
+	InitInventory(router)
+
+	r, _ := http.NewRequest("GET", "http://topology/topology/cloudInventoryAuditTopology/c1", nil)
+	rw := httptest.NewRecorder()
+	router.ServeHTTP(rw, r)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("GET cloudInventoryAuditTopology = %d, want %d", rw.Code, http.StatusOK)
+	}
+	var data TopologyData
+	if err := json.Unmarshal(rw.Body.Bytes(), &data); err != nil {
+		t.Fatal(err)
+	}
+	if data.Title != "c1 Inventory Audit (11 findings)" {
+		t.Errorf("title %q, want 11 findings", data.Title)
+	}
+	marked := make(map[string]bool)
+	for _, node := range data.Nodes {
+		if node.Color == inventoryColor {
+			marked[node.Name] = true
+		}
+	}
+	// The OVS interfaces are collapsed into br-int and the vNICs into their
+	// linux bridges; the unplugged port marks its network.
+	for _, name := range []string{"vm2", "stray", "ghost", "br-int", "qbr4", "qbr5", "net-b"} {
+		if !marked[name] {
+			t.Errorf("node %s not marked, marked %v", name, marked)
+		}
+	}
+	for _, name := range []string{"hv1", "vRouter1", "net-a"} {
+		if marked[name] {
+			t.Errorf("node %s marked without a finding", name)
+		}
+	}
+}
@@ -0,0 +1,515 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strings"
+)
+
+const (
+	layoutNone         = "none"
+	layoutLayered      = "layered"
+	layoutGrid         = "grid"
+	layoutRadial       = "radial"
+	layoutHierarchical = "hierarchical"
+	layoutForce        = "force"
+)
+
+var layoutNames = []string{layoutNone, layoutLayered, layoutGrid, layoutRadial, layoutHierarchical, layoutForce}
+
+const (
+	layoutSpacingX      = 120
+	layoutSpacingY      = 100
+	layoutIterations    = 200
+	layoutForceGravity  = 0.1
+	layoutBarycenterRun = 3
+)
+
+// layoutCompute assigns X and Y to every node of data and centers each node
+// set on its members. none keeps the coordinates the view was built with.
+func layoutCompute(data *TopologyData, layout string) error {
+	switch layout {
+	case layoutNone:
+		return nil
+	case layoutLayered:
+		layoutLayeredNodes(data)
+	case layoutGrid:
+		layoutGridNodes(data)
+	case layoutRadial:
+		layoutRadialNodes(data)
+	case layoutHierarchical:
+		layoutHierarchicalNodes(data)
+	case layoutForce:
+		layoutForceNodes(data)
+	default:
+		return errors.New("Invalid layout " + layout + ", expected one of " + strings.Join(layoutNames, ", "))
+	}
+	layoutNodeSets(data)
+	return nil
+}
+
+// layoutNodeSets places each node set at the center of its members, which
+// may be nodes or node sets listed before it.
+func layoutNodeSets(data *TopologyData) {
+	positions := make(map[int][2]int)
+	for _, node := range data.Nodes {
+		positions[node.ID] = [2]int{node.X, node.Y}
+	}
+	for i := range data.NodeSets {
+		nodeSet := &data.NodeSets[i]
+		sumX, sumY, count := 0, 0, 0
+		for _, id := range nodeSet.Nodes {
+			if position, ok := positions[id]; ok {
+				sumX += position[0]
+				sumY += position[1]
+				count++
+			}
+		}
+		if count > 0 {
+			nodeSet.X = sumX / count
+			nodeSet.Y = sumY / count
+		}
+		positions[nodeSet.ID] = [2]int{nodeSet.X, nodeSet.Y}
+	}
+}
+
+// layoutAdjacency returns the sorted neighbors of each node index, ignoring
+// direction, and the number of links into each node.
+func layoutAdjacency(data *TopologyData, index map[int]int) ([][]int, []int) {
+	adjacent := make([][]int, len(data.Nodes))
+	incoming := make([]int, len(data.Nodes))
+	seen := make(map[[2]int]bool)
+	for _, link := range data.Links {
+		source, ok := index[link.Source]
+		if !ok {
+			continue
+		}
+		target, ok := index[link.Target]
+		if !ok || source == target {
+			continue
+		}
+		incoming[target]++
+		pair := [2]int{source, target}
+		if source > target {
+			pair = [2]int{target, source}
+		}
+		if seen[pair] {
+			continue
+		}
+		seen[pair] = true
+		adjacent[source] = append(adjacent[source], target)
+		adjacent[target] = append(adjacent[target], source)
+	}
+	for _, peers := range adjacent {
+		sort.Ints(peers)
+	}
+	return adjacent, incoming
+}
+
+// layoutComponents lists the connected components in node order.
+func layoutComponents(adjacent [][]int) [][]int {
+	var components [][]int
+	visited := make([]bool, len(adjacent))
+	for i := range adjacent {
+		if visited[i] {
+			continue
+		}
+		visited[i] = true
+		component := []int{i}
+		for j := 0; j < len(component); j++ {
+			for _, peer := range adjacent[component[j]] {
+				if !visited[peer] {
+					visited[peer] = true
+					component = append(component, peer)
+				}
+			}
+		}
+		sort.Ints(component)
+		components = append(components, component)
+	}
+	return components
+}
+
+// layoutLayers ranks a component by its distance from the nodes nothing
+// links into, or from its first node when every node has a link in.
+func layoutLayers(component []int, adjacent [][]int, incoming []int) [][]int {
+	layer := make(map[int]int)
+	var order []int
+	for _, i := range component {
+		if incoming[i] == 0 {
+			layer[i] = 0
+			order = append(order, i)
+		}
+	}
+	if len(order) == 0 {
+		layer[component[0]] = 0
+		order = append(order, component[0])
+	}
+	for j := 0; j < len(order); j++ {
+		for _, peer := range adjacent[order[j]] {
+			if _, ok := layer[peer]; !ok {
+				layer[peer] = layer[order[j]] + 1
+				order = append(order, peer)
+			}
+		}
+	}
+
+	var layers [][]int
+	for _, i := range order {
+		for len(layers) <= layer[i] {
+			layers = append(layers, nil)
+		}
+		layers[layer[i]] = append(layers[layer[i]], i)
+	}
+	return layers
+}
+
+// layoutBarycenter reorders layer by the mean position of each node's
+// neighbors in the reference layer to cut down on crossings. Nodes stay
+// together by group when groups are given.
+func layoutBarycenter(layer []int, position map[int]float64, reference map[int]bool, adjacent [][]int, group []int) {
+	center := make(map[int]float64)
+	for _, i := range layer {
+		sum, count := 0.0, 0
+		for _, peer := range adjacent[i] {
+			if reference[peer] {
+				sum += position[peer]
+				count++
+			}
+		}
+		if count > 0 {
+			center[i] = sum / float64(count)
+		} else {
+			center[i] = position[i]
+		}
+	}
+	sort.SliceStable(layer, func(a, b int) bool {
+		if group != nil && group[layer[a]] != group[layer[b]] {
+			return group[layer[a]] < group[layer[b]]
+		}
+		return center[layer[a]] < center[layer[b]]
+	})
+	for j, i := range layer {
+		position[i] = float64(j)
+	}
+}
+
+// layoutSweep runs barycenter passes down and up the layers.
+func layoutSweep(layers [][]int, position map[int]float64, members []map[int]bool, adjacent [][]int, group []int) {
+	for run := 0; run < layoutBarycenterRun; run++ {
+		if run%2 == 0 {
+			for l := 1; l < len(layers); l++ {
+				layoutBarycenter(layers[l], position, members[l-1], adjacent, group)
+			}
+		} else {
+			for l := len(layers) - 2; l >= 0; l-- {
+				layoutBarycenter(layers[l], position, members[l+1], adjacent, group)
+			}
+		}
+	}
+}
+
+// layoutHierarchicalNodes places each component in layers top down, side
+// by side from left to right.
+func layoutHierarchicalNodes(data *TopologyData) {
+	index := diagramIndex(data)
+	adjacent, incoming := layoutAdjacency(data, index)
+	offset := 0
+	for _, component := range layoutComponents(adjacent) {
+		layers := layoutLayers(component, adjacent, incoming)
+		position := make(map[int]float64)
+		members := make([]map[int]bool, len(layers))
+		width := 0
+		for l, layer := range layers {
+			members[l] = make(map[int]bool)
+			for j, i := range layer {
+				position[i] = float64(j)
+				members[l][i] = true
+			}
+			if len(layer) > width {
+				width = len(layer)
+			}
+		}
+		layoutSweep(layers, position, members, adjacent, nil)
+
+		for l, layer := range layers {
+			indent := float64(width-len(layer)) / 2
+			for j, i := range layer {
+				data.Nodes[i].X = offset + int((float64(j)+indent)*layoutSpacingX)
+				data.Nodes[i].Y = l * layoutSpacingY
+			}
+		}
+		offset += (width + 1) * layoutSpacingX
+	}
+}
+
+// layoutForceNodes runs a Fruchterman-Reingold simulation from a circle so
+// that the same topology always lands in the same place. Gravity toward
+// the center keeps disconnected components together.
+func layoutForceNodes(data *TopologyData) {
+	n := len(data.Nodes)
+	if n == 0 {
+		return
+	}
+	index := diagramIndex(data)
+	adjacent, _ := layoutAdjacency(data, index)
+
+	k := float64(layoutSpacingX)
+	radius := math.Max(k, k*float64(n)/(2*math.Pi))
+	x := make([]float64, n)
+	y := make([]float64, n)
+	for i := range data.Nodes {
+		angle := 2 * math.Pi * float64(i) / float64(n)
+		x[i] = radius * math.Cos(angle)
+		y[i] = radius * math.Sin(angle)
+	}
+
+	dx := make([]float64, n)
+	dy := make([]float64, n)
+	start := k * 2
+	for iteration := 0; iteration < layoutIterations; iteration++ {
+		for i := range dx {
+			gravity := math.Hypot(x[i], y[i]) / k * layoutForceGravity
+			dx[i] = -x[i] * gravity
+			dy[i] = -y[i] * gravity
+		}
+		for i := 0; i < n; i++ {
+			for j := i + 1; j < n; j++ {
+				ex, ey := x[i]-x[j], y[i]-y[j]
+				distance := math.Max(math.Hypot(ex, ey), 0.01)
+				force := k * k / distance / distance
+				dx[i] += ex * force
+				dy[i] += ey * force
+				dx[j] -= ex * force
+				dy[j] -= ey * force
+			}
+		}
+		for i, peers := range adjacent {
+			for _, j := range peers {
+				if j < i {
+					continue
+				}
+				ex, ey := x[i]-x[j], y[i]-y[j]
+				force := math.Hypot(ex, ey) / k
+				dx[i] -= ex * force
+				dy[i] -= ey * force
+				dx[j] += ex * force
+				dy[j] += ey * force
+			}
+		}
+		temperature := start * (1 - float64(iteration)/layoutIterations)
+		for i := range x {
+			distance := math.Hypot(dx[i], dy[i])
+			if distance == 0 {
+				continue
+			}
+			step := math.Min(distance, temperature)
+			x[i] += dx[i] / distance * step
+			y[i] += dy[i] / distance * step
+		}
+	}
+
+	minX, minY := x[0], y[0]
+	for i := range x {
+		minX = math.Min(minX, x[i])
+		minY = math.Min(minY, y[i])
+	}
+	for i := range data.Nodes {
+		data.Nodes[i].X = int(x[i] - minX + 0.5)
+		data.Nodes[i].Y = int(y[i] - minY + 0.5)
+	}
+}
+
+const (
+	layoutRankCloud = iota
+	layoutRankHost
+	layoutRankInstance
+	layoutRankVnic
+	layoutRankIntegration
+	layoutRankBridge
+	layoutRankNic
+	layoutRankOther
+)
+
+// layoutRank puts a node on its row of the layered layout. vNICs carry
+// their tap device; a bridge they attach to is an integration bridge and
+// sits above the tunnel, external and physical bridges.
+func layoutRank(data *TopologyData, i int, adjacent [][]int) int {
+	node := &data.Nodes[i]
+	switch node.DeviceType {
+	case "cloud":
+		return layoutRankCloud
+	case "host":
+		return layoutRankHost
+	case "server":
+		return layoutRankInstance
+	case "router":
+		return layoutRankIntegration
+	case "port":
+		return layoutRankNic
+	case "switch":
+		if _, ok := node.Props["tap"]; ok {
+			return layoutRankVnic
+		}
+		for _, peer := range adjacent[i] {
+			if _, ok := data.Nodes[peer].Props["tap"]; ok {
+				return layoutRankIntegration
+			}
+		}
+		return layoutRankBridge
+	}
+	return layoutRankOther
+}
+
+// layoutLayeredNodes stacks the OVS data path top down: hosts, instances,
+// vNICs, br-int, br-tun and br-ex, then NICs. Each hypervisor keeps its own
+// columns so that its nodes line up under it.
+func layoutLayeredNodes(data *TopologyData) {
+	index := diagramIndex(data)
+	adjacent, _ := layoutAdjacency(data, index)
+	_, group := diagramGroups(data, index)
+
+	rows := make([][]int, layoutRankOther+1)
+	for i := range data.Nodes {
+		rank := layoutRank(data, i, adjacent)
+		rows[rank] = append(rows[rank], i)
+	}
+	var layers [][]int
+	for _, row := range rows {
+		if len(row) > 0 {
+			layers = append(layers, row)
+		}
+	}
+
+	position := make(map[int]float64)
+	members := make([]map[int]bool, len(layers))
+	for l, layer := range layers {
+		members[l] = make(map[int]bool)
+		for j, i := range layer {
+			position[i] = float64(j)
+			members[l][i] = true
+		}
+	}
+	for _, layer := range layers {
+		sort.SliceStable(layer, func(a, b int) bool {
+			return group[layer[a]] < group[layer[b]]
+		})
+	}
+	layoutSweep(layers, position, members, adjacent, group)
+
+	// Each group is as wide as its widest row.
+	widths := make(map[int]int)
+	for _, layer := range layers {
+		count := make(map[int]int)
+		for _, i := range layer {
+			count[group[i]]++
+			if count[group[i]] > widths[group[i]] {
+				widths[group[i]] = count[group[i]]
+			}
+		}
+	}
+	var groups []int
+	for g := range widths {
+		groups = append(groups, g)
+	}
+	sort.Ints(groups)
+	offsets := make(map[int]int)
+	offset := 0
+	for _, g := range groups {
+		offsets[g] = offset
+		offset += widths[g] + 1
+	}
+
+	for l, layer := range layers {
+		count := make(map[int]int)
+		for _, i := range layer {
+			count[group[i]]++
+		}
+		column := make(map[int]int)
+		for _, i := range layer {
+			g := group[i]
+			indent := float64(widths[g]-count[g]) / 2
+			data.Nodes[i].X = int((float64(offsets[g]+column[g]) + indent) * layoutSpacingX)
+			data.Nodes[i].Y = l * layoutSpacingY
+			column[g]++
+		}
+	}
+}
+
+// layoutGridNodes fills a square grid row by row in node order.
+func layoutGridNodes(data *TopologyData) {
+	columns := int(math.Ceil(math.Sqrt(float64(len(data.Nodes)))))
+	for i := range data.Nodes {
+		data.Nodes[i].X = (i % columns) * layoutSpacingX
+		data.Nodes[i].Y = (i / columns) * layoutSpacingY
+	}
+}
+
+// layoutRadialNodes puts the first node of each component in the middle
+// with the rest on rings by distance, children in the arc of their parent.
+// Components sit side by side.
+func layoutRadialNodes(data *TopologyData) {
+	index := diagramIndex(data)
+	adjacent, _ := layoutAdjacency(data, index)
+	offset := 0.0
+	for _, component := range layoutComponents(adjacent) {
+		root := component[0]
+		parent := map[int]int{root: -1}
+		depth := map[int]int{root: 0}
+		order := []int{root}
+		children := make(map[int][]int)
+		for j := 0; j < len(order); j++ {
+			for _, peer := range adjacent[order[j]] {
+				if _, ok := parent[peer]; !ok {
+					parent[peer] = order[j]
+					depth[peer] = depth[order[j]] + 1
+					children[order[j]] = append(children[order[j]], peer)
+					order = append(order, peer)
+				}
+			}
+		}
+
+		// Each subtree gets an arc in proportion to its leaves.
+		leaves := make(map[int]int)
+		for j := len(order) - 1; j >= 0; j-- {
+			i := order[j]
+			if len(children[i]) == 0 {
+				leaves[i] = 1
+			}
+			leaves[parent[i]] += leaves[i]
+		}
+		start := map[int]float64{root: 0}
+		angle := make(map[int]float64)
+		maxDepth := 0
+		for _, i := range order {
+			arc := 2 * math.Pi * float64(leaves[i]) / float64(leaves[root])
+			angle[i] = start[i] + arc/2
+			next := start[i]
+			for _, child := range children[i] {
+				start[child] = next
+				next += 2 * math.Pi * float64(leaves[child]) / float64(leaves[root])
+			}
+			if depth[i] > maxDepth {
+				maxDepth = depth[i]
+			}
+		}
+
+		// Rings spread out so that crowded ones keep the node spacing.
+		count := make([]int, maxDepth+1)
+		for _, i := range order {
+			count[depth[i]]++
+		}
+		rings := make([]float64, maxDepth+1)
+		for d := 1; d <= maxDepth; d++ {
+			rings[d] = math.Max(rings[d-1]+layoutSpacingX, float64(count[d]*layoutSpacingX)/(2*math.Pi))
+		}
+		radius := rings[maxDepth]
+		for _, i := range order {
+			r := rings[depth[i]]
+			data.Nodes[i].X = int(offset + radius + r*math.Cos(angle[i]) + 0.5)
+			data.Nodes[i].Y = int(radius + r*math.Sin(angle[i]) + 0.5)
+		}
+		offset += 2*radius + layoutSpacingX
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"testing"
+)
+
+// layoutTestData builds a topology of the given device types linked by
+// pairs of node indexes.
+func layoutTestData(deviceTypes []string, links [][2]int) *TopologyData {
+	data := &TopologyData{}
+	for i, deviceType := range deviceTypes {
+		data.Nodes = append(data.Nodes, TopologyNode{ID: i, DeviceType: deviceType, Props: make(map[string]interface{})})
+	}
+	for _, link := range links {
+		data.Links = append(data.Links, TopologyLink{Source: link[0], Target: link[1]})
+	}
+	return data
+}
+
+func TestLayoutGridAndNodeSets(t *testing.T) {
+	data := layoutTestData([]string{"host", "host", "host", "host", "host"}, nil)
+	data.NodeSets = []TopologyNodeSet{{ID: 10, Nodes: []int{0, 1}}, {ID: 11, Nodes: []int{10, 4}}}
+	if err := layoutCompute(data, layoutGrid); err != nil {
+		t.Fatal(err)
+	}
+	want := [][2]int{{0, 0}, {120, 0}, {240, 0}, {0, 100}, {120, 100}}
+	for i, node := range data.Nodes {
+		if node.X != want[i][0] || node.Y != want[i][1] {
+			t.Errorf("node %d at %d,%d, want %d,%d", i, node.X, node.Y, want[i][0], want[i][1])
+		}
+	}
+	if set := data.NodeSets[0]; set.X != 60 || set.Y != 0 {
+		t.Errorf("node set 10 at %d,%d, want the center of its nodes 60,0", set.X, set.Y)
+	}
+	if set := data.NodeSets[1]; set.X != 90 || set.Y != 50 {
+		t.Errorf("node set 11 at %d,%d, want the center of node set 10 and node 4 90,50", set.X, set.Y)
+	}
+}
+
+func TestLayoutHierarchicalPutsParentsAbove(t *testing.T) {
+	data := layoutTestData([]string{"host", "server", "server", "switch", "host", "server"}, [][2]int{{0, 1}, {0, 2}, {1, 3}, {4, 5}})
+	layoutCompute(data, layoutHierarchical)
+	for _, link := range data.Links {
+		if source, target := data.Nodes[link.Source], data.Nodes[link.Target]; target.Y != source.Y+layoutSpacingY {
+			t.Errorf("node %d at y %d, want one row under node %d at y %d", target.ID, target.Y, source.ID, source.Y)
+		}
+	}
+	for i := 0; i < 4; i++ {
+		if data.Nodes[i].X >= data.Nodes[4].X {
+			t.Errorf("node %d at x %d, want the first component left of the second at x %d", i, data.Nodes[i].X, data.Nodes[4].X)
+		}
+	}
+}
+
+func TestLayoutLayeredRanksDataPath(t *testing.T) {
+	data := layoutTestData([]string{"port", "switch", "switch", "switch", "server", "host", "cloud"}, [][2]int{{6, 5}, {5, 4}, {4, 3}, {3, 2}, {2, 1}, {1, 0}})
+	data.Nodes[3].Props["tap"] = "tap1"
+	layoutCompute(data, layoutLayered)
+	// cloud, host, instance, vNIC, integration bridge, bridge, NIC
+	for _, i := range []int{6, 5, 4, 3, 2, 1} {
+		if data.Nodes[i].Y >= data.Nodes[i-1].Y {
+			t.Errorf("node %d (%s) at y %d, want it above node %d (%s) at y %d", i, data.Nodes[i].DeviceType, data.Nodes[i].Y, i-1, data.Nodes[i-1].DeviceType, data.Nodes[i-1].Y)
+		}
+	}
+}
+
+func TestLayoutRadialRings(t *testing.T) {
+	data := layoutTestData([]string{"cloud", "host", "host", "host", "server"}, [][2]int{{0, 1}, {0, 2}, {0, 3}, {1, 4}})
+	layoutCompute(data, layoutRadial)
+	distance := func(i int) float64 {
+		return math.Hypot(float64(data.Nodes[i].X-data.Nodes[0].X), float64(data.Nodes[i].Y-data.Nodes[0].Y))
+	}
+	for _, i := range []int{2, 3} {
+		if math.Abs(distance(i)-distance(1)) > 1 {
+			t.Errorf("node %d is %.1f from the root, want %.1f like node 1", i, distance(i), distance(1))
+		}
+	}
+	if distance(4) <= distance(1) {
+		t.Errorf("node 4 is %.1f from the root, want it on an outer ring beyond %.1f", distance(4), distance(1))
+	}
+}
+
+func TestLayoutViewsAreStableAndDistinct(t *testing.T) {
+	defer testFixture()()
+	for _, layout := range []string{layoutLayered, layoutGrid, layoutRadial, layoutHierarchical, layoutForce} {
+		var positions [2][][2]int
+		for run := range positions {
+			rw, _ := exportTestGet(t, "?layout="+layout, "")
+			var data TopologyData
+			if err := json.Unmarshal(rw.Body.Bytes(), &data); err != nil {
+				t.Fatal(err)
+			}
+			for _, node := range data.Nodes {
+				positions[run] = append(positions[run], [2]int{node.X, node.Y})
+			}
+		}
+		seen := make(map[[2]int]int)
+		for i, position := range positions[0] {
+			if position != positions[1][i] {
+				t.Errorf("%s moved node %d from %v to %v between requests", layout, i, position, positions[1][i])
+			}
+			if j, ok := seen[position]; ok {
+				t.Errorf("%s put nodes %d and %d both at %v", layout, j, i, position)
+			}
+			seen[position] = i
+		}
+	}
+	router := testBedTestRouter()
+	if rw := testBedTestRequest(router, "GET", exportTestView+"?layout=spiral", ""); rw.Code != http.StatusBadRequest {
+		t.Errorf("GET ?layout=spiral = %d, want %d", rw.Code, http.StatusBadRequest)
+	}
+}
@@ -7,6 +7,8 @@ import (
 	libvirt "github.com/rgbkrk/libvirt-go"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 type LibvirtDomainInstance struct {
@@ -40,6 +42,17 @@ type LibvirtConnection struct {
 var libvirtDomainInstances map[string][]LibvirtDomainInstance = make(map[string][]LibvirtDomainInstance)
 var libvirtPhysicalInterfaces map[string][]LibvirtPhysicalInterface = make(map[string][]LibvirtPhysicalInterface)
 
+// libvirtDomainLock guards libvirtDomainInstances, which domain events and
+// placement changes update while discovery and requests read it.
+var libvirtDomainLock sync.RWMutex
+var libvirtEventWatches map[string]bool = make(map[string]bool)
+var libvirtEventLock sync.Mutex
+
+// libvirtStatsConnections holds the connection statistics polls reuse for
+// each hypervisor until it fails or the hypervisor goes away.
+var libvirtStatsConnections map[string]*LibvirtConnection = make(map[string]*LibvirtConnection)
+var libvirtStatsLock sync.Mutex
+
 func libvirtLoadInfo(cloudInfo CloudInfo, ipAddress string) error {
 	lc, err := libvirtConnect(cloudInfo, ipAddress)
 	if err != nil {
@@ -49,6 +62,10 @@ func libvirtLoadInfo(cloudInfo CloudInfo, ipAddress string) error {
 	lc.libvirtLoadPhysicalInterfaces()
 	lc.libvirtDisconnect()
 
+	if cfg.Placement.Events {
+		libvirtWatchDomainEvents(cloudInfo, ipAddress)
+	}
+
 	return nil
 }
 
@@ -131,7 +148,10 @@ func (c *LibvirtConnection) libvirtLoadDomainInstances() error {
 		}
 		instances[i] = *instance
 	}
+	libvirtDomainLock.Lock()
 	libvirtDomainInstances[c.ipAddress] = instances
+	libvirtDomainLock.Unlock()
+	placementRecordInstances(c.cloudInfo, c.ipAddress, instances)
 
 	service.Logger().WithFields(logFields).Info("Succesfully loaded libvirt domain instances")
 
@@ -243,6 +263,7 @@ func (c *LibvirtConnection) libvirtLoadDomainInterfaceInfo(domain libvirt.VirDom
 			sMap["tx_packets"] = stats.TxPackets
 			sMap["tx_errs"] = stats.TxErrs
 			sMap["tx_drop"] = stats.TxDrop
+			statsRecordLibvirtSample(c.ipAddress, devName, sMap, time.Now())
 			interfaces[i] = LibvirtDomainInterface{
 				MacAddress:  macAddr,
 				Type:        ifType,
@@ -256,6 +277,103 @@ func (c *LibvirtConnection) libvirtLoadDomainInterfaceInfo(domain libvirt.VirDom
 	return interfaces, nil
 }
 
+func libvirtLoadStatistics(cloudInfo CloudInfo, ipAddress string) error {
+	libvirtStatsLock.Lock()
+	lc := libvirtStatsConnections[ipAddress]
+	libvirtStatsLock.Unlock()
+	if lc == nil {
+		var err error
+		if lc, err = libvirtConnect(cloudInfo, ipAddress); err != nil {
+			return err
+		}
+		libvirtStatsLock.Lock()
+		libvirtStatsConnections[ipAddress] = lc
+		libvirtStatsLock.Unlock()
+	}
+
+	err := lc.libvirtLoadDomainInterfaceStatistics()
+	if err != nil {
+		libvirtStatsLock.Lock()
+		delete(libvirtStatsConnections, ipAddress)
+		libvirtStatsLock.Unlock()
+		lc.libvirtDisconnect()
+	}
+	return err
+}
+
+// libvirtPruneStatistics closes the statistics connections to hypervisors
+// that are no longer polled.
+func libvirtPruneStatistics(polled map[string]bool) {
+	libvirtStatsLock.Lock()
+	var stale []*LibvirtConnection
+	for ipAddress, lc := range libvirtStatsConnections {
+		if !polled[ipAddress] {
+			stale = append(stale, lc)
+			delete(libvirtStatsConnections, ipAddress)
+		}
+	}
+	libvirtStatsLock.Unlock()
+
+	for _, lc := range stale {
+		lc.libvirtDisconnect()
+	}
+}
+
+func (c *LibvirtConnection) libvirtLoadDomainInterfaceStatistics() error {
+	domains, err := c.connection.ListAllDomains(libvirt.VIR_CONNECT_LIST_DOMAINS_ACTIVE)
+	if err != nil {
+		logFields := log.Fields{
+			"Name":      c.cloudInfo.Name,
+			"IpAddress": c.ipAddress,
+			"Error":     err.Error(),
+		}
+		service.Logger().WithFields(logFields).Error("Error listing all libvirt domains")
+		return err
+	}
+	instanceList := libvirtGetDomainInstances(c.ipAddress)
+	for _, domain := range domains {
+		uuid, err := domain.GetUUIDString()
+		if err != nil {
+			continue
+		}
+		for _, instance := range instanceList {
+			if instance.UUID != uuid {
+				continue
+			}
+			for _, iface := range instance.Interfaces {
+				if len(iface.DevName) == 0 {
+					continue
+				}
+				stats, err := domain.InterfaceStats(iface.DevName)
+				if err != nil {
+					logFields := log.Fields{
+						"Name":      c.cloudInfo.Name,
+						"IpAddress": c.ipAddress,
+						"DevName":   iface.DevName,
+						"Error":     err.Error(),
+					}
+					service.Logger().WithFields(logFields).Error("Error reading libvirt interface stats for device")
+					continue
+				}
+				sMap := map[string]int64{
+					"rx_bytes":   stats.RxBytes,
+					"rx_packets": stats.RxPackets,
+					"rx_errs":    stats.RxErrs,
+					"rx_drop":    stats.RxDrop,
+					"tx_bytes":   stats.TxBytes,
+					"tx_packets": stats.TxPackets,
+					"tx_errs":    stats.TxErrs,
+					"tx_drop":    stats.TxDrop,
+				}
+				statsRecordLibvirtSample(c.ipAddress, iface.DevName, sMap, time.Now())
+			}
+			break
+		}
+	}
+
+	return nil
+}
+
 func (c *LibvirtConnection) libvirtLoadPhysicalInterfaces() error {
 	logFields := log.Fields{
 		"Name":      c.cloudInfo.Name,
@@ -313,15 +431,125 @@ func (c *LibvirtConnection) libvirtLoadPhysicalInterfaces() error {
 	return nil
 }
 
+func libvirtStartEventLoop() {
+	libvirt.EventRegisterDefaultImpl()
+	go func() {
+		for !shutdown {
+			libvirt.EventRunDefaultImpl()
+		}
+	}()
+}
+
+// libvirtWatchDomainEvents keeps a connection open to the hypervisor so that
+// live migrations show up without waiting for the next discovery.
+func libvirtWatchDomainEvents(cloudInfo CloudInfo, ipAddress string) {
+	libvirtEventLock.Lock()
+	defer libvirtEventLock.Unlock()
+
+	if libvirtEventWatches[ipAddress] {
+		return
+	}
+	libvirtEventWatches[ipAddress] = true
+	go libvirtWatchDomainEventsLoop(cloudInfo, ipAddress)
+}
+
+func libvirtWatchDomainEventsLoop(cloudInfo CloudInfo, ipAddress string) {
+	for !shutdown {
+		lc, err := libvirtConnect(cloudInfo, ipAddress)
+		if err == nil {
+			callback := libvirt.DomainEventCallback(func(c *libvirt.VirConnection, d *libvirt.VirDomain, event interface{}, f func()) int {
+				lc.libvirtHandleDomainEvent(d, event)
+				return 0
+			})
+			callbackId := lc.connection.DomainEventRegister(libvirt.VirDomain{}, libvirt.VIR_DOMAIN_EVENT_ID_LIFECYCLE, &callback, func() {})
+			for !shutdown {
+				time.Sleep(10 * time.Second)
+				if alive, err := lc.connection.IsAlive(); err != nil || !alive {
+					break
+				}
+			}
+			lc.connection.DomainEventDeregister(callbackId)
+			lc.libvirtDisconnect()
+		}
+		if !shutdown {
+			time.Sleep(30 * time.Second)
+		}
+	}
+}
+
+func (c *LibvirtConnection) libvirtHandleDomainEvent(domain *libvirt.VirDomain, event interface{}) {
+	lifecycleEvent, ok := event.(libvirt.DomainLifecycleEvent)
+	if !ok {
+		return
+	}
+	if lifecycleEvent.Event == libvirt.VIR_DOMAIN_EVENT_STARTED && lifecycleEvent.Detail == libvirt.VIR_DOMAIN_EVENT_STARTED_MIGRATED {
+		instance, err := c.libvirtLoadDomainInfo(*domain)
+		if err != nil {
+			return
+		}
+		libvirtAddDomainInstance(c.ipAddress, *instance)
+		placementRecordInstance(c.cloudInfo, c.ipAddress, *instance, placementSourceEvent)
+	} else if lifecycleEvent.Event == libvirt.VIR_DOMAIN_EVENT_STOPPED && lifecycleEvent.Detail == libvirt.VIR_DOMAIN_EVENT_STOPPED_MIGRATED {
+		uuid, err := domain.GetUUIDString()
+		if err != nil {
+			return
+		}
+		libvirtRemoveDomainInstance(c.ipAddress, uuid)
+	}
+}
+
+func libvirtAddDomainInstance(ipAddress string, instance LibvirtDomainInstance) {
+	libvirtDomainLock.Lock()
+	dList := libvirtDomainInstances[ipAddress]
+	found := false
+	for i, di := range dList {
+		if di.UUID == instance.UUID {
+			dList[i] = instance
+			found = true
+			break
+		}
+	}
+	if !found {
+		libvirtDomainInstances[ipAddress] = append(dList, instance)
+	}
+	libvirtDomainLock.Unlock()
+	graphInvalidate()
+}
+
+func libvirtRemoveDomainInstance(ipAddress string, uuid string) {
+	libvirtDomainLock.Lock()
+	dList := libvirtDomainInstances[ipAddress]
+	removed := false
+	for i, di := range dList {
+		if di.UUID == uuid {
+			libvirtDomainInstances[ipAddress] = append(dList[:i:i], dList[i+1:]...)
+			removed = true
+			break
+		}
+	}
+	libvirtDomainLock.Unlock()
+	if removed {
+		graphInvalidate()
+	}
+}
+
+// libvirtGetDomainInstances returns a copy of the domains last seen on a
+// hypervisor, so callers can range over it while events update the map.
 func libvirtGetDomainInstances(ipAddress string) []LibvirtDomainInstance {
+	libvirtDomainLock.RLock()
+	defer libvirtDomainLock.RUnlock()
+
 	if dList, ok := libvirtDomainInstances[ipAddress]; ok == true {
-		return dList
+		return append([]LibvirtDomainInstance(nil), dList...)
 	}
 	var dList []LibvirtDomainInstance
 	return dList
 }
 
 func libvirtGetDomainInstance(ipAddress string, instanceName string) *LibvirtDomainInstance {
+	libvirtDomainLock.RLock()
+	defer libvirtDomainLock.RUnlock()
+
 	if dList, ok := libvirtDomainInstances[ipAddress]; ok == true {
 		for _, di := range dList {
 			if di.InstanceName == instanceName {
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestLibvirtAddRemoveDomainInstance(t *testing.T) {
+	defer testFixture()()
+
+	libvirtAddDomainInstance("10.0.0.2", LibvirtDomainInstance{UUID: "u1", InstanceName: "vRouter1"})
+	libvirtAddDomainInstance("10.0.0.2", LibvirtDomainInstance{UUID: "u1", InstanceName: "vRouter1", HypervisorName: "hv2"})
+	libvirtRemoveDomainInstance("10.0.0.1", "u1")
+
+	if di := libvirtGetDomainInstance("10.0.0.1", "vRouter1"); di != nil {
+		t.Errorf("vRouter1 still listed on hv1 after it was removed")
+	}
+	if dList := libvirtGetDomainInstances("10.0.0.2"); len(dList) != 2 || dList[1].HypervisorName != "hv2" {
+		t.Errorf("hv2 domains = %+v, want net-a and the updated vRouter1", dList)
+	}
+}
+
+func TestLibvirtGetDomainInstancesReturnsCopy(t *testing.T) {
+	defer testFixture()()
+
+	dList := libvirtGetDomainInstances("10.0.0.1")
+	libvirtAddDomainInstance("10.0.0.1", LibvirtDomainInstance{UUID: "u1", InstanceName: "renamed"})
+	if dList[0].InstanceName != "vRouter1" {
+		t.Errorf("returned domain changed to %q with the map", dList[0].InstanceName)
+	}
+}
+
+// Run with -race to check that events and readers share the map safely.
+func TestLibvirtDomainInstancesConcurrentEvents(t *testing.T) {
+	defer testFixture()()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				uuid := "e" + strconv.Itoa(i) + "-" + strconv.Itoa(j)
+				libvirtAddDomainInstance("10.0.0.1", LibvirtDomainInstance{UUID: uuid, InstanceName: uuid})
+				libvirtRemoveDomainInstance("10.0.0.1", uuid)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				for _, di := range libvirtGetDomainInstances("10.0.0.1") {
+					libvirtGetDomainInstance("10.0.0.1", di.InstanceName)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if dList := libvirtGetDomainInstances("10.0.0.1"); len(dList) != 2 {
+		t.Errorf("hv1 has %d domains after the events, want 2", len(dList))
+	}
+}
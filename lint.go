@@ -0,0 +1,239 @@
+package main
+
+import (
+	"github.com/SpirentOrion/httprouter"
+	"github.com/SpirentOrion/luddite"
+	"golang.org/x/net/context"
+	"net/http"
+	"strconv"
+)
+
+const (
+	lintPatchPeerMissing    = "patch_peer_missing"
+	lintPatchPeerAsymmetric = "patch_peer_asymmetric"
+	lintPortWithoutBridge   = "port_without_bridge"
+	lintInterfaceOfPort     = "interface_ofport"
+	lintInterfaceError      = "interface_error"
+	lintBridgeWithoutUplink = "bridge_without_uplink"
+	lintColor               = "#FFA500"
+)
+
+// lintUplinkTypes are the OVS interface types that leave the host.
+var lintUplinkTypes = []string{"dpdk", "vxlan", "gre", "geneve", "stt", "lisp"}
+
+// WiringFinding is one OVS wiring problem on a hypervisor. Key is the UID of
+// the offending element when it was discovered.
+type WiringFinding struct {
+	Check     string `json:"check,required"`
+	Host      string `json:"host,required"`
+	Bridge    string `json:"bridge,omitempty"`
+	Port      string `json:"port,omitempty"`
+	Interface string `json:"interface,omitempty"`
+	Key       string `json:"key,omitempty"`
+	Message   string `json:"message,required"`
+	hostIP    string
+	entity    string
+}
+
+type WiringLint struct {
+	Cloud    string          `json:"cloud,required"`
+	Summary  map[string]int  `json:"summary,required"`
+	Findings []WiringFinding `json:"findings,required"`
+}
+
+func (l *WiringLint) add(finding WiringFinding) {
+	l.Summary[finding.Check]++
+	l.Findings = append(l.Findings, finding)
+}
+
+// interfaceWarnings returns the messages of the findings on an interface.
+func (l *WiringLint) interfaceWarnings(hostIP string, name string) []string {
+	if l == nil {
+		return nil
+	}
+	var warnings []string
+	for _, finding := range l.Findings {
+		if finding.hostIP == hostIP && finding.Interface == name {
+			warnings = append(warnings, finding.Message)
+		}
+	}
+	return warnings
+}
+
+// lintWiring checks the OVS bridges, ports and interfaces of each hypervisor
+// against each other.
+func lintWiring(g *TopologyGraph) *WiringLint {
+	l := &WiringLint{
+		Cloud:    g.Cloud.Name,
+		Summary:  make(map[string]int),
+		Findings: make([]WiringFinding, 0),
+	}
+	for _, hypervisor := range g.Hypervisors() {
+		hostIP := hypervisor.HostIP
+		interfaces := make(map[string]*GraphEntity)
+		uplinks := make(map[string]bool)
+		for _, relation := range g.HostRelations(hostIP, graphRelationUplink) {
+			uplinks[relation.Target] = true
+		}
+
+		for _, bridge := range g.Children(hypervisor.Key, graphEntityBridge) {
+			for _, port := range g.Children(bridge.Key, graphEntityPort) {
+				for _, iface := range g.Children(port.Key, graphEntityInterface) {
+					interfaces[iface.Name] = iface
+					finding := WiringFinding{
+						Host:      hypervisor.Name,
+						Bridge:    bridge.Name,
+						Port:      port.Name,
+						Interface: iface.Name,
+						Key:       iface.UID,
+						hostIP:    hostIP,
+						entity:    iface.Key,
+					}
+					if iface.Interface.OfPort == -1 {
+						finding.Check = lintInterfaceOfPort
+						finding.Message = "Interface " + iface.Name + " on bridge " + bridge.Name + " has ofport -1"
+						l.add(finding)
+					}
+					if len(iface.Interface.Error) > 0 {
+						finding.Check = lintInterfaceError
+						finding.Message = "Interface " + iface.Name + " on bridge " + bridge.Name + " reports error: " + iface.Interface.Error
+						l.add(finding)
+					}
+					if queryContains(lintUplinkTypes, iface.Interface.Type) {
+						uplinks[bridge.Key] = true
+					}
+				}
+			}
+		}
+
+		for _, bc := range ovsGetBridgeConnections(hostIP) {
+			source := bc.SourceInterface
+			peer := source.Options["peer"]
+			finding := WiringFinding{
+				Check:     lintPatchPeerMissing,
+				Host:      hypervisor.Name,
+				Bridge:    bc.SourceBridge.Name,
+				Port:      bc.SourcePort.Name,
+				Interface: source.Name,
+				hostIP:    hostIP,
+				entity:    hypervisor.Key,
+			}
+			if e, ok := interfaces[source.Name]; ok {
+				finding.Key = e.UID
+				finding.entity = e.Key
+			}
+			switch {
+			case len(peer) == 0:
+				finding.Message = "Patch port " + source.Name + " has no peer"
+			case len(bc.TargetInterface.Name) == 0:
+				finding.Message = "Patch port " + source.Name + " peers with " + peer + ", which does not exist"
+			case bc.TargetInterface.Type != "patch":
+				finding.Check = lintPatchPeerAsymmetric
+				finding.Message = "Patch port " + source.Name + " peers with " + peer + ", which is not a patch port"
+			case bc.TargetInterface.Options["peer"] != source.Name:
+				finding.Check = lintPatchPeerAsymmetric
+				finding.Message = "Patch port " + source.Name + " peers with " + peer + ", which peers with " + strconv.Quote(bc.TargetInterface.Options["peer"])
+			case len(bc.TargetBridge.Name) == 0:
+				finding.Message = "Patch port " + source.Name + " peers with " + peer + ", which is on no bridge"
+			default:
+				if len(bc.SourceBridge.Name) > 0 {
+					uplinks[graphBridgeKey(hostIP, bc.SourceBridge.Name)] = true
+				}
+				continue
+			}
+			l.add(finding)
+		}
+
+		bridgePorts := make(map[string]bool)
+		for _, bridge := range ovsGetBridges(hostIP) {
+			for _, portUUID := range bridge.PortUUIDs {
+				bridgePorts[portUUID] = true
+			}
+		}
+		for _, port := range ovsGetPorts(hostIP) {
+			if bridgePorts[port.UUID] {
+				continue
+			}
+			l.add(WiringFinding{
+				Check:   lintPortWithoutBridge,
+				Host:    hypervisor.Name,
+				Port:    port.Name,
+				Message: "Port " + port.Name + " is on no bridge",
+				hostIP:  hostIP,
+				entity:  hypervisor.Key,
+			})
+		}
+
+		for _, bridge := range g.Children(hypervisor.Key, graphEntityBridge) {
+			if uplinks[bridge.Key] {
+				continue
+			}
+			l.add(WiringFinding{
+				Check:   lintBridgeWithoutUplink,
+				Host:    hypervisor.Name,
+				Bridge:  bridge.Name,
+				Key:     bridge.UID,
+				Message: "Bridge " + bridge.Name + " has no uplink, tunnel or patch to another bridge",
+				hostIP:  hostIP,
+				entity:  bridge.Key,
+			})
+		}
+	}
+	return l
+}
+
+// addWiringWarnings lists each finding in the warnings of the element it is
+// on, or of its nearest ancestor the view shows.
+func (b *topologyBuilder) addWiringWarnings() {
+	if b.graph == nil || b.graph.lint == nil {
+		return
+	}
+	for _, finding := range b.graph.lint.Findings {
+		for key := finding.entity; len(key) > 0; {
+			if i, ok := b.keyIds[key]; ok {
+				node := &b.nodes[i]
+				if node.Props == nil {
+					node.Props = make(map[string]interface{})
+				}
+				warnings, _ := node.Props["warnings"].([]string)
+				node.Props["warnings"] = append(warnings, finding.Message)
+				break
+			}
+			e := b.graph.Entity(key)
+			if e == nil {
+				break
+			}
+			key = e.Parent
+		}
+	}
+}
+
+// topologyMissingPeerNode stands in for the peer of a patch port that is not
+// on any bridge.
+func topologyMissingPeerNode(bc *OvsBridgeConnection) TopologyNode {
+	name := bc.SourceInterface.Options["peer"]
+	if len(name) == 0 {
+		name = bc.SourceInterface.Name + " (no peer)"
+	}
+	props := make(map[string]interface{})
+	props["missing"] = true
+	return TopologyNode{
+		Name:       name,
+		DeviceType: "port",
+		Color:      lintColor,
+		Props:      props,
+	}
+}
+
+func GetWiringLint(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	cloudName := httprouter.ContextParams(ctx).ByName("cloud_name")
+	g := topologyGetGraph(rw, r, cloudName)
+	if g == nil {
+		return
+	}
+	luddite.WriteResponse(rw, http.StatusOK, g.lint)
+}
+
+func InitLint(router *httprouter.Router) {
+	router.GET("/topology/lint/:cloud_name", authorize(authRoleViewer, viewCached(GetWiringLint)))
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/SpirentOrion/httprouter"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLintWiringFindings(t *testing.T) {
+	defer testFixture()()
+	ip := "10.0.0.2"
+	ovsInterfaces[ip][0].OfPort = -1
+	ovsInterfaces[ip][0].Error = "could not open network device qvo1"
+	ovsInterfaces[ip][3].Options = map[string]string{"peer": "phy-br-int"}
+	ovsPorts[ip] = append(ovsPorts[ip], OvsPort{UUID: ip + "p99", Name: "stray"})
+	lint := lintWiring(graphBuild(&clouds[0]))
+
+	want := []WiringFinding{
+		{Check: "interface_ofport", Interface: "qvo1", Message: "Interface qvo1 on bridge br-int has ofport -1"},
+		{Check: "interface_error", Interface: "qvo1", Message: "Interface qvo1 on bridge br-int reports error: could not open network device qvo1"},
+		{Check: "patch_peer_asymmetric", Interface: "patch-tun", Message: `Patch port patch-tun peers with patch-int, which peers with "phy-br-int"`},
+		{Check: "patch_peer_asymmetric", Interface: "patch-int", Message: `Patch port patch-int peers with phy-br-int, which peers with "int-br-phy"`},
+		{Check: "patch_peer_missing", Interface: "ex-dangling", Message: "Patch port ex-dangling peers with missing, which does not exist"},
+		{Check: "port_without_bridge", Message: "Port stray is on no bridge"},
+		{Check: "bridge_without_uplink", Message: "Bridge br-tun has no uplink, tunnel or patch to another bridge"},
+		{Check: "bridge_without_uplink", Message: "Bridge br-ex has no uplink, tunnel or patch to another bridge"},
+	}
+	var found []WiringFinding
+	for _, finding := range lint.Findings {
+		if finding.Host == "hv2" {
+			found = append(found, finding)
+		}
+	}
+	if len(found) != len(want) {
+		t.Fatalf("hv2 findings %+v, want %d", found, len(want))
+	}
+	for i, finding := range found {
+		if finding.Check != want[i].Check || finding.Interface != want[i].Interface || finding.Message != want[i].Message {
+			t.Errorf("finding %d = %s %s %q, want %s %s %q", i, finding.Check, finding.Interface, finding.Message, want[i].Check, want[i].Interface, want[i].Message)
+		}
+	}
+	if lint.Summary["patch_peer_missing"] != 2 || lint.Summary["bridge_without_uplink"] != 3 {
+		t.Errorf("summary %v, want the hv1 and hv2 findings counted together", lint.Summary)
+	}
+	if warnings := lint.interfaceWarnings(ip, "qvo1"); len(warnings) != 2 {
+		t.Errorf("qvo1 warnings %v, want the ofport and error findings", warnings)
+	}
+}
+
+func TestLintWiringTunnelIsAnUplink(t *testing.T) {
+	defer testFixture()()
+	ip := "10.0.0.1"
+	ovsInterfaces[ip][4].Type = "vxlan"
+	ovsInterfaces[ip][4].Options = map[string]string{"remote_ip": "10.0.0.2"}
+	lint := lintWiring(graphBuild(&clouds[0]))
+
+	for _, finding := range lint.Findings {
+		if finding.Host == "hv1" {
+			t.Errorf("hv1 finding %s %q, want none with a vxlan on br-ex", finding.Check, finding.Message)
+		}
+	}
+}
+
+func TestLintMissingPeerNodeIsKeyedAndLast(t *testing.T) {
+	defer testFixture()()
+	router := httprouter.New()
+	InitTopology(router)
+	r, _ := http.NewRequest("GET", "http://topology/topology/cloudHypervisorOvsNetworkTopology/c1/hv1", nil)
+	rw := httptest.NewRecorder()
+	router.ServeHTTP(rw, r)
+	var data TopologyData
+	if err := json.Unmarshal(rw.Body.Bytes(), &data); err != nil || len(data.Nodes) == 0 {
+		t.Fatalf("GET %s = %d %s", r.URL.Path, rw.Code, rw.Body.String())
+	}
+
+	peer := data.Nodes[len(data.Nodes)-1]
+	if missing, _ := peer.Props["missing"].(bool); !missing || peer.Name != "missing" {
+		t.Fatalf("last node %+v, want the stand-in for the missing peer", peer)
+	}
+	iface := graphGet(&clouds[0]).Entity(graphInterfaceKey("10.0.0.1", "ex-dangling"))
+	if peer.Key != iface.UID+"/peer" {
+		t.Errorf("stand-in key = %q, want %q", peer.Key, iface.UID+"/peer")
+	}
+	for _, link := range data.Links {
+		if link.Props["source_interface"] == "ex-dangling" && link.Target != peer.ID {
+			t.Errorf("ex-dangling link target = %d, want the stand-in %d", link.Target, peer.ID)
+		}
+	}
+}
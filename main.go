@@ -17,16 +17,26 @@ var shutdown = false
 
 func Cleanup() {
 	shutdown = true
+	historyFlush()
 }
 
 func usage() {
 	fmt.Fprintf(os.Stderr, "usage: %s [-c topology.yaml]\n", os.Args[0])
+	for _, name := range cliNames() {
+		fmt.Fprintf(os.Stderr, "       %s %s\n", os.Args[0], cliCommands[name].usage)
+	}
 }
 
 func main() {
 	var cfgFile string
 	var err error
 
+	if len(os.Args) > 1 {
+		if command, ok := cliCommands[os.Args[1]]; ok {
+			os.Exit(command.run(os.Args[2:]))
+		}
+	}
+
 	fs := flag.NewFlagSet("topology", flag.ExitOnError)
 	fs.StringVar(&cfgFile, "c", "topology.yaml", "Path to config file")
 	fs.Usage = usage
@@ -43,8 +53,22 @@ func main() {
 		panic(err)
 	}
 
+	InitAuth(service.Router())
+	InitAudit(service.Router())
 	InitDiscovery(service.Router())
 	InitTopology(service.Router())
+	InitStats(service.Router())
+	InitHistory(service.Router())
+	InitReport(service.Router())
+	InitAlerts(service.Router())
+	InitPlacement(service.Router())
+	InitQuery(service.Router())
+	InitTestBeds(service.Router())
+	InitSavedLayouts(service.Router())
+	InitSearch(service.Router())
+	InitInventory(service.Router())
+	InitLint(service.Router())
+	InitProjects(service.Router())
 
 	go func() {
 		service.Logger().Info("Starting to listen on " + cfg.Service.Addr)
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"errors"
+	"github.com/SpirentOrion/httprouter"
+	"github.com/SpirentOrion/luddite"
+	"golang.org/x/net/context"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var neighborhoodRelations = []string{graphRelationContains, graphRelationPatch, graphRelationAttachment, graphRelationUplink, graphRelationNetwork}
+
+var neighborhoodKinds = []string{graphEntityCloud, graphEntityHypervisor, graphEntityInstance, graphEntityVnic, graphEntityBridge, graphEntityPort, graphEntityInterface, graphEntityNetwork, graphEntityPhysicalNic}
+
+type neighborhoodEdge struct {
+	relation int
+	peer     string
+}
+
+// neighborhoodMatch reports whether e is named by entity: its key, name,
+// instance UUID or MAC address.
+func neighborhoodMatch(e *GraphEntity, entity string) bool {
+	if e.Key == entity || e.Name == entity {
+		return true
+	}
+	switch e.Kind {
+	case graphEntityInstance:
+		return e.Instance.UUID == entity
+	case graphEntityVnic:
+		return strings.EqualFold(e.Vnic.MacAddress, entity) || e.Vnic.DevName == entity
+	case graphEntityInterface:
+		return strings.EqualFold(e.Interface.MacAddressInUse, entity)
+	case graphEntityPhysicalNic:
+		return strings.EqualFold(e.PhysicalNic.MacAddress, entity)
+	}
+	return false
+}
+
+// neighborhoodFind resolves the start entity. kind and hypervisor narrow
+// names that repeat across hosts.
+func neighborhoodFind(g *TopologyGraph, entity string, kind string, hypervisorName string) (*GraphEntity, *APIError) {
+	if e := g.Entity(entity); e != nil {
+		return e, nil
+	}
+
+	var hostIP string
+	if len(hypervisorName) > 0 {
+		hypervisor := g.FindHypervisor(hypervisorName)
+		if hypervisor == nil {
+			hypervisor = g.FindHypervisorByHostName(hypervisorName)
+		}
+		if hypervisor == nil {
+			return nil, &APIError{http.StatusNotFound, "Hypervisor " + hypervisorName + " for cloud " + g.Cloud.Name + " Not discovered"}
+		}
+		hostIP = hypervisor.HostIP
+	}
+
+	var keys []string
+	for key, e := range g.Entities {
+		if len(kind) > 0 && e.Kind != kind {
+			continue
+		}
+		if len(hostIP) > 0 && e.HostIP != hostIP {
+			continue
+		}
+		if neighborhoodMatch(e, entity) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	switch len(keys) {
+	case 0:
+		return nil, &APIError{http.StatusNotFound, "Entity " + entity + " for cloud " + g.Cloud.Name + " Not discovered"}
+	case 1:
+		return g.Entity(keys[0]), nil
+	}
+	return nil, &APIError{http.StatusConflict, "Entity " + entity + " is ambiguous, use kind, hypervisor or one of the keys " + strings.Join(keys, ", ")}
+}
+
+// neighborhoodCollect walks the relations of the given kinds in both
+// directions and returns the entities within hops of start in visiting order
+// with their distance.
+func neighborhoodCollect(g *TopologyGraph, start *GraphEntity, hops int, relations []string) ([]string, map[string]int) {
+	edges := make(map[string][]neighborhoodEdge)
+	for i, relation := range g.Relations {
+		if len(relation.Target) == 0 || !queryContains(relations, relation.Kind) {
+			continue
+		}
+		edges[relation.Source] = append(edges[relation.Source], neighborhoodEdge{i, relation.Target})
+		edges[relation.Target] = append(edges[relation.Target], neighborhoodEdge{i, relation.Source})
+	}
+
+	order := []string{start.Key}
+	distance := map[string]int{start.Key: 0}
+	for i := 0; i < len(order); i++ {
+		key := order[i]
+		if distance[key] == hops {
+			continue
+		}
+		for _, edge := range edges[key] {
+			if _, ok := distance[edge.peer]; ok {
+				continue
+			}
+			distance[edge.peer] = distance[key] + 1
+			order = append(order, edge.peer)
+		}
+	}
+	return order, distance
+}
+
+func (b *topologyBuilder) neighborhoodNode(g *TopologyGraph, e *GraphEntity) TopologyNode {
+	switch e.Kind {
+	case graphEntityCloud:
+		return topologyCloudNode(e.Cloud, b.cloudViews(e.Name, false))
+	case graphEntityHypervisor:
+		return topologyHypervisorNode(e.Hypervisor, b.hypervisorViews(e.Name))
+	case graphEntityInstance:
+		return topologyInstanceNode(e.Instance, b.instanceViews(g.Entity(e.Parent).Name, e.Name))
+	case graphEntityVnic:
+		return topologyVnicNode(e.Vnic)
+	case graphEntityBridge:
+		return topologyBridgeNode(e.Bridge, e.HostIP)
+	case graphEntityPort:
+		return topologyOvsPortNode(e.Port)
+	case graphEntityInterface:
+		return topologyOvsInterfaceNode(e.Interface)
+	case graphEntityNetwork:
+		return topologyNetworkNode(e.Network, b.networkViews(e.Name))
+	}
+	return topologyPortNode(e.PhysicalNic)
+}
+
+func (b *topologyBuilder) neighborhoodUrl(key string, hops int, relations []string) string {
+	values := url.Values{}
+	values.Set("entity", key)
+	values.Set("hops", strconv.Itoa(hops))
+	values.Set("relations", strings.Join(relations, ","))
+	return b.viewUrl("cloudNeighborhoodTopology", b.cloudName) + "?" + values.Encode()
+}
+
+// addNeighborhood projects the collected entities and every relation
+// between them.
+func (b *topologyBuilder) addNeighborhood(g *TopologyGraph, order []string, distance map[string]int, hops int, relations []string) {
+	nodes := make(map[string]TopologyNode)
+	for _, key := range order {
+		e := g.Entity(key)
+		node := b.neighborhoodNode(g, e)
+		node.Props["entity_key"] = e.Key
+		node.Props["entity_kind"] = e.Kind
+		node.Props["hops"] = distance[key]
+		if node.Views == nil {
+			node.Views = make(map[string]string)
+		}
+		node.Views["Neighborhood"] = b.neighborhoodUrl(e.Key, hops, relations)
+		nodes[key] = b.addNode(key, node)
+	}
+
+	for _, relation := range g.Relations {
+		if !queryContains(relations, relation.Kind) {
+			continue
+		}
+		source, ok := nodes[relation.Source]
+		if !ok {
+			continue
+		}
+		target, ok := nodes[relation.Target]
+		if !ok {
+			continue
+		}
+		var link TopologyLink
+		switch relation.Kind {
+		case graphRelationPatch:
+			link = topologyPatchLink(relation.Connection, source.ID, source.Name, target.ID, target.Name, true)
+			if warnings := g.lint.interfaceWarnings(relation.HostIP, relation.Connection.SourceInterface.Name); len(warnings) > 0 {
+				link.Color = lintColor
+				link.Props["warnings"] = warnings
+			}
+		case graphRelationAttachment:
+			link = topologyAttachmentLink(relation.Connection, source, target.ID, target.Name, true)
+		case graphRelationUplink:
+			link = topologyUplinkLink(relation.Connection, target.ID, target.Name, source, true)
+		case graphRelationNetwork:
+			link = topologyNodeLink(source, target, "#888888")
+		default:
+			link = topologyNodeLink(source, target, "#0000FF")
+		}
+		link.Props["relation"] = relation.Kind
+		b.addLink(link)
+	}
+}
+
+func neighborhoodParse(values url.Values) (int, []string, error) {
+	hops := 1
+	if len(values.Get("hops")) > 0 {
+		var err error
+		hops, err = strconv.Atoi(values.Get("hops"))
+		if err != nil || hops < 0 {
+			return 0, nil, errors.New("Invalid hops " + values.Get("hops"))
+		}
+	}
+	relations := queryList(values["relations"])
+	if len(relations) == 0 {
+		relations = neighborhoodRelations
+	}
+	for _, relation := range relations {
+		if !queryContains(neighborhoodRelations, relation) {
+			return 0, nil, errors.New("Invalid relation " + relation + ", expected one of " + strings.Join(neighborhoodRelations, ", "))
+		}
+	}
+	if kind := values.Get("kind"); len(kind) > 0 && !queryContains(neighborhoodKinds, kind) {
+		return 0, nil, errors.New("Invalid kind " + kind + ", expected one of " + strings.Join(neighborhoodKinds, ", "))
+	}
+	return hops, relations, nil
+}
+
+func CloudNeighborhoodTopology(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	cloudName := httprouter.ContextParams(ctx).ByName("cloud_name")
+	values := r.URL.Query()
+	entity := values.Get("entity")
+	if len(entity) == 0 {
+		apiError := APIError{http.StatusBadRequest, "Neighborhood requires an entity"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	hops, relations, err := neighborhoodParse(values)
+	if err != nil {
+		apiError := APIError{http.StatusBadRequest, err.Error()}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	g := topologyGetGraph(rw, r, cloudName)
+	if g == nil {
+		return
+	}
+	start, apiError := neighborhoodFind(g, entity, values.Get("kind"), values.Get("hypervisor"))
+	if apiError != nil {
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+
+	order, distance := neighborhoodCollect(g, start, hops, relations)
+	b := newGraphTopologyBuilder(r, g)
+	b.addNeighborhood(g, order, distance, hops, relations)
+
+	views := b.cloudViews(cloudName, false)
+	views["Zoom Out"] = b.neighborhoodUrl(start.Key, hops+1, relations)
+	if hops > 0 {
+		views["Zoom In"] = b.neighborhoodUrl(start.Key, hops-1, relations)
+	}
+	title := cloudName + " " + start.Name + " Neighborhood (" + strconv.Itoa(hops) + " hops)"
+	topologyWrite(rw, r, b.data(title, views))
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/SpirentOrion/httprouter"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestNeighborhoodHopsAndRelations(t *testing.T) {
+	defer testFixture()()
+	router := httprouter.New()
+	InitTopology(router)
+
+	tests := []struct {
+		query string
+		keys  []string
+	}{
+		{"entity=vRouter1&hops=0", []string{"instance/10.0.0.1/u1"}},
+		{"entity=vRouter1", []string{"hypervisor/10.0.0.1", "instance/10.0.0.1/u1", "vnic/10.0.0.1/u1/0", "vnic/10.0.0.1/u1/1", "vnic/10.0.0.1/u1/2"}},
+		{"entity=vRouter1&relations=network", []string{"instance/10.0.0.1/u1"}},
+		{"entity=net-b&kind=network&relations=network", []string{"network/c1/n2", "vnic/10.0.0.1/u1/1"}},
+		{"entity=net-b&kind=network&hops=2&relations=network,contains", []string{"cloud/c1", "hypervisor/10.0.0.1", "hypervisor/10.0.0.2", "hypervisor/10.0.0.3", "instance/10.0.0.1/u1", "network/c1/n1", "network/c1/n2", "network/c1/n4", "vnic/10.0.0.1/u1/1"}},
+		{"entity=eth0&kind=physical_nic&hypervisor=hv2", []string{"hypervisor/10.0.0.2", "physical_nic/10.0.0.2/eth0"}},
+	}
+	for _, test := range tests {
+		path := "/topology/cloudNeighborhoodTopology/c1?" + test.query
+		r, _ := http.NewRequest("GET", "http://topology"+path, nil)
+		rw := httptest.NewRecorder()
+		router.ServeHTTP(rw, r)
+		if rw.Code != http.StatusOK {
+			t.Errorf("GET %s = %d, want %d", path, rw.Code, http.StatusOK)
+			continue
+		}
+		var data TopologyData
+		if err := json.Unmarshal(rw.Body.Bytes(), &data); err != nil {
+			t.Errorf("GET %s: %v", path, err)
+			continue
+		}
+		var keys []string
+		for _, node := range data.Nodes {
+			keys = append(keys, node.Props["entity_key"].(string))
+		}
+		sort.Strings(keys)
+		if strings.Join(keys, " ") != strings.Join(test.keys, " ") {
+			t.Errorf("GET %s nodes = %v, want %v", path, keys, test.keys)
+		}
+	}
+}
+
+func TestNeighborhoodErrors(t *testing.T) {
+	defer testFixture()()
+	router := httprouter.New()
+	InitTopology(router)
+
+	tests := []struct {
+		query  string
+		status int
+	}{
+		{"entity=net-a", http.StatusConflict},
+		{"entity=eth0", http.StatusConflict},
+		{"entity=eth0&kind=physical_nic", http.StatusConflict},
+		{"entity=net-a&kind=instance", http.StatusOK},
+		{"entity=net-a&hypervisor=hv2", http.StatusOK},
+		{"entity=ghost", http.StatusNotFound},
+		{"entity=vRouter1&hypervisor=hv9", http.StatusNotFound},
+		{"", http.StatusBadRequest},
+		{"entity=vRouter1&hops=-1", http.StatusBadRequest},
+		{"entity=vRouter1&relations=peer", http.StatusBadRequest},
+		{"entity=vRouter1&kind=router", http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		path := "/topology/cloudNeighborhoodTopology/c1?" + test.query
+		r, _ := http.NewRequest("GET", "http://topology"+path, nil)
+		rw := httptest.NewRecorder()
+		router.ServeHTTP(rw, r)
+		if rw.Code != test.status {
+			t.Errorf("GET %s = %d, want %d", path, rw.Code, test.status)
+		}
+	}
+}
@@ -4,12 +4,15 @@ import (
 	"encoding/json"
 	log "github.com/SpirentOrion/logrus"
 	"github.com/socketplane/libovsdb"
+	"sync"
+	"time"
 )
 
 type OvsBridge struct {
-	UUID      string
-	Name      string
-	PortUUIDs []string
+	UUID         string
+	Name         string
+	DatapathType string
+	PortUUIDs    []string
 }
 
 type OvsPort struct {
@@ -26,6 +29,8 @@ type OvsInterface struct {
 	Options         map[string]string
 	ExternalIDs     map[string]string
 	Statistics      map[string]float64
+	OfPort          int
+	Error           string
 }
 
 type OvsBridgeConnection struct {
@@ -48,6 +53,11 @@ var ovsBridges map[string][]OvsBridge = make(map[string][]OvsBridge)
 var ovsPorts map[string][]OvsPort = make(map[string][]OvsPort)
 var ovsInterfaces map[string][]OvsInterface = make(map[string][]OvsInterface)
 
+// ovsStatsConnections holds the connection statistics polls reuse for each
+// hypervisor until it fails or the hypervisor goes away.
+var ovsStatsConnections map[string]*OvsConnection = make(map[string]*OvsConnection)
+var ovsStatsLock sync.Mutex
+
 func ovsLoadInfo(cloudInfo CloudInfo, ipAddress string) error {
 	oc, err := ovsConnect(cloudInfo, ipAddress, 6640)
 	if err != nil {
@@ -137,10 +147,12 @@ func (c *OvsConnection) ovsLoadBridges() error {
 			for k, v := range oSet.GoSet {
 				portUUIDs[k] = v.(libovsdb.UUID).GoUUID
 			}
+			datapathType, _ := row["datapath_type"].(string)
 			bridges[i] = OvsBridge{
-				UUID:      row["_uuid"].([]interface{})[1].(string),
-				Name:      row["name"].(string),
-				PortUUIDs: portUUIDs,
+				UUID:         row["_uuid"].([]interface{})[1].(string),
+				Name:         row["name"].(string),
+				DatapathType: datapathType,
+				PortUUIDs:    portUUIDs,
 			}
 		}
 		ovsBridges[c.ipAddress] = bridges
@@ -257,6 +269,14 @@ func (c *OvsConnection) ovsLoadInterfaces() error {
 				macInUse = ""
 
 			}
+			// ofport is an empty set until OVS assigns one, and -1 when it
+			// could not add the interface.
+			ofPort := 0
+			if v, ok := row["ofport"].(float64); ok {
+				ofPort = int(v)
+			}
+			ifaceError, _ := row["error"].(string)
+			statsRecordOvsSample(c.ipAddress, row["name"].(string), statistics, time.Now())
 			interfaces[i] = OvsInterface{
 				UUID:            row["_uuid"].([]interface{})[1].(string),
 				Name:            row["name"].(string),
@@ -265,6 +285,8 @@ func (c *OvsConnection) ovsLoadInterfaces() error {
 				Options:         options,
 				ExternalIDs:     externalIDs,
 				Statistics:      statistics,
+				OfPort:          ofPort,
+				Error:           ifaceError,
 			}
 		}
 		ovsInterfaces[c.ipAddress] = interfaces
@@ -278,6 +300,91 @@ func (c *OvsConnection) ovsLoadInterfaces() error {
 	return nil
 }
 
+func ovsLoadStatistics(cloudInfo CloudInfo, ipAddress string) error {
+	ovsStatsLock.Lock()
+	oc := ovsStatsConnections[ipAddress]
+	ovsStatsLock.Unlock()
+	if oc == nil {
+		var err error
+		oc, err = ovsConnect(cloudInfo, ipAddress, 6640)
+		if err != nil {
+			oc, err = ovsConnect(cloudInfo, ipAddress, 6641)
+			if err != nil {
+				return err
+			}
+		}
+		ovsStatsLock.Lock()
+		ovsStatsConnections[ipAddress] = oc
+		ovsStatsLock.Unlock()
+	}
+
+	err := oc.ovsLoadInterfaceStatistics()
+	if err != nil {
+		ovsStatsLock.Lock()
+		delete(ovsStatsConnections, ipAddress)
+		ovsStatsLock.Unlock()
+		oc.ovsDisconnect()
+	}
+	return err
+}
+
+// ovsPruneStatistics closes the statistics connections to hypervisors that
+// are no longer polled.
+func ovsPruneStatistics(polled map[string]bool) {
+	ovsStatsLock.Lock()
+	var stale []*OvsConnection
+	for ipAddress, oc := range ovsStatsConnections {
+		if !polled[ipAddress] {
+			stale = append(stale, oc)
+			delete(ovsStatsConnections, ipAddress)
+		}
+	}
+	ovsStatsLock.Unlock()
+
+	for _, oc := range stale {
+		oc.ovsDisconnect()
+	}
+}
+
+func (c *OvsConnection) ovsLoadInterfaceStatistics() error {
+	condition := libovsdb.NewCondition("name", "!=", "")
+	selectOp := libovsdb.Operation{
+		Op:      "select",
+		Table:   "Interface",
+		Where:   []interface{}{condition},
+		Columns: []string{"name", "statistics"},
+	}
+	operations := []libovsdb.Operation{selectOp}
+	reply, err := c.connection.Transact("Open_vSwitch", operations...)
+
+	if err != nil || len(reply) == 0 {
+		logFields := log.Fields{
+			"Name":      c.cloudInfo.Name,
+			"IpAddress": c.ipAddress,
+		}
+		if err != nil {
+			logFields["Error"] = err.Error()
+		}
+		service.Logger().WithFields(logFields).Error("Error loading OVS interface statistics")
+		return err
+	}
+
+	now := time.Now()
+	for _, row := range reply[0].Rows {
+		sl := row["statistics"].([]interface{})
+		bsliced, _ := json.Marshal(sl)
+		var oMap libovsdb.OvsMap
+		json.Unmarshal(bsliced, &oMap)
+		statistics := make(map[string]float64, len(oMap.GoMap))
+		for k, v := range oMap.GoMap {
+			statistics[k.(string)] = v.(float64)
+		}
+		statsRecordOvsSample(c.ipAddress, row["name"].(string), statistics, now)
+	}
+
+	return nil
+}
+
 func ovsGetBridges(ipAddress string) []OvsBridge {
 	if bList, ok := ovsBridges[ipAddress]; ok == true {
 		return bList
@@ -316,6 +423,22 @@ func ovsGetDPDKInterfaces(ipAddress string) []OvsInterface {
 	return pIList
 }
 
+func ovsGetBridgeForInterface(ipAddress string, name string) *OvsBridge {
+	for _, port := range ovsGetPorts(ipAddress) {
+		if port.Name != name {
+			continue
+		}
+		for _, bridge := range ovsGetBridges(ipAddress) {
+			for _, portUUID := range bridge.PortUUIDs {
+				if port.UUID == portUUID {
+					return &bridge
+				}
+			}
+		}
+	}
+	return nil
+}
+
 func ovsGetBridgeConnections(ipAddress string) []OvsBridgeConnection {
 	var bridgeConnections []OvsBridgeConnection
 	interfaceList := ovsGetInterfaces(ipAddress)
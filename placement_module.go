@@ -0,0 +1,339 @@
+package main
+
+import (
+	"github.com/SpirentOrion/httprouter"
+	log "github.com/SpirentOrion/logrus"
+	"github.com/SpirentOrion/luddite"
+	"golang.org/x/net/context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+type InstancePlacement struct {
+	Hypervisor string     `json:"hypervisor,required"`
+	HostIP     string     `json:"host_ip,required"`
+	Source     string     `json:"source,required"`
+	Since      time.Time  `json:"since,required"`
+	Until      *time.Time `json:"until,omitempty"`
+}
+
+type InstancePlacementHistory struct {
+	UUID         string              `json:"uuid,required"`
+	Cloud        string              `json:"cloud,required"`
+	InstanceName string              `json:"instance_name,required"`
+	Placements   []InstancePlacement `json:"placements,required"`
+}
+
+type InstanceMigration struct {
+	UUID           string    `json:"uuid,required"`
+	InstanceName   string    `json:"instance_name,required"`
+	FromHypervisor string    `json:"from_hypervisor,required"`
+	FromHostIP     string    `json:"from_host_ip,required"`
+	ToHypervisor   string    `json:"to_hypervisor,required"`
+	ToHostIP       string    `json:"to_host_ip,required"`
+	Source         string    `json:"source,required"`
+	Time           time.Time `json:"time,required"`
+}
+
+type InstanceMigrations struct {
+	Migrations []InstanceMigration `json:"migrations,required"`
+}
+
+const (
+	placementSourceDiscovery = "discovery"
+	placementSourceEvent     = "event"
+)
+
+const placementStoreName = "placements.json"
+
+var placementHistory map[string]*InstancePlacementHistory = make(map[string]*InstancePlacementHistory)
+var placementLock sync.Mutex
+
+func placementRecentWindow() time.Duration {
+	window := time.Duration(cfg.Placement.RecentWindow) * time.Second
+	if window <= 0 {
+		window = time.Hour
+	}
+	return window
+}
+
+// placementUpdate records that the domain was seen on ipAddress and reports
+// the host it moved from, if any. Callers hold placementLock.
+func placementUpdate(cloudInfo CloudInfo, ipAddress string, instance LibvirtDomainInstance, source string, now time.Time) (bool, string) {
+	placement := InstancePlacement{
+		Hypervisor: instance.HypervisorName,
+		HostIP:     ipAddress,
+		Source:     source,
+		Since:      now,
+	}
+	history, ok := placementHistory[instance.UUID]
+	if !ok {
+		placementHistory[instance.UUID] = &InstancePlacementHistory{
+			UUID:         instance.UUID,
+			Cloud:        cloudInfo.Name,
+			InstanceName: instance.InstanceName,
+			Placements:   []InstancePlacement{placement},
+		}
+		return true, ""
+	}
+	if len(instance.InstanceName) > 0 {
+		history.InstanceName = instance.InstanceName
+	}
+	last := &history.Placements[len(history.Placements)-1]
+	if last.HostIP == ipAddress {
+		return false, ""
+	}
+
+	fromHostIP := last.HostIP
+	last.Until = &now
+	history.Placements = append(history.Placements, placement)
+	maxEntries := cfg.Placement.MaxEntries
+	if maxEntries > 0 && len(history.Placements) > maxEntries {
+		history.Placements = history.Placements[len(history.Placements)-maxEntries:]
+	}
+
+	logFields := log.Fields{
+		"Name":           cloudInfo.Name,
+		"Instance":       history.InstanceName,
+		"UUID":           instance.UUID,
+		"FromIpAddress":  fromHostIP,
+		"ToIpAddress":    ipAddress,
+		"PlacementEvent": source,
+	}
+	service.Logger().WithFields(logFields).Info("Instance moved to another hypervisor")
+	return true, fromHostIP
+}
+
+func placementRecordInstances(cloudInfo CloudInfo, ipAddress string, instances []LibvirtDomainInstance) {
+	now := time.Now()
+	var movedFrom []string
+	var movedUUIDs []string
+
+	placementLock.Lock()
+	changed := false
+	for _, instance := range instances {
+		updated, fromHostIP := placementUpdate(cloudInfo, ipAddress, instance, placementSourceDiscovery, now)
+		changed = changed || updated
+		if len(fromHostIP) > 0 {
+			movedFrom = append(movedFrom, fromHostIP)
+			movedUUIDs = append(movedUUIDs, instance.UUID)
+		}
+	}
+	placementLock.Unlock()
+
+	// The source host keeps listing the domain until it is rediscovered.
+	for i := range movedUUIDs {
+		libvirtRemoveDomainInstance(movedFrom[i], movedUUIDs[i])
+	}
+	if changed {
+		placementSave()
+	}
+}
+
+func placementRecordInstance(cloudInfo CloudInfo, ipAddress string, instance LibvirtDomainInstance, source string) {
+	placementLock.Lock()
+	changed, fromHostIP := placementUpdate(cloudInfo, ipAddress, instance, source, time.Now())
+	placementLock.Unlock()
+
+	if len(fromHostIP) > 0 {
+		libvirtRemoveDomainInstance(fromHostIP, instance.UUID)
+	}
+	if changed {
+		placementSave()
+	}
+}
+
+func placementGetHistory(cloudName string, instanceName string) *InstancePlacementHistory {
+	placementLock.Lock()
+	defer placementLock.Unlock()
+
+	for _, history := range placementHistory {
+		if history.Cloud != cloudName {
+			continue
+		}
+		if history.InstanceName == instanceName || history.UUID == instanceName {
+			h := *history
+			h.Placements = append([]InstancePlacement(nil), history.Placements...)
+			return &h
+		}
+	}
+	return nil
+}
+
+func placementGetMigrations(cloudName string, since time.Time) []InstanceMigration {
+	placementLock.Lock()
+	migrations := make([]InstanceMigration, 0)
+	for _, history := range placementHistory {
+		if history.Cloud != cloudName {
+			continue
+		}
+		for i := 1; i < len(history.Placements); i++ {
+			from := history.Placements[i-1]
+			to := history.Placements[i]
+			if to.Since.Before(since) {
+				continue
+			}
+			migrations = append(migrations, InstanceMigration{
+				UUID:           history.UUID,
+				InstanceName:   history.InstanceName,
+				FromHypervisor: from.Hypervisor,
+				FromHostIP:     from.HostIP,
+				ToHypervisor:   to.Hypervisor,
+				ToHostIP:       to.HostIP,
+				Source:         to.Source,
+				Time:           to.Since,
+			})
+		}
+	}
+	placementLock.Unlock()
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Time.After(migrations[j].Time)
+	})
+	return migrations
+}
+
+// placementGetRecentMove returns the latest move of the domain within the
+// recent window, used to annotate the topology views.
+func placementGetRecentMove(cloudName string, uuid string) *InstanceMigration {
+	placementLock.Lock()
+	defer placementLock.Unlock()
+
+	history, ok := placementHistory[uuid]
+	if !ok || history.Cloud != cloudName || len(history.Placements) < 2 {
+		return nil
+	}
+	from := history.Placements[len(history.Placements)-2]
+	to := history.Placements[len(history.Placements)-1]
+	if time.Since(to.Since) > placementRecentWindow() {
+		return nil
+	}
+	return &InstanceMigration{
+		UUID:           history.UUID,
+		InstanceName:   history.InstanceName,
+		FromHypervisor: from.Hypervisor,
+		FromHostIP:     from.HostIP,
+		ToHypervisor:   to.Hypervisor,
+		ToHostIP:       to.HostIP,
+		Source:         to.Source,
+		Time:           to.Since,
+	}
+}
+
+func placementSetMovedFromProps(props map[string]interface{}, move *InstanceMigration) {
+	props["moved_from"] = move.FromHypervisor
+	props["moved_at"] = move.Time
+}
+
+func placementMovedFromLink(move *InstanceMigration, fromNode TopologyNode, instanceNode TopologyNode) TopologyLink {
+	movedLinkProps := make(map[string]interface{})
+	movedLinkProps["source_name"] = fromNode.Name
+	movedLinkProps["target_name"] = instanceNode.Name
+	movedLinkProps["moved_at"] = move.Time
+	movedLinkProps["placement_event"] = move.Source
+	return TopologyLink{
+		Name:   "moved from",
+		Source: fromNode.ID,
+		Target: instanceNode.ID,
+		Color:  "#888888",
+		Dotted: true,
+		Props:  movedLinkProps,
+	}
+}
+
+func placementSave() {
+	placementLock.Lock()
+	histories := make([]InstancePlacementHistory, 0, len(placementHistory))
+	for _, history := range placementHistory {
+		histories = append(histories, *history)
+	}
+	err := storeSave(placementStoreName, histories)
+	placementLock.Unlock()
+
+	if err != nil {
+		logFields := log.Fields{
+			"Path":  storePath(placementStoreName),
+			"Error": err.Error(),
+		}
+		service.Logger().WithFields(logFields).Error("Error saving instance placement history")
+	}
+}
+
+func placementLoad() error {
+	var histories []InstancePlacementHistory
+	if err := storeLoad(placementStoreName, &histories); err != nil {
+		logFields := log.Fields{
+			"Path":  storePath(placementStoreName),
+			"Error": err.Error(),
+		}
+		service.Logger().WithFields(logFields).Error("Error loading instance placement history")
+		return err
+	}
+
+	placementLock.Lock()
+	defer placementLock.Unlock()
+
+	for i := range histories {
+		if len(histories[i].Placements) > 0 {
+			placementHistory[histories[i].UUID] = &histories[i]
+		}
+	}
+	return nil
+}
+
+func GetInstancePlacementHistory(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	cloudName := httprouter.ContextParams(ctx).ByName("cloud_name")
+	instanceName := httprouter.ContextParams(ctx).ByName("instance_name")
+	history := placementGetHistory(cloudName, instanceName)
+	if cloudInfo := cloudGetCloudInfo(cloudName); history != nil && cloudInfo != nil {
+		if scope := authProjectGraph(r, cloudInfo); scope != nil && !scope.HasInstance(history.UUID) {
+			history = nil
+		}
+	}
+	if history == nil {
+		apiError := APIError{http.StatusNotFound, "Instance " + instanceName + " for cloud " + cloudName + " Not discovered"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	luddite.WriteResponse(rw, http.StatusOK, history)
+}
+
+func GetInstanceMigrations(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	cloudName := httprouter.ContextParams(ctx).ByName("cloud_name")
+	cloudInfo := cloudGetCloudInfo(cloudName)
+	if cloudInfo == nil {
+		apiError := APIError{http.StatusNotFound, "Cloud " + cloudName + " Not discovered"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	since, err := parseTimeParam(r.URL.Query().Get("since"), time.Now().Add(-placementRecentWindow()))
+	if err != nil {
+		apiError := APIError{http.StatusBadRequest, "Invalid since time " + r.URL.Query().Get("since")}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+
+	migrations := InstanceMigrations{placementGetMigrations(cloudName, since)}
+	if scope := authProjectGraph(r, cloudInfo); scope != nil {
+		visible := make([]InstanceMigration, 0, len(migrations.Migrations))
+		for _, migration := range migrations.Migrations {
+			if scope.HasInstance(migration.UUID) {
+				visible = append(visible, migration)
+			}
+		}
+		migrations.Migrations = visible
+	}
+	luddite.WriteResponse(rw, http.StatusOK, migrations)
+}
+
+func InitPlacement(router *httprouter.Router) {
+	router.GET("/topology/placement/history/:cloud_name/:instance_name", authorize(authRoleViewer, GetInstancePlacementHistory))
+	router.GET("/topology/placement/migrations/:cloud_name", authorize(authRoleViewer, GetInstanceMigrations))
+
+	placementLoad()
+	if cfg.Placement.Events {
+		libvirtStartEventLoop()
+	}
+}
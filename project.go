@@ -0,0 +1,145 @@
+package main
+
+import (
+	"github.com/SpirentOrion/httprouter"
+	"github.com/SpirentOrion/luddite"
+	"golang.org/x/net/context"
+	"net/http"
+	"strconv"
+)
+
+// projectRedactedKinds are the infrastructure entities hidden from users
+// other than admins when redact_infrastructure is set.
+var projectRedactedKinds = []string{graphEntityHypervisor, graphEntityBridge, graphEntityPort, graphEntityInterface, graphEntityPhysicalNic}
+
+// projectName prefers the name of a project, which not every listing has.
+func projectName(project CloudProjectInfo) string {
+	if len(project.Name) > 0 {
+		return project.Name
+	}
+	return project.ID
+}
+
+// addProjects tags the instance and network nodes with their project and,
+// where the node has views, a link to the project's.
+func (b *topologyBuilder) addProjects() {
+	if b.graph == nil {
+		return
+	}
+	for key, i := range b.keyIds {
+		e := b.graph.Entity(key)
+		if e == nil || len(e.Project.ID) == 0 {
+			continue
+		}
+		node := &b.nodes[i]
+		if node.Props == nil {
+			node.Props = make(map[string]interface{})
+		}
+		node.Props["project_id"] = e.Project.ID
+		node.Props["project_name"] = e.Project.Name
+		if node.Views != nil {
+			node.Views["Project Topology"] = b.viewUrl("cloudProjectTopology", b.graph.Cloud.Name, projectName(e.Project))
+		}
+	}
+}
+
+// redactInfrastructure replaces the names, keys and properties of the
+// hypervisor, OVS and physical nodes, and of missing patch peers, with ones
+// numbered by kind, and strips
+// the links between them down to their end names.
+func (b *topologyBuilder) redactInfrastructure() {
+	keys := make([]string, len(b.nodes))
+	for key, i := range b.keyIds {
+		keys[i] = key
+	}
+	counts := make(map[string]int)
+	names := make(map[int]string)
+	for i := range b.nodes {
+		node := &b.nodes[i]
+		kind := ""
+		if e := b.graph.Entity(keys[i]); e != nil && queryContains(projectRedactedKinds, e.Kind) {
+			kind = e.Kind
+		} else if missing, _ := node.Props["missing"].(bool); missing {
+			kind = graphEntityPort
+		}
+		if len(kind) == 0 {
+			continue
+		}
+		counts[kind]++
+		node.Name = kind + "-" + strconv.Itoa(counts[kind])
+		node.Key = "redacted/" + node.Name
+		node.Props = map[string]interface{}{"redacted": true}
+		node.Views = nil
+		names[node.ID] = node.Name
+	}
+	for i := range b.links {
+		link := &b.links[i]
+		sourceName, sourceRedacted := names[link.Source]
+		targetName, targetRedacted := names[link.Target]
+		if !sourceRedacted && !targetRedacted {
+			continue
+		}
+		props := make(map[string]interface{})
+		props["source_name"] = link.Props["source_name"]
+		props["target_name"] = link.Props["target_name"]
+		if sourceRedacted {
+			props["source_name"] = sourceName
+		}
+		if targetRedacted {
+			props["target_name"] = targetName
+		}
+		link.Props = props
+	}
+	b.filtered = nil
+}
+
+func GetProjects(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	cloudName := httprouter.ContextParams(ctx).ByName("cloud_name")
+	cloudInfo := cloudGetCloudInfo(cloudName)
+	if cloudInfo == nil {
+		apiError := APIError{http.StatusNotFound, "Cloud " + cloudName + " Not discovered"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	projects := authProjects(r, cloudInfo)
+	list := CloudProjects{make([]CloudProjectInfo, 0)}
+	for _, project := range cloudGetProjectList(cloudInfo) {
+		if projects == nil || graphProjectSelected(project, projects) {
+			list.Projects = append(list.Projects, project)
+		}
+	}
+	luddite.WriteResponse(rw, http.StatusOK, list)
+}
+
+// CloudProjectTopology shows the instances and networks of one project and
+// the hypervisors, bridges and physical ports they use.
+func CloudProjectTopology(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	cloudName := httprouter.ContextParams(ctx).ByName("cloud_name")
+	project := httprouter.ContextParams(ctx).ByName("project_name")
+	g := topologyGetProjectGraph(rw, r, cloudName, project)
+	if g == nil {
+		return
+	}
+	q := TopologyQuery{
+		Cloud:        cloudName,
+		Layers:       []string{queryLayerOvs, queryLayerLinuxBridge, queryLayerPhysical, queryLayerL3},
+		noStatistics: true,
+	}
+	selections, apiError := queryResolve(g, &q)
+	if apiError != nil {
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	b := newGraphTopologyBuilder(r, g)
+	b.layout = layoutLayered
+	b.addQuery(g, &q, selections)
+
+	projectInfo := cloudGetProjectInfo(cloudName, project)
+	title := cloudName + " " + projectName(*projectInfo) + " Project Topology"
+	topologyWrite(rw, r, b.data(title, b.cloudViews(cloudName, false)))
+}
+
+func InitProjects(router *httprouter.Router) {
+	router.GET("/topology/projects/:cloud_name", authorize(authRoleViewer, viewCached(GetProjects)))
+	router.GET("/topology/cloudProjectTopology/:cloud_name/:project_name", authorize(authRoleViewer, viewCachedStats(CloudProjectTopology)))
+}
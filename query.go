@@ -0,0 +1,608 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/SpirentOrion/httprouter"
+	"github.com/SpirentOrion/luddite"
+	"golang.org/x/net/context"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	queryLayerL3          = "l3"
+	queryLayerLinuxBridge = "linux_bridge"
+	queryLayerOvs         = "ovs"
+	queryLayerPhysical    = "physical"
+)
+
+const (
+	queryCollapseNone    = "none"
+	queryCollapseBridges = "bridges"
+)
+
+// Depth of each entity below the cloud. Networks sit one level below
+// whatever links to them.
+const (
+	queryDepthHypervisor = 1
+	queryDepthInstance   = 2
+	queryDepthBridge     = 2
+	queryDepthVnic       = 3
+	queryDepthPhysical   = 3
+)
+
+type queryViewMode int
+
+const (
+	queryViewLinks queryViewMode = iota
+	queryViewEmpty
+	queryViewNone
+)
+
+var queryLayers = []string{queryLayerL3, queryLayerLinuxBridge, queryLayerOvs, queryLayerPhysical}
+
+type TopologyQuery struct {
+	Cloud               string                    `json:"cloud,required"`
+	Hypervisors         []string                  `json:"hypervisors,omitempty"`
+	Instances           []string                  `json:"instances,omitempty"`
+	HypervisorInstances []HypervisorInstanceNames `json:"hypervisor_instances,omitempty"`
+	Networks            []string                  `json:"networks,omitempty"`
+	Project             string                    `json:"project,omitempty"`
+	Layers              []string                  `json:"layers,omitempty"`
+	ExcludeBridges      []string                  `json:"exclude_bridges,omitempty"`
+	Filtered            bool                      `json:"filtered,omitempty"`
+	FilterRules         []BridgeFilterRule        `json:"filter_rules,omitempty"`
+	Collapse            string                    `json:"collapse,omitempty"`
+	MaxDepth            int                       `json:"max_depth,omitempty"`
+	Title               string                    `json:"title,omitempty"`
+
+	// Presets for the fixed view routes tune the output to what those
+	// routes always returned; they cannot be set from a request. Those
+	// routes drew patch and attachment links to bridges they did not show
+	// to node 0, and a network node for every vNIC of a single instance.
+	hideHypervisors   bool
+	hideBridgeHost    bool
+	noStatistics      bool
+	hiddenBridgeLinks bool
+	vnicNetworks      bool
+	vnicColor         string
+	hypervisorViews   queryViewMode
+	instanceViews     queryViewMode
+	networkViews      queryViewMode
+
+	filters []bridgeFilter
+}
+
+type queryHypervisorSelection struct {
+	hypervisor *GraphEntity
+	instances  []*GraphEntity
+}
+
+// queryMissingPeer is a patch link waiting for the stand-in of its peer.
+type queryMissingPeer struct {
+	link int
+	key  string
+	bc   *OvsBridgeConnection
+}
+
+func queryList(values []string) []string {
+	var list []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); len(item) > 0 {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
+func queryContains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// queryParse reads a query from the URL parameters, overlaid by a JSON body
+// on POST.
+func queryParse(r *http.Request) (TopologyQuery, error) {
+	var q TopologyQuery
+	if r.Method == "POST" && r.Body != nil && r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+			return q, errors.New("Invalid topology query: " + err.Error())
+		}
+	}
+	values := r.URL.Query()
+	if err := queryParseValues(&q, values); err != nil {
+		return q, err
+	}
+	return q, nil
+}
+
+func queryParseValues(q *TopologyQuery, values url.Values) error {
+	if len(values.Get("cloud")) > 0 {
+		q.Cloud = values.Get("cloud")
+	}
+	if list := queryList(values["hypervisors"]); len(list) > 0 {
+		q.Hypervisors = list
+	}
+	if list := queryList(values["instances"]); len(list) > 0 {
+		q.Instances = list
+	}
+	selections, err := hypervisorInstancesParse(values["hypervisor_instances"])
+	if err != nil {
+		return err
+	}
+	q.HypervisorInstances = append(q.HypervisorInstances, selections...)
+	if list := queryList(values["networks"]); len(list) > 0 {
+		q.Networks = list
+	}
+	if len(values.Get("project")) > 0 {
+		q.Project = values.Get("project")
+	}
+	if list := queryList(values["layers"]); len(list) > 0 {
+		q.Layers = list
+	}
+	if list := queryList(values["exclude_bridges"]); len(list) > 0 {
+		q.ExcludeBridges = list
+	}
+	if len(values.Get("filtered")) > 0 {
+		q.Filtered = values.Get("filtered") == "true"
+	}
+	if rules := filterParseValues(values); len(rules) > 0 {
+		q.FilterRules = rules
+	}
+	if len(values.Get("collapse")) > 0 {
+		q.Collapse = values.Get("collapse")
+	}
+	if len(values.Get("max_depth")) > 0 {
+		maxDepth, err := strconv.Atoi(values.Get("max_depth"))
+		if err != nil {
+			return errors.New("Invalid max_depth " + values.Get("max_depth"))
+		}
+		q.MaxDepth = maxDepth
+	}
+	if len(values.Get("title")) > 0 {
+		q.Title = values.Get("title")
+	}
+	return nil
+}
+
+func queryValidate(q *TopologyQuery) error {
+	if len(q.Cloud) == 0 {
+		return errors.New("Topology query requires a cloud")
+	}
+	if len(q.HypervisorInstances) > 0 && (len(q.Hypervisors) > 0 || len(q.Instances) > 0) {
+		return errors.New("hypervisor_instances cannot be combined with hypervisors or instances")
+	}
+	for _, layer := range q.Layers {
+		if !queryContains(queryLayers, layer) {
+			return errors.New("Invalid layer " + layer + ", expected one of " + strings.Join(queryLayers, ", "))
+		}
+	}
+	for _, pattern := range q.ExcludeBridges {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.New("Invalid bridge pattern " + pattern)
+		}
+	}
+	switch q.Collapse {
+	case "", queryCollapseNone, queryCollapseBridges:
+	default:
+		return errors.New("Invalid collapse " + q.Collapse + ", expected " + queryCollapseNone + " or " + queryCollapseBridges)
+	}
+	if q.MaxDepth < 0 {
+		return errors.New("Invalid max_depth " + strconv.Itoa(q.MaxDepth))
+	}
+	return nil
+}
+
+func (q *TopologyQuery) hasLayer(layer string) bool {
+	return len(q.Layers) == 0 || queryContains(q.Layers, layer)
+}
+
+func (q *TopologyQuery) allowsDepth(depth int) bool {
+	return q.MaxDepth == 0 || depth <= q.MaxDepth
+}
+
+func (q *TopologyQuery) bridgeExcluded(name string) bool {
+	for _, pattern := range q.ExcludeBridges {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *TopologyQuery) networkSelected(name string) bool {
+	return len(q.Networks) == 0 || queryContains(q.Networks, name)
+}
+
+func queryViews(mode queryViewMode, views func() map[string]string) map[string]string {
+	switch mode {
+	case queryViewNone:
+		return nil
+	case queryViewEmpty:
+		return make(map[string]string)
+	}
+	return views()
+}
+
+// queryResolve picks the hypervisors and instances a query covers. Unknown
+// names are reported rather than silently dropped.
+func queryResolve(g *TopologyGraph, q *TopologyQuery) ([]queryHypervisorSelection, *APIError) {
+	for _, name := range q.Networks {
+		if g.FindNetwork(name) == nil {
+			return nil, &APIError{http.StatusNotFound, "Network " + name + " for cloud " + g.Cloud.Name + " Not discovered"}
+		}
+	}
+	if len(q.HypervisorInstances) > 0 {
+		return queryResolveHypervisorInstances(g, q), nil
+	}
+	var hypervisors []*GraphEntity
+	if len(q.Hypervisors) == 0 {
+		hypervisors = g.Hypervisors()
+	}
+	for _, name := range q.Hypervisors {
+		hypervisor := g.FindHypervisor(name)
+		if hypervisor == nil {
+			hypervisor = g.FindHypervisorByHostName(name)
+		}
+		if hypervisor == nil {
+			return nil, &APIError{http.StatusNotFound, "Hypervisor " + name + " for cloud " + g.Cloud.Name + " Not discovered"}
+		}
+		hypervisors = append(hypervisors, hypervisor)
+	}
+
+	found := make(map[string]bool)
+	var selections []queryHypervisorSelection
+	for _, hypervisor := range hypervisors {
+		selection := queryHypervisorSelection{hypervisor: hypervisor}
+		for _, instance := range g.Children(hypervisor.Key, graphEntityInstance) {
+			if len(q.Instances) > 0 {
+				if !queryContains(q.Instances, instance.Name) && !queryContains(q.Instances, instance.Instance.UUID) {
+					continue
+				}
+				found[instance.Name] = true
+				found[instance.Instance.UUID] = true
+			}
+			if len(q.Networks) > 0 && !queryInstanceOnNetworks(g, instance, q.Networks) {
+				continue
+			}
+			selection.instances = append(selection.instances, instance)
+		}
+		selections = append(selections, selection)
+	}
+	for _, name := range q.Instances {
+		if found[name] {
+			continue
+		}
+		// The instance views name one hypervisor and have always said so.
+		if len(q.Hypervisors) == 1 {
+			return nil, &APIError{http.StatusNotFound, "Instance " + name + " for hypervisor " + hypervisors[0].Name + " and cloud " + g.Cloud.Name + " Not discovered"}
+		}
+		return nil, &APIError{http.StatusNotFound, "Instance " + name + " for cloud " + g.Cloud.Name + " Not discovered"}
+	}
+	return selections, nil
+}
+
+// queryResolveHypervisorInstances selects instances per host. The selection
+// has been validated against discovery already.
+func queryResolveHypervisorInstances(g *TopologyGraph, q *TopologyQuery) []queryHypervisorSelection {
+	var selections []queryHypervisorSelection
+	for _, hi := range q.HypervisorInstances {
+		hypervisor := g.FindHypervisorByHostName(hi.HostName)
+		if hypervisor == nil {
+			continue
+		}
+		selection := queryHypervisorSelection{hypervisor: hypervisor}
+		for _, instance := range g.Children(hypervisor.Key, graphEntityInstance) {
+			if len(hi.InstanceNames) > 0 && !queryContains(hi.InstanceNames, instance.Name) {
+				continue
+			}
+			if len(q.Networks) > 0 && !queryInstanceOnNetworks(g, instance, q.Networks) {
+				continue
+			}
+			selection.instances = append(selection.instances, instance)
+		}
+		selections = append(selections, selection)
+	}
+	return selections
+}
+
+func queryInstanceOnNetworks(g *TopologyGraph, instance *GraphEntity, networks []string) bool {
+	for _, vnic := range g.Children(instance.Key, graphEntityVnic) {
+		if relation := g.Outgoing(vnic.Key, graphRelationNetwork); relation != nil {
+			if queryContains(networks, g.Entity(relation.Target).Name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// addQuery projects the selected part of the graph. Node order follows
+// discovery order so identical queries yield identical ids.
+func (b *topologyBuilder) addQuery(g *TopologyGraph, q *TopologyQuery, selections []queryHypervisorSelection) {
+	collapsed := q.Collapse == queryCollapseBridges
+	statistics := !q.noStatistics
+	vnicColor := q.vnicColor
+	if len(vnicColor) == 0 {
+		vnicColor = "#0000FF"
+	}
+
+	var bridgeGroups []int
+	var missingPeers []queryMissingPeer
+	for _, selection := range selections {
+		hypervisor := selection.hypervisor
+		var hypervisorNode *TopologyNode
+		if !q.hideHypervisors {
+			node := b.addNode(hypervisor.Key, topologyHypervisorNode(hypervisor.Hypervisor, queryViews(q.hypervisorViews, func() map[string]string {
+				return b.hypervisorViews(hypervisor.Name)
+			})))
+			hypervisorNode = &node
+		}
+
+		showBridges := q.hasLayer(queryLayerOvs) && q.allowsDepth(queryDepthBridge)
+		if showBridges {
+			hostIP := hypervisor.HostIP
+			if q.hideBridgeHost {
+				hostIP = ""
+			}
+			var ovsBridgeNodeSetIdList []int
+			for _, bridge := range g.Children(hypervisor.Key, graphEntityBridge) {
+				if q.bridgeExcluded(bridge.Name) {
+					b.addFiltered("exclude_bridges", filterKindBridge, bridge.Name, hypervisor.HostIP)
+					continue
+				}
+				if rule := filterBridge(q.filters, bridge.Bridge); len(rule) > 0 {
+					b.addFiltered(rule, filterKindBridge, bridge.Name, hypervisor.HostIP)
+					continue
+				}
+				bridgeNode := b.addNode(bridge.Key, topologyBridgeNode(bridge.Bridge, hostIP))
+				if collapsed {
+					ovsBridgeNodeSetIdList = append(ovsBridgeNodeSetIdList, bridgeNode.ID)
+				}
+			}
+			if len(ovsBridgeNodeSetIdList) > 0 {
+				nodeSet := TopologyNodeSet{
+					ID:         b.nextId(),
+					Nodes:      ovsBridgeNodeSetIdList,
+					Name:       "ovs-bridge-group",
+					DeviceType: "switch",
+					X:          -100,
+					Y:          0,
+					Color:      "#00FF00",
+					Props:      make(map[string]interface{}),
+				}
+				bridgeGroups = append(bridgeGroups, nodeSet.ID)
+				b.nodeSets = append(b.nodeSets, nodeSet)
+			}
+
+			for _, relation := range g.HostRelations(hypervisor.HostIP, graphRelationPatch) {
+				sourceId, sourceName, ok := b.findByKey(relation.Source)
+				if !ok && !q.hiddenBridgeLinks {
+					continue
+				}
+				targetId, targetName, ok := b.findByKey(relation.Target)
+				if !ok && len(relation.Target) > 0 && !q.hiddenBridgeLinks {
+					continue
+				}
+				bc := relation.Connection
+				rule := filterInterface(q.filters, bc.SourceBridge, bc.SourceInterface, bc.SourcePort)
+				if len(rule) == 0 && len(bc.TargetInterface.Name) > 0 {
+					rule = filterInterface(q.filters, bc.TargetBridge, bc.TargetInterface, bc.TargetPort)
+				}
+				if len(rule) > 0 {
+					b.addFiltered(rule, filterKindPatch, bc.SourceInterface.Name, hypervisor.HostIP)
+					continue
+				}
+				// A patch whose peer is missing still shows, dangling to a
+				// stand-in for the peer added after all other nodes.
+				if len(relation.Target) == 0 {
+					peer := queryMissingPeer{link: len(b.links), bc: bc}
+					if iface := g.Entity(graphInterfaceKey(hypervisor.HostIP, bc.SourceInterface.Name)); iface != nil {
+						peer.key = iface.UID + "/peer"
+					}
+					missingPeers = append(missingPeers, peer)
+					targetName = topologyMissingPeerNode(bc).Name
+				}
+				link := topologyPatchLink(bc, sourceId, sourceName, targetId, targetName, statistics)
+				if warnings := g.lint.interfaceWarnings(hypervisor.HostIP, bc.SourceInterface.Name); len(warnings) > 0 {
+					link.Color = lintColor
+					link.Props["warnings"] = warnings
+				}
+				b.addLink(link)
+			}
+		}
+
+		if q.allowsDepth(queryDepthInstance) {
+			for _, instance := range selection.instances {
+				b.addQueryInstance(g, q, hypervisor, hypervisorNode, instance, vnicColor, collapsed, &bridgeGroups)
+			}
+		}
+
+		if showBridges && q.hasLayer(queryLayerPhysical) && q.allowsDepth(queryDepthPhysical) {
+			for _, nic := range g.Children(hypervisor.Key, graphEntityPhysicalNic) {
+				relation := g.Outgoing(nic.Key, graphRelationUplink)
+				if relation == nil {
+					continue
+				}
+				sourceId, sourceName, ok := b.findByKey(relation.Target)
+				if !ok {
+					continue
+				}
+				bc := relation.Connection
+				if rule := filterInterface(q.filters, bc.SourceBridge, bc.SourceInterface, bc.SourcePort); len(rule) > 0 {
+					b.addFiltered(rule, filterKindUplink, bc.SourceInterface.Name, hypervisor.HostIP)
+					continue
+				}
+				portNode := b.addNode(nic.Key, topologyPortNode(nic.PhysicalNic))
+				b.addLink(topologyUplinkLink(relation.Connection, sourceId, sourceName, portNode, statistics))
+			}
+		}
+	}
+
+	if len(bridgeGroups) > 0 {
+		nodeSet := TopologyNodeSet{
+			ID:         b.nextId(),
+			Nodes:      bridgeGroups,
+			Name:       "bridge-group",
+			DeviceType: "switch",
+			X:          0,
+			Y:          0,
+			Color:      "#0000FF",
+			Props:      make(map[string]interface{}),
+		}
+		b.nodeSets = append(b.nodeSets, nodeSet)
+	}
+
+	for _, peer := range missingPeers {
+		b.links[peer.link].Target = b.addNode(peer.key, topologyMissingPeerNode(peer.bc)).ID
+	}
+}
+
+func (b *topologyBuilder) addQueryInstance(g *TopologyGraph, q *TopologyQuery, hypervisor *GraphEntity, hypervisorNode *TopologyNode, instance *GraphEntity, vnicColor string, collapsed bool, bridgeGroups *[]int) {
+	statistics := !q.noStatistics
+	instanceNode := b.addNode(instance.Key, topologyInstanceNode(instance.Instance, queryViews(q.instanceViews, func() map[string]string {
+		return b.instanceViews(hypervisor.Name, instance.Name)
+	})))
+	if hypervisorNode != nil {
+		b.addLink(topologyNodeLink(*hypervisorNode, instanceNode, "#0000FF"))
+	}
+
+	showVnics := q.hasLayer(queryLayerLinuxBridge) && q.allowsDepth(queryDepthVnic)
+	var linuxBridgeNodeSetIdList []int
+	for _, vnic := range g.Children(instance.Key, graphEntityVnic) {
+		// Without the linux bridge layer networks hang off the instance.
+		parentNode := instanceNode
+		parentDepth := queryDepthInstance
+		if showVnics {
+			parentNode = b.addNode(vnic.Key, topologyVnicNode(vnic.Vnic))
+			parentDepth = queryDepthVnic
+			if collapsed {
+				linuxBridgeNodeSetIdList = append(linuxBridgeNodeSetIdList, parentNode.ID)
+			}
+			b.addLink(topologyVnicLink(instanceNode, parentNode, vnic, vnicColor, statistics))
+		}
+
+		relation := g.Outgoing(vnic.Key, graphRelationNetwork)
+		if relation != nil && q.hasLayer(queryLayerL3) && q.allowsDepth(parentDepth+1) {
+			network := g.Entity(relation.Target)
+			if q.networkSelected(network.Name) {
+				networkId, _, ok := b.findByKey(network.Key)
+				if !ok || q.vnicNetworks {
+					networkId = b.addNode(network.Key, topologyNetworkNode(network.Network, queryViews(q.networkViews, func() map[string]string {
+						return b.networkViews(network.Name)
+					}))).ID
+				}
+				color := "#888888"
+				if !showVnics {
+					color = "#0000FF"
+				}
+				b.addLink(topologyLink(parentNode.ID, parentNode.Name, networkId, network.Name, color))
+			}
+		}
+
+		if relation := g.Outgoing(vnic.Key, graphRelationAttachment); relation != nil && showVnics {
+			bc := relation.Connection
+			if targetId, targetName, ok := b.findByKey(relation.Target); ok || q.hiddenBridgeLinks {
+				if rule := filterInterface(q.filters, bc.TargetBridge, bc.TargetInterface, bc.TargetPort); len(rule) > 0 {
+					b.addFiltered(rule, filterKindAttachment, bc.TargetInterface.Name, hypervisor.HostIP)
+					continue
+				}
+				b.addLink(topologyAttachmentLink(relation.Connection, parentNode, targetId, targetName, statistics))
+			}
+		}
+	}
+	if len(linuxBridgeNodeSetIdList) > 0 {
+		nodeSet := TopologyNodeSet{
+			ID:         b.nextId(),
+			Nodes:      linuxBridgeNodeSetIdList,
+			Name:       "linux-bridge-group",
+			Root:       instanceNode.ID,
+			DeviceType: "switch",
+			X:          200,
+			Y:          0,
+			Color:      "#FF00FF",
+			Props:      make(map[string]interface{}),
+		}
+		*bridgeGroups = append(*bridgeGroups, nodeSet.ID)
+		b.nodeSets = append(b.nodeSets, nodeSet)
+	}
+}
+
+// queryWrite runs a query and writes the projected topology. views are the
+// top level view links; nil selects the cloud views.
+func queryWrite(rw http.ResponseWriter, r *http.Request, q TopologyQuery, views map[string]string) {
+	if err := queryValidate(&q); err != nil {
+		apiError := APIError{http.StatusBadRequest, err.Error()}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	rules := q.FilterRules
+	if len(rules) == 0 && q.Filtered {
+		rules = filterGetRules(q.Cloud)
+	}
+	filters, err := filterCompile(rules)
+	if err != nil {
+		apiError := APIError{http.StatusBadRequest, err.Error()}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	q.filters = filters
+
+	// The fixed view routes take the project from the URL alone.
+	project := q.Project
+	if len(project) == 0 {
+		project = r.URL.Query().Get("project")
+	}
+	g := topologyGetProjectGraph(rw, r, q.Cloud, project)
+	if g == nil {
+		return
+	}
+	if itemErrors := hypervisorInstancesValidate(q.Cloud, q.HypervisorInstances); len(itemErrors) > 0 {
+		writeHypervisorInstancesErrors(rw, itemErrors)
+		return
+	}
+	selections, apiError := queryResolve(g, &q)
+	if apiError != nil {
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+
+	b := newGraphTopologyBuilder(r, g)
+	b.layout = layoutLayered
+	b.addQuery(g, &q, selections)
+
+	title := q.Title
+	if len(title) == 0 {
+		title = g.Cloud.Name + " VNF Topology"
+	}
+	if views == nil {
+		views = b.cloudViews(g.Cloud.Name, false)
+	}
+	topologyWrite(rw, r, b.data(title, views))
+}
+
+func QueryTopology(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	q, err := queryParse(r)
+	if err != nil {
+		apiError := APIError{http.StatusBadRequest, err.Error()}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	queryWrite(rw, r, q, nil)
+}
+
+func InitQuery(router *httprouter.Router) {
+	router.GET("/topology/query", authorize(authRoleViewer, viewCachedStats(QueryTopology)))
+	router.POST("/topology/query", authorize(authRoleViewer, QueryTopology))
+	router.GET("/topology/filters/:cloud_name", authorize(authRoleViewer, GetBridgeFilterRules))
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+)
+
+const (
+	renderMargin     = 60
+	renderTitleSpace = 40
+	renderLabelSpace = 30
+	renderMinWidth   = 400
+	renderMaxSize    = 4000
+	renderBackground = "#FFFFFF"
+	renderDetail     = "#FFFFFF"
+	renderText       = "#333333"
+)
+
+// renderCanvas is the drawing surface shared by the SVG and PNG renderers.
+// Text is centered on x with its baseline at y.
+type renderCanvas interface {
+	line(x1, y1, x2, y2 float64, c string, width float64, dashed bool, title string)
+	rect(x, y, w, h float64, c string)
+	circle(cx, cy, r float64, c string)
+	text(x, y float64, s string, c string)
+}
+
+func renderColor(s string) color.RGBA {
+	var r, g, b uint8
+	if len(s) == 7 && s[0] == '#' {
+		if _, err := fmt.Sscanf(s[1:], "%02x%02x%02x", &r, &g, &b); err == nil {
+			return color.RGBA{r, g, b, 0xFF}
+		}
+	}
+	return color.RGBA{0x88, 0x88, 0x88, 0xFF}
+}
+
+// renderFrame maps layout coordinates onto the picture, shrinking layouts
+// too large for renderMaxSize. Nodes without a layout are laid out first.
+type renderFrame struct {
+	minX, minY    int
+	scale, left   float64
+	width, height int
+}
+
+func newRenderFrame(data *TopologyData) renderFrame {
+	laidOut := false
+	for _, node := range data.Nodes {
+		if node.X != data.Nodes[0].X || node.Y != data.Nodes[0].Y {
+			laidOut = true
+			break
+		}
+	}
+	if !laidOut && len(data.Nodes) > 1 {
+		layoutHierarchicalNodes(data)
+	}
+
+	f := renderFrame{scale: 1}
+	maxX, maxY := 0, 0
+	for i, node := range data.Nodes {
+		if i == 0 || node.X < f.minX {
+			f.minX = node.X
+		}
+		if i == 0 || node.Y < f.minY {
+			f.minY = node.Y
+		}
+		if i == 0 || node.X > maxX {
+			maxX = node.X
+		}
+		if i == 0 || node.Y > maxY {
+			maxY = node.Y
+		}
+	}
+	spanX, spanY := float64(maxX-f.minX), float64(maxY-f.minY)
+	if span := math.Max(spanX, spanY); span > renderMaxSize {
+		f.scale = renderMaxSize / span
+	}
+	f.width = int(spanX*f.scale) + 2*renderMargin
+	f.left = renderMargin
+	if f.width < renderMinWidth {
+		f.left += float64(renderMinWidth-f.width) / 2
+		f.width = renderMinWidth
+	}
+	f.height = int(spanY*f.scale) + 2*renderMargin + renderTitleSpace
+	return f
+}
+
+func (f *renderFrame) point(node *TopologyNode) (float64, float64) {
+	return f.left + float64(node.X-f.minX)*f.scale, float64(renderMargin+renderTitleSpace) + float64(node.Y-f.minY)*f.scale
+}
+
+// renderIcon draws the NeXt device type icon filled with the node color.
+func renderIcon(c renderCanvas, deviceType string, x, y float64, fill string) {
+	switch deviceType {
+	case "host":
+		c.rect(x-16, y-14, 32, 22, fill)
+		c.rect(x-12, y-10, 24, 14, renderDetail)
+		c.rect(x-3, y+8, 6, 4, fill)
+		c.rect(x-10, y+12, 20, 3, fill)
+	case "server":
+		c.rect(x-11, y-16, 22, 32, fill)
+		for i := 0.0; i < 3; i++ {
+			c.line(x-7, y-8+i*7, x+7, y-8+i*7, renderDetail, 2, false, "")
+		}
+	case "switch":
+		c.rect(x-18, y-10, 36, 20, fill)
+		c.line(x-10, y-4, x+10, y-4, renderDetail, 2, false, "")
+		c.line(x+10, y-4, x+6, y-7, renderDetail, 2, false, "")
+		c.line(x+10, y-4, x+6, y-1, renderDetail, 2, false, "")
+		c.line(x-10, y+4, x+10, y+4, renderDetail, 2, false, "")
+		c.line(x-10, y+4, x-6, y+1, renderDetail, 2, false, "")
+		c.line(x-10, y+4, x-6, y+7, renderDetail, 2, false, "")
+	case "router":
+		c.circle(x, y, 16, fill)
+		c.line(x-9, y, x+9, y, renderDetail, 2, false, "")
+		c.line(x, y-9, x, y+9, renderDetail, 2, false, "")
+	case "cloud":
+		c.circle(x-9, y+2, 9, fill)
+		c.circle(x+1, y-5, 11, fill)
+		c.circle(x+10, y+3, 8, fill)
+		c.rect(x-9, y+3, 19, 8, fill)
+	default:
+		c.circle(x, y, 8, fill)
+		c.circle(x, y, 4, renderDetail)
+	}
+}
+
+// renderTopology draws the links under the nodes, each node with its label.
+func renderTopology(c renderCanvas, data *TopologyData, f renderFrame) {
+	c.rect(0, 0, float64(f.width), float64(f.height), renderBackground)
+	c.text(float64(f.width)/2, renderMargin/2+6, data.Title, renderText)
+
+	index := diagramIndex(data)
+	for i := range data.Links {
+		link := &data.Links[i]
+		source, ok := index[link.Source]
+		if !ok {
+			continue
+		}
+		target, ok := index[link.Target]
+		if !ok {
+			continue
+		}
+		x1, y1 := f.point(&data.Nodes[source])
+		x2, y2 := f.point(&data.Nodes[target])
+		width := float64(link.Width)
+		if width < 2 {
+			width = 2
+		}
+		c.line(x1, y1, x2, y2, link.Color, width, link.Dotted, diagramLinkLabel(link))
+	}
+	for i := range data.Nodes {
+		node := &data.Nodes[i]
+		x, y := f.point(node)
+		renderIcon(c, node.DeviceType, x, y, node.Color)
+		c.text(x, y+renderLabelSpace, diagramNodeName(node), renderText)
+	}
+}
+
+type svgCanvas struct {
+	buf bytes.Buffer
+}
+
+func svgColor(s string) string {
+	rgba := renderColor(s)
+	return fmt.Sprintf("#%02X%02X%02X", rgba.R, rgba.G, rgba.B)
+}
+
+func (s *svgCanvas) line(x1, y1, x2, y2 float64, c string, width float64, dashed bool, title string) {
+	fmt.Fprintf(&s.buf, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s" stroke-width="%.1f"`, x1, y1, x2, y2, svgColor(c), width)
+	if dashed {
+		s.buf.WriteString(` stroke-dasharray="6,4"`)
+	}
+	if len(title) > 0 {
+		fmt.Fprintf(&s.buf, "><title>%s</title></line>\n", html.EscapeString(title))
+		return
+	}
+	s.buf.WriteString("/>\n")
+}
+
+func (s *svgCanvas) rect(x, y, w, h float64, c string) {
+	fmt.Fprintf(&s.buf, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"/>`+"\n", x, y, w, h, svgColor(c))
+}
+
+func (s *svgCanvas) circle(cx, cy, r float64, c string) {
+	fmt.Fprintf(&s.buf, `<circle cx="%.1f" cy="%.1f" r="%.1f" fill="%s"/>`+"\n", cx, cy, r, svgColor(c))
+}
+
+func (s *svgCanvas) text(x, y float64, t string, c string) {
+	fmt.Fprintf(&s.buf, `<text x="%.1f" y="%.1f" fill="%s" font-family="sans-serif" font-size="11" text-anchor="middle">%s</text>`+"\n", x, y, svgColor(c), html.EscapeString(t))
+}
+
+func exportSvg(data *TopologyData) ([]byte, error) {
+	f := newRenderFrame(data)
+	s := &svgCanvas{}
+	fmt.Fprintf(&s.buf, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprintf(&s.buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n", f.width, f.height, f.width, f.height)
+	fmt.Fprintf(&s.buf, "<title>%s</title>\n", html.EscapeString(data.Title))
+	renderTopology(s, data, f)
+	s.buf.WriteString("</svg>\n")
+	return s.buf.Bytes(), nil
+}
+
+type pngCanvas struct {
+	img *image.RGBA
+}
+
+func (p *pngCanvas) fill(x0, y0, x1, y1 int, c color.RGBA) {
+	draw.Draw(p.img, image.Rect(x0, y0, x1, y1), image.NewUniform(c), image.ZP, draw.Src)
+}
+
+func (p *pngCanvas) line(x1, y1, x2, y2 float64, c string, width float64, dashed bool, title string) {
+	rgba := renderColor(c)
+	length := math.Hypot(x2-x1, y2-y1)
+	steps := int(length*2) + 1
+	half := width / 2
+	for i := 0; i <= steps; i++ {
+		t := float64(i) / float64(steps)
+		if dashed && int(t*length/5)%2 == 1 {
+			continue
+		}
+		x, y := x1+(x2-x1)*t, y1+(y2-y1)*t
+		p.fill(int(x-half+0.5), int(y-half+0.5), int(x+half+0.5), int(y+half+0.5), rgba)
+	}
+}
+
+func (p *pngCanvas) rect(x, y, w, h float64, c string) {
+	p.fill(int(x), int(y), int(x+w), int(y+h), renderColor(c))
+}
+
+func (p *pngCanvas) circle(cx, cy, r float64, c string) {
+	rgba := renderColor(c)
+	for y := int(cy - r); y <= int(cy+r); y++ {
+		for x := int(cx - r); x <= int(cx+r); x++ {
+			dx, dy := float64(x)+0.5-cx, float64(y)+0.5-cy
+			if dx*dx+dy*dy <= r*r {
+				p.img.SetRGBA(x, y, rgba)
+			}
+		}
+	}
+}
+
+func (p *pngCanvas) text(x, y float64, s string, c string) {
+	d := font.Drawer{
+		Dst:  p.img,
+		Src:  image.NewUniform(renderColor(c)),
+		Face: basicfont.Face7x13,
+	}
+	d.Dot = fixed.P(int(x)-d.MeasureString(s).Round()/2, int(y))
+	d.DrawString(s)
+}
+
+func exportPng(data *TopologyData) ([]byte, error) {
+	f := newRenderFrame(data)
+	p := &pngCanvas{image.NewRGBA(image.Rect(0, 0, f.width, f.height))}
+	renderTopology(p, data, f)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, p.img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"image/color"
+	"image/png"
+	"strconv"
+	"testing"
+)
+
+type renderTestSvg struct {
+	Width  string `xml:"width,attr"`
+	Height string `xml:"height,attr"`
+	Title  string `xml:"title"`
+	Lines  []struct {
+		Stroke string `xml:"stroke,attr"`
+	} `xml:"line"`
+	Texts []string `xml:"text"`
+}
+
+func TestRenderSvg(t *testing.T) {
+	defer testFixture()()
+	rw, data := exportTestGet(t, "?format=svg", "")
+	if contentType := rw.Header().Get("Content-Type"); contentType != exportContentTypes[exportFormatSvg] {
+		t.Errorf("Content-Type = %s, want %s", contentType, exportContentTypes[exportFormatSvg])
+	}
+	var svg renderTestSvg
+	if err := xml.Unmarshal(rw.Body.Bytes(), &svg); err != nil {
+		t.Fatal(err)
+	}
+
+	f := newRenderFrame(&data)
+	if svg.Width != strconv.Itoa(f.width) || svg.Height != strconv.Itoa(f.height) {
+		t.Errorf("svg is %sx%s, want %dx%d", svg.Width, svg.Height, f.width, f.height)
+	}
+	if svg.Title != data.Title {
+		t.Errorf("svg title = %q, want %q", svg.Title, data.Title)
+	}
+	links := 0
+	for _, line := range svg.Lines {
+		if line.Stroke != renderDetail {
+			links++
+		}
+	}
+	if links != len(data.Links) {
+		t.Errorf("svg draws %d links, want %d", links, len(data.Links))
+	}
+	labels := make(map[string]int)
+	for _, text := range svg.Texts {
+		labels[text]++
+	}
+	for i := range data.Nodes {
+		if labels[diagramNodeName(&data.Nodes[i])] == 0 {
+			t.Errorf("svg lacks the label of node %s", diagramNodeName(&data.Nodes[i]))
+		}
+	}
+}
+
+func TestRenderPng(t *testing.T) {
+	defer testFixture()()
+	rw, data := exportTestGet(t, "", "image/png")
+	if contentType := rw.Header().Get("Content-Type"); contentType != exportContentTypes[exportFormatPng] {
+		t.Errorf("Content-Type = %s, want %s", contentType, exportContentTypes[exportFormatPng])
+	}
+	img, err := png.Decode(bytes.NewReader(rw.Body.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := newRenderFrame(&data)
+	if bounds := img.Bounds(); bounds.Dx() != f.width || bounds.Dy() != f.height {
+		t.Errorf("png is %dx%d, want %dx%d", bounds.Dx(), bounds.Dy(), f.width, f.height)
+	}
+	background := renderColor(renderBackground)
+	if c := color.RGBAModel.Convert(img.At(0, 0)); c != background {
+		t.Errorf("png corner is %v, want the background %v", c, background)
+	}
+	x, y := f.point(&data.Nodes[0])
+	drawn := false
+	for dx := -20; dx <= 20 && !drawn; dx++ {
+		drawn = color.RGBAModel.Convert(img.At(int(x)+dx, int(y))) != background
+	}
+	if !drawn {
+		t.Errorf("png has nothing drawn at node %s", data.Nodes[0].Name)
+	}
+}
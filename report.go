@@ -0,0 +1,347 @@
+package main
+
+import (
+	"github.com/SpirentOrion/httprouter"
+	"github.com/SpirentOrion/luddite"
+	"golang.org/x/net/context"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+type TopTalker struct {
+	Rank       int                `json:"rank,required"`
+	Entity     string             `json:"entity,required"`
+	Name       string             `json:"name,required"`
+	Hypervisor string             `json:"hypervisor,required"`
+	Bridge     string             `json:"bridge,omitempty"`
+	Instance   string             `json:"instance,omitempty"`
+	Source     string             `json:"source,omitempty"`
+	Value      float64            `json:"value,required"`
+	Rates      map[string]float64 `json:"rates,required"`
+	Views      map[string]string  `json:"views,required"`
+}
+
+// TopTalkersReport ranks entities by a metric. Interfaces names the set of
+// interfaces summed into each instance, bridge or hypervisor.
+type TopTalkersReport struct {
+	Cloud      string      `json:"cloud,required"`
+	Entity     string      `json:"entity,required"`
+	Metric     string      `json:"metric,required"`
+	Interfaces string      `json:"interfaces,omitempty"`
+	Start      time.Time   `json:"start,required"`
+	End        time.Time   `json:"end,required"`
+	Items      []TopTalker `json:"items,required"`
+}
+
+type reportInterface struct {
+	Source     string
+	Name       string
+	Hypervisor CloudHypervisorInfo
+	Bridge     string
+	Instance   string
+	Edge       bool
+	Rates      map[string]float64
+}
+
+const (
+	reportInterfacesEdge = "edge"
+	reportInterfacesAll  = "all"
+)
+
+var reportMetrics = map[string][]string{
+	"throughput": {"rx_bps", "tx_bps"},
+	"packets":    {"rx_pps", "tx_pps"},
+	"drops":      {"rx_drop_rate", "tx_drop_rate"},
+	"errors":     {"rx_error_rate", "tx_error_rate"},
+}
+
+var reportEntities = map[string]bool{
+	"instance":   true,
+	"interface":  true,
+	"bridge":     true,
+	"hypervisor": true,
+}
+
+func reportInterfaceRates(source string, ipAddress string, name string, start time.Time, end time.Time) map[string]float64 {
+	if rates, ok := historyAverageRates(statsKey(source, ipAddress, name), start, end); ok {
+		return rates
+	}
+	if rates, ok := statsGetRates(source, ipAddress, name); ok {
+		return historyRatesMap(rates)
+	}
+	return make(map[string]float64)
+}
+
+// reportSummed returns the interfaces summed into an entity for a metric.
+// Traffic crosses the tap, veth, patch and uplink ports on its way, so it is
+// only summed over the edge interfaces: the vNICs and the physical uplinks.
+// Drops and errors happen on one interface each and are summed over all.
+func reportSummed(entity string, metric string) string {
+	switch {
+	case entity == "interface":
+		return ""
+	case metric == "drops" || metric == "errors":
+		return reportInterfacesAll
+	default:
+		return reportInterfacesEdge
+	}
+}
+
+// reportGetInterfaces lists every counter-bearing interface of a cloud once:
+// all non-patch OVS interfaces plus the instance vNICs OVS does not know by
+// name (tap devices behind a linux bridge). Each vNIC and physical uplink is
+// marked as an edge interface. A project graph limits them to the ones it
+// keeps.
+func reportGetInterfaces(cloudInfo *CloudInfo, scope *TopologyGraph, start time.Time, end time.Time) []reportInterface {
+	var interfaces []reportInterface
+	for _, hypervisor := range cloudGetHypervisorList(cloudInfo) {
+		if scope != nil && scope.Entity(graphHypervisorKey(hypervisor.HostIP)) == nil {
+			continue
+		}
+		ovsNames := make(map[string]bool)
+		vnicOwners := make(map[string]string)
+		vnicNames := make(map[string]bool)
+		vhostMacs := make(map[string]bool)
+		for _, instance := range libvirtGetDomainInstances(hypervisor.HostIP) {
+			for _, iface := range instance.Interfaces {
+				if len(iface.DevName) > 0 {
+					vnicOwners[iface.DevName] = instance.InstanceName
+					vnicNames[iface.DevName] = true
+				}
+				if len(iface.MacAddress) > 0 {
+					vnicOwners[iface.MacAddress] = instance.InstanceName
+					if len(iface.DevName) == 0 {
+						vhostMacs[iface.MacAddress] = true
+					}
+				}
+			}
+		}
+		physicalNames := make(map[string]bool)
+		for _, iface := range libvirtGetPhysicalInterfaces(hypervisor.HostIP) {
+			physicalNames[iface.Name] = true
+		}
+		for _, iface := range ovsGetInterfaces(hypervisor.HostIP) {
+			ovsNames[iface.Name] = true
+			if iface.Type == "patch" || (scope != nil && !scope.HasInterface(hypervisor.HostIP, statsSourceOvs, iface.Name)) {
+				continue
+			}
+			ri := reportInterface{
+				Source:     statsSourceOvs,
+				Name:       iface.Name,
+				Hypervisor: hypervisor,
+				Instance:   vnicOwners[iface.Name],
+				Rates:      reportInterfaceRates(statsSourceOvs, hypervisor.HostIP, iface.Name, start, end),
+			}
+			attachedMac := iface.ExternalIDs["attached-mac"]
+			if len(ri.Instance) == 0 && len(attachedMac) > 0 {
+				ri.Instance = vnicOwners[attachedMac]
+			}
+			ri.Edge = vnicNames[iface.Name] || physicalNames[iface.Name] || iface.Type == "dpdk" || (len(attachedMac) > 0 && vhostMacs[attachedMac])
+			if bridge := ovsGetBridgeForInterface(hypervisor.HostIP, iface.Name); bridge != nil {
+				ri.Bridge = bridge.Name
+			}
+			interfaces = append(interfaces, ri)
+		}
+		for _, instance := range libvirtGetDomainInstances(hypervisor.HostIP) {
+			for _, iface := range instance.Interfaces {
+				if len(iface.DevName) == 0 || ovsNames[iface.DevName] {
+					continue
+				}
+				if scope != nil && !scope.HasInterface(hypervisor.HostIP, statsSourceLibvirt, iface.DevName) {
+					continue
+				}
+				ri := reportInterface{
+					Source:     statsSourceLibvirt,
+					Name:       iface.DevName,
+					Hypervisor: hypervisor,
+					Instance:   instance.InstanceName,
+					Edge:       true,
+					Rates:      reportInterfaceRates(statsSourceLibvirt, hypervisor.HostIP, iface.DevName, start, end),
+				}
+				if bc := ovsGetBridgeConnection(hypervisor.HostIP, iface.MacAddress); bc != nil {
+					ri.Bridge = bc.TargetBridge.Name
+				}
+				interfaces = append(interfaces, ri)
+			}
+		}
+	}
+	return interfaces
+}
+
+func reportHypervisorViews(host string, cloudName string, hypervisorName string) map[string]string {
+	views := make(map[string]string)
+	views["OVS Bridges"] = "http://" + host + "/topology/cloudHypervisorOvsNetworkTopology/" + cloudName + "/" + hypervisorName
+	return views
+}
+
+func reportInstanceViews(host string, cloudName string, hypervisorName string, instanceName string) map[string]string {
+	views := reportHypervisorViews(host, cloudName, hypervisorName)
+	views["Instance OVS Bridges"] = "http://" + host + "/topology/cloudInstanceOvsNetworkTopology/" + cloudName + "/" + hypervisorName + "/" + instanceName
+	return views
+}
+
+func reportTopTalkers(host string, cloudInfo *CloudInfo, scope *TopologyGraph, entity string, metric string, n int, start time.Time, end time.Time) TopTalkersReport {
+	talkers := make(map[string]*TopTalker)
+	var order []string
+	summed := reportSummed(entity, metric)
+	for _, ri := range reportGetInterfaces(cloudInfo, scope, start, end) {
+		if summed == reportInterfacesEdge && !ri.Edge {
+			continue
+		}
+		var key string
+		talker := TopTalker{
+			Entity:     entity,
+			Hypervisor: ri.Hypervisor.Name,
+			Rates:      make(map[string]float64),
+		}
+		switch entity {
+		case "interface":
+			key = ri.Hypervisor.HostIP + "/" + ri.Source + "/" + ri.Name
+			talker.Name = ri.Name
+			talker.Source = ri.Source
+			talker.Bridge = ri.Bridge
+			talker.Instance = ri.Instance
+		case "instance":
+			if len(ri.Instance) == 0 {
+				continue
+			}
+			key = ri.Hypervisor.HostIP + "/" + ri.Instance
+			talker.Name = ri.Instance
+			talker.Instance = ri.Instance
+		case "bridge":
+			if len(ri.Bridge) == 0 {
+				continue
+			}
+			key = ri.Hypervisor.HostIP + "/" + ri.Bridge
+			talker.Name = ri.Bridge
+			talker.Bridge = ri.Bridge
+		case "hypervisor":
+			key = ri.Hypervisor.HostIP
+			talker.Name = ri.Hypervisor.Name
+		}
+		t, ok := talkers[key]
+		if !ok {
+			if len(talker.Instance) > 0 {
+				talker.Views = reportInstanceViews(host, cloudInfo.Name, ri.Hypervisor.Name, talker.Instance)
+			} else {
+				talker.Views = reportHypervisorViews(host, cloudInfo.Name, ri.Hypervisor.Name)
+			}
+			t = &talker
+			talkers[key] = t
+			order = append(order, key)
+		}
+		for k, v := range ri.Rates {
+			t.Rates[k] += v
+		}
+	}
+
+	items := make([]TopTalker, 0, len(order))
+	for _, key := range order {
+		t := talkers[key]
+		for _, rate := range reportMetrics[metric] {
+			t.Value += t.Rates[rate]
+		}
+		items = append(items, *t)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Value > items[j].Value
+	})
+	if n > 0 && len(items) > n {
+		items = items[:n]
+	}
+	for i := range items {
+		items[i].Rank = i + 1
+	}
+
+	return TopTalkersReport{
+		Cloud:      cloudInfo.Name,
+		Entity:     entity,
+		Metric:     metric,
+		Interfaces: summed,
+		Start:      start,
+		End:        end,
+		Items:      items,
+	}
+}
+
+func writeTopTalkers(rw http.ResponseWriter, r *http.Request, cloudName string, entity string, metric string) {
+	cloudInfo := cloudGetCloudInfo(cloudName)
+	if cloudInfo == nil {
+		apiError := APIError{http.StatusNotFound, "Cloud " + cloudName + " Not discovered"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	if !reportEntities[entity] {
+		apiError := APIError{http.StatusBadRequest, "Unknown entity " + entity}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	if _, ok := reportMetrics[metric]; !ok {
+		apiError := APIError{http.StatusBadRequest, "Unknown metric " + metric}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+
+	query := r.URL.Query()
+	n := 10
+	if len(query.Get("n")) > 0 {
+		var err error
+		if n, err = strconv.Atoi(query.Get("n")); err != nil || n < 1 {
+			apiError := APIError{http.StatusBadRequest, "Invalid n " + query.Get("n")}
+			luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+			return
+		}
+	}
+	end, err := parseTimeParam(query.Get("end"), time.Now())
+	if err != nil {
+		apiError := APIError{http.StatusBadRequest, "Invalid end time " + query.Get("end")}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	window := 15 * time.Minute
+	if len(query.Get("window")) > 0 {
+		if window, err = time.ParseDuration(query.Get("window")); err != nil {
+			apiError := APIError{http.StatusBadRequest, "Invalid window " + query.Get("window")}
+			luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+			return
+		}
+	}
+	start, err := parseTimeParam(query.Get("start"), end.Add(-window))
+	if err != nil {
+		apiError := APIError{http.StatusBadRequest, "Invalid start time " + query.Get("start")}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+
+	report := reportTopTalkers(r.Host, cloudInfo, authProjectGraph(r, cloudInfo), entity, metric, n, start, end)
+	luddite.WriteResponse(rw, http.StatusOK, report)
+}
+
+func GetTopTalkers(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	cloudName := httprouter.ContextParams(ctx).ByName("cloud_name")
+	entity := r.URL.Query().Get("entity")
+	if len(entity) == 0 {
+		entity = "instance"
+	}
+	metric := r.URL.Query().Get("metric")
+	if len(metric) == 0 {
+		metric = "throughput"
+	}
+	writeTopTalkers(rw, r, cloudName, entity, metric)
+}
+
+func GetDropHotspots(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	cloudName := httprouter.ContextParams(ctx).ByName("cloud_name")
+	entity := r.URL.Query().Get("entity")
+	if len(entity) == 0 {
+		entity = "interface"
+	}
+	writeTopTalkers(rw, r, cloudName, entity, "drops")
+}
+
+func InitReport(router *httprouter.Router) {
+	router.GET("/topology/report/topTalkers/:cloud_name", authorize(authRoleViewer, GetTopTalkers))
+	router.GET("/topology/report/dropHotspots/:cloud_name", authorize(authRoleViewer, GetDropHotspots))
+}
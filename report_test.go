@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func reportTestInterfaces() map[string]reportInterface {
+	interfaces := make(map[string]reportInterface)
+	for _, ri := range reportGetInterfaces(&clouds[0], nil, time.Time{}, time.Time{}) {
+		if ri.Hypervisor.Name == "hv1" {
+			interfaces[ri.Source+"/"+ri.Name] = ri
+		}
+	}
+	return interfaces
+}
+
+func TestReportGetInterfacesOwners(t *testing.T) {
+	defer testFixture()()
+	interfaces := reportTestInterfaces()
+
+	for _, name := range []string{"ovs/dpdk0", "ovs/eth0", "ovs/qvo1", "ovs/vhu2", "ovs/tap3", "libvirt/tap1", "libvirt/tap4"} {
+		if _, ok := interfaces[name]; !ok {
+			t.Fatalf("interface %s missing from %v", name, interfaces)
+		}
+	}
+	owners := map[string]string{
+		"ovs/dpdk0":    "",
+		"ovs/eth0":     "",
+		"ovs/qvo1":     "vRouter1",
+		"ovs/vhu2":     "vRouter1",
+		"ovs/tap3":     "vRouter1",
+		"libvirt/tap1": "vRouter1",
+		"libvirt/tap4": "vm2",
+	}
+	for name, owner := range owners {
+		if interfaces[name].Instance != owner {
+			t.Errorf("%s owned by %q, want %q", name, interfaces[name].Instance, owner)
+		}
+	}
+	edges := map[string]bool{
+		"ovs/dpdk0":    true,
+		"ovs/eth0":     true,
+		"ovs/qvo1":     false,
+		"ovs/vhu2":     true,
+		"ovs/tap3":     true,
+		"libvirt/tap1": true,
+	}
+	for name, edge := range edges {
+		if interfaces[name].Edge != edge {
+			t.Errorf("%s edge = %v, want %v", name, interfaces[name].Edge, edge)
+		}
+	}
+}
+
+func TestReportTopTalkersSumsEdgeInterfaces(t *testing.T) {
+	defer testFixture()()
+	testFixtureStats()
+
+	report := reportTopTalkers("", &clouds[0], nil, "hypervisor", "throughput", 0, time.Time{}, time.Time{})
+	if report.Interfaces != reportInterfacesEdge {
+		t.Errorf("throughput report sums %q interfaces, want %q", report.Interfaces, reportInterfacesEdge)
+	}
+	if len(report.Items) == 0 || report.Items[0].Name != "hv1" {
+		t.Fatalf("top hypervisor = %+v, want hv1", report.Items)
+	}
+	if value := report.Items[0].Value; value != 800000+80 {
+		t.Errorf("hv1 throughput = %v, want the tap1 and dpdk0 rates 800080", value)
+	}
+
+	report = reportTopTalkers("", &clouds[0], nil, "hypervisor", "drops", 0, time.Time{}, time.Time{})
+	if report.Interfaces != reportInterfacesAll {
+		t.Errorf("drops report sums %q interfaces, want %q", report.Interfaces, reportInterfacesAll)
+	}
+	if len(report.Items) == 0 || report.Items[0].Value != 10 {
+		t.Errorf("hv1 drops = %+v, want 10 from qvo1", report.Items)
+	}
+
+	report = reportTopTalkers("", &clouds[0], nil, "interface", "throughput", 0, time.Time{}, time.Time{})
+	if report.Interfaces != "" || len(report.Items) < 2 || report.Items[1].Value != 800000 {
+		t.Errorf("interface report = %+v, want qvo1 ranked alongside tap1", report.Items)
+	}
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/SpirentOrion/httprouter"
+	log "github.com/SpirentOrion/logrus"
+	"github.com/SpirentOrion/luddite"
+	"golang.org/x/net/context"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+type LayoutPosition struct {
+	X int `json:"x,required"`
+	Y int `json:"y,required"`
+}
+
+// SavedLayout holds the positions of the nodes and the collapsed state of
+// the node sets of one view, by their keys, for a user or a test bed.
+type SavedLayout struct {
+	View      string                    `json:"view,required"`
+	User      string                    `json:"user,omitempty"`
+	TestBed   string                    `json:"testbed,omitempty"`
+	Positions map[string]LayoutPosition `json:"positions,required"`
+	Collapsed map[string]bool           `json:"collapsed,omitempty"`
+	Updated   time.Time                 `json:"updated,required"`
+}
+
+type SavedLayouts struct {
+	Layouts []SavedLayout `json:"layouts,required"`
+}
+
+const savedLayoutStoreName = "layouts.json"
+
+// savedLayoutIgnored are the view parameters that do not change its nodes.
+var savedLayoutIgnored = []string{"user", "layout", "format"}
+
+var savedLayouts map[string]SavedLayout = make(map[string]SavedLayout)
+var savedLayoutLock sync.Mutex
+
+// savedLayoutView reduces a view URL to its path and the parameters that
+// select its content, in a canonical order.
+func savedLayoutView(view string) (string, error) {
+	u, err := url.Parse(view)
+	if err != nil || len(u.Path) == 0 {
+		return "", errors.New("Invalid view " + view)
+	}
+	values := u.Query()
+	for _, name := range savedLayoutIgnored {
+		values.Del(name)
+	}
+	if len(values) == 0 {
+		return u.Path, nil
+	}
+	return u.Path + "?" + values.Encode(), nil
+}
+
+// savedLayoutUser returns the user a layout is read or written for.
+// Authenticated users other than admins only have their own layouts.
+func savedLayoutUser(r *http.Request, user string) string {
+	if principal := authPrincipal(r); principal != nil && len(user) > 0 && !principal.allows(authRoleAdmin) {
+		return principal.User
+	}
+	return user
+}
+
+// savedLayoutOwner picks the user, or failing that the test bed, a layout
+// belongs to.
+func savedLayoutOwner(r *http.Request, values url.Values) (string, string) {
+	if user := savedLayoutUser(r, values.Get("user")); len(user) > 0 {
+		return user, ""
+	}
+	return "", values.Get("testbed")
+}
+
+func savedLayoutKey(view string, user string, testBed string) string {
+	if len(user) > 0 {
+		return "user/" + user + " " + view
+	}
+	return "testbed/" + testBed + " " + view
+}
+
+func savedLayoutGet(view string, user string, testBed string) *SavedLayout {
+	savedLayoutLock.Lock()
+	defer savedLayoutLock.Unlock()
+
+	if layout, ok := savedLayouts[savedLayoutKey(view, user, testBed)]; ok {
+		return &layout
+	}
+	return nil
+}
+
+func savedLayoutSave() {
+	viewCacheInvalidate()
+
+	savedLayoutLock.Lock()
+	list := make([]SavedLayout, 0, len(savedLayouts))
+	for _, layout := range savedLayouts {
+		list = append(list, layout)
+	}
+	err := storeSave(savedLayoutStoreName, list)
+	savedLayoutLock.Unlock()
+
+	if err != nil {
+		logFields := log.Fields{
+			"Path":  storePath(savedLayoutStoreName),
+			"Error": err.Error(),
+		}
+		service.Logger().WithFields(logFields).Error("Error saving layouts")
+	}
+}
+
+func savedLayoutLoad() error {
+	var list []SavedLayout
+	if err := storeLoad(savedLayoutStoreName, &list); err != nil {
+		logFields := log.Fields{
+			"Path":  storePath(savedLayoutStoreName),
+			"Error": err.Error(),
+		}
+		service.Logger().WithFields(logFields).Error("Error loading layouts")
+		return err
+	}
+
+	savedLayoutLock.Lock()
+	for _, layout := range list {
+		savedLayouts[savedLayoutKey(layout.View, layout.User, layout.TestBed)] = layout
+	}
+	savedLayoutLock.Unlock()
+	return nil
+}
+
+// savedLayoutFree reports whether no node but i sits within half the node
+// spacing of x, y.
+func savedLayoutFree(data *TopologyData, i int, x int, y int) bool {
+	for j, node := range data.Nodes {
+		if j != i && math.Abs(float64(node.X-x)) < layoutSpacingX/2 && math.Abs(float64(node.Y-y)) < layoutSpacingY/2 {
+			return false
+		}
+	}
+	return true
+}
+
+func savedLayoutPlace(data *TopologyData, i int, x int, y int) {
+	for !savedLayoutFree(data, i, x, y) {
+		x += layoutSpacingX / 2
+	}
+	data.Nodes[i].X = x
+	data.Nodes[i].Y = y
+}
+
+// savedLayoutMerge moves the saved nodes to their positions. A new node
+// goes below the saved nodes it links to, or, with none, keeps its computed
+// place shifted as far as the saved nodes moved on average.
+func savedLayoutMerge(data *TopologyData, layout *SavedLayout) {
+	placed := make([]bool, len(data.Nodes))
+	shiftX, shiftY, count := 0, 0, 0
+	for i := range data.Nodes {
+		node := &data.Nodes[i]
+		position, ok := layout.Positions[node.Key]
+		if !ok || len(node.Key) == 0 {
+			continue
+		}
+		shiftX += position.X - node.X
+		shiftY += position.Y - node.Y
+		count++
+		node.X, node.Y = position.X, position.Y
+		placed[i] = true
+	}
+
+	if count > 0 {
+		index := diagramIndex(data)
+		adjacent, _ := layoutAdjacency(data, index)
+		for progress := true; progress; {
+			progress = false
+			for i := range data.Nodes {
+				if placed[i] {
+					continue
+				}
+				sumX, sumY, peers := 0, 0, 0
+				for _, peer := range adjacent[i] {
+					if placed[peer] {
+						sumX += data.Nodes[peer].X
+						sumY += data.Nodes[peer].Y
+						peers++
+					}
+				}
+				if peers == 0 {
+					continue
+				}
+				savedLayoutPlace(data, i, sumX/peers, sumY/peers+layoutSpacingY)
+				placed[i] = true
+				progress = true
+			}
+		}
+		for i := range data.Nodes {
+			if !placed[i] {
+				savedLayoutPlace(data, i, data.Nodes[i].X+shiftX/count, data.Nodes[i].Y+shiftY/count)
+			}
+		}
+	}
+
+	for i := range data.NodeSets {
+		if collapsed, ok := layout.Collapsed[data.NodeSets[i].Key]; ok {
+			data.NodeSets[i].Collapsed = &collapsed
+		}
+	}
+	layoutNodeSets(data)
+}
+
+// savedLayoutApply merges the layout saved for the requested view and its
+// user or test bed, if any.
+func savedLayoutApply(r *http.Request, data *TopologyData) {
+	user, testBed := savedLayoutOwner(r, r.URL.Query())
+	if len(user) == 0 && len(testBed) == 0 {
+		return
+	}
+	view, err := savedLayoutView(r.URL.RequestURI())
+	if err != nil {
+		return
+	}
+	if layout := savedLayoutGet(view, user, testBed); layout != nil {
+		savedLayoutMerge(data, layout)
+	}
+}
+
+// savedLayoutParams reads the view and owner naming one saved layout.
+func savedLayoutParams(rw http.ResponseWriter, r *http.Request) (string, string, string, bool) {
+	values := r.URL.Query()
+	view, err := savedLayoutView(values.Get("view"))
+	if err != nil {
+		apiError := APIError{http.StatusBadRequest, err.Error()}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return "", "", "", false
+	}
+	user, testBed := savedLayoutOwner(r, values)
+	if len(user) == 0 && len(testBed) == 0 {
+		apiError := APIError{http.StatusBadRequest, "Layout requires a user or testbed"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return "", "", "", false
+	}
+	if len(testBed) > 0 && testBedVisible(r, testBed) == nil {
+		apiError := APIError{http.StatusNotFound, "Test bed " + testBed + " Not found"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return "", "", "", false
+	}
+	return view, user, testBed, true
+}
+
+func GetSavedLayouts(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	list := SavedLayouts{make([]SavedLayout, 0)}
+	savedLayoutLock.Lock()
+	for _, layout := range savedLayouts {
+		if user := values.Get("user"); len(user) > 0 && layout.User != user {
+			continue
+		}
+		if len(layout.User) > 0 && savedLayoutUser(r, layout.User) != layout.User {
+			continue
+		}
+		if len(layout.TestBed) > 0 && testBedVisible(r, layout.TestBed) == nil {
+			continue
+		}
+		if testBed := values.Get("testbed"); len(testBed) > 0 && layout.TestBed != testBed {
+			continue
+		}
+		list.Layouts = append(list.Layouts, layout)
+	}
+	savedLayoutLock.Unlock()
+
+	sort.Slice(list.Layouts, func(i, j int) bool {
+		return savedLayoutKey(list.Layouts[i].View, list.Layouts[i].User, list.Layouts[i].TestBed) < savedLayoutKey(list.Layouts[j].View, list.Layouts[j].User, list.Layouts[j].TestBed)
+	})
+	luddite.WriteResponse(rw, http.StatusOK, list)
+}
+
+func GetSavedLayout(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	view, user, testBed, ok := savedLayoutParams(rw, r)
+	if !ok {
+		return
+	}
+	layout := savedLayoutGet(view, user, testBed)
+	if layout == nil {
+		apiError := APIError{http.StatusNotFound, "Layout for " + view + " Not found"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	luddite.WriteResponse(rw, http.StatusOK, layout)
+}
+
+func SaveLayout(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	var layout SavedLayout
+	if err := json.NewDecoder(r.Body).Decode(&layout); err != nil {
+		apiError := APIError{http.StatusBadRequest, "Invalid layout: " + err.Error()}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	view, err := savedLayoutView(layout.View)
+	if err != nil {
+		apiError := APIError{http.StatusBadRequest, err.Error()}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	if len(layout.User) > 0 == (len(layout.TestBed) > 0) {
+		apiError := APIError{http.StatusBadRequest, "Layout requires either a user or a testbed"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	if len(layout.TestBed) > 0 && testBedVisible(r, layout.TestBed) == nil {
+		apiError := APIError{http.StatusNotFound, "Test bed " + layout.TestBed + " Not found"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	if len(layout.TestBed) > 0 && !authAllowed(r, authRoleOperator) {
+		apiError := APIError{http.StatusForbidden, "Role " + authRoleOperator + " required to save test bed layouts"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	layout.View = view
+	layout.User = savedLayoutUser(r, layout.User)
+	if layout.Positions == nil {
+		layout.Positions = make(map[string]LayoutPosition)
+	}
+	layout.Updated = time.Now().UTC()
+	auditNote(r, layout.View, map[string]string{"user": layout.User, "testbed": layout.TestBed})
+
+	savedLayoutLock.Lock()
+	savedLayouts[savedLayoutKey(layout.View, layout.User, layout.TestBed)] = layout
+	savedLayoutLock.Unlock()
+
+	savedLayoutSave()
+	luddite.WriteResponse(rw, http.StatusOK, layout)
+}
+
+func DeleteSavedLayout(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	view, user, testBed, ok := savedLayoutParams(rw, r)
+	if !ok {
+		return
+	}
+	if len(testBed) > 0 && !authAllowed(r, authRoleOperator) {
+		apiError := APIError{http.StatusForbidden, "Role " + authRoleOperator + " required to delete test bed layouts"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	auditNote(r, view, map[string]string{"user": user, "testbed": testBed})
+
+	key := savedLayoutKey(view, user, testBed)
+	savedLayoutLock.Lock()
+	_, exists := savedLayouts[key]
+	delete(savedLayouts, key)
+	savedLayoutLock.Unlock()
+
+	if !exists {
+		apiError := APIError{http.StatusNotFound, "Layout for " + view + " Not found"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	savedLayoutSave()
+	apiError := APIError{http.StatusOK, "OK"}
+	luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+}
+
+func InitSavedLayouts(router *httprouter.Router) {
+	router.GET("/topology/layouts", authorize(authRoleViewer, GetSavedLayouts))
+	router.GET("/topology/layout", authorize(authRoleViewer, GetSavedLayout))
+	router.PUT("/topology/layout", authorize(authRoleViewer, audited(auditActionLayoutSave, SaveLayout)))
+	router.DELETE("/topology/layout", authorize(authRoleViewer, audited(auditActionLayoutDelete, DeleteSavedLayout)))
+
+	savedLayoutLoad()
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/SpirentOrion/httprouter"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSavedLayoutTestBedWritesRequireOperator(t *testing.T) {
+	_, restore := authTestSetup()
+	defer restore()
+	cfg.Auth.Tokens = append(cfg.Auth.Tokens, AuthToken{Token: "t-other-operator", User: "otto", Role: authRoleOperator, Tenants: []string{"other"}})
+	testBeds["lab"] = TestBed{Name: "lab", Cloud: "c2"}
+	router := httprouter.New()
+	InitSavedLayouts(router)
+
+	layout := func(method string, path string, body string, token string) int {
+		r, _ := http.NewRequest(method, "http://topology"+path, strings.NewReader(body))
+		r.Header.Set(headerAuthToken, token)
+		rw := httptest.NewRecorder()
+		router.ServeHTTP(rw, r)
+		return rw.Code
+	}
+	view := "/topology/cloudOvsNetworkTopology/c2"
+	testBedBody := `{"view":"` + view + `","testbed":"lab","positions":{}}`
+	userBody := `{"view":"` + view + `","user":"guest","positions":{}}`
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		token  string
+		status int
+	}{
+		{"viewer saves a test bed layout", "PUT", "/topology/layout", testBedBody, "t-viewer", http.StatusForbidden},
+		{"viewer saves its own layout", "PUT", "/topology/layout", userBody, "t-viewer", http.StatusOK},
+		{"operator saves a test bed layout", "PUT", "/topology/layout", testBedBody, "t-other-operator", http.StatusOK},
+		{"viewer deletes a test bed layout", "DELETE", "/topology/layout?testbed=lab&view=" + view, "", "t-viewer", http.StatusForbidden},
+		{"viewer deletes its own layout", "DELETE", "/topology/layout?user=guest&view=" + view, "", "t-viewer", http.StatusOK},
+		{"operator deletes a test bed layout", "DELETE", "/topology/layout?testbed=lab&view=" + view, "", "t-other-operator", http.StatusOK},
+	}
+	for _, test := range tests {
+		if status := layout(test.method, test.path, test.body, test.token); status != test.status {
+			t.Errorf("%s: %s %s = %d, want %d", test.name, test.method, test.path, status, test.status)
+		}
+	}
+}
+
+func TestSavedLayoutAppliesPositionsByEntityUID(t *testing.T) {
+	defer testFixture()()
+	savedLayouts = make(map[string]SavedLayout)
+	router := httprouter.New()
+	InitTopology(router)
+	InitSavedLayouts(router)
+
+	serve := func(method string, path string, body string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest(method, "http://topology"+path, strings.NewReader(body))
+		rw := httptest.NewRecorder()
+		router.ServeHTTP(rw, r)
+		return rw
+	}
+	view := "/topology/cloudOvsNetworkTopology/c1"
+	uid := graphGet(&clouds[0]).Entity(graphHypervisorKey("10.0.0.1")).UID
+	body := `{"view":"` + view + `","user":"alice","positions":{"` + uid + `":{"x":1234,"y":567}}}`
+	if rw := serve("PUT", "/topology/layout", body); rw.Code != http.StatusOK {
+		t.Fatalf("PUT /topology/layout = %d, want %d", rw.Code, http.StatusOK)
+	}
+
+	rw := serve("GET", view+"?user=alice", "")
+	if rw.Code != http.StatusOK {
+		t.Fatalf("GET %s = %d, want %d", view, rw.Code, http.StatusOK)
+	}
+	var data TopologyData
+	if err := json.Unmarshal(rw.Body.Bytes(), &data); err != nil {
+		t.Fatal(err)
+	}
+	for _, node := range data.Nodes {
+		if node.Key == uid {
+			if node.X != 1234 || node.Y != 567 {
+				t.Errorf("node %s at %d,%d, want 1234,567", uid, node.X, node.Y)
+			}
+			return
+		}
+	}
+	t.Errorf("node %s not in %s", uid, view)
+}
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"errors"
+	"github.com/SpirentOrion/httprouter"
+	"github.com/SpirentOrion/luddite"
+	"golang.org/x/net/context"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	searchTypeCloud            = "cloud"
+	searchTypeHypervisor       = "hypervisor"
+	searchTypeInstance         = "instance"
+	searchTypeNetwork          = "network"
+	searchTypeNeutronPort      = "neutron_port"
+	searchTypeLibvirtInterface = "libvirt_interface"
+	searchTypeOvsInterface     = "ovs_interface"
+	searchTypePhysicalNic      = "physical_nic"
+	searchMatchExact           = "exact"
+	searchMatchPrefix          = "prefix"
+	searchMatchSubstring       = "substring"
+	searchMatchFuzzy           = "fuzzy"
+	searchDefaultLimit         = 50
+	searchMaxQuery             = 256
+)
+
+var searchTypes = []string{searchTypeCloud, searchTypeHypervisor, searchTypeInstance, searchTypeNetwork, searchTypeNeutronPort, searchTypeLibvirtInterface, searchTypeOvsInterface, searchTypePhysicalNic}
+
+// searchFuzzyFields are the fields that tolerate typos.
+var searchFuzzyFields = []string{"name", "host_name", "instance_name"}
+
+// searchMatches are the values of ?match=, each accepting the ones before.
+var searchMatches = []string{searchMatchExact, searchMatchPrefix, searchMatchFuzzy}
+
+type SearchLocation struct {
+	Cloud    string `json:"cloud,required"`
+	Host     string `json:"host,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Network  string `json:"network,omitempty"`
+	Bridge   string `json:"bridge,omitempty"`
+	Port     string `json:"port,omitempty"`
+}
+
+// SearchHit is one object matching the search. Field and Value tell which
+// of its names or identifiers matched and how well.
+type SearchHit struct {
+	Type     string            `json:"type,required"`
+	Name     string            `json:"name,required"`
+	Key      string            `json:"key,omitempty"`
+	Field    string            `json:"field,required"`
+	Value    string            `json:"value,required"`
+	Match    string            `json:"match,required"`
+	Score    int               `json:"score,required"`
+	Location SearchLocation    `json:"location,required"`
+	Views    map[string]string `json:"views,omitempty"`
+}
+
+type SearchResults struct {
+	Query string      `json:"query,required"`
+	Hits  []SearchHit `json:"hits,required"`
+}
+
+type searchField struct {
+	name  string
+	value string
+}
+
+type searchRequest struct {
+	query string
+	types []string
+	match string
+	limit int
+}
+
+// searchCompact drops the separators of a MAC address so that fa:16:3e,
+// fa-16-3e and fa163e match alike.
+func searchCompact(s string) string {
+	return strings.NewReplacer(":", "", "-", "", ".", "").Replace(s)
+}
+
+// searchDistance counts the edits, adjacent swaps included, from a to b.
+func searchDistance(a string, b string) int {
+	rows := make([][]int, len(a)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(b)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d := rows[i-1][j-1] + cost
+			if rows[i-1][j]+1 < d {
+				d = rows[i-1][j] + 1
+			}
+			if rows[i][j-1]+1 < d {
+				d = rows[i][j-1] + 1
+			}
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] && rows[i-2][j-2]+1 < d {
+				d = rows[i-2][j-2] + 1
+			}
+			rows[i][j] = d
+		}
+	}
+	return rows[len(a)][len(b)]
+}
+
+// searchScore rates how well one field matches the lower cased query: an
+// exact match over a prefix over a substring over a few typos, in the whole
+// name or in its beginning. Identifiers are not matched fuzzily.
+func searchScore(field searchField, query string, loosest string) (string, int) {
+	value := strings.ToLower(field.value)
+	if len(value) == 0 {
+		return "", 0
+	}
+	if field.name == "mac" || field.name == "attached_mac" {
+		value, query = searchCompact(value), searchCompact(query)
+	}
+	switch {
+	case len(query) == 0:
+		return "", 0
+	case value == query:
+		return searchMatchExact, 100
+	case loosest == searchMatchExact:
+		return "", 0
+	case strings.HasPrefix(value, query):
+		return searchMatchPrefix, 80
+	case loosest == searchMatchPrefix:
+		return "", 0
+	case strings.Contains(value, query):
+		return searchMatchSubstring, 60
+	case len(query) < 3 || !queryContains(searchFuzzyFields, field.name):
+		return "", 0
+	}
+	allowed := len(query) / 4
+	if allowed < 1 {
+		allowed = 1
+	}
+	// Each character the query has beyond the value costs an edit.
+	if len(query)-len(value) > allowed {
+		return "", 0
+	}
+	distance := searchDistance(query, value)
+	if len(value) > len(query) {
+		if d := searchDistance(query, value[:len(query)]); d < distance {
+			distance = d
+		}
+	}
+	if distance > allowed {
+		return "", 0
+	}
+	return searchMatchFuzzy, 50 - 10*distance
+}
+
+// searchCollector keeps the best matching field of each object offered.
+type searchCollector struct {
+	request *searchRequest
+	hits    []SearchHit
+}
+
+func (c *searchCollector) add(hit SearchHit, fields []searchField, views func() map[string]string) {
+	if len(c.request.types) > 0 && !queryContains(c.request.types, hit.Type) {
+		return
+	}
+	for _, field := range fields {
+		match, score := searchScore(field, c.request.query, c.request.match)
+		if score > hit.Score {
+			hit.Field, hit.Value, hit.Match, hit.Score = field.name, field.value, match, score
+		}
+	}
+	if hit.Score == 0 {
+		return
+	}
+	if views != nil {
+		hit.Views = views()
+	}
+	c.hits = append(c.hits, hit)
+}
+
+// searchAttachment returns the OVS bridge and port a vNIC or physical NIC is
+// wired to.
+func searchAttachment(g *TopologyGraph, key string, kind string) (string, string) {
+	relation := g.Outgoing(key, kind)
+	if relation == nil || relation.Connection == nil {
+		return "", ""
+	}
+	if kind == graphRelationUplink {
+		return relation.Connection.SourceBridge.Name, relation.Connection.SourcePort.Name
+	}
+	return relation.Connection.TargetBridge.Name, relation.Connection.TargetPort.Name
+}
+
+func searchCloud(r *http.Request, c *searchCollector, cloudInfo *CloudInfo) {
+	g := graphGet(cloudInfo)
+	if projects := authProjects(r, cloudInfo); projects != nil {
+		g = g.SelectProjects(projects)
+	}
+	b := newGraphTopologyBuilder(r, g)
+	neighborhood := func(key string) func() map[string]string {
+		return func() map[string]string {
+			return map[string]string{"Neighborhood": b.neighborhoodUrl(key, 1, neighborhoodRelations)}
+		}
+	}
+
+	novaInstances := make(map[string]CloudInstanceInfo)
+	for _, instance := range g.NovaInstances() {
+		novaInstances[instance.ID] = instance
+	}
+	vnics := make(map[string]*GraphEntity)
+
+	keys := make([]string, 0, len(g.Entities))
+	for key := range g.Entities {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		e := g.Entities[key]
+		parent := g.Entity(e.Parent)
+		location := SearchLocation{Cloud: cloudInfo.Name}
+		hit := SearchHit{Name: e.Name, Key: e.UID}
+		switch e.Kind {
+		case graphEntityCloud:
+			hit.Type = searchTypeCloud
+			hit.Location = location
+			c.add(hit, []searchField{{"name", e.Name}}, func() map[string]string {
+				return b.cloudViews(cloudInfo.Name, true)
+			})
+		case graphEntityHypervisor:
+			hit.Type = searchTypeHypervisor
+			location.Host = e.Name
+			hit.Location = location
+			c.add(hit, []searchField{
+				{"name", e.Name},
+				{"host_name", e.Hypervisor.HostName},
+				{"id", e.Hypervisor.ID},
+				{"ip", e.HostIP},
+			}, func() map[string]string {
+				views := b.hypervisorViews(e.Name)
+				views["Neighborhood"] = b.neighborhoodUrl(e.Key, 1, neighborhoodRelations)
+				return views
+			})
+		case graphEntityInstance:
+			hit.Type = searchTypeInstance
+			location.Host = parent.Name
+			hit.Location = location
+			fields := []searchField{
+				{"name", e.Instance.Name},
+				{"instance_name", e.Instance.InstanceName},
+				{"uuid", e.Instance.UUID},
+			}
+			if instance, ok := novaInstances[e.Instance.UUID]; ok {
+				fields = append(fields, searchField{"name", instance.Name})
+				delete(novaInstances, e.Instance.UUID)
+			}
+			c.add(hit, fields, func() map[string]string {
+				return b.instanceViews(parent.Name, e.Instance.InstanceName)
+			})
+		case graphEntityNetwork:
+			hit.Type = searchTypeNetwork
+			location.Network = e.Name
+			hit.Location = location
+			c.add(hit, []searchField{{"name", e.Name}, {"id", e.Network.ID}}, func() map[string]string {
+				return b.networkViews(e.Name)
+			})
+		case graphEntityVnic:
+			vnics[strings.ToLower(e.Vnic.MacAddress)] = e
+			hit.Type = searchTypeLibvirtInterface
+			if len(hit.Name) == 0 {
+				hit.Name = e.Vnic.MacAddress
+			}
+			location.Host = g.Entity(parent.Parent).Name
+			location.Instance = parent.Instance.InstanceName
+			location.Network = e.Vnic.NetworkName
+			location.Bridge, location.Port = searchAttachment(g, e.Key, graphRelationAttachment)
+			hit.Location = location
+			c.add(hit, []searchField{{"name", e.Vnic.DevName}, {"mac", e.Vnic.MacAddress}}, neighborhood(e.Key))
+		case graphEntityInterface:
+			bridge := g.Entity(parent.Parent)
+			hit.Type = searchTypeOvsInterface
+			location.Host = g.Entity(bridge.Parent).Name
+			location.Bridge = bridge.Name
+			location.Port = parent.Name
+			hit.Location = location
+			c.add(hit, []searchField{
+				{"name", e.Name},
+				{"mac", e.Interface.MacAddressInUse},
+				{"attached_mac", e.Interface.ExternalIDs["attached-mac"]},
+				{"iface_id", e.Interface.ExternalIDs["iface-id"]},
+				{"vm_uuid", e.Interface.ExternalIDs["vm-uuid"]},
+				{"uuid", e.Interface.UUID},
+				{"ip", e.Interface.Options["local_ip"]},
+				{"ip", e.Interface.Options["remote_ip"]},
+			}, neighborhood(e.Key))
+		case graphEntityPhysicalNic:
+			hit.Type = searchTypePhysicalNic
+			location.Host = parent.Name
+			location.Bridge, location.Port = searchAttachment(g, e.Key, graphRelationUplink)
+			hit.Location = location
+			c.add(hit, []searchField{{"name", e.Name}, {"mac", e.PhysicalNic.MacAddress}}, neighborhood(e.Key))
+		}
+	}
+
+	// Nova instances whose domain was not found on their host.
+	for _, instance := range g.NovaInstances() {
+		if _, ok := novaInstances[instance.ID]; !ok {
+			continue
+		}
+		hit := SearchHit{
+			Type:     searchTypeInstance,
+			Name:     instance.Name,
+			Key:      graphEntityInstance + "/" + cloudInfo.Name + "/" + instance.ID,
+			Location: SearchLocation{Cloud: cloudInfo.Name},
+		}
+		var views func() map[string]string
+		if hypervisor := g.FindHypervisorByHostName(instance.HostName); hypervisor != nil {
+			hit.Location.Host = hypervisor.Name
+			views = func() map[string]string {
+				return b.hypervisorViews(hypervisor.Name)
+			}
+		}
+		c.add(hit, []searchField{{"name", instance.Name}, {"uuid", instance.ID}}, views)
+	}
+
+	for _, port := range g.NetworkPorts() {
+		hit := SearchHit{
+			Type:     searchTypeNeutronPort,
+			Name:     port.Name,
+			Key:      searchTypeNeutronPort + "/" + cloudInfo.Name + "/" + port.ID,
+			Location: SearchLocation{Cloud: cloudInfo.Name, Network: port.NetworkName},
+		}
+		if len(hit.Name) == 0 {
+			hit.Name = port.ID
+		}
+		views := func() map[string]string {
+			return b.networkViews(port.NetworkName)
+		}
+		if vnic, ok := vnics[strings.ToLower(port.MacAddress)]; ok {
+			instance := g.Entity(vnic.Parent)
+			hit.Location.Host = g.Entity(instance.Parent).Name
+			hit.Location.Instance = instance.Instance.InstanceName
+			hit.Location.Bridge, hit.Location.Port = searchAttachment(g, vnic.Key, graphRelationAttachment)
+			views = func() map[string]string {
+				return b.instanceViews(hit.Location.Host, hit.Location.Instance)
+			}
+		}
+		c.add(hit, []searchField{{"name", port.Name}, {"id", port.ID}, {"mac", port.MacAddress}}, views)
+	}
+}
+
+func searchParse(values url.Values) (*searchRequest, error) {
+	request := &searchRequest{
+		query: strings.ToLower(strings.TrimSpace(values.Get("q"))),
+		types: queryList(values["type"]),
+		match: searchMatchFuzzy,
+		limit: searchDefaultLimit,
+	}
+	if len(request.query) == 0 {
+		return nil, errors.New("Search requires a query q")
+	}
+	if len(request.query) > searchMaxQuery {
+		return nil, errors.New("Query q is longer than " + strconv.Itoa(searchMaxQuery) + " characters")
+	}
+	for _, t := range request.types {
+		if !queryContains(searchTypes, t) {
+			return nil, errors.New("Invalid type " + t + ", expected one of " + strings.Join(searchTypes, ", "))
+		}
+	}
+	if match := values.Get("match"); len(match) > 0 {
+		if !queryContains(searchMatches, match) {
+			return nil, errors.New("Invalid match " + match + ", expected one of " + strings.Join(searchMatches, ", "))
+		}
+		request.match = match
+	}
+	if limit := values.Get("limit"); len(limit) > 0 {
+		var err error
+		request.limit, err = strconv.Atoi(limit)
+		if err != nil || request.limit <= 0 {
+			return nil, errors.New("Invalid limit " + limit)
+		}
+	}
+	return request, nil
+}
+
+func Search(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	request, err := searchParse(values)
+	if err != nil {
+		apiError := APIError{http.StatusBadRequest, err.Error()}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	cloudList := authCloudList(r)
+	if cloudName := values.Get("cloud"); len(cloudName) > 0 {
+		cloudInfo := cloudGetCloudInfo(cloudName)
+		if cloudInfo == nil || !authCloudVisible(r, cloudInfo) {
+			apiError := APIError{http.StatusNotFound, "Cloud " + cloudName + " Not discovered"}
+			luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+			return
+		}
+		cloudList = []CloudInfo{*cloudInfo}
+	}
+
+	c := &searchCollector{request: request, hits: make([]SearchHit, 0)}
+	for i := range cloudList {
+		searchCloud(r, c, &cloudList[i])
+	}
+	sort.SliceStable(c.hits, func(i, j int) bool {
+		if c.hits[i].Score != c.hits[j].Score {
+			return c.hits[i].Score > c.hits[j].Score
+		}
+		return c.hits[i].Name < c.hits[j].Name
+	})
+	if len(c.hits) > request.limit {
+		c.hits = c.hits[:request.limit]
+	}
+	luddite.WriteResponse(rw, http.StatusOK, SearchResults{values.Get("q"), c.hits})
+}
+
+func InitSearch(router *httprouter.Router) {
+	router.GET("/topology/search", authorize(authRoleViewer, viewCached(Search)))
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/SpirentOrion/httprouter"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSearchScore(t *testing.T) {
+	tests := []struct {
+		field   searchField
+		query   string
+		loosest string
+		match   string
+		score   int
+	}{
+		{searchField{"name", "vRouter1"}, "vrouter1", searchMatchFuzzy, searchMatchExact, 100},
+		{searchField{"name", "vRouter1"}, "vrou", searchMatchFuzzy, searchMatchPrefix, 80},
+		{searchField{"name", "vRouter1"}, "vrou", searchMatchExact, "", 0},
+		{searchField{"name", "vRouter1"}, "uter", searchMatchFuzzy, searchMatchSubstring, 60},
+		{searchField{"name", "vRouter1"}, "uter", searchMatchPrefix, "", 0},
+		{searchField{"name", "vRouter1"}, "vroutre1", searchMatchFuzzy, searchMatchFuzzy, 40},
+		{searchField{"name", "vRouter1"}, "vruotre1", searchMatchFuzzy, searchMatchFuzzy, 30},
+		{searchField{"name", "vRouter1"}, "vruotr1x", searchMatchFuzzy, "", 0},
+		{searchField{"id", "u1"}, "u2", searchMatchFuzzy, "", 0},
+		{searchField{"name", "hypervisor"}, "hypre", searchMatchFuzzy, searchMatchFuzzy, 40},
+		{searchField{"name", "hypervisor"}, "hyprv", searchMatchFuzzy, "", 0},
+		{searchField{"mac", "fa:16:00:00:00:01"}, "fa-16-00-00-00-01", searchMatchExact, searchMatchExact, 100},
+		{searchField{"mac", ""}, "fa16", searchMatchFuzzy, "", 0},
+		{searchField{"name", "vm2"}, "vm2x", searchMatchFuzzy, searchMatchFuzzy, 40},
+		{searchField{"name", "vm2"}, strings.Repeat("vm2", 80), searchMatchFuzzy, "", 0},
+	}
+	for _, test := range tests {
+		if match, score := searchScore(test.field, test.query, test.loosest); match != test.match || score != test.score {
+			t.Errorf("%s %q for %q (%s) = %s %d, want %s %d", test.field.name, test.field.value, test.query, test.loosest, match, score, test.match, test.score)
+		}
+	}
+}
+
+func TestSearchParseRejectsBadParameters(t *testing.T) {
+	for _, query := range []string{"", "q=x&type=router", "q=x&match=regexp", "q=x&limit=0", "q=x&limit=ten", "q=" + strings.Repeat("x", searchMaxQuery+1)} {
+		values, _ := url.ParseQuery(query)
+		if _, err := searchParse(values); err == nil {
+			t.Errorf("searchParse accepted %q", query)
+		}
+	}
+}
+
+func TestSearchFindsInstancesByNameAndMac(t *testing.T) {
+	defer testFixture()()
+	router := httprouter.New()
+	InitSearch(router)
+
+	search := func(query string) []SearchHit {
+		r, _ := http.NewRequest("GET", "http://topology/topology/search?"+query, nil)
+		rw := httptest.NewRecorder()
+		router.ServeHTTP(rw, r)
+		var results SearchResults
+		if err := json.Unmarshal(rw.Body.Bytes(), &results); rw.Code != http.StatusOK || err != nil {
+			t.Fatalf("GET /topology/search?%s = %d %s", query, rw.Code, rw.Body.String())
+		}
+		return results.Hits
+	}
+
+	hits := search("q=vroutr1&type=instance")
+	if len(hits) != 1 || hits[0].Name != "vRouter1" || hits[0].Match != searchMatchFuzzy || hits[0].Location.Host != "hv1" {
+		t.Errorf("instance hits %+v, want vRouter1 on hv1 by a typo", hits)
+	}
+	hits = search("q=FA-16-00-00-00-01&match=exact")
+	if len(hits) == 0 || hits[0].Score != 100 {
+		t.Errorf("MAC hits %+v, want exact matches", hits)
+	}
+	for _, hit := range hits {
+		if hit.Field != "mac" && hit.Field != "attached_mac" {
+			t.Errorf("MAC hit %s %s on field %s", hit.Type, hit.Name, hit.Field)
+		}
+	}
+	if hits := search("q=hv&limit=1"); len(hits) != 1 {
+		t.Errorf("%d hits with limit=1", len(hits))
+	}
+}
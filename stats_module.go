@@ -0,0 +1,321 @@
+package main
+
+import (
+	"github.com/SpirentOrion/httprouter"
+	"github.com/SpirentOrion/luddite"
+	"golang.org/x/net/context"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type StatsSample struct {
+	Time     time.Time
+	Counters map[string]float64
+}
+
+type InterfaceRates struct {
+	Source      string  `json:"source,required"`
+	Name        string  `json:"name,required"`
+	RxBps       float64 `json:"rx_bps,required"`
+	TxBps       float64 `json:"tx_bps,required"`
+	RxPps       float64 `json:"rx_pps,required"`
+	TxPps       float64 `json:"tx_pps,required"`
+	RxDropRate  float64 `json:"rx_drop_rate,required"`
+	TxDropRate  float64 `json:"tx_drop_rate,required"`
+	RxErrorRate float64 `json:"rx_error_rate,required"`
+	TxErrorRate float64 `json:"tx_error_rate,required"`
+	Utilization float64 `json:"utilization,required"`
+}
+
+type HypervisorInterfaceRates struct {
+	Interfaces []InterfaceRates `json:"interfaces,required"`
+}
+
+const (
+	statsSourceLibvirt = "libvirt"
+	statsSourceOvs     = "ovs"
+
+	statsDefaultPollConcurrency = 8
+)
+
+var statsSamples map[string][]StatsSample = make(map[string][]StatsSample)
+var statsLock sync.RWMutex
+
+// statsGeneration counts the polls, so views decorated with rates can be
+// cached apart from the structure they decorate.
+var statsGeneration uint64
+
+// Libvirt and OVS name their counters differently, so each rate is computed
+// from whichever of the aliases the sample carries.
+var statsCounterAliases = map[string][]string{
+	"rx_bytes":   {"rx_bytes"},
+	"tx_bytes":   {"tx_bytes"},
+	"rx_packets": {"rx_packets"},
+	"tx_packets": {"tx_packets"},
+	"rx_drop":    {"rx_drop", "rx_dropped"},
+	"tx_drop":    {"tx_drop", "tx_dropped"},
+	"rx_errs":    {"rx_errs", "rx_errors"},
+	"tx_errs":    {"tx_errs", "tx_errors"},
+}
+
+func statsKey(source string, ipAddress string, name string) string {
+	return source + "/" + ipAddress + "/" + name
+}
+
+func statsRecordLibvirtSample(ipAddress string, devName string, statistics map[string]int64, t time.Time) {
+	counters := make(map[string]float64, len(statistics))
+	for k, v := range statistics {
+		counters[k] = float64(v)
+	}
+	statsRecordSample(statsSourceLibvirt, ipAddress, devName, counters, t)
+}
+
+func statsRecordOvsSample(ipAddress string, name string, statistics map[string]float64, t time.Time) {
+	counters := make(map[string]float64, len(statistics))
+	for k, v := range statistics {
+		counters[k] = v
+	}
+	statsRecordSample(statsSourceOvs, ipAddress, name, counters, t)
+}
+
+func statsRecordSample(source string, ipAddress string, name string, counters map[string]float64, t time.Time) {
+	maxSamples := cfg.Stats.Samples
+	if maxSamples < 2 {
+		maxSamples = 2
+	}
+	key := statsKey(source, ipAddress, name)
+
+	statsLock.Lock()
+	samples := append(statsSamples[key], StatsSample{Time: t, Counters: counters})
+	if len(samples) > maxSamples {
+		samples = samples[len(samples)-maxSamples:]
+	}
+	statsSamples[key] = samples
+	statsLock.Unlock()
+
+	if len(samples) >= 2 {
+		historyRecord(key, t, counters, statsComputeRates(source, name, samples[len(samples)-2:]))
+	}
+}
+
+func statsCounter(sample StatsSample, counter string) (float64, bool) {
+	for _, alias := range statsCounterAliases[counter] {
+		if v, ok := sample.Counters[alias]; ok {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+func statsCounterRate(first StatsSample, last StatsSample, counter string) float64 {
+	seconds := last.Time.Sub(first.Time).Seconds()
+	if seconds <= 0 {
+		return 0
+	}
+	v1, ok1 := statsCounter(first, counter)
+	v2, ok2 := statsCounter(last, counter)
+	if !ok1 || !ok2 || v2 < v1 {
+		// Counter missing or reset since the first sample.
+		return 0
+	}
+	return (v2 - v1) / seconds
+}
+
+func statsComputeRates(source string, name string, samples []StatsSample) InterfaceRates {
+	first := samples[0]
+	last := samples[len(samples)-1]
+	rates := InterfaceRates{
+		Source:      source,
+		Name:        name,
+		RxBps:       8 * statsCounterRate(first, last, "rx_bytes"),
+		TxBps:       8 * statsCounterRate(first, last, "tx_bytes"),
+		RxPps:       statsCounterRate(first, last, "rx_packets"),
+		TxPps:       statsCounterRate(first, last, "tx_packets"),
+		RxDropRate:  statsCounterRate(first, last, "rx_drop"),
+		TxDropRate:  statsCounterRate(first, last, "tx_drop"),
+		RxErrorRate: statsCounterRate(first, last, "rx_errs"),
+		TxErrorRate: statsCounterRate(first, last, "tx_errs"),
+	}
+	if cfg.Stats.LinkSpeedMbps > 0 {
+		bps := rates.RxBps
+		if rates.TxBps > bps {
+			bps = rates.TxBps
+		}
+		rates.Utilization = bps / (cfg.Stats.LinkSpeedMbps * 1000000)
+	}
+	return rates
+}
+
+func statsGetRates(source string, ipAddress string, name string) (InterfaceRates, bool) {
+	statsLock.RLock()
+	samples := statsSamples[statsKey(source, ipAddress, name)]
+	statsLock.RUnlock()
+
+	if len(samples) < 2 {
+		return InterfaceRates{}, false
+	}
+	return statsComputeRates(source, name, samples), true
+}
+
+func statsGetGeneration() uint64 {
+	statsLock.RLock()
+	defer statsLock.RUnlock()
+	return statsGeneration
+}
+
+func statsGetHypervisorRates(ipAddress string) []InterfaceRates {
+	statsLock.RLock()
+	var keys []string
+	for key, samples := range statsSamples {
+		if len(samples) < 2 {
+			continue
+		}
+		parts := strings.SplitN(key, "/", 3)
+		if len(parts) == 3 && parts[1] == ipAddress {
+			keys = append(keys, key)
+		}
+	}
+	statsLock.RUnlock()
+
+	sort.Strings(keys)
+	ratesList := make([]InterfaceRates, 0, len(keys))
+	for _, key := range keys {
+		parts := strings.SplitN(key, "/", 3)
+		if rates, ok := statsGetRates(parts[0], parts[1], parts[2]); ok {
+			ratesList = append(ratesList, rates)
+		}
+	}
+	return ratesList
+}
+
+func statsSetLinkUtilization(link *TopologyLink, source string, ipAddress string, name string) {
+	if len(name) == 0 {
+		return
+	}
+	rates, ok := statsGetRates(source, ipAddress, name)
+	if !ok {
+		return
+	}
+	link.Props["rx_bps"] = rates.RxBps
+	link.Props["tx_bps"] = rates.TxBps
+	link.Props["rx_pps"] = rates.RxPps
+	link.Props["tx_pps"] = rates.TxPps
+	link.Props["rx_drop_rate"] = rates.RxDropRate
+	link.Props["tx_drop_rate"] = rates.TxDropRate
+	link.Props["rx_error_rate"] = rates.RxErrorRate
+	link.Props["tx_error_rate"] = rates.TxErrorRate
+	link.Props["utilization"] = rates.Utilization
+
+	var threshold *StatsThreshold
+	for i, t := range cfg.Stats.Thresholds {
+		if rates.Utilization >= t.Utilization && (threshold == nil || t.Utilization >= threshold.Utilization) {
+			threshold = &cfg.Stats.Thresholds[i]
+		}
+	}
+	if threshold != nil {
+		link.Width = threshold.Width
+		if len(threshold.Color) > 0 {
+			link.Color = threshold.Color
+		}
+	}
+}
+
+// statsPollHosts calls poll for each host, running at most limit calls at
+// once, and returns when all of them have.
+func statsPollHosts(hosts []string, limit int, poll func(ipAddress string)) {
+	if limit <= 0 {
+		limit = statsDefaultPollConcurrency
+	}
+	slots := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for _, ipAddress := range hosts {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(ipAddress string) {
+			defer wg.Done()
+			poll(ipAddress)
+			<-slots
+		}(ipAddress)
+	}
+	wg.Wait()
+}
+
+func statsPoll() {
+	cloudInfos := make(map[string]CloudInfo)
+	var hosts []string
+	for _, cloudInfo := range cloudGetCloudList() {
+		for _, hypervisor := range cloudGetHypervisorList(&cloudInfo) {
+			if hypervisor.State == "up" {
+				if _, ok := cloudInfos[hypervisor.HostIP]; !ok {
+					hosts = append(hosts, hypervisor.HostIP)
+				}
+				cloudInfos[hypervisor.HostIP] = cloudInfo
+			}
+		}
+	}
+
+	statsPollHosts(hosts, cfg.Stats.PollConcurrency, func(ipAddress string) {
+		libvirtLoadStatistics(cloudInfos[ipAddress], ipAddress)
+		ovsLoadStatistics(cloudInfos[ipAddress], ipAddress)
+	})
+
+	polled := make(map[string]bool, len(hosts))
+	for _, ipAddress := range hosts {
+		polled[ipAddress] = true
+	}
+	libvirtPruneStatistics(polled)
+	ovsPruneStatistics(polled)
+
+	statsLock.Lock()
+	statsGeneration++
+	statsLock.Unlock()
+}
+
+func statsPollLoop() {
+	interval := time.Duration(cfg.Stats.PollInterval) * time.Second
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	for !shutdown {
+		time.Sleep(interval)
+		statsPoll()
+		alertEvaluate()
+	}
+}
+
+func GetHypervisorInterfaceRates(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	cloudName := httprouter.ContextParams(ctx).ByName("cloud_name")
+	hypervisorName := httprouter.ContextParams(ctx).ByName("hypervisor_name")
+	hypervisor := cloudGetHypervisorInfo(cloudName, hypervisorName)
+	if hypervisor == nil {
+		apiError := APIError{http.StatusNotFound, "Hypervisor " + hypervisorName + " for cloud " + cloudName + " Not discovered"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+
+	scope := authProjectGraph(r, cloudGetCloudInfo(cloudName))
+	if scope != nil && scope.Entity(graphHypervisorKey(hypervisor.HostIP)) == nil {
+		apiError := APIError{http.StatusNotFound, "Hypervisor " + hypervisorName + " for cloud " + cloudName + " Not discovered"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+
+	rates := HypervisorInterfaceRates{make([]InterfaceRates, 0)}
+	for _, interfaceRates := range statsGetHypervisorRates(hypervisor.HostIP) {
+		if scope == nil || scope.HasInterface(hypervisor.HostIP, interfaceRates.Source, interfaceRates.Name) {
+			rates.Interfaces = append(rates.Interfaces, interfaceRates)
+		}
+	}
+	luddite.WriteResponse(rw, http.StatusOK, rates)
+}
+
+func InitStats(router *httprouter.Router) {
+	router.GET("/topology/stats/rates/:cloud_name/:hypervisor_name", authorize(authRoleViewer, GetHypervisorInterfaceRates))
+
+	if cfg.Stats.Enabled {
+		go statsPollLoop()
+	}
+}
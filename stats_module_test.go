@@ -0,0 +1,89 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStatsCounterRate(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	sample := func(seconds int, counters map[string]float64) StatsSample {
+		return StatsSample{Time: t0.Add(time.Duration(seconds) * time.Second), Counters: counters}
+	}
+	tests := []struct {
+		name    string
+		first   StatsSample
+		last    StatsSample
+		counter string
+		rate    float64
+	}{
+		{"increase", sample(0, map[string]float64{"rx_bytes": 100}), sample(10, map[string]float64{"rx_bytes": 1100}), "rx_bytes", 100},
+		{"ovs alias", sample(0, map[string]float64{"rx_dropped": 0}), sample(10, map[string]float64{"rx_dropped": 50}), "rx_drop", 5},
+		{"counter reset", sample(0, map[string]float64{"rx_bytes": 1000}), sample(10, map[string]float64{"rx_bytes": 10}), "rx_bytes", 0},
+		{"missing counter", sample(0, map[string]float64{"rx_bytes": 0}), sample(10, map[string]float64{}), "rx_bytes", 0},
+		{"same time", sample(10, map[string]float64{"rx_bytes": 0}), sample(10, map[string]float64{"rx_bytes": 100}), "rx_bytes", 0},
+		{"out of order", sample(10, map[string]float64{"rx_bytes": 0}), sample(0, map[string]float64{"rx_bytes": 100}), "rx_bytes", 0},
+	}
+	for _, test := range tests {
+		if rate := statsCounterRate(test.first, test.last, test.counter); rate != test.rate {
+			t.Errorf("%s: rate = %v, want %v", test.name, rate, test.rate)
+		}
+	}
+}
+
+func TestStatsGetRatesUtilization(t *testing.T) {
+	defer testFixture()()
+	testFixtureStats()
+
+	rates, ok := statsGetRates(statsSourceLibvirt, "10.0.0.1", "tap1")
+	if !ok {
+		t.Fatal("no rates for tap1")
+	}
+	if rates.RxBps != 800000 || rates.TxBps != 0 {
+		t.Errorf("tap1 rates = %v rx, %v tx b/s, want 800000 rx", rates.RxBps, rates.TxBps)
+	}
+	if rates.Utilization != 800000/(cfg.Stats.LinkSpeedMbps*1000000) {
+		t.Errorf("tap1 utilization = %v", rates.Utilization)
+	}
+	if _, ok := statsGetRates(statsSourceOvs, "10.0.0.1", "tap1"); ok {
+		t.Error("tap1 has OVS rates without OVS samples")
+	}
+}
+
+func TestStatsRecordSampleKeepsNewest(t *testing.T) {
+	defer testFixture()()
+	for i := 0; i < cfg.Stats.Samples+2; i++ {
+		statsRecordOvsSample("10.0.0.1", "qvo1", map[string]float64{"rx_bytes": float64(i)}, testFixtureTime.Add(time.Duration(i)*time.Second))
+	}
+	samples := statsSamples[statsKey(statsSourceOvs, "10.0.0.1", "qvo1")]
+	if len(samples) != cfg.Stats.Samples || samples[len(samples)-1].Counters["rx_bytes"] != float64(cfg.Stats.Samples+1) {
+		t.Errorf("kept %d samples ending %v, want the newest %d", len(samples), samples[len(samples)-1].Counters, cfg.Stats.Samples)
+	}
+}
+
+func TestStatsPollHostsBoundsConcurrency(t *testing.T) {
+	hosts := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5", "10.0.0.6"}
+	var lock sync.Mutex
+	running, most := 0, 0
+	polled := make(map[string]bool)
+	statsPollHosts(hosts, 2, func(ipAddress string) {
+		lock.Lock()
+		running++
+		if running > most {
+			most = running
+		}
+		polled[ipAddress] = true
+		lock.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		lock.Lock()
+		running--
+		lock.Unlock()
+	})
+	if len(polled) != len(hosts) {
+		t.Errorf("polled %d hosts, want %d", len(polled), len(hosts))
+	}
+	if most != 2 {
+		t.Errorf("%d polls ran at once, want 2", most)
+	}
+}
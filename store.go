@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+func storePath(name string) string {
+	path := cfg.Store.Path
+	if len(path) == 0 {
+		path = "."
+	}
+	return filepath.Join(path, name)
+}
+
+func storeLoad(name string, v interface{}) error {
+	data, err := ioutil.ReadFile(storePath(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func storeSave(name string, v interface{}) error {
+	return storeWrite(name, v, 0644)
+}
+
+// storeSavePrivate saves like storeSave but leaves the file readable by the
+// service's user only.
+func storeSavePrivate(name string, v interface{}) error {
+	return storeWrite(name, v, 0600)
+}
+
+func storeWrite(name string, v interface{}, perm os.FileMode) error {
+	path := storePath(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err = ioutil.WriteFile(tmpPath, data, perm); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmpPath, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
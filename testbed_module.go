@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/SpirentOrion/httprouter"
+	log "github.com/SpirentOrion/logrus"
+	"github.com/SpirentOrion/luddite"
+	"golang.org/x/net/context"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+type TestBed struct {
+	Name                string                    `json:"name,required"`
+	Cloud               string                    `json:"cloud,required"`
+	Description         string                    `json:"description,omitempty"`
+	HypervisorInstances []HypervisorInstanceNames `json:"hypervisor_instances,required"`
+	Expanded            bool                      `json:"expanded,omitempty"`
+	Unfiltered          bool                      `json:"unfiltered,omitempty"`
+	Layers              []string                  `json:"layers,omitempty"`
+	Networks            []string                  `json:"networks,omitempty"`
+}
+
+type TestBeds struct {
+	TestBeds []TestBed `json:"testbeds,required"`
+}
+
+const testBedStoreName = "testbeds.json"
+
+var testBeds map[string]TestBed = make(map[string]TestBed)
+var testBedLock sync.Mutex
+
+func testBedGet(name string) *TestBed {
+	testBedLock.Lock()
+	defer testBedLock.Unlock()
+
+	if testBed, ok := testBeds[name]; ok {
+		return &testBed
+	}
+	return nil
+}
+
+// testBedVisible returns a test bed unless it is missing or the request
+// may not see its cloud.
+func testBedVisible(r *http.Request, testBedName string) *TestBed {
+	testBed := testBedGet(testBedName)
+	if testBed == nil {
+		return nil
+	}
+	if !testBedCloudVisible(r, testBed) {
+		return nil
+	}
+	return testBed
+}
+
+func testBedCloudVisible(r *http.Request, testBed *TestBed) bool {
+	cloudInfo := cloudGetCloudInfo(testBed.Cloud)
+	return cloudInfo == nil || authCloudVisible(r, cloudInfo)
+}
+
+// testBedGetList returns the test beds sorted by name, limited to one cloud
+// unless cloudName is empty.
+func testBedGetList(cloudName string) []TestBed {
+	testBedLock.Lock()
+	list := make([]TestBed, 0, len(testBeds))
+	for _, testBed := range testBeds {
+		if len(cloudName) == 0 || testBed.Cloud == cloudName {
+			list = append(list, testBed)
+		}
+	}
+	testBedLock.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+func testBedValidate(testBed TestBed) error {
+	if len(testBed.Name) == 0 {
+		return errors.New("Test bed name is required")
+	}
+	if cloudGetCloudInfo(testBed.Cloud) == nil {
+		return errors.New("Cloud " + testBed.Cloud + " Not discovered")
+	}
+	if len(testBed.HypervisorInstances) == 0 {
+		return errors.New("Test bed " + testBed.Name + " requires hypervisor_instances")
+	}
+	for _, hi := range testBed.HypervisorInstances {
+		if len(hi.HostName) == 0 {
+			return errors.New("Test bed " + testBed.Name + " has a selection without host_name")
+		}
+	}
+	for _, layer := range testBed.Layers {
+		if !queryContains(queryLayers, layer) {
+			return errors.New("Invalid layer " + layer)
+		}
+	}
+	return nil
+}
+
+// testBedQuery renders a test bed like the filtered OVS views, using the
+// view options saved with it.
+func testBedQuery(testBed *TestBed) TopologyQuery {
+	q := cloudHypervisorsOvsNetworkQuery(testBed.Cloud, testBed.HypervisorInstances, testBed.Expanded, testBed.Unfiltered)
+	q.Title = testBed.Cloud + " " + testBed.Name + " Test Bed " + cloudHypervisorsOvsNetworkTopologyTitle(testBed.Expanded, testBed.Unfiltered)
+	if len(testBed.Layers) > 0 {
+		q.Layers = testBed.Layers
+	}
+	q.Networks = testBed.Networks
+	return q
+}
+
+func testBedSave() {
+	viewCacheInvalidate()
+
+	testBedLock.Lock()
+	list := make([]TestBed, 0, len(testBeds))
+	for _, testBed := range testBeds {
+		list = append(list, testBed)
+	}
+	err := storeSave(testBedStoreName, list)
+	testBedLock.Unlock()
+
+	if err != nil {
+		logFields := log.Fields{
+			"Path":  storePath(testBedStoreName),
+			"Error": err.Error(),
+		}
+		service.Logger().WithFields(logFields).Error("Error saving test beds")
+	}
+}
+
+func testBedLoad() error {
+	var list []TestBed
+	if err := storeLoad(testBedStoreName, &list); err != nil {
+		logFields := log.Fields{
+			"Path":  storePath(testBedStoreName),
+			"Error": err.Error(),
+		}
+		service.Logger().WithFields(logFields).Error("Error loading test beds")
+		return err
+	}
+
+	testBedLock.Lock()
+	defer testBedLock.Unlock()
+
+	for _, testBed := range list {
+		testBeds[testBed.Name] = testBed
+	}
+	return nil
+}
+
+func testBedRead(rw http.ResponseWriter, r *http.Request) *TestBed {
+	var testBed TestBed
+	if err := json.NewDecoder(r.Body).Decode(&testBed); err != nil {
+		apiError := APIError{http.StatusBadRequest, "Invalid test bed: " + err.Error()}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return nil
+	}
+	if err := testBedValidate(testBed); err != nil {
+		apiError := APIError{http.StatusBadRequest, err.Error()}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return nil
+	}
+	if !authCloudVisible(r, cloudGetCloudInfo(testBed.Cloud)) {
+		apiError := APIError{http.StatusBadRequest, "Cloud " + testBed.Cloud + " Not discovered"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return nil
+	}
+	return &testBed
+}
+
+func GetTestBeds(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	list := TestBeds{make([]TestBed, 0)}
+	for _, testBed := range testBedGetList(r.URL.Query().Get("cloud")) {
+		if testBedCloudVisible(r, &testBed) {
+			list.TestBeds = append(list.TestBeds, testBed)
+		}
+	}
+	luddite.WriteResponse(rw, http.StatusOK, list)
+}
+
+func GetTestBed(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	testBedName := httprouter.ContextParams(ctx).ByName("testbed_name")
+	testBed := testBedVisible(r, testBedName)
+	if testBed == nil {
+		apiError := APIError{http.StatusNotFound, "Test bed " + testBedName + " Not found"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	luddite.WriteResponse(rw, http.StatusOK, testBed)
+}
+
+func CreateTestBed(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	testBed := testBedRead(rw, r)
+	if testBed == nil {
+		return
+	}
+	auditNote(r, testBed.Name, map[string]string{"cloud": testBed.Cloud})
+
+	testBedLock.Lock()
+	_, exists := testBeds[testBed.Name]
+	if !exists {
+		testBeds[testBed.Name] = *testBed
+	}
+	testBedLock.Unlock()
+
+	if exists {
+		apiError := APIError{http.StatusConflict, "Test bed " + testBed.Name + " already exists"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	testBedSave()
+	luddite.WriteResponse(rw, http.StatusCreated, testBed)
+}
+
+func UpdateTestBed(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	testBedName := httprouter.ContextParams(ctx).ByName("testbed_name")
+	testBed := testBedRead(rw, r)
+	if testBed == nil {
+		return
+	}
+	if testBed.Name != testBedName {
+		apiError := APIError{http.StatusBadRequest, "Test bed name " + testBed.Name + " does not match " + testBedName}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	if testBedVisible(r, testBedName) == nil {
+		apiError := APIError{http.StatusNotFound, "Test bed " + testBedName + " Not found"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+
+	testBedLock.Lock()
+	_, exists := testBeds[testBedName]
+	if exists {
+		testBeds[testBedName] = *testBed
+	}
+	testBedLock.Unlock()
+
+	if !exists {
+		apiError := APIError{http.StatusNotFound, "Test bed " + testBedName + " Not found"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	testBedSave()
+	luddite.WriteResponse(rw, http.StatusOK, testBed)
+}
+
+func DeleteTestBed(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	testBedName := httprouter.ContextParams(ctx).ByName("testbed_name")
+	if testBedVisible(r, testBedName) == nil {
+		apiError := APIError{http.StatusNotFound, "Test bed " + testBedName + " Not found"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+
+	testBedLock.Lock()
+	_, exists := testBeds[testBedName]
+	delete(testBeds, testBedName)
+	testBedLock.Unlock()
+
+	if !exists {
+		apiError := APIError{http.StatusNotFound, "Test bed " + testBedName + " Not found"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	testBedSave()
+	apiError := APIError{http.StatusOK, "OK"}
+	luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+}
+
+func TestBedTopology(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	testBedName := httprouter.ContextParams(ctx).ByName("testbed_name")
+	testBed := testBedVisible(r, testBedName)
+	if testBed == nil {
+		apiError := APIError{http.StatusNotFound, "Test bed " + testBedName + " Not found"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
+	queryWrite(rw, r, testBedQuery(testBed), newTopologyBuilder(r, testBed.Cloud).cloudViews(testBed.Cloud, false))
+}
+
+func InitTestBeds(router *httprouter.Router) {
+	router.GET("/topology/testbeds", authorize(authRoleViewer, GetTestBeds))
+	router.POST("/topology/testbeds", authorize(authRoleOperator, audited(auditActionTestBedCreate, CreateTestBed)))
+	router.GET("/topology/testbeds/:testbed_name", authorize(authRoleViewer, GetTestBed))
+	router.PUT("/topology/testbeds/:testbed_name", authorize(authRoleOperator, audited(auditActionTestBedUpdate, UpdateTestBed)))
+	router.DELETE("/topology/testbeds/:testbed_name", authorize(authRoleOperator, audited(auditActionTestBedDelete, DeleteTestBed)))
+	router.GET("/topology/testbedTopology/:testbed_name", authorize(authRoleViewer, viewCachedStats(TestBedTopology)))
+
+	testBedLoad()
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/SpirentOrion/httprouter"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func testBedTestRouter() *httprouter.Router {
+	router := httprouter.New()
+	InitTopology(router)
+	InitTestBeds(router)
+	return router
+}
+
+func testBedTestRequest(router *httprouter.Router, method string, path string, body string) *httptest.ResponseRecorder {
+	r, _ := http.NewRequest(method, "http://topology"+path, strings.NewReader(body))
+	rw := httptest.NewRecorder()
+	router.ServeHTTP(rw, r)
+	return rw
+}
+
+func TestTestBedCrud(t *testing.T) {
+	defer testFixture()()
+	router := testBedTestRouter()
+
+	lab := `{"name":"lab","cloud":"c1","hypervisor_instances":[{"host_name":"compute-node.spirent.com","instance_names":["vRouter1"]}]}`
+	expanded := `{"name":"lab","cloud":"c1","expanded":true,"hypervisor_instances":[{"host_name":"compute-node.spirent.com","instance_names":["vRouter1"]}]}`
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"POST", "/topology/testbeds", lab, http.StatusCreated},
+		{"POST", "/topology/testbeds", lab, http.StatusConflict},
+		{"POST", "/topology/testbeds", `{"name":"lab2","cloud":"c9","hypervisor_instances":[{"host_name":"hv2.local"}]}`, http.StatusBadRequest},
+		{"POST", "/topology/testbeds", `{"name":"lab2","cloud":"c1","hypervisor_instances":[]}`, http.StatusBadRequest},
+		{"POST", "/topology/testbeds", `{"name":"lab2","cloud":"c1","hypervisor_instances":[{"host_name":""}]}`, http.StatusBadRequest},
+		{"POST", "/topology/testbeds", `{"name":"lab2","cloud":"c1","layers":["l7"],"hypervisor_instances":[{"host_name":"hv2.local"}]}`, http.StatusBadRequest},
+		{"POST", "/topology/testbeds", `{"name":`, http.StatusBadRequest},
+		{"GET", "/topology/testbeds/lab", "", http.StatusOK},
+		{"GET", "/topology/testbeds/ghost", "", http.StatusNotFound},
+		{"PUT", "/topology/testbeds/lab", strings.Replace(expanded, `"lab"`, `"lab3"`, 1), http.StatusBadRequest},
+		{"PUT", "/topology/testbeds/ghost", strings.Replace(expanded, `"lab"`, `"ghost"`, 1), http.StatusNotFound},
+		{"PUT", "/topology/testbeds/lab", expanded, http.StatusOK},
+		{"GET", "/topology/testbedTopology/lab", "", http.StatusOK},
+		{"GET", "/topology/testbedTopology/ghost", "", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		if rw := testBedTestRequest(router, test.method, test.path, test.body); rw.Code != test.status {
+			t.Errorf("%s %s = %d, want %d", test.method, test.path, rw.Code, test.status)
+		}
+	}
+
+	var list TestBeds
+	json.Unmarshal(testBedTestRequest(router, "GET", "/topology/testbeds?cloud=c1", "").Body.Bytes(), &list)
+	if len(list.TestBeds) != 1 || !list.TestBeds[0].Expanded {
+		t.Errorf("test beds %+v, want the updated lab", list.TestBeds)
+	}
+	var stored []TestBed
+	storeLoad(testBedStoreName, &stored)
+	if len(stored) != 1 || stored[0].Name != "lab" || !stored[0].Expanded {
+		t.Errorf("stored test beds %+v, want the updated lab", stored)
+	}
+	var data TopologyData
+	json.Unmarshal(testBedTestRequest(router, "GET", "/topology/testbedTopology/lab", "").Body.Bytes(), &data)
+	if data.Title != "c1 lab Test Bed Expanded Filtered VNF OVS Network Topology" {
+		t.Errorf("test bed title = %q, want the expanded filtered test bed view", data.Title)
+	}
+
+	if rw := testBedTestRequest(router, "DELETE", "/topology/testbeds/lab", ""); rw.Code != http.StatusOK {
+		t.Errorf("DELETE lab = %d, want %d", rw.Code, http.StatusOK)
+	}
+	if rw := testBedTestRequest(router, "DELETE", "/topology/testbeds/lab", ""); rw.Code != http.StatusNotFound {
+		t.Errorf("DELETE lab again = %d, want %d", rw.Code, http.StatusNotFound)
+	}
+	stored = nil
+	storeLoad(testBedStoreName, &stored)
+	if len(stored) != 0 {
+		t.Errorf("stored test beds %+v after deleting lab, want none", stored)
+	}
+}
+
+func TestTestBedSelectsViews(t *testing.T) {
+	defer testFixture()()
+	router := testBedTestRouter()
+	testBeds["lab"] = TestBed{Name: "lab", Cloud: "c1", HypervisorInstances: []HypervisorInstanceNames{{"compute-node.spirent.com", []string{"vRouter1"}}}}
+	testBeds["other"] = TestBed{Name: "other", Cloud: "c2", HypervisorInstances: []HypervisorInstanceNames{{"hv9", nil}}}
+	testBeds["stale"] = TestBed{Name: "stale", Cloud: "c1", HypervisorInstances: []HypervisorInstanceNames{{"compute-node.spirent.com", []string{"gone"}}}}
+
+	names := func(path string) map[string]bool {
+		var data TopologyData
+		json.Unmarshal(testBedTestRequest(router, "GET", path, "").Body.Bytes(), &data)
+		names := make(map[string]bool)
+		for _, node := range data.Nodes {
+			names[node.Name] = true
+		}
+		return names
+	}
+	all := names("/topology/cloudHypervisorTopology/c1")
+	lab := names("/topology/cloudHypervisorTopology/c1?testbed=lab")
+	for _, name := range []string{"vRouter1", "vm2", "hv2"} {
+		if !all[name] {
+			t.Errorf("cloud view lacks %s", name)
+		}
+	}
+	if !lab["vRouter1"] || lab["vm2"] || lab["hv2"] {
+		t.Errorf("test bed view nodes %v, want vRouter1 without vm2 and hv2", lab)
+	}
+
+	for _, test := range []struct {
+		testBed string
+		status  int
+	}{
+		{"ghost", http.StatusNotFound},
+		{"other", http.StatusBadRequest},
+		{"stale", http.StatusNotFound},
+	} {
+		path := "/topology/cloudHypervisorTopology/c1?testbed=" + test.testBed
+		if rw := testBedTestRequest(router, "GET", path, ""); rw.Code != test.status {
+			t.Errorf("GET %s = %d, want %d", path, rw.Code, test.status)
+		}
+	}
+}
@@ -1,23 +1,31 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"github.com/SpirentOrion/httprouter"
 	"github.com/SpirentOrion/luddite"
 	"golang.org/x/net/context"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 )
 
 type TopologyData struct {
-	Title    string            `json:"title,required"`
-	Nodes    []TopologyNode    `json:"nodes,required"`
-	Links    []TopologyLink    `json:"links,required"`
-	NodeSets []TopologyNodeSet `json:"nodeSet,required"`
-	Groups   []TopologyGroup   `json:"groups,required"`
-	Views    map[string]string `json:"views,required"`
+	Title    string                `json:"title,required"`
+	Nodes    []TopologyNode        `json:"nodes,required"`
+	Links    []TopologyLink        `json:"links,required"`
+	NodeSets []TopologyNodeSet     `json:"nodeSet,required"`
+	Groups   []TopologyGroup       `json:"groups,required"`
+	Views    map[string]string     `json:"views,required"`
+	Filtered []TopologyFilterMatch `json:"filtered,omitempty"`
+	layout   string
 }
 
 type TopologyNode struct {
 	ID         int                    `json:"id,required"`
+	Key        string                 `json:"key,omitempty"`
 	Name       string                 `json:"name,required"`
 	DeviceType string                 `json:"device_type,required"`
 	X          int                    `json:"x,required"`
@@ -29,6 +37,7 @@ type TopologyNode struct {
 
 type TopologyNodeSet struct {
 	ID         int                    `json:"id,required"`
+	Key        string                 `json:"key,omitempty"`
 	Nodes      []int                  `json:"nodes,required"`
 	Name       string                 `json:"name,required"`
 	Root       int                    `json:"root,required"`
@@ -36,15 +45,18 @@ type TopologyNodeSet struct {
 	X          int                    `json:"x,required"`
 	Y          int                    `json:"y,required"`
 	Color      string                 `json:"color,required"`
+	Collapsed  *bool                  `json:"collapsed,omitempty"`
 	Props      map[string]interface{} `json:"props,required"`
 }
 
 type TopologyLink struct {
+	Key    string                 `json:"key,omitempty"`
 	Name   string                 `json:"name,required"`
 	Source int                    `json:"source,required"`
 	Target int                    `json:"target,required"`
 	Color  string                 `json:"color,required"`
 	Width  int                    `json:"width,required"`
+	Dotted bool                   `json:"dotted,omitempty"`
 	Props  map[string]interface{} `json:"props,required"`
 }
 
@@ -70,8 +82,20 @@ type HypervisorInstances struct {
 }
 
 type HypervisorInstanceNames struct {
-	HostName  string `json:"host_name,required"`
-	InstanceNames     []string `json:"instance_names,required"`
+	HostName      string   `json:"host_name,required"`
+	InstanceNames []string `json:"instance_names,required"`
+}
+
+type HypervisorInstanceError struct {
+	HostName     string `json:"host_name,required"`
+	InstanceName string `json:"instance_name,omitempty"`
+	ErrorMessage string `json:"errorMessage,required"`
+}
+
+type HypervisorInstancesError struct {
+	ErrorCode    int                       `json:"errorCode,required"`
+	ErrorMessage string                    `json:"errorMessage,required"`
+	Errors       []HypervisorInstanceError `json:"errors,required"`
 }
 
 func (df *DirWithFallback) Open(name string) (f http.File, err error) {
@@ -90,3753 +114,947 @@ func NewContentHandler(path, fallback string) http.Handler {
 	return http.FileServer(fs)
 }
 
-func CloudsTopology(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+// topologyBuilder accumulates the nodes and links of one view projected
+// from a TopologyGraph. Node sets share the node id sequence. layout is the
+// default placement of the view. Nodes take the UID of their entity as key
+// when the builder has the graph.
+type topologyBuilder struct {
+	host      string
+	cloudName string
+	graph     *TopologyGraph
+	nodes     []TopologyNode
+	links     []TopologyLink
+	nodeSets  []TopologyNodeSet
+	nodeId    int
+	keyIds    map[string]int
+	nameIds   map[string]int
+	filtered  []TopologyFilterMatch
+	layout    string
+	redact    bool
+}
+
+func newTopologyBuilder(r *http.Request, cloudName string) *topologyBuilder {
+	return &topologyBuilder{
+		host:      r.Host,
+		cloudName: cloudName,
+		keyIds:    make(map[string]int),
+		nameIds:   make(map[string]int),
+		layout:    layoutRadial,
+	}
+}
+
+func newGraphTopologyBuilder(r *http.Request, g *TopologyGraph) *topologyBuilder {
+	b := newTopologyBuilder(r, g.Cloud.Name)
+	b.graph = g
+	b.redact = authRedacted(r)
+	return b
+}
+
+func (b *topologyBuilder) viewUrl(view string, names ...string) string {
+	return "http://" + b.host + "/topology/" + view + "/" + strings.Join(names, "/")
+}
+
+func (b *topologyBuilder) nextId() int {
+	id := b.nodeId
+	b.nodeId++
+	return id
+}
 
-	topologyTitle := "Cloud Topology"
-
-	cloudList := cloudGetCloudList()
-	var nodeList []TopologyNode
-
-	nodeId := 0
-
-	for _, cloudInfo := range cloudList {
-		cloudProps := make(map[string]interface{})
-		cloudProps["authUrl"] = cloudInfo.AuthUrl
-		cloudProps["provider"] = cloudInfo.Provider
-		cloudViews := make(map[string]string)
-		cloudViews["Cloud Topology"] = "http://" + r.Host + "/topology/cloudTopology/" + cloudInfo.Name
-		cloudViews["Cloud Hypervisors"] = "http://" + r.Host + "/topology/cloudHypervisorTopology/" + cloudInfo.Name
-		cloudViews["Cloud Networks"] = "http://" + r.Host + "/topology/cloudLayer3NetworkTopology/" + cloudInfo.Name
-		cloudViews["Cloud Linux Bridges"] = "http://" + r.Host + "/topology/cloudLayer2NetworkTopology/" + cloudInfo.Name
-		cloudViews["Cloud OVS Bridges"] = "http://" + r.Host + "/topology/cloudOvsNetworkTopology/" + cloudInfo.Name
-		cloudViews["Cloud Hypervisors Collapsed Filtered OVS Topology"] = "http://" + r.Host + "/topology/cloudHypervisorsCollapsedFilteredOvsNetworkTopology/" + cloudInfo.Name
-		cloudViews["Cloud Hypervisors Expanded Filtered OVS Topology"] = "http://" + r.Host + "/topology/cloudHypervisorsExpandedFilteredOvsNetworkTopology/" + cloudInfo.Name
-		cloudViews["Cloud Hypervisors Collapsed Unfiltered OVS Topology"] = "http://" + r.Host + "/topology/cloudHypervisorsCollapsedUnfilteredOvsNetworkTopology/" + cloudInfo.Name
-		cloudViews["Cloud Hypervisors Expanded Unfiltered OVS Topology"] = "http://" + r.Host + "/topology/cloudHypervisorsExpandedUnfilteredOvsNetworkTopology/" + cloudInfo.Name
-		cloudNodeId := nodeId
-		cloudNode := TopologyNode{
-			ID:         cloudNodeId,
-			Name:       cloudInfo.Name,
-			DeviceType: "cloud",
-			Color:      "#00CCFF",
-			Props:      cloudProps,
-			Views:      cloudViews,
+// addNode assigns the next id to node. key is the graph entity the node was
+// projected from and may be empty.
+func (b *topologyBuilder) addNode(key string, node TopologyNode) TopologyNode {
+	node.ID = b.nextId()
+	node.Key = key
+	if b.graph != nil {
+		if e := b.graph.Entity(key); e != nil {
+			node.Key = e.UID
 		}
-		nodeList = append(nodeList, cloudNode)
-		nodeId++
 	}
+	b.nodes = append(b.nodes, node)
+	if len(key) > 0 {
+		b.keyIds[key] = len(b.nodes) - 1
+	}
+	if _, ok := b.nameIds[node.Name]; !ok {
+		b.nameIds[node.Name] = len(b.nodes) - 1
+	}
+	return node
+}
 
-	linkList := make([]TopologyLink, 0)
-	nodeSetList := make([]TopologyNodeSet, 0)
-	groupList := make([]TopologyGroup, 0)
+func (b *topologyBuilder) addLink(link TopologyLink) {
+	b.links = append(b.links, link)
+}
 
-	viewList := make(map[string]string, 2)
+func (b *topologyBuilder) findByKey(key string) (int, string, bool) {
+	if i, ok := b.keyIds[key]; ok {
+		return b.nodes[i].ID, b.nodes[i].Name, true
+	}
+	return 0, "", false
+}
 
-	cloudTopologyData := TopologyData{
-		Title:    topologyTitle,
-		Nodes:    nodeList,
-		Links:    linkList,
-		NodeSets: nodeSetList,
-		Groups:   groupList,
-		Views:    viewList,
+// findByName returns the first node added with the given name, whatever its
+// kind.
+func (b *topologyBuilder) findByName(name string) (int, string, bool) {
+	if i, ok := b.nameIds[name]; ok {
+		return b.nodes[i].ID, b.nodes[i].Name, true
 	}
+	return 0, "", false
+}
 
-	luddite.WriteResponse(rw, http.StatusOK, cloudTopologyData)
+// nodeSetKeys names each node set after its first member, so that it keeps
+// its key while the view is rebuilt.
+// nodeKeys numbers the nodes drawn again for an entity in the order they
+// were added.
+func (b *topologyBuilder) nodeKeys() {
+	seen := make(map[string]int)
+	for i := range b.nodes {
+		node := &b.nodes[i]
+		if len(node.Key) == 0 {
+			continue
+		}
+		seen[node.Key]++
+		if seen[node.Key] > 1 {
+			node.Key += "#" + strconv.Itoa(seen[node.Key])
+		}
+	}
 }
 
-func CloudTopology(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+func (b *topologyBuilder) nodeSetKeys() {
+	keys := make(map[int]string)
+	for _, node := range b.nodes {
+		keys[node.ID] = node.Key
+	}
+	for i := range b.nodeSets {
+		nodeSet := &b.nodeSets[i]
+		if len(nodeSet.Nodes) > 0 && len(keys[nodeSet.Nodes[0]]) > 0 {
+			nodeSet.Key = nodeSet.Name + ":" + keys[nodeSet.Nodes[0]]
+		}
+		keys[nodeSet.ID] = nodeSet.Key
+	}
+}
 
-	cloudName := httprouter.ContextParams(ctx).ByName("cloud_name")
-	cloudInfo := cloudGetCloudInfo(cloudName)
+// linkKeys names each link after its end nodes and the interface it runs
+// through, numbering links that still share a key in the order they were
+// added.
+func (b *topologyBuilder) linkKeys() {
+	keys := make(map[int]string)
+	for _, node := range b.nodes {
+		keys[node.ID] = node.Key
+	}
+	seen := make(map[string]int)
+	for i := range b.links {
+		link := &b.links[i]
+		source, target := keys[link.Source], keys[link.Target]
+		if len(source) == 0 || len(target) == 0 {
+			continue
+		}
+		key := source + "|" + target
+		if iface, _ := link.Props["source_interface"].(string); len(iface) > 0 {
+			key += "|" + iface
+		} else if iface, _ := link.Props["target_interface"].(string); len(iface) > 0 {
+			key += "|" + iface
+		}
+		seen[key]++
+		if seen[key] > 1 {
+			key += "#" + strconv.Itoa(seen[key])
+		}
+		link.Key = key
+	}
+}
+
+func (b *topologyBuilder) data(title string, views map[string]string) TopologyData {
+	b.addWiringWarnings()
+	b.addProjects()
+	if b.redact {
+		b.redactInfrastructure()
+	}
+	b.nodeKeys()
+	b.nodeSetKeys()
+	b.linkKeys()
+	return TopologyData{
+		Title:    title,
+		Nodes:    b.nodes,
+		Links:    b.links,
+		NodeSets: b.nodeSets,
+		Groups:   make([]TopologyGroup, 0),
+		Views:    views,
+		Filtered: b.filtered,
+		layout:   b.layout,
+	}
+}
 
-	topologyTitle := cloudInfo.Name + " Topology"
+func (b *topologyBuilder) cloudViews(cloudName string, all bool) map[string]string {
+	views := make(map[string]string)
+	views["Cloud Topology"] = b.viewUrl("cloudTopology", cloudName)
+	views["Cloud Hypervisors"] = b.viewUrl("cloudHypervisorTopology", cloudName)
+	views["Cloud Networks"] = b.viewUrl("cloudLayer3NetworkTopology", cloudName)
+	views["Cloud Linux Bridges"] = b.viewUrl("cloudLayer2NetworkTopology", cloudName)
+	views["Cloud OVS Bridges"] = b.viewUrl("cloudOvsNetworkTopology", cloudName)
+	if all {
+		views["Cloud Hypervisors Collapsed Filtered OVS Topology"] = b.viewUrl("cloudHypervisorsCollapsedFilteredOvsNetworkTopology", cloudName)
+		views["Cloud Hypervisors Expanded Filtered OVS Topology"] = b.viewUrl("cloudHypervisorsExpandedFilteredOvsNetworkTopology", cloudName)
+		views["Cloud Hypervisors Collapsed Unfiltered OVS Topology"] = b.viewUrl("cloudHypervisorsCollapsedUnfilteredOvsNetworkTopology", cloudName)
+		views["Cloud Hypervisors Expanded Unfiltered OVS Topology"] = b.viewUrl("cloudHypervisorsExpandedUnfilteredOvsNetworkTopology", cloudName)
+		for _, testBed := range testBedGetList(cloudName) {
+			views["Test Bed "+testBed.Name] = b.viewUrl("testbedTopology", testBed.Name)
+		}
+	}
+	return views
+}
 
-	hypervisorList := cloudGetHypervisorList(cloudInfo)
-	networkList := cloudGetNetworkList(cloudInfo)
+func (b *topologyBuilder) hypervisorViews(hypervisorName string) map[string]string {
+	views := make(map[string]string)
+	views["Instance Topology"] = b.viewUrl("cloudHypervisorInstancesTopology", b.cloudName, hypervisorName)
+	views["Linux Bridges"] = b.viewUrl("cloudHypervisorLayer2NetworkTopology", b.cloudName, hypervisorName)
+	views["OVS Bridges"] = b.viewUrl("cloudHypervisorOvsNetworkTopology", b.cloudName, hypervisorName)
+	return views
+}
 
-	var nodeList []TopologyNode
-	var linkList []TopologyLink
-	var nodeSetList []TopologyNodeSet
+func (b *topologyBuilder) instanceViews(hypervisorName string, instanceName string) map[string]string {
+	views := make(map[string]string)
+	views["Networks"] = b.viewUrl("cloudInstanceLayer3NetworkTopology", b.cloudName, hypervisorName, instanceName)
+	views["Linux Bridges"] = b.viewUrl("cloudInstanceLayer2NetworkTopology", b.cloudName, hypervisorName, instanceName)
+	views["OVS Bridges"] = b.viewUrl("cloudInstanceOvsNetworkTopology", b.cloudName, hypervisorName, instanceName)
+	views["Neighborhood"] = b.viewUrl("cloudNeighborhoodTopology", b.cloudName) + "?" + url.Values{
+		"entity":     {instanceName},
+		"kind":       {graphEntityInstance},
+		"hypervisor": {hypervisorName},
+	}.Encode()
+	return views
+}
 
-	nodeId := 0
-	linkId := 0
+func (b *topologyBuilder) networkViews(networkName string) map[string]string {
+	views := make(map[string]string)
+	views["Network Topology"] = b.viewUrl("cloudNetworkLayer3NetworkTopology", b.cloudName, networkName)
+	return views
+}
 
-	cloudProps := make(map[string]interface{})
-	cloudProps["authUrl"] = cloudInfo.AuthUrl
-	cloudProps["provider"] = cloudInfo.Provider
-	cloudViews := make(map[string]string)
-	cloudNodeId := nodeId
-	cloudNode := TopologyNode{
-		ID:         cloudNodeId,
+func topologyCloudNode(cloudInfo CloudInfo, views map[string]string) TopologyNode {
+	props := make(map[string]interface{})
+	props["authUrl"] = cloudInfo.AuthUrl
+	props["provider"] = cloudInfo.Provider
+	return TopologyNode{
 		Name:       cloudInfo.Name,
 		DeviceType: "cloud",
 		Color:      "#00CCFF",
-		Props:      cloudProps,
-		Views:      cloudViews,
-	}
-	nodeList = append(nodeList, cloudNode)
-	nodeId++
-
-	for _, hypervisor := range hypervisorList {
-		hypervisorNodeProps := make(map[string]interface{})
-		hypervisorNodeProps["id"] = hypervisor.ID
-		hypervisorNodeProps["host_name"] = hypervisor.HostName
-		hypervisorNodeProps["ip_address"] = hypervisor.HostIP
-		hypervisorNodeProps["state"] = hypervisor.State
-		hypervisorNodeColor := "#9C27B0"
-		if hypervisor.State == "down" {
-			hypervisorNodeColor = "#FF0000"
-		}
-		hypervisorNodeViews := make(map[string]string)
-		hypervisorNodeViews["Instance Topology"] = "http://" + r.Host + "/topology/cloudHypervisorInstancesTopology/" + cloudInfo.Name + "/" + hypervisor.Name
-		hypervisorNodeViews["Linux Bridges"] = "http://" + r.Host + "/topology/cloudHypervisorLayer2NetworkTopology/" + cloudInfo.Name + "/" + hypervisor.Name
-		hypervisorNodeViews["OVS Bridges"] = "http://" + r.Host + "/topology/cloudHypervisorOvsNetworkTopology/" + cloudName + "/" + hypervisor.Name
-		hyperviosrNode := TopologyNode{
-			ID: nodeId, Name: hypervisor.Name,
-			DeviceType: "host",
-			//X:          200,
-			//Y:          (200 + (5 * i)),
-			Color: hypervisorNodeColor,
-			Props: hypervisorNodeProps,
-			Views: hypervisorNodeViews,
-		}
-		nodeList = append(nodeList, hyperviosrNode)
-
-		hypervisorLinkProps := make(map[string]interface{})
-		hypervisorLinkProps["source_name"] = cloudNode.Name
-		hypervisorLinkProps["target_name"] = hyperviosrNode.Name
-		hypervisorLink := TopologyLink{
-			Name:   "",
-			Source: cloudNodeId,
-			Target: nodeId,
-			Color:  "#0000FF",
-			Props:  hypervisorLinkProps,
-		}
-		linkList = append(linkList, hypervisorLink)
-		nodeId++
-		linkId++
-	}
-
-	for _, network := range networkList {
-		networkNodeProps := make(map[string]interface{})
-		networkNodeProps["id"] = network.ID
-		networkNodeViews := make(map[string]string)
-		networkNodeViews["Network Topology"] = "http://" + r.Host + "/topology/cloudNetworkLayer3NetworkTopology/" + cloudInfo.Name + "/" + network.Name
-
-		networkNode := TopologyNode{
-			ID:         nodeId,
-			Name:       network.Name,
-			DeviceType: "router",
-			//X:          400,
-			//Y:          (200 + (5 * i)),
-			Color: "#888888",
-			Props: networkNodeProps,
-			Views: networkNodeViews,
-		}
-		nodeList = append(nodeList, networkNode)
-
-		networkLinkProps := make(map[string]interface{})
-		networkLinkProps["source_name"] = cloudNode.Name
-		networkLinkProps["target_name"] = networkNode.Name
-		networkLink := TopologyLink{
-			Name:   "",
-			Source: cloudNodeId,
-			Target: nodeId,
-			Color:  "#0000FF",
-			Props:  networkLinkProps,
-		}
-		linkList = append(linkList, networkLink)
-		nodeId++
-		linkId++
+		Props:      props,
+		Views:      views,
 	}
+}
 
-	groupList := make([]TopologyGroup, 0)
+func topologyHypervisorNode(hypervisor CloudHypervisorInfo, views map[string]string) TopologyNode {
+	props := make(map[string]interface{})
+	props["id"] = hypervisor.ID
+	props["host_name"] = hypervisor.HostName
+	props["ip_address"] = hypervisor.HostIP
+	props["state"] = hypervisor.State
+	color := "#9C27B0"
+	if hypervisor.State == "down" {
+		color = "#FF0000"
+	}
+	return TopologyNode{
+		Name:       hypervisor.Name,
+		DeviceType: "host",
+		Color:      color,
+		Props:      props,
+		Views:      views,
+	}
+}
 
-	viewList := make(map[string]string, 2)
-	viewList["Cloud Topology"] = "http://" + r.Host + "/topology/cloudTopology/" + cloudInfo.Name
-	viewList["Cloud Hypervisors"] = "http://" + r.Host + "/topology/cloudHypervisorTopology/" + cloudInfo.Name
-	viewList["Cloud Networks"] = "http://" + r.Host + "/topology/cloudLayer3NetworkTopology/" + cloudInfo.Name
-	viewList["Cloud Linux Bridges"] = "http://" + r.Host + "/topology/cloudLayer2NetworkTopology/" + cloudInfo.Name
-	viewList["Cloud OVS Bridges"] = "http://" + r.Host + "/topology/cloudOvsNetworkTopology/" + cloudInfo.Name
-	viewList["Cloud Hypervisors Collapsed Filtered OVS Topology"] = "http://" + r.Host + "/topology/cloudHypervisorsCollapsedFilteredOvsNetworkTopology/" + cloudInfo.Name
-	viewList["Cloud Hypervisors Expanded Filtered OVS Topology"] = "http://" + r.Host + "/topology/cloudHypervisorsExpandedFilteredOvsNetworkTopology/" + cloudInfo.Name
-	viewList["Cloud Hypervisors Collapsed Unfiltered OVS Topology"] = "http://" + r.Host + "/topology/cloudHypervisorsCollapsedUnfilteredOvsNetworkTopology/" + cloudInfo.Name
-	viewList["Cloud Hypervisors Expanded Unfiltered OVS Topology"] = "http://" + r.Host + "/topology/cloudHypervisorsExpandedUnfilteredOvsNetworkTopology/" + cloudInfo.Name
+func topologyInstanceNode(instance LibvirtDomainInstance, views map[string]string) TopologyNode {
+	props := make(map[string]interface{})
+	props["uuid"] = instance.UUID
+	props["name"] = instance.Name
+	props["hypervisor name"] = instance.HypervisorName
+	return TopologyNode{
+		Name:       instance.InstanceName,
+		DeviceType: "server",
+		Color:      "#0000FF",
+		Props:      props,
+		Views:      views,
+	}
+}
 
-	cloudTopologyData := TopologyData{
-		Title:    topologyTitle,
-		Nodes:    nodeList,
-		Links:    linkList,
-		NodeSets: nodeSetList,
-		Groups:   groupList,
-		Views:    viewList,
+func topologyVnicNode(iface LibvirtDomainInterface) TopologyNode {
+	props := make(map[string]interface{})
+	props["tap"] = iface.DevName
+	props["mac_address"] = iface.MacAddress
+	props["network_name"] = iface.NetworkName
+	return TopologyNode{
+		Name:       iface.BridgeName,
+		DeviceType: "switch",
+		Color:      "#FF00FF",
+		Props:      props,
 	}
+}
 
-	luddite.WriteResponse(rw, http.StatusOK, cloudTopologyData)
+// topologyBridgeNode tags the bridge with its hypervisor in cloud wide views
+// where bridge names repeat across hosts.
+func topologyBridgeNode(bridge OvsBridge, hostIP string) TopologyNode {
+	props := make(map[string]interface{})
+	props["uuid"] = bridge.UUID
+	props["name"] = bridge.Name
+	if len(bridge.DatapathType) > 0 {
+		props["datapath_type"] = bridge.DatapathType
+	}
+	if len(hostIP) > 0 {
+		props["hypervisor_ip"] = hostIP
+	}
+	return TopologyNode{
+		Name:       bridge.Name,
+		DeviceType: "switch",
+		Color:      "#00FF00",
+		Props:      props,
+	}
 }
 
-func CloudHypervisorTopology(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+func topologyNetworkNode(network CloudNetworkInfo, views map[string]string) TopologyNode {
+	props := make(map[string]interface{})
+	props["id"] = network.ID
+	return TopologyNode{
+		Name:       network.Name,
+		DeviceType: "router",
+		Color:      "#888888",
+		Props:      props,
+		Views:      views,
+	}
+}
 
-	cloudName := httprouter.ContextParams(ctx).ByName("cloud_name")
-	cloudInfo := cloudGetCloudInfo(cloudName)
+func topologyPortNode(iface LibvirtPhysicalInterface) TopologyNode {
+	props := make(map[string]interface{})
+	props["mac_address"] = iface.MacAddress
+	return TopologyNode{
+		Name:       iface.Name,
+		DeviceType: "port",
+		Color:      "#000000",
+		Props:      props,
+	}
+}
 
-	topologyTitle := cloudInfo.Name + " VNF Hypervisor Topology"
-
-	hypervisorList := cloudGetHypervisorList(cloudInfo)
-
-	var nodeList []TopologyNode
-	var linkList []TopologyLink
-	var nodeSetList []TopologyNodeSet
-	nodeId := 0
-	linkId := 0
-
-	for _, hypervisor := range hypervisorList {
-		hypervisorNodeProps := make(map[string]interface{})
-		hypervisorNodeProps["id"] = hypervisor.ID
-		hypervisorNodeProps["host_name"] = hypervisor.HostName
-		hypervisorNodeProps["ip_address"] = hypervisor.HostIP
-		hypervisorNodeProps["state"] = hypervisor.State
-		hypervisorNodeColor := "#9C27B0"
-		if hypervisor.State == "down" {
-			hypervisorNodeColor = "#FF0000"
-		}
-		hypervisorNodeViews := make(map[string]string)
-		hypervisorNodeViews["Instance Topology"] = "http://" + r.Host + "/topology/cloudHypervisorInstancesTopology/" + cloudInfo.Name + "/" + hypervisor.Name
-		hypervisorNodeViews["Linux Bridges"] = "http://" + r.Host + "/topology/cloudHypervisorLayer2NetworkTopology/" + cloudInfo.Name + "/" + hypervisor.Name
-		hypervisorNodeViews["OVS Bridges"] = "http://" + r.Host + "/topology/cloudHypervisorOvsNetworkTopology/" + cloudName + "/" + hypervisor.Name
-		hypervisorNodeId := nodeId
-		hypervisorNode := TopologyNode{
-			ID:         hypervisorNodeId,
-			Name:       hypervisor.Name,
-			DeviceType: "host",
-			//X:          200,
-			//Y:          (200 + (5 * i)),
-			Color: hypervisorNodeColor,
-			Props: hypervisorNodeProps,
-			Views: hypervisorNodeViews,
-		}
-		nodeList = append(nodeList, hypervisorNode)
-		nodeId++
-
-		instanceList := libvirtGetDomainInstances(hypervisor.HostIP)
-		var instanceNodeSetIdList []int
-		for _, instance := range instanceList {
-			instanceNodeProps := make(map[string]interface{})
-			instanceNodeProps["uuid"] = instance.UUID
-			instanceNodeProps["name"] = instance.Name
-			instanceNodeProps["hypervisor name"] = instance.HypervisorName
-			instanceNodeViews := make(map[string]string)
-			instanceNodeViews["Networks"] = "http://" + r.Host + "/topology/cloudInstanceLayer3NetworkTopology/" + cloudName + "/" + hypervisor.Name + "/" + instance.InstanceName
-			instanceNodeViews["Linux Bridges"] = "http://" + r.Host + "/topology/cloudInstanceLayer2NetworkTopology/" + cloudName + "/" + hypervisor.Name + "/" + instance.InstanceName
-			instanceNodeViews["OVS Bridges"] = "http://" + r.Host + "/topology/cloudInstanceOvsNetworkTopology/" + cloudName + "/" + hypervisor.Name + "/" + instance.InstanceName
-
-			instanceNode := TopologyNode{
-				ID:         nodeId,
-				Name:       instance.InstanceName,
-				DeviceType: "server",
-				//X:          300,
-				//Y:          (200 + (5 * j)),
-				Color: "#0000FF",
-				Props: instanceNodeProps,
-				Views: instanceNodeViews,
-			}
-			nodeList = append(nodeList, instanceNode)
-
-			instanceLinkProps := make(map[string]interface{})
-			instanceLinkProps["source_name"] = hypervisorNode.Name
-			instanceLinkProps["target_name"] = instanceNode.Name
-			instanceLink := TopologyLink{
-				Name:   "",
-				Source: hypervisorNodeId,
-				Target: nodeId,
-				Color:  "#0000FF",
-				Props:  instanceLinkProps,
-			}
-			linkList = append(linkList, instanceLink)
-			nodeId++
-			linkId++
-		}
+func topologyOvsPortNode(port OvsPort) TopologyNode {
+	props := make(map[string]interface{})
+	props["uuid"] = port.UUID
+	return TopologyNode{
+		Name:       port.Name,
+		DeviceType: "port",
+		Color:      "#00AA00",
+		Props:      props,
+	}
+}
 
-		nodeSetProps := make(map[string]interface{})
-		if len(instanceNodeSetIdList) > 1 {
-			nodeSet := TopologyNodeSet{
-				ID:         nodeId,
-				Nodes:      instanceNodeSetIdList,
-				Name:       "instance-group",
-				Root:       hypervisorNodeId,
-				DeviceType: "groups",
-				//X:          500,
-				//Y:          100,
-				Color: "#0000FF",
-				Props: nodeSetProps,
-			}
-			nodeSetList = append(nodeSetList, nodeSet)
-			nodeId++
+func topologyOvsInterfaceNode(iface OvsInterface) TopologyNode {
+	props := make(map[string]interface{})
+	props["uuid"] = iface.UUID
+	props["type"] = iface.Type
+	props["mac_address"] = iface.MacAddressInUse
+	if iface.OfPort != 0 {
+		props["ofport"] = iface.OfPort
+	}
+	if len(iface.Error) > 0 {
+		props["error"] = iface.Error
+	}
+	for k, v := range iface.Options {
+		props["options:"+k] = v
+	}
+	for k, v := range iface.ExternalIDs {
+		props["external_ids:"+k] = v
+	}
+	return TopologyNode{
+		Name:       iface.Name,
+		DeviceType: "port",
+		Color:      "#006600",
+		Props:      props,
+	}
+}
+
+func topologyLink(sourceId int, sourceName string, targetId int, targetName string, color string) TopologyLink {
+	props := make(map[string]interface{})
+	props["source_name"] = sourceName
+	props["target_name"] = targetName
+	return TopologyLink{
+		Name:   "",
+		Source: sourceId,
+		Target: targetId,
+		Color:  color,
+		Props:  props,
+	}
+}
+
+func topologyNodeLink(source TopologyNode, target TopologyNode, color string) TopologyLink {
+	return topologyLink(source.ID, source.Name, target.ID, target.Name, color)
+}
+
+func topologyVnicLink(instanceNode TopologyNode, vnicNode TopologyNode, vnic *GraphEntity, color string, statistics bool) TopologyLink {
+	link := topologyNodeLink(instanceNode, vnicNode, color)
+	link.Props["interface_type"] = vnic.Vnic.Type
+	if statistics {
+		for k, v := range vnic.Vnic.Statistics {
+			link.Props[k] = v
 		}
 	}
+	statsSetLinkUtilization(&link, statsSourceLibvirt, vnic.HostIP, vnic.Vnic.DevName)
+	return link
+}
 
-	groupList := make([]TopologyGroup, 0)
+func topologyPatchLink(bc *OvsBridgeConnection, sourceId int, sourceName string, targetId int, targetName string, statistics bool) TopologyLink {
+	link := topologyLink(sourceId, sourceName, targetId, targetName, "#00FF00")
+	if statistics {
+		for k, v := range bc.SourceInterface.Statistics {
+			link.Props[k] = v
+		}
+		link.Props["source_name"] = sourceName
+		link.Props["target_name"] = targetName
+	}
+	link.Props["source_interface"] = bc.SourceInterface.Name
+	link.Props["target_interface"] = bc.TargetInterface.Name
+	link.Props["source_interface_type"] = bc.SourceInterface.Type
+	link.Props["target_interface_type"] = bc.TargetInterface.Type
+	link.Props["source_port"] = bc.SourcePort.Name
+	link.Props["target_port"] = bc.TargetPort.Name
+	statsSetLinkUtilization(&link, statsSourceOvs, bc.HostIP, bc.SourceInterface.Name)
+	return link
+}
 
-	viewList := make(map[string]string, 2)
-	viewList["Cloud Topology"] = "http://" + r.Host + "/topology/cloudTopology/" + cloudInfo.Name
-	viewList["Cloud Hypervisors"] = "http://" + r.Host + "/topology/cloudHypervisorTopology/" + cloudInfo.Name
-	viewList["Cloud Networks"] = "http://" + r.Host + "/topology/cloudLayer3NetworkTopology/" + cloudInfo.Name
-	viewList["Cloud Linux Bridges"] = "http://" + r.Host + "/topology/cloudLayer2NetworkTopology/" + cloudInfo.Name
-	viewList["Cloud OVS Bridges"] = "http://" + r.Host + "/topology/cloudOvsNetworkTopology/" + cloudInfo.Name
+func topologyAttachmentLink(bc *OvsBridgeConnection, vnicNode TopologyNode, targetId int, targetName string, statistics bool) TopologyLink {
+	link := topologyLink(vnicNode.ID, vnicNode.Name, targetId, targetName, "#FF00FF")
+	link.Props["target_interface"] = bc.TargetInterface.Name
+	link.Props["target_interface_type"] = bc.TargetInterface.Type
+	link.Props["target_port"] = bc.TargetPort.Name
+	if statistics {
+		for k, v := range bc.TargetInterface.Statistics {
+			link.Props[k] = v
+		}
+		link.Props["source_name"] = vnicNode.Name
+		link.Props["target_name"] = targetName
+	}
+	statsSetLinkUtilization(&link, statsSourceOvs, bc.HostIP, bc.TargetInterface.Name)
+	return link
+}
 
-	cloudTopologyData := TopologyData{
-		Title:    topologyTitle,
-		Nodes:    nodeList,
-		Links:    linkList,
-		NodeSets: nodeSetList,
-		Groups:   groupList,
-		Views:    viewList,
+func topologyUplinkLink(bc *OvsBridgeConnection, sourceId int, sourceName string, portNode TopologyNode, statistics bool) TopologyLink {
+	link := topologyLink(sourceId, sourceName, portNode.ID, portNode.Name, "#000000")
+	link.Props["source_interface"] = bc.SourceInterface.Name
+	link.Props["source_interface_type"] = bc.SourceInterface.Type
+	link.Props["source_port"] = bc.SourcePort.Name
+	if statistics {
+		for k, v := range bc.SourceInterface.Statistics {
+			link.Props[k] = v
+		}
+		link.Props["source_name"] = sourceName
+		link.Props["target_name"] = portNode.Name
 	}
+	statsSetLinkUtilization(&link, statsSourceOvs, bc.HostIP, bc.SourceInterface.Name)
+	return link
+}
 
-	luddite.WriteResponse(rw, http.StatusOK, cloudTopologyData)
+// topologyGetGraph returns the graph of a cloud, limited to the test bed
+// named by the testbed parameter and the project named by the project
+// parameter when there are.
+func topologyGetGraph(rw http.ResponseWriter, r *http.Request, cloudName string) *TopologyGraph {
+	return topologyGetProjectGraph(rw, r, cloudName, r.URL.Query().Get("project"))
 }
 
-func CloudLayer3NetworkTopology(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+// topologyGetProjectGraph returns the graph of a cloud limited to a project,
+// if one is given, and to the projects the requester is a member of when it
+// may not see the whole cloud.
+func topologyGetProjectGraph(rw http.ResponseWriter, r *http.Request, cloudName string, project string) *TopologyGraph {
+	g := topologyGetTestBedGraph(rw, r, cloudName)
+	if g == nil {
+		return nil
+	}
+	projects := authProjects(r, &g.Cloud)
+	if len(project) > 0 {
+		projectInfo := cloudGetProjectInfo(cloudName, project)
+		if projectInfo == nil || (projects != nil && !graphProjectSelected(*projectInfo, projects)) {
+			apiError := APIError{http.StatusNotFound, "Project " + project + " for cloud " + cloudName + " Not discovered"}
+			luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+			return nil
+		}
+		projects = []string{projectInfo.ID}
+	}
+	if projects == nil {
+		return g
+	}
+	return g.SelectProjects(projects)
+}
 
-	cloudName := httprouter.ContextParams(ctx).ByName("cloud_name")
+func topologyGetTestBedGraph(rw http.ResponseWriter, r *http.Request, cloudName string) *TopologyGraph {
 	cloudInfo := cloudGetCloudInfo(cloudName)
+	if cloudInfo == nil || !authCloudVisible(r, cloudInfo) {
+		apiError := APIError{http.StatusNotFound, "Cloud " + cloudName + " Not discovered"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return nil
+	}
+	testBedName := r.URL.Query().Get("testbed")
+	if len(testBedName) == 0 {
+		return graphGet(cloudInfo)
+	}
 
-	topologyTitle := cloudInfo.Name + " VNF Layer-3 Network Topology"
-
-	hypervisorList := cloudGetHypervisorList(cloudInfo)
-	networkList := cloudGetNetworkList(cloudInfo)
-
-	var nodeList []TopologyNode
-	var linkList []TopologyLink
-	var nodeSetList []TopologyNodeSet
-	nodeId := 0
-	linkId := 0
-
-	for _, network := range networkList {
-		networkNodeProps := make(map[string]interface{})
-		networkNodeProps["id"] = network.ID
-		networkNodeViews := make(map[string]string)
-		networkNodeViews["Network Topology"] = "http://" + r.Host + "/topology/cloudNetworkLayer3NetworkTopology/" + cloudInfo.Name + "/" + network.Name
-
-		networkNode := TopologyNode{
-			ID:         nodeId,
-			Name:       network.Name,
-			DeviceType: "router",
-			//X:          400,
-			//Y:          (200 + (5 * i)),
-			Color: "#888888",
-			Props: networkNodeProps,
-			Views: networkNodeViews,
-		}
-		nodeList = append(nodeList, networkNode)
-		nodeId++
-	}
-
-	for _, hypervisor := range hypervisorList {
-		instanceList := libvirtGetDomainInstances(hypervisor.HostIP)
-		for _, instance := range instanceList {
-			instanceNodeProps := make(map[string]interface{})
-			instanceNodeProps["uuid"] = instance.UUID
-			instanceNodeProps["name"] = instance.Name
-			instanceNodeProps["hypervisor name"] = instance.HypervisorName
-			instanceNodeViews := make(map[string]string)
-			instanceNodeViews["Networks"] = "http://" + r.Host + "/topology/cloudInstanceLayer3NetworkTopology/" + cloudName + "/" + hypervisor.Name + "/" + instance.InstanceName
-			instanceNodeViews["Linux Bridges"] = "http://" + r.Host + "/topology/cloudInstanceLayer2NetworkTopology/" + cloudName + "/" + hypervisor.Name + "/" + instance.InstanceName
-			instanceNodeViews["OVS Bridges"] = "http://" + r.Host + "/topology/cloudInstanceOvsNetworkTopology/" + cloudName + "/" + hypervisor.Name + "/" + instance.InstanceName
-			instanceNodeId := nodeId
-			instanceNode := TopologyNode{
-				ID:         nodeId,
-				Name:       instance.InstanceName,
-				DeviceType: "server",
-				//X:          300,
-				//Y:          (200 + (5 * j)),
-				Color: "#0000FF",
-				Props: instanceNodeProps,
-				Views: instanceNodeViews,
-			}
-			nodeList = append(nodeList, instanceNode)
-			nodeId++
-			for _, iface := range instance.Interfaces {
-				for _, node := range nodeList {
-					if node.Name == iface.NetworkName {
-						networkLinkProps := make(map[string]interface{})
-						networkLinkProps["source_name"] = node.Name
-						networkLinkProps["target_name"] = instanceNode.Name
-						networkLink := TopologyLink{
-							Name:   "",
-							Source: node.ID,
-							Target: instanceNodeId,
-							Color:  "#0000FF",
-							Props:  networkLinkProps,
-						}
-						linkList = append(linkList, networkLink)
-						linkId++
-						break
-					}
-				}
-			}
-		}
+	testBed := testBedGet(testBedName)
+	if testBed == nil {
+		apiError := APIError{http.StatusNotFound, "Test bed " + testBedName + " Not found"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return nil
+	}
+	if testBed.Cloud != cloudName {
+		apiError := APIError{http.StatusBadRequest, "Test bed " + testBedName + " is not part of cloud " + cloudName}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return nil
+	}
+	if itemErrors := hypervisorInstancesValidate(cloudName, testBed.HypervisorInstances); len(itemErrors) > 0 {
+		writeHypervisorInstancesErrors(rw, itemErrors)
+		return nil
 	}
+	return graphGet(cloudInfo).Select(testBed.HypervisorInstances)
+}
 
-	groupList := make([]TopologyGroup, 0)
+func topologyGetHypervisor(rw http.ResponseWriter, g *TopologyGraph, hypervisorName string) *GraphEntity {
+	hypervisor := g.FindHypervisor(hypervisorName)
+	if hypervisor == nil {
+		apiError := APIError{http.StatusNotFound, "Hypervisor " + hypervisorName + " for cloud " + g.Cloud.Name + " Not discovered"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+	}
+	return hypervisor
+}
 
-	viewList := make(map[string]string, 2)
-	viewList["Cloud Topology"] = "http://" + r.Host + "/topology/cloudTopology/" + cloudInfo.Name
-	viewList["Cloud Hypervisors"] = "http://" + r.Host + "/topology/cloudHypervisorTopology/" + cloudInfo.Name
-	viewList["Cloud Networks"] = "http://" + r.Host + "/topology/cloudLayer3NetworkTopology/" + cloudInfo.Name
-	viewList["Cloud Linux Bridges"] = "http://" + r.Host + "/topology/cloudLayer2NetworkTopology/" + cloudInfo.Name
-	viewList["Cloud OVS Bridges"] = "http://" + r.Host + "/topology/cloudOvsNetworkTopology/" + cloudInfo.Name
+func topologyGetInstance(rw http.ResponseWriter, g *TopologyGraph, hypervisor *GraphEntity, instanceName string) *GraphEntity {
+	instance := g.FindInstance(hypervisor, instanceName)
+	if instance == nil {
+		apiError := APIError{http.StatusNotFound, "Instance " + instanceName + " for hypervisor " + hypervisor.Name + " and cloud " + g.Cloud.Name + " Not discovered"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+	}
+	return instance
+}
 
-	cloudTopologyData := TopologyData{
-		Title:    topologyTitle,
-		Nodes:    nodeList,
-		Links:    linkList,
-		NodeSets: nodeSetList,
-		Groups:   groupList,
-		Views:    viewList,
+func CloudsTopology(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	b := newTopologyBuilder(r, "")
+	b.layout = layoutGrid
+	for _, cloudInfo := range authCloudList(r) {
+		b.addNode(graphCloudKey(cloudInfo.Name), topologyCloudNode(cloudInfo, b.cloudViews(cloudInfo.Name, true)))
 	}
 
-	luddite.WriteResponse(rw, http.StatusOK, cloudTopologyData)
+	cloudTopologyData := b.data("Cloud Topology", make(map[string]string))
+	cloudTopologyData.Links = make([]TopologyLink, 0)
+	cloudTopologyData.NodeSets = make([]TopologyNodeSet, 0)
+	topologyWrite(rw, r, cloudTopologyData)
 }
 
-func CloudLayer2NetworkTopology(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+func CloudTopology(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	cloudName := httprouter.ContextParams(ctx).ByName("cloud_name")
+	g := topologyGetGraph(rw, r, cloudName)
+	if g == nil {
+		return
+	}
+
+	b := newGraphTopologyBuilder(r, g)
+	cloudNode := b.addNode(g.Root, topologyCloudNode(g.Cloud, make(map[string]string)))
+	for _, hypervisor := range g.Hypervisors() {
+		hypervisorNode := b.addNode(hypervisor.Key, topologyHypervisorNode(hypervisor.Hypervisor, b.hypervisorViews(hypervisor.Name)))
+		b.addLink(topologyNodeLink(cloudNode, hypervisorNode, "#0000FF"))
+	}
+	for _, network := range g.Networks() {
+		networkNode := b.addNode(network.Key, topologyNetworkNode(network.Network, b.networkViews(network.Name)))
+		b.addLink(topologyNodeLink(cloudNode, networkNode, "#0000FF"))
+	}
 
+	cloudTopologyData := b.data(g.Cloud.Name+" Topology", b.cloudViews(g.Cloud.Name, true))
+	topologyWrite(rw, r, cloudTopologyData)
+}
+
+func CloudHypervisorTopology(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
 	cloudName := httprouter.ContextParams(ctx).ByName("cloud_name")
-	cloudInfo := cloudGetCloudInfo(cloudName)
+	g := topologyGetGraph(rw, r, cloudName)
+	if g == nil {
+		return
+	}
 
-	topologyTitle := cloudInfo.Name + " VNF Layer-2 Network Topology"
-
-	hypervisorList := cloudGetHypervisorList(cloudInfo)
-
-	var nodeList []TopologyNode
-	var linkList []TopologyLink
-	var nodeSetList []TopologyNodeSet
-	nodeId := 0
-	linkId := 0
-
-	var hypervisorNodeSetIdList []int
-	for _, hypervisor := range hypervisorList {
-		hypervisorNodeProps := make(map[string]interface{})
-		hypervisorNodeProps["id"] = hypervisor.ID
-		hypervisorNodeProps["host_name"] = hypervisor.HostName
-		hypervisorNodeProps["ip_address"] = hypervisor.HostIP
-		hypervisorNodeProps["state"] = hypervisor.State
-		hypervisorNodeColor := "#9C27B0"
-		if hypervisor.State == "down" {
-			hypervisorNodeColor = "#FF0000"
-		}
-		hypervisorNodeViews := make(map[string]string)
-		hypervisorNodeViews["Instance Topology"] = "http://" + r.Host + "/topology/cloudHypervisorInstancesTopology/" + cloudInfo.Name + "/" + hypervisor.Name
-		hypervisorNodeViews["Linux Bridges"] = "http://" + r.Host + "/topology/cloudHypervisorLayer2NetworkTopology/" + cloudInfo.Name + "/" + hypervisor.Name
-		hypervisorNodeViews["OVS Bridges"] = "http://" + r.Host + "/topology/cloudHypervisorOvsNetworkTopology/" + cloudName + "/" + hypervisor.Name
-		hypervisorNodeId := nodeId
-		hypervisorNode := TopologyNode{
-			ID:         hypervisorNodeId,
-			Name:       hypervisor.Name,
-			DeviceType: "host",
-			//X:          200,
-			//Y:          (200 + (5 * i)),
-			Color: hypervisorNodeColor,
-			Props: hypervisorNodeProps,
-			Views: hypervisorNodeViews,
-		}
-		nodeList = append(nodeList, hypervisorNode)
-		nodeId++
-		instanceList := libvirtGetDomainInstances(hypervisor.HostIP)
-		for _, instance := range instanceList {
-			instanceNodeProps := make(map[string]interface{})
-			instanceNodeProps["uuid"] = instance.UUID
-			instanceNodeProps["name"] = instance.Name
-			instanceNodeProps["hypervisor name"] = instance.HypervisorName
-			instanceNodeViews := make(map[string]string)
-			instanceNodeViews["Networks"] = "http://" + r.Host + "/topology/cloudInstanceLayer3NetworkTopology/" + cloudName + "/" + hypervisor.Name + "/" + instance.InstanceName
-			instanceNodeViews["Linux Bridges"] = "http://" + r.Host + "/topology/cloudInstanceLayer2NetworkTopology/" + cloudName + "/" + hypervisor.Name + "/" + instance.InstanceName
-			instanceNodeViews["OVS Bridges"] = "http://" + r.Host + "/topology/cloudInstanceOvsNetworkTopology/" + cloudName + "/" + hypervisor.Name + "/" + instance.InstanceName
-			instanceNodeId := nodeId
-			instanceNode := TopologyNode{
-				ID:         instanceNodeId,
-				Name:       instance.InstanceName,
-				DeviceType: "server",
-				//X:          300,
-				//Y:          (200 + (5 * j)),
-				Color: "#0000FF",
-				Props: instanceNodeProps,
-				Views: instanceNodeViews,
-			}
-			nodeList = append(nodeList, instanceNode)
-			//instanceNodeSetIdList = append(instanceNodeSetIdList, instanceNodeId)
-			instanceLinkProps := make(map[string]interface{})
-			instanceLinkProps["source_name"] = hypervisorNode.Name
-			instanceLinkProps["target_name"] = instanceNode.Name
-			hypervisorLink := TopologyLink{
-				Name:   "",
-				Source: hypervisorNodeId,
-				Target: instanceNodeId,
-				Color:  "#0000FF",
-				Props:  instanceLinkProps,
-			}
-			linkList = append(linkList, hypervisorLink)
-			nodeId++
-			linkId++
-			var bridgeNodeSetIdList []int
-			for _, iface := range instance.Interfaces {
-				bridgeNodeProps := make(map[string]interface{})
-				bridgeNodeProps["tap"] = iface.DevName
-				bridgeNodeProps["mac_address"] = iface.MacAddress
-				bridgeNodeProps["network_name"] = iface.NetworkName
-				bridgeNodeId := nodeId
-				bridgeNode := TopologyNode{
-					ID:         bridgeNodeId,
-					Name:       iface.BridgeName,
-					DeviceType: "switch",
-					//X:          200,
-					//Y:          (200 + (5 * k)),
-					Color: "#FF00FF",
-					Props: bridgeNodeProps,
-				}
-				nodeList = append(nodeList, bridgeNode)
-				//bridgeNodeSetIdList = append(bridgeNodeSetIdList, bridgeNodeId)
-				bridgeLinkProps := make(map[string]interface{})
-				bridgeLinkProps["source_name"] = instanceNode.Name
-				bridgeLinkProps["target_name"] = bridgeNode.Name
-				bridgeLinkProps["interface_type"] = iface.Type
-				for k, v := range iface.Statistics {
-					bridgeLinkProps[k] = v
-				}
-				bridgeLink := TopologyLink{
-					Name:   "",
-					Source: instanceNodeId,
-					Target: bridgeNodeId,
-					Color:  "#FF00FF",
-					Props:  bridgeLinkProps,
-				}
-				linkList = append(linkList, bridgeLink)
-				nodeId++
-				linkId++
-
-				network := cloudGetNetworkInfo(cloudName, iface.NetworkName)
-				if network != nil {
-					networkNodeId := -1
-					for _, node := range nodeList {
-						if node.Name == network.Name {
-							networkNodeId = node.ID
-							break
-						}
-					}
-
-					if networkNodeId == -1 {
-						networkNodeProps := make(map[string]interface{})
-						networkNodeProps["id"] = network.ID
-						networkNodeViews := make(map[string]string)
-						networkNodeId = nodeId
-						networkNode := TopologyNode{
-							ID:         networkNodeId,
-							Name:       network.Name,
-							DeviceType: "router",
-							//X:          400,
-							//Y:          (200 + (5 * i)),
-							Color: "#888888",
-							Props: networkNodeProps,
-							Views: networkNodeViews,
-						}
-						nodeList = append(nodeList, networkNode)
-						nodeId++
-					}
-					networkLinkProps := make(map[string]interface{})
-					networkLinkProps["source_name"] = bridgeNode.Name
-					networkLinkProps["target_name"] = network.Name
-					networkLink := TopologyLink{
-						Name:   "",
-						Source: bridgeNodeId,
-						Target: networkNodeId,
-						Color:  "#888888",
-						Props:  networkLinkProps,
-					}
-					linkList = append(linkList, networkLink)
-					linkId++
-				}
+	b := newGraphTopologyBuilder(r, g)
+	hypervisorNodes := make(map[string]TopologyNode)
+	var movedInstanceNodes []TopologyNode
+	var movedInstances []*InstanceMigration
+	for _, hypervisor := range g.Hypervisors() {
+		hypervisorNode := b.addNode(hypervisor.Key, topologyHypervisorNode(hypervisor.Hypervisor, b.hypervisorViews(hypervisor.Name)))
+		hypervisorNodes[hypervisor.Name] = hypervisorNode
+
+		for _, instance := range g.Children(hypervisor.Key, graphEntityInstance) {
+			node := topologyInstanceNode(instance.Instance, b.instanceViews(hypervisor.Name, instance.Name))
+			move := placementGetRecentMove(cloudName, instance.Instance.UUID)
+			if move != nil {
+				placementSetMovedFromProps(node.Props, move)
 			}
-			if len(bridgeNodeSetIdList) > 0 {
-				nodeSetProps := make(map[string]interface{})
-				nodeSet := TopologyNodeSet{
-					ID:         nodeId,
-					Nodes:      bridgeNodeSetIdList,
-					Name:       "bridge-group",
-					Root:       instanceNodeId,
-					DeviceType: "groups",
-					//X:          (200 + (100 * j)),
-					//Y:          400,
-					Color: "#0000FF",
-					Props: nodeSetProps,
-				}
-				nodeSetList = append(nodeSetList, nodeSet)
-				nodeId++
+			instanceNode := b.addNode(instance.Key, node)
+			if move != nil {
+				movedInstanceNodes = append(movedInstanceNodes, instanceNode)
+				movedInstances = append(movedInstances, move)
 			}
+			b.addLink(topologyNodeLink(hypervisorNode, instanceNode, "#0000FF"))
 		}
 	}
-	if len(hypervisorNodeSetIdList) > 1 {
-		nodeSetProps := make(map[string]interface{})
-		nodeSet := TopologyNodeSet{
-			ID:         nodeId,
-			Nodes:      hypervisorNodeSetIdList,
-			Name:       "hypervisor-group",
-			DeviceType: "groups",
-			//X:          200,
-			//Y:          200,
-			Color: "#0000FF",
-			Props: nodeSetProps,
+
+	for i, move := range movedInstances {
+		if fromNode, ok := hypervisorNodes[move.FromHypervisor]; ok {
+			b.addLink(placementMovedFromLink(move, fromNode, movedInstanceNodes[i]))
 		}
-		nodeSetList = append(nodeSetList, nodeSet)
-		nodeId++
 	}
 
-	groupList := make([]TopologyGroup, 0)
+	cloudTopologyData := b.data(g.Cloud.Name+" VNF Hypervisor Topology", b.cloudViews(g.Cloud.Name, false))
+	topologyWrite(rw, r, cloudTopologyData)
+}
 
-	viewList := make(map[string]string, 2)
-	viewList["Cloud Topology"] = "http://" + r.Host + "/topology/cloudTopology/" + cloudInfo.Name
-	viewList["Cloud Hypervisors"] = "http://" + r.Host + "/topology/cloudHypervisorTopology/" + cloudInfo.Name
-	viewList["Cloud Networks"] = "http://" + r.Host + "/topology/cloudLayer3NetworkTopology/" + cloudInfo.Name
-	viewList["Cloud Linux Bridges"] = "http://" + r.Host + "/topology/cloudLayer2NetworkTopology/" + cloudInfo.Name
-	viewList["Cloud OVS Bridges"] = "http://" + r.Host + "/topology/cloudOvsNetworkTopology/" + cloudInfo.Name
+func CloudLayer3NetworkTopology(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	cloudName := httprouter.ContextParams(ctx).ByName("cloud_name")
+	g := topologyGetGraph(rw, r, cloudName)
+	if g == nil {
+		return
+	}
 
-	cloudTopologyData := TopologyData{
-		Title:    topologyTitle,
-		Nodes:    nodeList,
-		Links:    linkList,
-		NodeSets: nodeSetList,
-		Groups:   groupList,
-		Views:    viewList,
+	b := newGraphTopologyBuilder(r, g)
+	for _, network := range g.Networks() {
+		b.addNode(network.Key, topologyNetworkNode(network.Network, b.networkViews(network.Name)))
+	}
+	for _, hypervisor := range g.Hypervisors() {
+		for _, instance := range g.Children(hypervisor.Key, graphEntityInstance) {
+			instanceNode := b.addNode(instance.Key, topologyInstanceNode(instance.Instance, b.instanceViews(hypervisor.Name, instance.Name)))
+			for _, vnic := range g.Children(instance.Key, graphEntityVnic) {
+				if networkId, networkName, ok := b.findByName(vnic.Vnic.NetworkName); ok {
+					b.addLink(topologyLink(networkId, networkName, instanceNode.ID, instanceNode.Name, "#0000FF"))
+				}
+			}
+		}
 	}
 
-	luddite.WriteResponse(rw, http.StatusOK, cloudTopologyData)
+	cloudTopologyData := b.data(g.Cloud.Name+" VNF Layer-3 Network Topology", b.cloudViews(g.Cloud.Name, false))
+	topologyWrite(rw, r, cloudTopologyData)
 }
 
-func CloudOvsNetworkTopology(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+func CloudLayer2NetworkTopology(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	cloudName := httprouter.ContextParams(ctx).ByName("cloud_name")
+	q := TopologyQuery{
+		Cloud:        cloudName,
+		Layers:       []string{queryLayerLinuxBridge, queryLayerL3},
+		Title:        cloudName + " VNF Layer-2 Network Topology",
+		vnicColor:    "#FF00FF",
+		networkViews: queryViewEmpty,
+	}
+	queryWrite(rw, r, q, nil)
+}
 
+func CloudOvsNetworkTopology(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
 	cloudName := httprouter.ContextParams(ctx).ByName("cloud_name")
-	cloudInfo := cloudGetCloudInfo(cloudName)
+	q := TopologyQuery{
+		Cloud:             cloudName,
+		Layers:            []string{queryLayerOvs, queryLayerLinuxBridge, queryLayerPhysical},
+		Title:             cloudName + " VNF OVS Network Topology",
+		hiddenBridgeLinks: true,
+	}
+	queryWrite(rw, r, q, nil)
+}
 
-	topologyTitle := cloudInfo.Name + " VNF OVS Network Topology"
-
-	hypervisorList := cloudGetHypervisorList(cloudInfo)
-
-	var nodeList []TopologyNode
-	var linkList []TopologyLink
-	var nodeSetList []TopologyNodeSet
-	nodeId := 0
-	linkId := 0
-
-	for _, hypervisor := range hypervisorList {
-		hypervisorNodeProps := make(map[string]interface{})
-		hypervisorNodeProps["id"] = hypervisor.ID
-		hypervisorNodeProps["host_name"] = hypervisor.HostName
-		hypervisorNodeProps["ip_address"] = hypervisor.HostIP
-		hypervisorNodeProps["state"] = hypervisor.State
-		hypervisorNodeColor := "#9C27B0"
-		if hypervisor.State == "down" {
-			hypervisorNodeColor = "#FF0000"
-		}
-		hypervisorNodeViews := make(map[string]string)
-		hypervisorNodeViews["Instance Topology"] = "http://" + r.Host + "/topology/cloudHypervisorInstancesTopology/" + cloudInfo.Name + "/" + hypervisor.Name
-		hypervisorNodeViews["Linux Bridges"] = "http://" + r.Host + "/topology/cloudHypervisorLayer2NetworkTopology/" + cloudInfo.Name + "/" + hypervisor.Name
-		hypervisorNodeViews["OVS Bridges"] = "http://" + r.Host + "/topology/cloudHypervisorOvsNetworkTopology/" + cloudName + "/" + hypervisor.Name
-		hypervisorNodeId := nodeId
-		hypervisorNode := TopologyNode{
-			ID:         hypervisorNodeId,
-			Name:       hypervisor.Name,
-			DeviceType: "host",
-			//X:          200,
-			//Y:          (200 + (5 * i)),
-			Color: hypervisorNodeColor,
-			Props: hypervisorNodeProps,
-			Views: hypervisorNodeViews,
-		}
-		nodeList = append(nodeList, hypervisorNode)
-		nodeId++
-		bridgeList := ovsGetBridges(hypervisor.HostIP)
-		for _, bridge := range bridgeList {
-			bridgeNodeProps := make(map[string]interface{})
-			bridgeNodeProps["uuid"] = bridge.UUID
-			bridgeNodeProps["name"] = bridge.Name
-			bridgeNodeProps["hypervisor_ip"] = hypervisor.HostIP
-			bridgeNodeId := nodeId
-			bridgeNode := TopologyNode{
-				ID:         bridgeNodeId,
-				Name:       bridge.Name,
-				DeviceType: "switch",
-				//X:          (-100 + (-300 * j)),
-				//Y:          (-600 + (300 * j)),
-				Color: "#00FF00",
-				Props: bridgeNodeProps,
-			}
-			nodeList = append(nodeList, bridgeNode)
-			nodeId++
-		}
-		bridgeConnections := ovsGetBridgeConnections(hypervisor.HostIP)
-		for _, bc := range bridgeConnections {
-			var sourceBridgeId int
-			var targetBridgeId int
-			var sourceBridgeName string
-			var targetBridgeName string
-			bridgeLinkProps := make(map[string]interface{})
-			for k, v := range bc.SourceInterface.Statistics {
-				bridgeLinkProps[k] = v
-			}
-			for _, node := range nodeList {
-				hypervisorIP, ok := node.Props["hypervisor_ip"].(string)
-				if !ok {
-					continue
-				}
-				if bc.HostIP == hypervisorIP && bc.SourceBridge.Name == node.Name {
-					sourceBridgeId = node.ID
-					sourceBridgeName = node.Name
-					break
-				}
+// hypervisorInstancesParse reads selections of the form
+// host_name[:instance_name,...], several separated by ';'. A host without
+// instances selects all of its instances.
+func hypervisorInstancesParse(values []string) ([]HypervisorInstanceNames, error) {
+	var selections []HypervisorInstanceNames
+	for _, value := range values {
+		for _, item := range strings.Split(value, ";") {
+			item = strings.TrimSpace(item)
+			if len(item) == 0 {
+				continue
 			}
-			for _, node := range nodeList {
-				hypervisorIP, ok := node.Props["hypervisor_ip"].(string)
-				if !ok {
-					continue
-				}
-				if bc.HostIP == hypervisorIP && bc.TargetBridge.Name == node.Name {
-					targetBridgeId = node.ID
-					targetBridgeName = node.Name
-					break
-				}
+			hostName := item
+			var instanceNames []string
+			if i := strings.Index(item, ":"); i >= 0 {
+				hostName = strings.TrimSpace(item[:i])
+				instanceNames = queryList([]string{item[i+1:]})
 			}
-			bridgeLinkProps["source_name"] = sourceBridgeName
-			bridgeLinkProps["target_name"] = targetBridgeName
-			bridgeLinkProps["source_interface"] = bc.SourceInterface.Name
-			bridgeLinkProps["target_interface"] = bc.TargetInterface.Name
-			bridgeLinkProps["source_interface_type"] = bc.SourceInterface.Type
-			bridgeLinkProps["target_interface_type"] = bc.TargetInterface.Type
-			bridgeLinkProps["source_port"] = bc.SourcePort.Name
-			bridgeLinkProps["target_port"] = bc.TargetPort.Name
-
-			bridgeLink := TopologyLink{
-				Name:   "",
-				Source: sourceBridgeId,
-				Target: targetBridgeId,
-				Color:  "#00FF00",
-				Props:  bridgeLinkProps,
+			if len(hostName) == 0 {
+				return nil, errors.New("Invalid hypervisor instances selection " + item)
 			}
-			linkList = append(linkList, bridgeLink)
-			linkId++
+			selections = append(selections, HypervisorInstanceNames{hostName, instanceNames})
 		}
-		instanceList := libvirtGetDomainInstances(hypervisor.HostIP)
-		var instanceNodeSetIdList []int
-		for _, instance := range instanceList {
-			instanceNodeProps := make(map[string]interface{})
-			instanceNodeProps["uuid"] = instance.UUID
-			instanceNodeProps["name"] = instance.Name
-			instanceNodeProps["hypervisor name"] = instance.HypervisorName
-			instanceNodeViews := make(map[string]string)
-			instanceNodeViews["Networks"] = "http://" + r.Host + "/topology/cloudInstanceLayer3NetworkTopology/" + cloudName + "/" + hypervisor.Name + "/" + instance.InstanceName
-			instanceNodeViews["Linux Bridges"] = "http://" + r.Host + "/topology/cloudInstanceLayer2NetworkTopology/" + cloudName + "/" + hypervisor.Name + "/" + instance.InstanceName
-			instanceNodeViews["OVS Bridges"] = "http://" + r.Host + "/topology/cloudInstanceOvsNetworkTopology/" + cloudName + "/" + hypervisor.Name + "/" + instance.InstanceName
-			instanceNodeId := nodeId
-			instanceNode := TopologyNode{
-				ID:         instanceNodeId,
-				Name:       instance.InstanceName,
-				DeviceType: "server",
-				//X:          800,
-				//Y:          (-200 + (5 * j)),
-				Color: "#0000FF",
-				Props: instanceNodeProps,
-				Views: instanceNodeViews,
-			}
-			nodeList = append(nodeList, instanceNode)
-			nodeId++
-			instanceLinkProps := make(map[string]interface{})
-			instanceLinkProps["source_name"] = hypervisorNode.Name
-			instanceLinkProps["target_name"] = instanceNode.Name
-			hypervisorLink := TopologyLink{
-				Name:   "",
-				Source: hypervisorNodeId,
-				Target: instanceNodeId,
-				Color:  "#0000FF",
-				Props:  instanceLinkProps,
-			}
-			linkList = append(linkList, hypervisorLink)
-			linkId++
-			var bridgeNodeSetIdList []int
-			for _, iface := range instance.Interfaces {
-				bridgeNodeProps := make(map[string]interface{})
-				bridgeNodeProps["tap"] = iface.DevName
-				bridgeNodeProps["mac_address"] = iface.MacAddress
-				bridgeNodeProps["network_name"] = iface.NetworkName
-				bridgeNodeId := nodeId
-				bridgeNode := TopologyNode{
-					ID:         bridgeNodeId,
-					Name:       iface.BridgeName,
-					DeviceType: "switch",
-					//X:          700,
-					//Y:          (-500 + (5 * k)),
-					Color: "#FF00FF",
-					Props: bridgeNodeProps,
-				}
-				nodeList = append(nodeList, bridgeNode)
-				//bridgeNodeSetIdList = append(bridgeNodeSetIdList, bridgeNodeId)
-				bridgeLinkProps := make(map[string]interface{})
-				bridgeLinkProps["source_name"] = instanceNode.Name
-				bridgeLinkProps["target_name"] = bridgeNode.Name
-				bridgeLinkProps["interface_type"] = iface.Type
-				for k, v := range iface.Statistics {
-					bridgeLinkProps[k] = v
-				}
-				bridgeLink := TopologyLink{
-					Name:   "",
-					Source: instanceNodeId,
-					Target: bridgeNodeId,
-					Color:  "#0000FF",
-					Props:  bridgeLinkProps,
-				}
-				linkList = append(linkList, bridgeLink)
-				nodeId++
-				linkId++
-				bc := ovsGetBridgeConnection(hypervisor.HostIP, iface.MacAddress)
-				if bc != nil {
-					var targetBridgeId int
-					var targetBridgeName string
-					ovsBridgeLinkProps := make(map[string]interface{})
-					ovsBridgeLinkProps["source_name"] = bridgeNode.Name
-					ovsBridgeLinkProps["target_interface"] = bc.TargetInterface.Name
-					ovsBridgeLinkProps["target_interface_type"] = bc.TargetInterface.Type
-					ovsBridgeLinkProps["target_port"] = bc.TargetPort.Name
-					for k, v := range bc.TargetInterface.Statistics {
-						ovsBridgeLinkProps[k] = v
-					}
-					for _, node := range nodeList {
-						hypervisorIP, ok := node.Props["hypervisor_ip"].(string)
-						if !ok {
-							continue
-						}
-						if bc.HostIP == hypervisorIP && bc.TargetBridge.Name == node.Name {
-							targetBridgeId = node.ID
-							targetBridgeName = node.Name
-							break
-						}
-					}
-					ovsBridgeLinkProps["target_name"] = targetBridgeName
-					ovsBridgeLink := TopologyLink{
-						Name:   "",
-						Source: bridgeNodeId,
-						Target: targetBridgeId,
-						Color:  "#FF00FF",
-						Props:  ovsBridgeLinkProps,
-					}
-					linkList = append(linkList, ovsBridgeLink)
-					linkId++
-				}
+	}
+	return selections, nil
+}
 
-			}
-			if len(bridgeNodeSetIdList) > 0 {
-				nodeSetProps := make(map[string]interface{})
-				nodeSet := TopologyNodeSet{
-					ID:         nodeId,
-					Nodes:      bridgeNodeSetIdList,
-					Name:       "bridge-group",
-					Root:       instanceNodeId,
-					DeviceType: "groups",
-					//X:          (-200 + (100 * j)),
-					//Y:          400,
-					Color: "#0000FF",
-					Props: nodeSetProps,
-				}
-				nodeSetList = append(nodeSetList, nodeSet)
-				nodeId++
-			}
+// hypervisorInstancesRead takes the selection from a POSTed HypervisorInstances
+// body and from hypervisor_instances query parameters.
+func hypervisorInstancesRead(r *http.Request) (HypervisorInstances, error) {
+	var his HypervisorInstances
+	if r.Method == "POST" && r.Body != nil && r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&his); err != nil {
+			return his, errors.New("Invalid hypervisor instances: " + err.Error())
 		}
-		interfaces := libvirtGetPhysicalInterfaces(hypervisor.HostIP)
-		for _, iface := range interfaces {
-			bc := ovsGetPhysicalPortConnection(hypervisor.HostIP, iface.Name, iface.MacAddress)
-			if bc != nil {
-				portNodeProps := make(map[string]interface{})
-				portNodeProps["mac_address"] = iface.MacAddress
-				portNodeId := nodeId
-				portNode := TopologyNode{
-					ID:         portNodeId,
-					Name:       iface.Name,
-					DeviceType: "port",
-					//X:          700,
-					//Y:          (-500 + (5 * k)),
-					Color: "#000000",
-					Props: portNodeProps,
-				}
-				nodeList = append(nodeList, portNode)
-
-				var sourceBridgeId int
-				var sourceBridgeName string
-				ovsBridgeLinkProps := make(map[string]interface{})
-				ovsBridgeLinkProps["source_interface"] = bc.SourceInterface.Name
-				ovsBridgeLinkProps["source_interface_type"] = bc.SourceInterface.Type
-				ovsBridgeLinkProps["source_port"] = bc.SourcePort.Name
-				ovsBridgeLinkProps["target_name"] = iface.Name
-				for k, v := range bc.SourceInterface.Statistics {
-					ovsBridgeLinkProps[k] = v
-				}
-				for _, node := range nodeList {
-					hypervisorIP, ok := node.Props["hypervisor_ip"].(string)
-					if !ok {
-						continue
-					}
-					if bc.HostIP == hypervisorIP && bc.SourceBridge.Name == node.Name {
-						sourceBridgeId = node.ID
-						sourceBridgeName = node.Name
-						break
-					}
-				}
-				ovsBridgeLinkProps["source_name"] = sourceBridgeName
-				ovsBridgeLink := TopologyLink{
-					Name:   "",
-					Source: sourceBridgeId,
-					Target: portNodeId,
-					Color:  "#000000",
-					Props:  ovsBridgeLinkProps,
-				}
-				linkList = append(linkList, ovsBridgeLink)
-				nodeId++
-				linkId++
-			}
+	}
+	selections, err := hypervisorInstancesParse(r.URL.Query()["hypervisor_instances"])
+	if err != nil {
+		return his, err
+	}
+	his.HypervisorInstances = append(his.HypervisorInstances, selections...)
+	return his, nil
+}
+
+// hypervisorInstancesValidate checks every host and instance of a selection
+// against discovery and reports each one that is unknown.
+func hypervisorInstancesValidate(cloudName string, selections []HypervisorInstanceNames) []HypervisorInstanceError {
+	var itemErrors []HypervisorInstanceError
+	for _, hi := range selections {
+		if len(hi.HostName) == 0 {
+			itemErrors = append(itemErrors, HypervisorInstanceError{ErrorMessage: "Missing host_name"})
+			continue
+		}
+		if cloudGetHypervisorInfoByHostName(cloudName, hi.HostName) == nil {
+			itemErrors = append(itemErrors, HypervisorInstanceError{
+				HostName:     hi.HostName,
+				ErrorMessage: "Hypervisor " + hi.HostName + " for cloud " + cloudName + " Not discovered",
+			})
+			continue
 		}
-		if len(instanceNodeSetIdList) > 0 {
-			nodeSetProps := make(map[string]interface{})
-			nodeSet := TopologyNodeSet{
-				ID:         nodeId,
-				Nodes:      instanceNodeSetIdList,
-				Name:       "instance-group",
-				Root:       0,
-				DeviceType: "groups",
-				X:          500,
-				Y:          200,
-				Color:      "#0000FF",
-				Props:      nodeSetProps,
+		for _, instanceName := range hi.InstanceNames {
+			if cloudGetInstanceInfoForHypervisorByHostName(cloudName, hi.HostName, instanceName) == nil {
+				itemErrors = append(itemErrors, HypervisorInstanceError{
+					HostName:     hi.HostName,
+					InstanceName: instanceName,
+					ErrorMessage: "Instance " + instanceName + " for hypervisor " + hi.HostName + " and cloud " + cloudName + " Not discovered",
+				})
 			}
-			nodeSetList = append(nodeSetList, nodeSet)
-			nodeId++
 		}
 	}
+	return itemErrors
+}
 
-	groupList := make([]TopologyGroup, 0)
-
-	viewList := make(map[string]string, 2)
-	viewList["Cloud Topology"] = "http://" + r.Host + "/topology/cloudTopology/" + cloudInfo.Name
-	viewList["Cloud Hypervisors"] = "http://" + r.Host + "/topology/cloudHypervisorTopology/" + cloudInfo.Name
-	viewList["Cloud Networks"] = "http://" + r.Host + "/topology/cloudLayer3NetworkTopology/" + cloudInfo.Name
-	viewList["Cloud Linux Bridges"] = "http://" + r.Host + "/topology/cloudLayer2NetworkTopology/" + cloudInfo.Name
-	viewList["Cloud OVS Bridges"] = "http://" + r.Host + "/topology/cloudOvsNetworkTopology/" + cloudInfo.Name
+func writeHypervisorInstancesErrors(rw http.ResponseWriter, itemErrors []HypervisorInstanceError) {
+	apiError := HypervisorInstancesError{http.StatusNotFound, strconv.Itoa(len(itemErrors)) + " hypervisor instances selection error(s)", itemErrors}
+	luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+}
 
-	cloudTopologyData := TopologyData{
-		Title:    topologyTitle,
-		Nodes:    nodeList,
-		Links:    linkList,
-		NodeSets: nodeSetList,
-		Groups:   groupList,
-		Views:    viewList,
+func cloudHypervisorsOvsNetworkTopologyTitle(expanded bool, unfiltered bool) string {
+	title := "Collapsed"
+	if expanded {
+		title = "Expanded"
+	}
+	if unfiltered {
+		return title + " Unfiltered VNF OVS Network Topology"
 	}
+	return title + " Filtered VNF OVS Network Topology"
+}
 
-	luddite.WriteResponse(rw, http.StatusOK, cloudTopologyData)
+func cloudHypervisorsOvsNetworkQuery(cloudName string, selections []HypervisorInstanceNames, expanded bool, unfiltered bool) TopologyQuery {
+	q := TopologyQuery{
+		Cloud:               cloudName,
+		HypervisorInstances: selections,
+		Layers:              []string{queryLayerOvs, queryLayerLinuxBridge, queryLayerPhysical},
+		Title:               cloudName + " " + cloudHypervisorsOvsNetworkTopologyTitle(expanded, unfiltered),
+		noStatistics:        true,
+		hiddenBridgeLinks:   true,
+		hypervisorViews:     queryViewEmpty,
+		instanceViews:       queryViewEmpty,
+	}
+	q.Filtered = !unfiltered
+	if !expanded {
+		q.Collapse = queryCollapseBridges
+	}
+	return q
 }
 
-func CloudHypervisorsCollapsedFilteredOvsNetworkTopology(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+// cloudHypervisorsOvsNetworkTopology renders the OVS topology of the selected
+// hypervisors and instances, or of the whole cloud without a selection.
+func cloudHypervisorsOvsNetworkTopology(ctx context.Context, rw http.ResponseWriter, r *http.Request, expanded bool, unfiltered bool) {
 	cloudName := httprouter.ContextParams(ctx).ByName("cloud_name")
-	cloudInfo := cloudGetCloudInfo(cloudName)
-	if cloudInfo == nil {
+	if cloudGetCloudInfo(cloudName) == nil {
 		apiError := APIError{http.StatusNotFound, "Cloud " + cloudName + " Not discovered"}
 		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
 		return
 	}
-/*
-	hi1 := HypervisorInstanceNames{
-		HostName: "sjc-ml-os-comp1.ad.spirentcom.com",
-		InstanceNames: []string{"STCv-1", "STCv-2", "STCv Test-2"},
+	his, err := hypervisorInstancesRead(r)
+	if err != nil {
+		apiError := APIError{http.StatusBadRequest, err.Error()}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
 	}
-	hi2 := HypervisorInstanceNames{
-		HostName: "sjc-ml-os-comp3.ad.spirentcom.com",
-		InstanceNames: []string{"STCv Test-1", "TEMEVA-OnPrem-Controller-LD-v794"},
+
+	q := cloudHypervisorsOvsNetworkQuery(cloudName, his.HypervisorInstances, expanded, unfiltered)
+	q.FilterRules = filterParseValues(r.URL.Query())
+	queryWrite(rw, r, q, make(map[string]string))
+}
+
+func CloudHypervisorsOvsNetworkTopology(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	expanded := r.URL.Query().Get("expanded") == "true"
+	unfiltered := r.URL.Query().Get("unfiltered") == "true"
+	cloudHypervisorsOvsNetworkTopology(ctx, rw, r, expanded, unfiltered)
+}
+
+func CloudHypervisorsCollapsedFilteredOvsNetworkTopology(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	cloudHypervisorsOvsNetworkTopology(ctx, rw, r, false, false)
+}
+
+func CloudHypervisorsExpandedFilteredOvsNetworkTopology(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	cloudHypervisorsOvsNetworkTopology(ctx, rw, r, true, false)
+}
+
+func CloudHypervisorsCollapsedUnfilteredOvsNetworkTopology(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	cloudHypervisorsOvsNetworkTopology(ctx, rw, r, false, true)
+}
+
+func CloudHypervisorsExpandedUnfilteredOvsNetworkTopology(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	cloudHypervisorsOvsNetworkTopology(ctx, rw, r, true, true)
+}
+
+func CloudHypervisorInstancesTopology(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+	cloudName := httprouter.ContextParams(ctx).ByName("cloud_name")
+	hypervisorName := httprouter.ContextParams(ctx).ByName("hypervisor_name")
+	g := topologyGetGraph(rw, r, cloudName)
+	if g == nil {
+		return
 	}
-	his := HypervisorInstances{[]HypervisorInstanceNames{hi1, hi2}}
-*/
-	hi1 := HypervisorInstanceNames{
-		HostName: "compute-node.spirent.com",
-		InstanceNames: []string{"vRouter1"},
+	hypervisor := topologyGetHypervisor(rw, g, hypervisorName)
+	if hypervisor == nil {
+		return
 	}
-	his := HypervisorInstances{[]HypervisorInstanceNames{hi1}}
 
-	for _,hi := range his.HypervisorInstances {
-		hypervisorInfo := cloudGetHypervisorInfoByHostName(cloudName, hi.HostName)
-		if hypervisorInfo == nil {
-			apiError := APIError{http.StatusNotFound, "Hypervisor " + hi.HostName + " for cloud "+ cloudName + " Not discovered"}
-			luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
-			return
-		}
-		for _, instanceName := range hi.InstanceNames {
-			instanceInfo := cloudGetInstanceInfoForHypervisorByHostName(cloudName, hi.HostName, instanceName)
-			if instanceInfo == nil {
-				apiError := APIError{http.StatusNotFound, "Instance " + instanceName + " for hypervisor " + hi.HostName + " and cloud "+ cloudName + " Not discovered"}
-				luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
-				return
-			}
+	b := newGraphTopologyBuilder(r, g)
+	hypervisorNode := b.addNode(hypervisor.Key, topologyHypervisorNode(hypervisor.Hypervisor, nil))
+	for _, instance := range g.Children(hypervisor.Key, graphEntityInstance) {
+		node := topologyInstanceNode(instance.Instance, b.instanceViews(hypervisor.Name, instance.Name))
+		if move := placementGetRecentMove(cloudName, instance.Instance.UUID); move != nil {
+			placementSetMovedFromProps(node.Props, move)
 		}
+		instanceNode := b.addNode(instance.Key, node)
+		b.addLink(topologyNodeLink(hypervisorNode, instanceNode, "#0000FF"))
 	}
 
-	expanded := ""
-	unfiltered := ""
-
-	topologyTitle := cloudInfo.Name + " Collapsed Filtered VNF OVS Network Topology"
-
-	var nodeList []TopologyNode
-	var linkList []TopologyLink
-	var nodeSetList []TopologyNodeSet
-	var bridgeNodeSetIdList []int
-	nodeId := 0
-	linkId := 0
-
-	for _, hi := range his.HypervisorInstances {
-		hypervisor := cloudGetHypervisorInfoByHostName(cloudName, hi.HostName)
-		hypervisorNodeProps := make(map[string]interface{})
-		hypervisorNodeProps["id"] = hypervisor.ID
-		hypervisorNodeProps["host_name"] = hypervisor.HostName
-		hypervisorNodeProps["ip_address"] = hypervisor.HostIP
-		hypervisorNodeProps["state"] = hypervisor.State
-		hypervisorNodeColor := "#9C27B0"
-		if hypervisor.State == "down" {
-			hypervisorNodeColor = "#FF0000"
-		}
-		hypervisorNodeViews := make(map[string]string)
-		hypervisorNodeId := nodeId
-		hypervisorNode := TopologyNode{
-			ID:         hypervisorNodeId,
-			Name:       hypervisor.Name,
-			DeviceType: "host",
-			//X:          -200,
-			//Y:          0,
-			Color: hypervisorNodeColor,
-			Props: hypervisorNodeProps,
-			Views: hypervisorNodeViews,
-		}
-		nodeList = append(nodeList, hypervisorNode)
-		nodeId++
-		bridgeList := ovsGetBridges(hypervisor.HostIP)
-		var ovsBridgeNodeSetIdList []int
-		for _, bridge := range bridgeList {
-			if len(unfiltered) == 0 {
-				if bridge.Name == "br-tun" || bridge.Name == "br-ex" {
-					continue
-				}
-			}
-			bridgeNodeProps := make(map[string]interface{})
-			bridgeNodeProps["uuid"] = bridge.UUID
-			bridgeNodeProps["name"] = bridge.Name
-			bridgeNodeProps["hypervisor_ip"] = hypervisor.HostIP
-			bridgeNodeId := nodeId
-			bridgeNode := TopologyNode{
-				ID:         bridgeNodeId,
-				Name:       bridge.Name,
-				DeviceType: "switch",
-				//X:          (-100 + (-300 * j)),
-				//Y:          (-600 + (300 * j)),
-				Color: "#00FF00",
-				Props: bridgeNodeProps,
-			}
-			nodeList = append(nodeList, bridgeNode)
-			if len(expanded) == 0 {
-				ovsBridgeNodeSetIdList = append(ovsBridgeNodeSetIdList, bridgeNodeId)
-			}
-			nodeId++
-		}
-		if len(ovsBridgeNodeSetIdList) > 0 {
-			nodeSetProps := make(map[string]interface{})
-			nodeSet := TopologyNodeSet{
-				ID:    nodeId,
-				Nodes: ovsBridgeNodeSetIdList,
-				Name:  "ovs-bridge-group",
-				//Root:       instanceNodeId,
-				DeviceType: "switch",
-				X:          -100,
-				Y:          0,
-				Color:      "#00FF00",
-				Props:      nodeSetProps,
-			}
-			bridgeNodeSetIdList = append(bridgeNodeSetIdList, nodeId)
-			nodeSetList = append(nodeSetList, nodeSet)
-			nodeId++
-		}
-		bridgeConnections := ovsGetBridgeConnections(hypervisor.HostIP)
-		for _, bc := range bridgeConnections {
-			var sourceBridgeId int
-			var targetBridgeId int
-			var sourceBridgeName string
-			var targetBridgeName string
-			bridgeLinkProps := make(map[string]interface{})
-			if len(unfiltered) == 0 {
-				if bc.SourceBridge.Name == "br-tun" || bc.TargetBridge.Name == "br-tun" {
-					continue
-				}
-			}
-			for _, node := range nodeList {
-				hypervisorIP, ok := node.Props["hypervisor_ip"].(string)
-				if !ok {
-					continue
-				}
-				if bc.HostIP == hypervisorIP && bc.SourceBridge.Name == node.Name {
-					sourceBridgeId = node.ID
-					sourceBridgeName = node.Name
-					break
-				}
-			}
-			for _, node := range nodeList {
-				hypervisorIP, ok := node.Props["hypervisor_ip"].(string)
-				if !ok {
-					continue
-				}
-				if bc.HostIP == hypervisorIP && bc.TargetBridge.Name == node.Name {
-					targetBridgeId = node.ID
-					targetBridgeName = node.Name
-					break
-				}
-			}
-			bridgeLinkProps["source_name"] = sourceBridgeName
-			bridgeLinkProps["target_name"] = targetBridgeName
-			bridgeLinkProps["source_interface"] = bc.SourceInterface.Name
-			bridgeLinkProps["target_interface"] = bc.TargetInterface.Name
-			bridgeLinkProps["source_interface_type"] = bc.SourceInterface.Type
-			bridgeLinkProps["target_interface_type"] = bc.TargetInterface.Type
-			bridgeLinkProps["source_port"] = bc.SourcePort.Name
-			bridgeLinkProps["target_port"] = bc.TargetPort.Name
-
-			bridgeLink := TopologyLink{
-				Name:   "",
-				Source: sourceBridgeId,
-				Target: targetBridgeId,
-				Color:  "#00FF00",
-				Props:  bridgeLinkProps,
-			}
-			linkList = append(linkList, bridgeLink)
-			linkId++
-		}
-		instanceList := libvirtGetDomainInstances(hypervisor.HostIP)
-		var instanceNodeSetIdList []int
-		for _, instance := range instanceList {
-			iFound := false
-			for _, instanceName := range hi.InstanceNames {
-				if instance.InstanceName == instanceName {
-					iFound = true
-					break
-				}
-			}
-			if !iFound {
-				continue
-			}
-			instanceNodeProps := make(map[string]interface{})
-			instanceNodeProps["uuid"] = instance.UUID
-			instanceNodeProps["name"] = instance.Name
-			instanceNodeProps["hypervisor name"] = instance.HypervisorName
-			instanceNodeViews := make(map[string]string)
-			instanceNodeId := nodeId
-			instanceNode := TopologyNode{
-				ID:         instanceNodeId,
-				Name:       instance.InstanceName,
-				DeviceType: "server",
-				//X:          300,
-				//Y:          0,
-				Color: "#0000FF",
-				Props: instanceNodeProps,
-				Views: instanceNodeViews,
-			}
-			nodeList = append(nodeList, instanceNode)
-			nodeId++
-			instanceLinkProps := make(map[string]interface{})
-			instanceLinkProps["source_name"] = hypervisorNode.Name
-			instanceLinkProps["target_name"] = instanceNode.Name
-			hypervisorLink := TopologyLink{
-				Name:   "",
-				Source: hypervisorNodeId,
-				Target: instanceNodeId,
-				Color:  "#0000FF",
-				Props:  instanceLinkProps,
-			}
-			linkList = append(linkList, hypervisorLink)
-			linkId++
-			var linuxBridgeNodeSetIdList []int
-			for _, iface := range instance.Interfaces {
-				bridgeNodeProps := make(map[string]interface{})
-				bridgeNodeProps["tap"] = iface.DevName
-				bridgeNodeProps["mac_address"] = iface.MacAddress
-				bridgeNodeProps["network_name"] = iface.NetworkName
-				bridgeNodeId := nodeId
-				bridgeNode := TopologyNode{
-					ID:         bridgeNodeId,
-					Name:       iface.BridgeName,
-					DeviceType: "switch",
-					//X:          700,
-					//Y:          (-500 + (5 * k)),
-					Color: "#FF00FF",
-					Props: bridgeNodeProps,
-				}
-				nodeList = append(nodeList, bridgeNode)
-				if len(expanded) == 0 {
-					linuxBridgeNodeSetIdList = append(linuxBridgeNodeSetIdList, bridgeNodeId)
-				}
-				bridgeLinkProps := make(map[string]interface{})
-				bridgeLinkProps["source_name"] = instanceNode.Name
-				bridgeLinkProps["target_name"] = bridgeNode.Name
-				bridgeLinkProps["interface_type"] = iface.Type
-				bridgeLink := TopologyLink{
-					Name:   "",
-					Source: instanceNodeId,
-					Target: bridgeNodeId,
-					Color:  "#0000FF",
-					Props:  bridgeLinkProps,
-				}
-				linkList = append(linkList, bridgeLink)
-				nodeId++
-				linkId++
-				bc := ovsGetBridgeConnection(hypervisor.HostIP, iface.MacAddress)
-				if bc != nil {
-					var targetBridgeId int
-					var targetBridgeName string
-					ovsBridgeLinkProps := make(map[string]interface{})
-					ovsBridgeLinkProps["source_name"] = bridgeNode.Name
-					ovsBridgeLinkProps["target_interface"] = bc.TargetInterface.Name
-					ovsBridgeLinkProps["target_interface_type"] = bc.TargetInterface.Type
-					ovsBridgeLinkProps["target_port"] = bc.TargetPort.Name
-					for _, node := range nodeList {
-						hypervisorIP, ok := node.Props["hypervisor_ip"].(string)
-						if !ok {
-							continue
-						}
-						if bc.HostIP == hypervisorIP && bc.TargetBridge.Name == node.Name {
-							targetBridgeId = node.ID
-							targetBridgeName = node.Name
-							break
-						}
-					}
-					ovsBridgeLinkProps["target_name"] = targetBridgeName
-					ovsBridgeLink := TopologyLink{
-						Name:   "",
-						Source: bridgeNodeId,
-						Target: targetBridgeId,
-						Color:  "#FF00FF",
-						Props:  ovsBridgeLinkProps,
-					}
-					linkList = append(linkList, ovsBridgeLink)
-					linkId++
-				}
-
-			}
-			if len(linuxBridgeNodeSetIdList) > 0 {
-				nodeSetProps := make(map[string]interface{})
-				nodeSet := TopologyNodeSet{
-					ID:         nodeId,
-					Nodes:      linuxBridgeNodeSetIdList,
-					Name:       "linux-bridge-group",
-					Root:       instanceNodeId,
-					DeviceType: "switch",
-					X:          200,
-					Y:          0,
-					Color:      "#FF00FF",
-					Props:      nodeSetProps,
-				}
-				bridgeNodeSetIdList = append(bridgeNodeSetIdList, nodeId)
-				nodeSetList = append(nodeSetList, nodeSet)
-				nodeId++
-			}
-		}
-		interfaces := libvirtGetPhysicalInterfaces(hypervisor.HostIP)
-		for _, iface := range interfaces {
-			bc := ovsGetPhysicalPortConnection(hypervisor.HostIP, iface.Name, iface.MacAddress)
-			var sourceBridgeId int
-			var sourceBridgeName string
-			if bc != nil {
-				bridgeFound := false
-				for _, node := range nodeList {
-					hypervisorIP, ok := node.Props["hypervisor_ip"].(string)
-					if !ok {
-						continue
-					}
-					if bc.HostIP == hypervisorIP && bc.SourceBridge.Name == node.Name {
-						sourceBridgeId = node.ID
-						sourceBridgeName = node.Name
-						bridgeFound = true
-						break
-					}
-				}
-				if !bridgeFound {
-					continue
-				}
-
-				portNodeProps := make(map[string]interface{})
-				portNodeProps["mac_address"] = iface.MacAddress
-				portNodeId := nodeId
-				portNode := TopologyNode{
-					ID:         portNodeId,
-					Name:       iface.Name,
-					DeviceType: "port",
-					//X:          700,
-					//Y:          (-500 + (5 * k)),
-					Color: "#000000",
-					Props: portNodeProps,
-				}
-				nodeList = append(nodeList, portNode)
-				ovsBridgeLinkProps := make(map[string]interface{})
-				ovsBridgeLinkProps["source_interface"] = bc.SourceInterface.Name
-				ovsBridgeLinkProps["source_interface_type"] = bc.SourceInterface.Type
-				ovsBridgeLinkProps["source_port"] = bc.SourcePort.Name
-				ovsBridgeLinkProps["target_name"] = iface.Name
-				ovsBridgeLinkProps["source_name"] = sourceBridgeName
-				ovsBridgeLink := TopologyLink{
-					Name:   "",
-					Source: sourceBridgeId,
-					Target: portNodeId,
-					Color:  "#000000",
-					Props:  ovsBridgeLinkProps,
-				}
-				linkList = append(linkList, ovsBridgeLink)
-				nodeId++
-				linkId++
-			}
-		}
-		if len(instanceNodeSetIdList) > 0 {
-			nodeSetProps := make(map[string]interface{})
-			nodeSet := TopologyNodeSet{
-				ID:         nodeId,
-				Nodes:      instanceNodeSetIdList,
-				Name:       "instance-group",
-				Root:       0,
-				DeviceType: "groups",
-				//X:          500,
-				//Y:          200,
-				Color: "#0000FF",
-				Props: nodeSetProps,
-			}
-			nodeSetList = append(nodeSetList, nodeSet)
-			nodeId++
-		}
-	}
-
-	if len(bridgeNodeSetIdList) > 0 {
-		nodeSetProps := make(map[string]interface{})
-		nodeSet := TopologyNodeSet{
-			ID:    nodeId,
-			Nodes: bridgeNodeSetIdList,
-			Name:  "bridge-group",
-			//Root:       instanceNodeId,
-			DeviceType: "switch",
-			X:          0,
-			Y:          0,
-			Color:      "#0000FF",
-			Props:      nodeSetProps,
-		}
-		nodeSetList = append(nodeSetList, nodeSet)
-		nodeId++
-	}
-
-	groupList := make([]TopologyGroup, 0)
-
-	viewList := make(map[string]string)
-
-	cloudTopologyData := TopologyData{
-		Title:    topologyTitle,
-		Nodes:    nodeList,
-		Links:    linkList,
-		NodeSets: nodeSetList,
-		Groups:   groupList,
-		Views:    viewList,
-	}
-
-	luddite.WriteResponse(rw, http.StatusOK, cloudTopologyData)
-}
-
-func CloudHypervisorsExpandedFilteredOvsNetworkTopology(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
-	cloudName := httprouter.ContextParams(ctx).ByName("cloud_name")
-	cloudInfo := cloudGetCloudInfo(cloudName)
-	if cloudInfo == nil {
-		apiError := APIError{http.StatusNotFound, "Cloud " + cloudName + " Not discovered"}
-		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
-		return
-	}
-/*
-	hi1 := HypervisorInstanceNames{
-		HostName: "sjc-ml-os-comp1.ad.spirentcom.com",
-		InstanceNames: []string{"STCv-1", "STCv-2", "STCv Test-2"},
-	}
-	hi2 := HypervisorInstanceNames{
-		HostName: "sjc-ml-os-comp3.ad.spirentcom.com",
-		InstanceNames: []string{"STCv Test-1", "TEMEVA-OnPrem-Controller-LD-v794"},
-	}
-	his := HypervisorInstances{[]HypervisorInstanceNames{hi1, hi2}}
-*/
-	hi1 := HypervisorInstanceNames{
-		HostName: "compute-node.spirent.com",
-		InstanceNames: []string{"vRouter1"},
-	}
-	his := HypervisorInstances{[]HypervisorInstanceNames{hi1}}
-
-	for _,hi := range his.HypervisorInstances {
-		hypervisorInfo := cloudGetHypervisorInfoByHostName(cloudName, hi.HostName)
-		if hypervisorInfo == nil {
-			apiError := APIError{http.StatusNotFound, "Hypervisor " + hi.HostName + " for cloud "+ cloudName + " Not discovered"}
-			luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
-			return
-		}
-		for _, instanceName := range hi.InstanceNames {
-			instanceInfo := cloudGetInstanceInfoForHypervisorByHostName(cloudName, hi.HostName, instanceName)
-			if instanceInfo == nil {
-				apiError := APIError{http.StatusNotFound, "Instance " + instanceName + " for hypervisor " + hi.HostName + " and cloud "+ cloudName + " Not discovered"}
-				luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
-				return
-			}
-		}
-	}
-
-	expanded := "true"
-	unfiltered := ""
-
-	topologyTitle := cloudInfo.Name + " Expanded Filtered VNF OVS Network Topology"
-
-	var nodeList []TopologyNode
-	var linkList []TopologyLink
-	var nodeSetList []TopologyNodeSet
-	var bridgeNodeSetIdList []int
-	nodeId := 0
-	linkId := 0
-
-	for _, hi := range his.HypervisorInstances {
-		hypervisor := cloudGetHypervisorInfoByHostName(cloudName, hi.HostName)
-		hypervisorNodeProps := make(map[string]interface{})
-		hypervisorNodeProps["id"] = hypervisor.ID
-		hypervisorNodeProps["host_name"] = hypervisor.HostName
-		hypervisorNodeProps["ip_address"] = hypervisor.HostIP
-		hypervisorNodeProps["state"] = hypervisor.State
-		hypervisorNodeColor := "#9C27B0"
-		if hypervisor.State == "down" {
-			hypervisorNodeColor = "#FF0000"
-		}
-		hypervisorNodeViews := make(map[string]string)
-		hypervisorNodeId := nodeId
-		hypervisorNode := TopologyNode{
-			ID:         hypervisorNodeId,
-			Name:       hypervisor.Name,
-			DeviceType: "host",
-			//X:          -200,
-			//Y:          0,
-			Color: hypervisorNodeColor,
-			Props: hypervisorNodeProps,
-			Views: hypervisorNodeViews,
-		}
-		nodeList = append(nodeList, hypervisorNode)
-		nodeId++
-		bridgeList := ovsGetBridges(hypervisor.HostIP)
-		var ovsBridgeNodeSetIdList []int
-		for _, bridge := range bridgeList {
-			if len(unfiltered) == 0 {
-				if bridge.Name == "br-tun" || bridge.Name == "br-ex" {
-					continue
-				}
-			}
-			bridgeNodeProps := make(map[string]interface{})
-			bridgeNodeProps["uuid"] = bridge.UUID
-			bridgeNodeProps["name"] = bridge.Name
-			bridgeNodeProps["hypervisor_ip"] = hypervisor.HostIP
-			bridgeNodeId := nodeId
-			bridgeNode := TopologyNode{
-				ID:         bridgeNodeId,
-				Name:       bridge.Name,
-				DeviceType: "switch",
-				//X:          (-100 + (-300 * j)),
-				//Y:          (-600 + (300 * j)),
-				Color: "#00FF00",
-				Props: bridgeNodeProps,
-			}
-			nodeList = append(nodeList, bridgeNode)
-			if len(expanded) == 0 {
-				ovsBridgeNodeSetIdList = append(ovsBridgeNodeSetIdList, bridgeNodeId)
-			}
-			nodeId++
-		}
-		if len(ovsBridgeNodeSetIdList) > 0 {
-			nodeSetProps := make(map[string]interface{})
-			nodeSet := TopologyNodeSet{
-				ID:    nodeId,
-				Nodes: ovsBridgeNodeSetIdList,
-				Name:  "ovs-bridge-group",
-				//Root:       instanceNodeId,
-				DeviceType: "switch",
-				X:          -100,
-				Y:          0,
-				Color:      "#00FF00",
-				Props:      nodeSetProps,
-			}
-			bridgeNodeSetIdList = append(bridgeNodeSetIdList, nodeId)
-			nodeSetList = append(nodeSetList, nodeSet)
-			nodeId++
-		}
-		bridgeConnections := ovsGetBridgeConnections(hypervisor.HostIP)
-		for _, bc := range bridgeConnections {
-			var sourceBridgeId int
-			var targetBridgeId int
-			var sourceBridgeName string
-			var targetBridgeName string
-			bridgeLinkProps := make(map[string]interface{})
-			if len(unfiltered) == 0 {
-				if bc.SourceBridge.Name == "br-tun" || bc.TargetBridge.Name == "br-tun" {
-					continue
-				}
-			}
-			for _, node := range nodeList {
-				hypervisorIP, ok := node.Props["hypervisor_ip"].(string)
-				if !ok {
-					continue
-				}
-				if bc.HostIP == hypervisorIP && bc.SourceBridge.Name == node.Name {
-					sourceBridgeId = node.ID
-					sourceBridgeName = node.Name
-					break
-				}
-			}
-			for _, node := range nodeList {
-				hypervisorIP, ok := node.Props["hypervisor_ip"].(string)
-				if !ok {
-					continue
-				}
-				if bc.HostIP == hypervisorIP && bc.TargetBridge.Name == node.Name {
-					targetBridgeId = node.ID
-					targetBridgeName = node.Name
-					break
-				}
-			}
-			bridgeLinkProps["source_name"] = sourceBridgeName
-			bridgeLinkProps["target_name"] = targetBridgeName
-			bridgeLinkProps["source_interface"] = bc.SourceInterface.Name
-			bridgeLinkProps["target_interface"] = bc.TargetInterface.Name
-			bridgeLinkProps["source_interface_type"] = bc.SourceInterface.Type
-			bridgeLinkProps["target_interface_type"] = bc.TargetInterface.Type
-			bridgeLinkProps["source_port"] = bc.SourcePort.Name
-			bridgeLinkProps["target_port"] = bc.TargetPort.Name
-
-			bridgeLink := TopologyLink{
-				Name:   "",
-				Source: sourceBridgeId,
-				Target: targetBridgeId,
-				Color:  "#00FF00",
-				Props:  bridgeLinkProps,
-			}
-			linkList = append(linkList, bridgeLink)
-			linkId++
-		}
-		instanceList := libvirtGetDomainInstances(hypervisor.HostIP)
-		var instanceNodeSetIdList []int
-		for _, instance := range instanceList {
-			iFound := false
-			for _, instanceName := range hi.InstanceNames {
-				if instance.InstanceName == instanceName {
-					iFound = true
-					break
-				}
-			}
-			if !iFound {
-				continue
-			}
-			instanceNodeProps := make(map[string]interface{})
-			instanceNodeProps["uuid"] = instance.UUID
-			instanceNodeProps["name"] = instance.Name
-			instanceNodeProps["hypervisor name"] = instance.HypervisorName
-			instanceNodeViews := make(map[string]string)
-			instanceNodeId := nodeId
-			instanceNode := TopologyNode{
-				ID:         instanceNodeId,
-				Name:       instance.InstanceName,
-				DeviceType: "server",
-				//X:          300,
-				//Y:          0,
-				Color: "#0000FF",
-				Props: instanceNodeProps,
-				Views: instanceNodeViews,
-			}
-			nodeList = append(nodeList, instanceNode)
-			nodeId++
-			instanceLinkProps := make(map[string]interface{})
-			instanceLinkProps["source_name"] = hypervisorNode.Name
-			instanceLinkProps["target_name"] = instanceNode.Name
-			hypervisorLink := TopologyLink{
-				Name:   "",
-				Source: hypervisorNodeId,
-				Target: instanceNodeId,
-				Color:  "#0000FF",
-				Props:  instanceLinkProps,
-			}
-			linkList = append(linkList, hypervisorLink)
-			linkId++
-			var linuxBridgeNodeSetIdList []int
-			for _, iface := range instance.Interfaces {
-				bridgeNodeProps := make(map[string]interface{})
-				bridgeNodeProps["tap"] = iface.DevName
-				bridgeNodeProps["mac_address"] = iface.MacAddress
-				bridgeNodeProps["network_name"] = iface.NetworkName
-				bridgeNodeId := nodeId
-				bridgeNode := TopologyNode{
-					ID:         bridgeNodeId,
-					Name:       iface.BridgeName,
-					DeviceType: "switch",
-					//X:          700,
-					//Y:          (-500 + (5 * k)),
-					Color: "#FF00FF",
-					Props: bridgeNodeProps,
-				}
-				nodeList = append(nodeList, bridgeNode)
-				if len(expanded) == 0 {
-					linuxBridgeNodeSetIdList = append(linuxBridgeNodeSetIdList, bridgeNodeId)
-				}
-				bridgeLinkProps := make(map[string]interface{})
-				bridgeLinkProps["source_name"] = instanceNode.Name
-				bridgeLinkProps["target_name"] = bridgeNode.Name
-				bridgeLinkProps["interface_type"] = iface.Type
-				bridgeLink := TopologyLink{
-					Name:   "",
-					Source: instanceNodeId,
-					Target: bridgeNodeId,
-					Color:  "#0000FF",
-					Props:  bridgeLinkProps,
-				}
-				linkList = append(linkList, bridgeLink)
-				nodeId++
-				linkId++
-				bc := ovsGetBridgeConnection(hypervisor.HostIP, iface.MacAddress)
-				if bc != nil {
-					var targetBridgeId int
-					var targetBridgeName string
-					ovsBridgeLinkProps := make(map[string]interface{})
-					ovsBridgeLinkProps["source_name"] = bridgeNode.Name
-					ovsBridgeLinkProps["target_interface"] = bc.TargetInterface.Name
-					ovsBridgeLinkProps["target_interface_type"] = bc.TargetInterface.Type
-					ovsBridgeLinkProps["target_port"] = bc.TargetPort.Name
-					for _, node := range nodeList {
-						hypervisorIP, ok := node.Props["hypervisor_ip"].(string)
-						if !ok {
-							continue
-						}
-						if bc.HostIP == hypervisorIP && bc.TargetBridge.Name == node.Name {
-							targetBridgeId = node.ID
-							targetBridgeName = node.Name
-							break
-						}
-					}
-					ovsBridgeLinkProps["target_name"] = targetBridgeName
-					ovsBridgeLink := TopologyLink{
-						Name:   "",
-						Source: bridgeNodeId,
-						Target: targetBridgeId,
-						Color:  "#FF00FF",
-						Props:  ovsBridgeLinkProps,
-					}
-					linkList = append(linkList, ovsBridgeLink)
-					linkId++
-				}
-
-			}
-			if len(linuxBridgeNodeSetIdList) > 0 {
-				nodeSetProps := make(map[string]interface{})
-				nodeSet := TopologyNodeSet{
-					ID:         nodeId,
-					Nodes:      linuxBridgeNodeSetIdList,
-					Name:       "linux-bridge-group",
-					Root:       instanceNodeId,
-					DeviceType: "switch",
-					X:          200,
-					Y:          0,
-					Color:      "#FF00FF",
-					Props:      nodeSetProps,
-				}
-				bridgeNodeSetIdList = append(bridgeNodeSetIdList, nodeId)
-				nodeSetList = append(nodeSetList, nodeSet)
-				nodeId++
-			}
-		}
-		interfaces := libvirtGetPhysicalInterfaces(hypervisor.HostIP)
-		for _, iface := range interfaces {
-			bc := ovsGetPhysicalPortConnection(hypervisor.HostIP, iface.Name, iface.MacAddress)
-			var sourceBridgeId int
-			var sourceBridgeName string
-			if bc != nil {
-				bridgeFound := false
-				for _, node := range nodeList {
-					hypervisorIP, ok := node.Props["hypervisor_ip"].(string)
-					if !ok {
-						continue
-					}
-					if bc.HostIP == hypervisorIP && bc.SourceBridge.Name == node.Name {
-						sourceBridgeId = node.ID
-						sourceBridgeName = node.Name
-						bridgeFound = true
-						break
-					}
-				}
-				if !bridgeFound {
-					continue
-				}
-
-				portNodeProps := make(map[string]interface{})
-				portNodeProps["mac_address"] = iface.MacAddress
-				portNodeId := nodeId
-				portNode := TopologyNode{
-					ID:         portNodeId,
-					Name:       iface.Name,
-					DeviceType: "port",
-					//X:          700,
-					//Y:          (-500 + (5 * k)),
-					Color: "#000000",
-					Props: portNodeProps,
-				}
-				nodeList = append(nodeList, portNode)
-				ovsBridgeLinkProps := make(map[string]interface{})
-				ovsBridgeLinkProps["source_interface"] = bc.SourceInterface.Name
-				ovsBridgeLinkProps["source_interface_type"] = bc.SourceInterface.Type
-				ovsBridgeLinkProps["source_port"] = bc.SourcePort.Name
-				ovsBridgeLinkProps["target_name"] = iface.Name
-				ovsBridgeLinkProps["source_name"] = sourceBridgeName
-				ovsBridgeLink := TopologyLink{
-					Name:   "",
-					Source: sourceBridgeId,
-					Target: portNodeId,
-					Color:  "#000000",
-					Props:  ovsBridgeLinkProps,
-				}
-				linkList = append(linkList, ovsBridgeLink)
-				nodeId++
-				linkId++
-			}
-		}
-		if len(instanceNodeSetIdList) > 0 {
-			nodeSetProps := make(map[string]interface{})
-			nodeSet := TopologyNodeSet{
-				ID:         nodeId,
-				Nodes:      instanceNodeSetIdList,
-				Name:       "instance-group",
-				Root:       0,
-				DeviceType: "groups",
-				//X:          500,
-				//Y:          200,
-				Color: "#0000FF",
-				Props: nodeSetProps,
-			}
-			nodeSetList = append(nodeSetList, nodeSet)
-			nodeId++
-		}
-	}
-
-	if len(bridgeNodeSetIdList) > 0 {
-		nodeSetProps := make(map[string]interface{})
-		nodeSet := TopologyNodeSet{
-			ID:    nodeId,
-			Nodes: bridgeNodeSetIdList,
-			Name:  "bridge-group",
-			//Root:       instanceNodeId,
-			DeviceType: "switch",
-			X:          0,
-			Y:          0,
-			Color:      "#0000FF",
-			Props:      nodeSetProps,
-		}
-		nodeSetList = append(nodeSetList, nodeSet)
-		nodeId++
-	}
-
-	groupList := make([]TopologyGroup, 0)
-
-	viewList := make(map[string]string)
-
-	cloudTopologyData := TopologyData{
-		Title:    topologyTitle,
-		Nodes:    nodeList,
-		Links:    linkList,
-		NodeSets: nodeSetList,
-		Groups:   groupList,
-		Views:    viewList,
-	}
-
-	luddite.WriteResponse(rw, http.StatusOK, cloudTopologyData)
-}
-
-func CloudHypervisorsCollapsedUnfilteredOvsNetworkTopology(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
-	cloudName := httprouter.ContextParams(ctx).ByName("cloud_name")
-	cloudInfo := cloudGetCloudInfo(cloudName)
-	if cloudInfo == nil {
-		apiError := APIError{http.StatusNotFound, "Cloud " + cloudName + " Not discovered"}
-		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
-		return
-	}
-/*
-	hi1 := HypervisorInstanceNames{
-		HostName: "sjc-ml-os-comp1.ad.spirentcom.com",
-		InstanceNames: []string{"STCv-1", "STCv-2", "STCv Test-2"},
-	}
-	hi2 := HypervisorInstanceNames{
-		HostName: "sjc-ml-os-comp3.ad.spirentcom.com",
-		InstanceNames: []string{"STCv Test-1", "TEMEVA-OnPrem-Controller-LD-v794"},
-	}
-	his := HypervisorInstances{[]HypervisorInstanceNames{hi1, hi2}}
-*/
-	hi1 := HypervisorInstanceNames{
-		HostName: "compute-node.spirent.com",
-		InstanceNames: []string{"vRouter1"},
-	}
-	his := HypervisorInstances{[]HypervisorInstanceNames{hi1}}
-
-	for _,hi := range his.HypervisorInstances {
-		hypervisorInfo := cloudGetHypervisorInfoByHostName(cloudName, hi.HostName)
-		if hypervisorInfo == nil {
-			apiError := APIError{http.StatusNotFound, "Hypervisor " + hi.HostName + " for cloud "+ cloudName + " Not discovered"}
-			luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
-			return
-		}
-		for _, instanceName := range hi.InstanceNames {
-			instanceInfo := cloudGetInstanceInfoForHypervisorByHostName(cloudName, hi.HostName, instanceName)
-			if instanceInfo == nil {
-				apiError := APIError{http.StatusNotFound, "Instance " + instanceName + " for hypervisor " + hi.HostName + " and cloud "+ cloudName + " Not discovered"}
-				luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
-				return
-			}
-		}
-	}
-
-	expanded := ""
-	unfiltered := "true"
-
-	topologyTitle := cloudInfo.Name + " Collapsed Unfiltered VNF OVS Network Topology"
-
-	var nodeList []TopologyNode
-	var linkList []TopologyLink
-	var nodeSetList []TopologyNodeSet
-	var bridgeNodeSetIdList []int
-	nodeId := 0
-	linkId := 0
-
-	for _, hi := range his.HypervisorInstances {
-		hypervisor := cloudGetHypervisorInfoByHostName(cloudName, hi.HostName)
-		hypervisorNodeProps := make(map[string]interface{})
-		hypervisorNodeProps["id"] = hypervisor.ID
-		hypervisorNodeProps["host_name"] = hypervisor.HostName
-		hypervisorNodeProps["ip_address"] = hypervisor.HostIP
-		hypervisorNodeProps["state"] = hypervisor.State
-		hypervisorNodeColor := "#9C27B0"
-		if hypervisor.State == "down" {
-			hypervisorNodeColor = "#FF0000"
-		}
-		hypervisorNodeViews := make(map[string]string)
-		hypervisorNodeId := nodeId
-		hypervisorNode := TopologyNode{
-			ID:         hypervisorNodeId,
-			Name:       hypervisor.Name,
-			DeviceType: "host",
-			//X:          -200,
-			//Y:          0,
-			Color: hypervisorNodeColor,
-			Props: hypervisorNodeProps,
-			Views: hypervisorNodeViews,
-		}
-		nodeList = append(nodeList, hypervisorNode)
-		nodeId++
-		bridgeList := ovsGetBridges(hypervisor.HostIP)
-		var ovsBridgeNodeSetIdList []int
-		for _, bridge := range bridgeList {
-			if len(unfiltered) == 0 {
-				if bridge.Name == "br-tun" || bridge.Name == "br-ex" {
-					continue
-				}
-			}
-			bridgeNodeProps := make(map[string]interface{})
-			bridgeNodeProps["uuid"] = bridge.UUID
-			bridgeNodeProps["name"] = bridge.Name
-			bridgeNodeProps["hypervisor_ip"] = hypervisor.HostIP
-			bridgeNodeId := nodeId
-			bridgeNode := TopologyNode{
-				ID:         bridgeNodeId,
-				Name:       bridge.Name,
-				DeviceType: "switch",
-				//X:          (-100 + (-300 * j)),
-				//Y:          (-600 + (300 * j)),
-				Color: "#00FF00",
-				Props: bridgeNodeProps,
-			}
-			nodeList = append(nodeList, bridgeNode)
-			if len(expanded) == 0 {
-				ovsBridgeNodeSetIdList = append(ovsBridgeNodeSetIdList, bridgeNodeId)
-			}
-			nodeId++
-		}
-		if len(ovsBridgeNodeSetIdList) > 0 {
-			nodeSetProps := make(map[string]interface{})
-			nodeSet := TopologyNodeSet{
-				ID:    nodeId,
-				Nodes: ovsBridgeNodeSetIdList,
-				Name:  "ovs-bridge-group",
-				//Root:       instanceNodeId,
-				DeviceType: "switch",
-				X:          -100,
-				Y:          0,
-				Color:      "#00FF00",
-				Props:      nodeSetProps,
-			}
-			bridgeNodeSetIdList = append(bridgeNodeSetIdList, nodeId)
-			nodeSetList = append(nodeSetList, nodeSet)
-			nodeId++
-		}
-		bridgeConnections := ovsGetBridgeConnections(hypervisor.HostIP)
-		for _, bc := range bridgeConnections {
-			var sourceBridgeId int
-			var targetBridgeId int
-			var sourceBridgeName string
-			var targetBridgeName string
-			bridgeLinkProps := make(map[string]interface{})
-			if len(unfiltered) == 0 {
-				if bc.SourceBridge.Name == "br-tun" || bc.TargetBridge.Name == "br-tun" {
-					continue
-				}
-			}
-			for _, node := range nodeList {
-				hypervisorIP, ok := node.Props["hypervisor_ip"].(string)
-				if !ok {
-					continue
-				}
-				if bc.HostIP == hypervisorIP && bc.SourceBridge.Name == node.Name {
-					sourceBridgeId = node.ID
-					sourceBridgeName = node.Name
-					break
-				}
-			}
-			for _, node := range nodeList {
-				hypervisorIP, ok := node.Props["hypervisor_ip"].(string)
-				if !ok {
-					continue
-				}
-				if bc.HostIP == hypervisorIP && bc.TargetBridge.Name == node.Name {
-					targetBridgeId = node.ID
-					targetBridgeName = node.Name
-					break
-				}
-			}
-			bridgeLinkProps["source_name"] = sourceBridgeName
-			bridgeLinkProps["target_name"] = targetBridgeName
-			bridgeLinkProps["source_interface"] = bc.SourceInterface.Name
-			bridgeLinkProps["target_interface"] = bc.TargetInterface.Name
-			bridgeLinkProps["source_interface_type"] = bc.SourceInterface.Type
-			bridgeLinkProps["target_interface_type"] = bc.TargetInterface.Type
-			bridgeLinkProps["source_port"] = bc.SourcePort.Name
-			bridgeLinkProps["target_port"] = bc.TargetPort.Name
-
-			bridgeLink := TopologyLink{
-				Name:   "",
-				Source: sourceBridgeId,
-				Target: targetBridgeId,
-				Color:  "#00FF00",
-				Props:  bridgeLinkProps,
-			}
-			linkList = append(linkList, bridgeLink)
-			linkId++
-		}
-		instanceList := libvirtGetDomainInstances(hypervisor.HostIP)
-		var instanceNodeSetIdList []int
-		for _, instance := range instanceList {
-			iFound := false
-			for _, instanceName := range hi.InstanceNames {
-				if instance.InstanceName == instanceName {
-					iFound = true
-					break
-				}
-			}
-			if !iFound {
-				continue
-			}
-			instanceNodeProps := make(map[string]interface{})
-			instanceNodeProps["uuid"] = instance.UUID
-			instanceNodeProps["name"] = instance.Name
-			instanceNodeProps["hypervisor name"] = instance.HypervisorName
-			instanceNodeViews := make(map[string]string)
-			instanceNodeId := nodeId
-			instanceNode := TopologyNode{
-				ID:         instanceNodeId,
-				Name:       instance.InstanceName,
-				DeviceType: "server",
-				//X:          300,
-				//Y:          0,
-				Color: "#0000FF",
-				Props: instanceNodeProps,
-				Views: instanceNodeViews,
-			}
-			nodeList = append(nodeList, instanceNode)
-			nodeId++
-			instanceLinkProps := make(map[string]interface{})
-			instanceLinkProps["source_name"] = hypervisorNode.Name
-			instanceLinkProps["target_name"] = instanceNode.Name
-			hypervisorLink := TopologyLink{
-				Name:   "",
-				Source: hypervisorNodeId,
-				Target: instanceNodeId,
-				Color:  "#0000FF",
-				Props:  instanceLinkProps,
-			}
-			linkList = append(linkList, hypervisorLink)
-			linkId++
-			var linuxBridgeNodeSetIdList []int
-			for _, iface := range instance.Interfaces {
-				bridgeNodeProps := make(map[string]interface{})
-				bridgeNodeProps["tap"] = iface.DevName
-				bridgeNodeProps["mac_address"] = iface.MacAddress
-				bridgeNodeProps["network_name"] = iface.NetworkName
-				bridgeNodeId := nodeId
-				bridgeNode := TopologyNode{
-					ID:         bridgeNodeId,
-					Name:       iface.BridgeName,
-					DeviceType: "switch",
-					//X:          700,
-					//Y:          (-500 + (5 * k)),
-					Color: "#FF00FF",
-					Props: bridgeNodeProps,
-				}
-				nodeList = append(nodeList, bridgeNode)
-				if len(expanded) == 0 {
-					linuxBridgeNodeSetIdList = append(linuxBridgeNodeSetIdList, bridgeNodeId)
-				}
-				bridgeLinkProps := make(map[string]interface{})
-				bridgeLinkProps["source_name"] = instanceNode.Name
-				bridgeLinkProps["target_name"] = bridgeNode.Name
-				bridgeLinkProps["interface_type"] = iface.Type
-				bridgeLink := TopologyLink{
-					Name:   "",
-					Source: instanceNodeId,
-					Target: bridgeNodeId,
-					Color:  "#0000FF",
-					Props:  bridgeLinkProps,
-				}
-				linkList = append(linkList, bridgeLink)
-				nodeId++
-				linkId++
-				bc := ovsGetBridgeConnection(hypervisor.HostIP, iface.MacAddress)
-				if bc != nil {
-					var targetBridgeId int
-					var targetBridgeName string
-					ovsBridgeLinkProps := make(map[string]interface{})
-					ovsBridgeLinkProps["source_name"] = bridgeNode.Name
-					ovsBridgeLinkProps["target_interface"] = bc.TargetInterface.Name
-					ovsBridgeLinkProps["target_interface_type"] = bc.TargetInterface.Type
-					ovsBridgeLinkProps["target_port"] = bc.TargetPort.Name
-					for _, node := range nodeList {
-						hypervisorIP, ok := node.Props["hypervisor_ip"].(string)
-						if !ok {
-							continue
-						}
-						if bc.HostIP == hypervisorIP && bc.TargetBridge.Name == node.Name {
-							targetBridgeId = node.ID
-							targetBridgeName = node.Name
-							break
-						}
-					}
-					ovsBridgeLinkProps["target_name"] = targetBridgeName
-					ovsBridgeLink := TopologyLink{
-						Name:   "",
-						Source: bridgeNodeId,
-						Target: targetBridgeId,
-						Color:  "#FF00FF",
-						Props:  ovsBridgeLinkProps,
-					}
-					linkList = append(linkList, ovsBridgeLink)
-					linkId++
-				}
-
-			}
-			if len(linuxBridgeNodeSetIdList) > 0 {
-				nodeSetProps := make(map[string]interface{})
-				nodeSet := TopologyNodeSet{
-					ID:         nodeId,
-					Nodes:      linuxBridgeNodeSetIdList,
-					Name:       "linux-bridge-group",
-					Root:       instanceNodeId,
-					DeviceType: "switch",
-					X:          200,
-					Y:          0,
-					Color:      "#FF00FF",
-					Props:      nodeSetProps,
-				}
-				bridgeNodeSetIdList = append(bridgeNodeSetIdList, nodeId)
-				nodeSetList = append(nodeSetList, nodeSet)
-				nodeId++
-			}
-		}
-		interfaces := libvirtGetPhysicalInterfaces(hypervisor.HostIP)
-		for _, iface := range interfaces {
-			bc := ovsGetPhysicalPortConnection(hypervisor.HostIP, iface.Name, iface.MacAddress)
-			var sourceBridgeId int
-			var sourceBridgeName string
-			if bc != nil {
-				bridgeFound := false
-				for _, node := range nodeList {
-					hypervisorIP, ok := node.Props["hypervisor_ip"].(string)
-					if !ok {
-						continue
-					}
-					if bc.HostIP == hypervisorIP && bc.SourceBridge.Name == node.Name {
-						sourceBridgeId = node.ID
-						sourceBridgeName = node.Name
-						bridgeFound = true
-						break
-					}
-				}
-				if !bridgeFound {
-					continue
-				}
-
-				portNodeProps := make(map[string]interface{})
-				portNodeProps["mac_address"] = iface.MacAddress
-				portNodeId := nodeId
-				portNode := TopologyNode{
-					ID:         portNodeId,
-					Name:       iface.Name,
-					DeviceType: "port",
-					//X:          700,
-					//Y:          (-500 + (5 * k)),
-					Color: "#000000",
-					Props: portNodeProps,
-				}
-				nodeList = append(nodeList, portNode)
-				ovsBridgeLinkProps := make(map[string]interface{})
-				ovsBridgeLinkProps["source_interface"] = bc.SourceInterface.Name
-				ovsBridgeLinkProps["source_interface_type"] = bc.SourceInterface.Type
-				ovsBridgeLinkProps["source_port"] = bc.SourcePort.Name
-				ovsBridgeLinkProps["target_name"] = iface.Name
-				ovsBridgeLinkProps["source_name"] = sourceBridgeName
-				ovsBridgeLink := TopologyLink{
-					Name:   "",
-					Source: sourceBridgeId,
-					Target: portNodeId,
-					Color:  "#000000",
-					Props:  ovsBridgeLinkProps,
-				}
-				linkList = append(linkList, ovsBridgeLink)
-				nodeId++
-				linkId++
-			}
-		}
-		if len(instanceNodeSetIdList) > 0 {
-			nodeSetProps := make(map[string]interface{})
-			nodeSet := TopologyNodeSet{
-				ID:         nodeId,
-				Nodes:      instanceNodeSetIdList,
-				Name:       "instance-group",
-				Root:       0,
-				DeviceType: "groups",
-				//X:          500,
-				//Y:          200,
-				Color: "#0000FF",
-				Props: nodeSetProps,
-			}
-			nodeSetList = append(nodeSetList, nodeSet)
-			nodeId++
-		}
-	}
-
-	if len(bridgeNodeSetIdList) > 0 {
-		nodeSetProps := make(map[string]interface{})
-		nodeSet := TopologyNodeSet{
-			ID:    nodeId,
-			Nodes: bridgeNodeSetIdList,
-			Name:  "bridge-group",
-			//Root:       instanceNodeId,
-			DeviceType: "switch",
-			X:          0,
-			Y:          0,
-			Color:      "#0000FF",
-			Props:      nodeSetProps,
-		}
-		nodeSetList = append(nodeSetList, nodeSet)
-		nodeId++
-	}
-
-	groupList := make([]TopologyGroup, 0)
-
-	viewList := make(map[string]string)
-
-	cloudTopologyData := TopologyData{
-		Title:    topologyTitle,
-		Nodes:    nodeList,
-		Links:    linkList,
-		NodeSets: nodeSetList,
-		Groups:   groupList,
-		Views:    viewList,
-	}
-
-	luddite.WriteResponse(rw, http.StatusOK, cloudTopologyData)
-}
-
-func CloudHypervisorsExpandedUnfilteredOvsNetworkTopology(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
-	cloudName := httprouter.ContextParams(ctx).ByName("cloud_name")
-	cloudInfo := cloudGetCloudInfo(cloudName)
-	if cloudInfo == nil {
-		apiError := APIError{http.StatusNotFound, "Cloud " + cloudName + " Not discovered"}
-		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
-		return
-	}
-/*
-	hi1 := HypervisorInstanceNames{
-		HostName: "sjc-ml-os-comp1.ad.spirentcom.com",
-		InstanceNames: []string{"STCv-1", "STCv-2", "STCv Test-2"},
-	}
-	hi2 := HypervisorInstanceNames{
-		HostName: "sjc-ml-os-comp3.ad.spirentcom.com",
-		InstanceNames: []string{"STCv Test-1", "TEMEVA-OnPrem-Controller-LD-v794"},
-	}
-	his := HypervisorInstances{[]HypervisorInstanceNames{hi1, hi2}}
-*/
-	hi1 := HypervisorInstanceNames{
-		HostName: "compute-node.spirent.com",
-		InstanceNames: []string{"vRouter1"},
-	}
-	his := HypervisorInstances{[]HypervisorInstanceNames{hi1}}
-
-	for _,hi := range his.HypervisorInstances {
-		hypervisorInfo := cloudGetHypervisorInfoByHostName(cloudName, hi.HostName)
-		if hypervisorInfo == nil {
-			apiError := APIError{http.StatusNotFound, "Hypervisor " + hi.HostName + " for cloud "+ cloudName + " Not discovered"}
-			luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
-			return
-		}
-		for _, instanceName := range hi.InstanceNames {
-			instanceInfo := cloudGetInstanceInfoForHypervisorByHostName(cloudName, hi.HostName, instanceName)
-			if instanceInfo == nil {
-				apiError := APIError{http.StatusNotFound, "Instance " + instanceName + " for hypervisor " + hi.HostName + " and cloud "+ cloudName + " Not discovered"}
-				luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
-				return
-			}
-		}
-	}
-
-	expanded := "true"
-	unfiltered := "true"
-
-	topologyTitle := cloudInfo.Name + " Expanded Unfiltered VNF OVS Network Topology"
-
-	var nodeList []TopologyNode
-	var linkList []TopologyLink
-	var nodeSetList []TopologyNodeSet
-	var bridgeNodeSetIdList []int
-	nodeId := 0
-	linkId := 0
-
-	for _, hi := range his.HypervisorInstances {
-		hypervisor := cloudGetHypervisorInfoByHostName(cloudName, hi.HostName)
-		hypervisorNodeProps := make(map[string]interface{})
-		hypervisorNodeProps["id"] = hypervisor.ID
-		hypervisorNodeProps["host_name"] = hypervisor.HostName
-		hypervisorNodeProps["ip_address"] = hypervisor.HostIP
-		hypervisorNodeProps["state"] = hypervisor.State
-		hypervisorNodeColor := "#9C27B0"
-		if hypervisor.State == "down" {
-			hypervisorNodeColor = "#FF0000"
-		}
-		hypervisorNodeViews := make(map[string]string)
-		hypervisorNodeId := nodeId
-		hypervisorNode := TopologyNode{
-			ID:         hypervisorNodeId,
-			Name:       hypervisor.Name,
-			DeviceType: "host",
-			//X:          -200,
-			//Y:          0,
-			Color: hypervisorNodeColor,
-			Props: hypervisorNodeProps,
-			Views: hypervisorNodeViews,
-		}
-		nodeList = append(nodeList, hypervisorNode)
-		nodeId++
-		bridgeList := ovsGetBridges(hypervisor.HostIP)
-		var ovsBridgeNodeSetIdList []int
-		for _, bridge := range bridgeList {
-			if len(unfiltered) == 0 {
-				if bridge.Name == "br-tun" || bridge.Name == "br-ex" {
-					continue
-				}
-			}
-			bridgeNodeProps := make(map[string]interface{})
-			bridgeNodeProps["uuid"] = bridge.UUID
-			bridgeNodeProps["name"] = bridge.Name
-			bridgeNodeProps["hypervisor_ip"] = hypervisor.HostIP
-			bridgeNodeId := nodeId
-			bridgeNode := TopologyNode{
-				ID:         bridgeNodeId,
-				Name:       bridge.Name,
-				DeviceType: "switch",
-				//X:          (-100 + (-300 * j)),
-				//Y:          (-600 + (300 * j)),
-				Color: "#00FF00",
-				Props: bridgeNodeProps,
-			}
-			nodeList = append(nodeList, bridgeNode)
-			if len(expanded) == 0 {
-				ovsBridgeNodeSetIdList = append(ovsBridgeNodeSetIdList, bridgeNodeId)
-			}
-			nodeId++
-		}
-		if len(ovsBridgeNodeSetIdList) > 0 {
-			nodeSetProps := make(map[string]interface{})
-			nodeSet := TopologyNodeSet{
-				ID:    nodeId,
-				Nodes: ovsBridgeNodeSetIdList,
-				Name:  "ovs-bridge-group",
-				//Root:       instanceNodeId,
-				DeviceType: "switch",
-				X:          -100,
-				Y:          0,
-				Color:      "#00FF00",
-				Props:      nodeSetProps,
-			}
-			bridgeNodeSetIdList = append(bridgeNodeSetIdList, nodeId)
-			nodeSetList = append(nodeSetList, nodeSet)
-			nodeId++
-		}
-		bridgeConnections := ovsGetBridgeConnections(hypervisor.HostIP)
-		for _, bc := range bridgeConnections {
-			var sourceBridgeId int
-			var targetBridgeId int
-			var sourceBridgeName string
-			var targetBridgeName string
-			bridgeLinkProps := make(map[string]interface{})
-			if len(unfiltered) == 0 {
-				if bc.SourceBridge.Name == "br-tun" || bc.TargetBridge.Name == "br-tun" {
-					continue
-				}
-			}
-			for _, node := range nodeList {
-				hypervisorIP, ok := node.Props["hypervisor_ip"].(string)
-				if !ok {
-					continue
-				}
-				if bc.HostIP == hypervisorIP && bc.SourceBridge.Name == node.Name {
-					sourceBridgeId = node.ID
-					sourceBridgeName = node.Name
-					break
-				}
-			}
-			for _, node := range nodeList {
-				hypervisorIP, ok := node.Props["hypervisor_ip"].(string)
-				if !ok {
-					continue
-				}
-				if bc.HostIP == hypervisorIP && bc.TargetBridge.Name == node.Name {
-					targetBridgeId = node.ID
-					targetBridgeName = node.Name
-					break
-				}
-			}
-			bridgeLinkProps["source_name"] = sourceBridgeName
-			bridgeLinkProps["target_name"] = targetBridgeName
-			bridgeLinkProps["source_interface"] = bc.SourceInterface.Name
-			bridgeLinkProps["target_interface"] = bc.TargetInterface.Name
-			bridgeLinkProps["source_interface_type"] = bc.SourceInterface.Type
-			bridgeLinkProps["target_interface_type"] = bc.TargetInterface.Type
-			bridgeLinkProps["source_port"] = bc.SourcePort.Name
-			bridgeLinkProps["target_port"] = bc.TargetPort.Name
-
-			bridgeLink := TopologyLink{
-				Name:   "",
-				Source: sourceBridgeId,
-				Target: targetBridgeId,
-				Color:  "#00FF00",
-				Props:  bridgeLinkProps,
-			}
-			linkList = append(linkList, bridgeLink)
-			linkId++
-		}
-		instanceList := libvirtGetDomainInstances(hypervisor.HostIP)
-		var instanceNodeSetIdList []int
-		for _, instance := range instanceList {
-			iFound := false
-			for _, instanceName := range hi.InstanceNames {
-				if instance.InstanceName == instanceName {
-					iFound = true
-					break
-				}
-			}
-			if !iFound {
-				continue
-			}
-			instanceNodeProps := make(map[string]interface{})
-			instanceNodeProps["uuid"] = instance.UUID
-			instanceNodeProps["name"] = instance.Name
-			instanceNodeProps["hypervisor name"] = instance.HypervisorName
-			instanceNodeViews := make(map[string]string)
-			instanceNodeId := nodeId
-			instanceNode := TopologyNode{
-				ID:         instanceNodeId,
-				Name:       instance.InstanceName,
-				DeviceType: "server",
-				//X:          300,
-				//Y:          0,
-				Color: "#0000FF",
-				Props: instanceNodeProps,
-				Views: instanceNodeViews,
-			}
-			nodeList = append(nodeList, instanceNode)
-			nodeId++
-			instanceLinkProps := make(map[string]interface{})
-			instanceLinkProps["source_name"] = hypervisorNode.Name
-			instanceLinkProps["target_name"] = instanceNode.Name
-			hypervisorLink := TopologyLink{
-				Name:   "",
-				Source: hypervisorNodeId,
-				Target: instanceNodeId,
-				Color:  "#0000FF",
-				Props:  instanceLinkProps,
-			}
-			linkList = append(linkList, hypervisorLink)
-			linkId++
-			var linuxBridgeNodeSetIdList []int
-			for _, iface := range instance.Interfaces {
-				bridgeNodeProps := make(map[string]interface{})
-				bridgeNodeProps["tap"] = iface.DevName
-				bridgeNodeProps["mac_address"] = iface.MacAddress
-				bridgeNodeProps["network_name"] = iface.NetworkName
-				bridgeNodeId := nodeId
-				bridgeNode := TopologyNode{
-					ID:         bridgeNodeId,
-					Name:       iface.BridgeName,
-					DeviceType: "switch",
-					//X:          700,
-					//Y:          (-500 + (5 * k)),
-					Color: "#FF00FF",
-					Props: bridgeNodeProps,
-				}
-				nodeList = append(nodeList, bridgeNode)
-				if len(expanded) == 0 {
-					linuxBridgeNodeSetIdList = append(linuxBridgeNodeSetIdList, bridgeNodeId)
-				}
-				bridgeLinkProps := make(map[string]interface{})
-				bridgeLinkProps["source_name"] = instanceNode.Name
-				bridgeLinkProps["target_name"] = bridgeNode.Name
-				bridgeLinkProps["interface_type"] = iface.Type
-				bridgeLink := TopologyLink{
-					Name:   "",
-					Source: instanceNodeId,
-					Target: bridgeNodeId,
-					Color:  "#0000FF",
-					Props:  bridgeLinkProps,
-				}
-				linkList = append(linkList, bridgeLink)
-				nodeId++
-				linkId++
-				bc := ovsGetBridgeConnection(hypervisor.HostIP, iface.MacAddress)
-				if bc != nil {
-					var targetBridgeId int
-					var targetBridgeName string
-					ovsBridgeLinkProps := make(map[string]interface{})
-					ovsBridgeLinkProps["source_name"] = bridgeNode.Name
-					ovsBridgeLinkProps["target_interface"] = bc.TargetInterface.Name
-					ovsBridgeLinkProps["target_interface_type"] = bc.TargetInterface.Type
-					ovsBridgeLinkProps["target_port"] = bc.TargetPort.Name
-					for _, node := range nodeList {
-						hypervisorIP, ok := node.Props["hypervisor_ip"].(string)
-						if !ok {
-							continue
-						}
-						if bc.HostIP == hypervisorIP && bc.TargetBridge.Name == node.Name {
-							targetBridgeId = node.ID
-							targetBridgeName = node.Name
-							break
-						}
-					}
-					ovsBridgeLinkProps["target_name"] = targetBridgeName
-					ovsBridgeLink := TopologyLink{
-						Name:   "",
-						Source: bridgeNodeId,
-						Target: targetBridgeId,
-						Color:  "#FF00FF",
-						Props:  ovsBridgeLinkProps,
-					}
-					linkList = append(linkList, ovsBridgeLink)
-					linkId++
-				}
-
-			}
-			if len(linuxBridgeNodeSetIdList) > 0 {
-				nodeSetProps := make(map[string]interface{})
-				nodeSet := TopologyNodeSet{
-					ID:         nodeId,
-					Nodes:      linuxBridgeNodeSetIdList,
-					Name:       "linux-bridge-group",
-					Root:       instanceNodeId,
-					DeviceType: "switch",
-					X:          200,
-					Y:          0,
-					Color:      "#FF00FF",
-					Props:      nodeSetProps,
-				}
-				bridgeNodeSetIdList = append(bridgeNodeSetIdList, nodeId)
-				nodeSetList = append(nodeSetList, nodeSet)
-				nodeId++
-			}
-		}
-		interfaces := libvirtGetPhysicalInterfaces(hypervisor.HostIP)
-		for _, iface := range interfaces {
-			bc := ovsGetPhysicalPortConnection(hypervisor.HostIP, iface.Name, iface.MacAddress)
-			var sourceBridgeId int
-			var sourceBridgeName string
-			if bc != nil {
-				bridgeFound := false
-				for _, node := range nodeList {
-					hypervisorIP, ok := node.Props["hypervisor_ip"].(string)
-					if !ok {
-						continue
-					}
-					if bc.HostIP == hypervisorIP && bc.SourceBridge.Name == node.Name {
-						sourceBridgeId = node.ID
-						sourceBridgeName = node.Name
-						bridgeFound = true
-						break
-					}
-				}
-				if !bridgeFound {
-					continue
-				}
-
-				portNodeProps := make(map[string]interface{})
-				portNodeProps["mac_address"] = iface.MacAddress
-				portNodeId := nodeId
-				portNode := TopologyNode{
-					ID:         portNodeId,
-					Name:       iface.Name,
-					DeviceType: "port",
-					//X:          700,
-					//Y:          (-500 + (5 * k)),
-					Color: "#000000",
-					Props: portNodeProps,
-				}
-				nodeList = append(nodeList, portNode)
-				ovsBridgeLinkProps := make(map[string]interface{})
-				ovsBridgeLinkProps["source_interface"] = bc.SourceInterface.Name
-				ovsBridgeLinkProps["source_interface_type"] = bc.SourceInterface.Type
-				ovsBridgeLinkProps["source_port"] = bc.SourcePort.Name
-				ovsBridgeLinkProps["target_name"] = iface.Name
-				ovsBridgeLinkProps["source_name"] = sourceBridgeName
-				ovsBridgeLink := TopologyLink{
-					Name:   "",
-					Source: sourceBridgeId,
-					Target: portNodeId,
-					Color:  "#000000",
-					Props:  ovsBridgeLinkProps,
-				}
-				linkList = append(linkList, ovsBridgeLink)
-				nodeId++
-				linkId++
-			}
-		}
-		if len(instanceNodeSetIdList) > 0 {
-			nodeSetProps := make(map[string]interface{})
-			nodeSet := TopologyNodeSet{
-				ID:         nodeId,
-				Nodes:      instanceNodeSetIdList,
-				Name:       "instance-group",
-				Root:       0,
-				DeviceType: "groups",
-				//X:          500,
-				//Y:          200,
-				Color: "#0000FF",
-				Props: nodeSetProps,
-			}
-			nodeSetList = append(nodeSetList, nodeSet)
-			nodeId++
-		}
-	}
-
-	if len(bridgeNodeSetIdList) > 0 {
-		nodeSetProps := make(map[string]interface{})
-		nodeSet := TopologyNodeSet{
-			ID:    nodeId,
-			Nodes: bridgeNodeSetIdList,
-			Name:  "bridge-group",
-			//Root:       instanceNodeId,
-			DeviceType: "switch",
-			X:          0,
-			Y:          0,
-			Color:      "#0000FF",
-			Props:      nodeSetProps,
-		}
-		nodeSetList = append(nodeSetList, nodeSet)
-		nodeId++
-	}
-
-	groupList := make([]TopologyGroup, 0)
-
-	viewList := make(map[string]string)
-
-	cloudTopologyData := TopologyData{
-		Title:    topologyTitle,
-		Nodes:    nodeList,
-		Links:    linkList,
-		NodeSets: nodeSetList,
-		Groups:   groupList,
-		Views:    viewList,
-	}
-
-	luddite.WriteResponse(rw, http.StatusOK, cloudTopologyData)
-}
-
-func CloudHypervisorInstancesTopology(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
-
-	cloudName := httprouter.ContextParams(ctx).ByName("cloud_name")
-	hypervisorName := httprouter.ContextParams(ctx).ByName("hypervisor_name")
-	hypervisor := cloudGetHypervisorInfo(cloudName, hypervisorName)
-
-	topologyTitle := cloudName + " - " + hypervisorName + " VNF Hypervisor Instance Topology"
-
-	var nodeList []TopologyNode
-	var linkList []TopologyLink
-	var nodeSetList []TopologyNodeSet
-	nodeId := 0
-	linkId := 0
-
-	hypervisorNodeProps := make(map[string]interface{})
-	hypervisorNodeProps["id"] = hypervisor.ID
-	hypervisorNodeProps["host_name"] = hypervisor.HostName
-	hypervisorNodeProps["ip_address"] = hypervisor.HostIP
-	hypervisorNodeProps["state"] = hypervisor.State
-	hypervisorNodeColor := "#9C27B0"
-	if hypervisor.State == "down" {
-		hypervisorNodeColor = "#FF0000"
-	}
-	hypervisorNodeId := nodeId
-	hypervisorNode := TopologyNode{
-		ID:         hypervisorNodeId,
-		Name:       hypervisor.Name,
-		DeviceType: "host",
-		//X:          200,
-		//Y:          (200 + (5 * i)),
-		Color: hypervisorNodeColor,
-		Props: hypervisorNodeProps,
-	}
-	nodeList = append(nodeList, hypervisorNode)
-	nodeId++
-
-	instanceList := libvirtGetDomainInstances(hypervisor.HostIP)
-	var instanceNodeSetIdList []int
-	for _, instance := range instanceList {
-		instanceNodeProps := make(map[string]interface{})
-		instanceNodeProps["uuid"] = instance.UUID
-		instanceNodeProps["name"] = instance.Name
-		instanceNodeProps["hypervisor name"] = instance.HypervisorName
-		instanceNodeViews := make(map[string]string)
-		instanceNodeViews["Networks"] = "http://" + r.Host + "/topology/cloudInstanceLayer3NetworkTopology/" + cloudName + "/" + hypervisor.Name + "/" + instance.InstanceName
-		instanceNodeViews["Linux Bridges"] = "http://" + r.Host + "/topology/cloudInstanceLayer2NetworkTopology/" + cloudName + "/" + hypervisorName + "/" + instance.InstanceName
-		instanceNodeViews["OVS Bridges"] = "http://" + r.Host + "/topology/cloudInstanceOvsNetworkTopology/" + cloudName + "/" + hypervisorName + "/" + instance.InstanceName
-		instanceNode := TopologyNode{
-			ID:         nodeId,
-			Name:       instance.InstanceName,
-			DeviceType: "server",
-			//X:          300,
-			//Y:          (200 + (5 * j)),
-			Color: "#0000FF",
-			Props: instanceNodeProps,
-			Views: instanceNodeViews,
-		}
-		nodeList = append(nodeList, instanceNode)
-
-		instanceLinkProps := make(map[string]interface{})
-		instanceLinkProps["source_name"] = hypervisorNode.Name
-		instanceLinkProps["target_name"] = instanceNode.Name
-		instanceLink := TopologyLink{
-			Name:   "",
-			Source: hypervisorNodeId,
-			Target: nodeId,
-			Color:  "#0000FF",
-			Props:  instanceLinkProps,
-		}
-		linkList = append(linkList, instanceLink)
-		nodeId++
-		linkId++
-	}
-
-	nodeSetProps := make(map[string]interface{})
-	if len(instanceNodeSetIdList) > 1 {
-		nodeSet := TopologyNodeSet{
-			ID:         nodeId,
-			Nodes:      instanceNodeSetIdList,
-			Name:       "instance-group",
-			Root:       hypervisorNodeId,
-			DeviceType: "groups",
-			//X:          500,
-			//Y:          100,
-			Color: "#0000FF",
-			Props: nodeSetProps,
-		}
-		nodeSetList = append(nodeSetList, nodeSet)
-		nodeId++
-	}
-
-	groupList := make([]TopologyGroup, 0)
-
-	viewList := make(map[string]string, 2)
-	viewList["Instance Topology"] = "http://" + r.Host + "/topology/cloudHypervisorInstancesTopology/" + cloudName + "/" + hypervisorName
-	viewList["Linux Bridges"] = "http://" + r.Host + "/topology/cloudHypervisorLayer2NetworkTopology/" + cloudName + "/" + hypervisorName
-	viewList["OVS Bridges"] = "http://" + r.Host + "/topology/cloudHypervisorOvsNetworkTopology/" + cloudName + "/" + hypervisorName
-
-	cloudTopologyData := TopologyData{
-		Title:    topologyTitle,
-		Nodes:    nodeList,
-		Links:    linkList,
-		NodeSets: nodeSetList,
-		Groups:   groupList,
-		Views:    viewList,
-	}
-
-	luddite.WriteResponse(rw, http.StatusOK, cloudTopologyData)
+	cloudTopologyData := b.data(cloudName+" - "+hypervisorName+" VNF Hypervisor Instance Topology", b.hypervisorViews(hypervisorName))
+	topologyWrite(rw, r, cloudTopologyData)
 }
 
 func CloudHypervisorLayer2NetworkTopology(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
-
 	cloudName := httprouter.ContextParams(ctx).ByName("cloud_name")
 	hypervisorName := httprouter.ContextParams(ctx).ByName("hypervisor_name")
-	hypervisor := cloudGetHypervisorInfo(cloudName, hypervisorName)
-
-	topologyTitle := cloudName + " - " + hypervisorName + " VNF Layer-2 Network Topology"
-
-	var nodeList []TopologyNode
-	var linkList []TopologyLink
-	var nodeSetList []TopologyNodeSet
-	nodeId := 0
-	linkId := 0
-
-	hypervisorNodeProps := make(map[string]interface{})
-	hypervisorNodeProps["id"] = hypervisor.ID
-	hypervisorNodeProps["host_name"] = hypervisor.HostName
-	hypervisorNodeProps["ip_address"] = hypervisor.HostIP
-	hypervisorNodeProps["state"] = hypervisor.State
-	hypervisorNodeColor := "#9C27B0"
-	if hypervisor.State == "down" {
-		hypervisorNodeColor = "#FF0000"
-	}
-	hypervisorNodeId := nodeId
-	hypervisorNode := TopologyNode{
-		ID:         hypervisorNodeId,
-		Name:       hypervisor.Name,
-		DeviceType: "host",
-		//X:          200,
-		//Y:          (200 + (5 * i)),
-		Color: hypervisorNodeColor,
-		Props: hypervisorNodeProps,
-	}
-	nodeList = append(nodeList, hypervisorNode)
-	nodeId++
-	instanceList := libvirtGetDomainInstances(hypervisor.HostIP)
-	for _, instance := range instanceList {
-		instanceNodeProps := make(map[string]interface{})
-		instanceNodeProps["uuid"] = instance.UUID
-		instanceNodeProps["name"] = instance.Name
-		instanceNodeProps["hypervisor name"] = instance.HypervisorName
-		instanceNodeViews := make(map[string]string)
-		instanceNodeViews["Networks"] = "http://" + r.Host + "/topology/cloudInstanceLayer3NetworkTopology/" + cloudName + "/" + hypervisor.Name + "/" + instance.InstanceName
-		instanceNodeViews["Linux Bridges"] = "http://" + r.Host + "/topology/cloudInstanceLayer2NetworkTopology/" + cloudName + "/" + hypervisorName + "/" + instance.InstanceName
-		instanceNodeViews["OVS Bridges"] = "http://" + r.Host + "/topology/cloudInstanceOvsNetworkTopology/" + cloudName + "/" + hypervisorName + "/" + instance.InstanceName
-		instanceNodeId := nodeId
-		instanceNode := TopologyNode{
-			ID:         instanceNodeId,
-			Name:       instance.InstanceName,
-			DeviceType: "server",
-			//X:          300,
-			//Y:          (200 + (5 * j)),
-			Color: "#0000FF",
-			Props: instanceNodeProps,
-			Views: instanceNodeViews,
-		}
-		nodeList = append(nodeList, instanceNode)
-		//instanceNodeSetIdList = append(instanceNodeSetIdList, instanceNodeId)
-		instanceLinkProps := make(map[string]interface{})
-		instanceLinkProps["source_name"] = hypervisorNode.Name
-		instanceLinkProps["target_name"] = instanceNode.Name
-		hypervisorLink := TopologyLink{
-			Name:   "",
-			Source: hypervisorNodeId,
-			Target: instanceNodeId,
-			Color:  "#0000FF",
-			Props:  instanceLinkProps,
-		}
-		linkList = append(linkList, hypervisorLink)
-		nodeId++
-		linkId++
-		var bridgeNodeSetIdList []int
-		for _, iface := range instance.Interfaces {
-			bridgeNodeProps := make(map[string]interface{})
-			bridgeNodeProps["tap"] = iface.DevName
-			bridgeNodeProps["mac_address"] = iface.MacAddress
-			bridgeNodeProps["network_name"] = iface.NetworkName
-			bridgeNodeId := nodeId
-			bridgeNode := TopologyNode{
-				ID:         bridgeNodeId,
-				Name:       iface.BridgeName,
-				DeviceType: "switch",
-				//X:          200,
-				//Y:          (200 + (5 * k)),
-				Color: "#FF00FF",
-				Props: bridgeNodeProps,
-			}
-			nodeList = append(nodeList, bridgeNode)
-			//bridgeNodeSetIdList = append(bridgeNodeSetIdList, bridgeNodeId)
-			bridgeLinkProps := make(map[string]interface{})
-			bridgeLinkProps["source_name"] = instanceNode.Name
-			bridgeLinkProps["target_name"] = bridgeNode.Name
-			bridgeLinkProps["interface_type"] = iface.Type
-			for k, v := range iface.Statistics {
-				bridgeLinkProps[k] = v
-			}
-			bridgeLink := TopologyLink{
-				Name:   "",
-				Source: instanceNodeId,
-				Target: bridgeNodeId,
-				Color:  "#FF00FF",
-				Props:  bridgeLinkProps,
-			}
-			linkList = append(linkList, bridgeLink)
-			nodeId++
-			linkId++
-
-			network := cloudGetNetworkInfo(cloudName, iface.NetworkName)
-			if network != nil {
-				networkNodeId := -1
-				for _, node := range nodeList {
-					if node.Name == network.Name {
-						networkNodeId = node.ID
-						break
-					}
-				}
-
-				if networkNodeId == -1 {
-					networkNodeProps := make(map[string]interface{})
-					networkNodeProps["id"] = network.ID
-					networkNodeViews := make(map[string]string)
-					networkNodeId = nodeId
-					networkNode := TopologyNode{
-						ID:         networkNodeId,
-						Name:       network.Name,
-						DeviceType: "router",
-						//X:          400,
-						//Y:          (200 + (5 * i)),
-						Color: "#888888",
-						Props: networkNodeProps,
-						Views: networkNodeViews,
-					}
-					nodeList = append(nodeList, networkNode)
-					nodeId++
-				}
-				networkLinkProps := make(map[string]interface{})
-				networkLinkProps["source_name"] = bridgeNode.Name
-				networkLinkProps["target_name"] = network.Name
-				networkLink := TopologyLink{
-					Name:   "",
-					Source: bridgeNodeId,
-					Target: networkNodeId,
-					Color:  "#888888",
-					Props:  networkLinkProps,
-				}
-				linkList = append(linkList, networkLink)
-				linkId++
-			}
-		}
-		if len(bridgeNodeSetIdList) > 0 {
-			nodeSetProps := make(map[string]interface{})
-			nodeSet := TopologyNodeSet{
-				ID:         nodeId,
-				Nodes:      bridgeNodeSetIdList,
-				Name:       "bridge-group",
-				Root:       instanceNodeId,
-				DeviceType: "groups",
-				//X:          (200 + (100 * j)),
-				//Y:          400,
-				Color: "#0000FF",
-				Props: nodeSetProps,
-			}
-			nodeSetList = append(nodeSetList, nodeSet)
-			nodeId++
-		}
-	}
-
-	groupList := make([]TopologyGroup, 0)
-
-	viewList := make(map[string]string, 2)
-	viewList["Instance Topology"] = "http://" + r.Host + "/topology/cloudHypervisorInstancesTopology/" + cloudName + "/" + hypervisorName
-	viewList["Linux Bridges"] = "http://" + r.Host + "/topology/cloudHypervisorLayer2NetworkTopology/" + cloudName + "/" + hypervisorName
-	viewList["OVS Bridges"] = "http://" + r.Host + "/topology/cloudHypervisorOvsNetworkTopology/" + cloudName + "/" + hypervisorName
-
-	cloudTopologyData := TopologyData{
-		Title:    topologyTitle,
-		Nodes:    nodeList,
-		Links:    linkList,
-		NodeSets: nodeSetList,
-		Groups:   groupList,
-		Views:    viewList,
-	}
-
-	luddite.WriteResponse(rw, http.StatusOK, cloudTopologyData)
+	q := TopologyQuery{
+		Cloud:           cloudName,
+		Hypervisors:     []string{hypervisorName},
+		Layers:          []string{queryLayerLinuxBridge, queryLayerL3},
+		Title:           cloudName + " - " + hypervisorName + " VNF Layer-2 Network Topology",
+		vnicColor:       "#FF00FF",
+		hypervisorViews: queryViewNone,
+		networkViews:    queryViewEmpty,
+	}
+	queryWrite(rw, r, q, newTopologyBuilder(r, cloudName).hypervisorViews(hypervisorName))
 }
 
 func CloudHypervisorOvsNetworkTopology(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
 	cloudName := httprouter.ContextParams(ctx).ByName("cloud_name")
 	hypervisorName := httprouter.ContextParams(ctx).ByName("hypervisor_name")
-	hypervisor := cloudGetHypervisorInfo(cloudName, hypervisorName)
-
-	topologyTitle := cloudName + " - " + hypervisorName + " VNF OVS Network Topology"
-
-	var nodeList []TopologyNode
-	var linkList []TopologyLink
-	var nodeSetList []TopologyNodeSet
-	nodeId := 0
-	linkId := 0
-
-	hypervisorNodeProps := make(map[string]interface{})
-	hypervisorNodeProps["id"] = hypervisor.ID
-	hypervisorNodeProps["host_name"] = hypervisor.HostName
-	hypervisorNodeProps["ip_address"] = hypervisor.HostIP
-	hypervisorNodeProps["state"] = hypervisor.State
-	hypervisorNodeColor := "#9C27B0"
-	if hypervisor.State == "down" {
-		hypervisorNodeColor = "#FF0000"
-	}
-	hypervisorNodeId := nodeId
-	hypervisorNode := TopologyNode{
-		ID:         hypervisorNodeId,
-		Name:       hypervisor.Name,
-		DeviceType: "host",
-		//X:          200,
-		//Y:          (200 + (5 * i)),
-		Color: hypervisorNodeColor,
-		Props: hypervisorNodeProps,
-	}
-	nodeList = append(nodeList, hypervisorNode)
-	nodeId++
-
-	bridgeList := ovsGetBridges(hypervisor.HostIP)
-	for _, bridge := range bridgeList {
-		bridgeNodeProps := make(map[string]interface{})
-		bridgeNodeProps["uuid"] = bridge.UUID
-		bridgeNodeProps["name"] = bridge.Name
-		bridgeNodeId := nodeId
-		bridgeNode := TopologyNode{
-			ID:         bridgeNodeId,
-			Name:       bridge.Name,
-			DeviceType: "switch",
-			//X:          (-100 + (-300 * j)),
-			//Y:          (-600 + (300 * j)),
-			Color: "#00FF00",
-			Props: bridgeNodeProps,
-		}
-		nodeList = append(nodeList, bridgeNode)
-		nodeId++
-	}
-	bridgeConnections := ovsGetBridgeConnections(hypervisor.HostIP)
-	for _, bc := range bridgeConnections {
-		var sourceBridgeId int
-		var targetBridgeId int
-		var sourceBridgeName string
-		var targetBridgeName string
-		bridgeLinkProps := make(map[string]interface{})
-		for k, v := range bc.SourceInterface.Statistics {
-			bridgeLinkProps[k] = v
-		}
-		for _, node := range nodeList {
-			if bc.SourceBridge.Name == node.Name {
-				sourceBridgeId = node.ID
-				sourceBridgeName = node.Name
-				break
-			}
-		}
-		for _, node := range nodeList {
-			if bc.TargetBridge.Name == node.Name {
-				targetBridgeId = node.ID
-				targetBridgeName = node.Name
-				break
-			}
-		}
-		bridgeLinkProps["source_name"] = sourceBridgeName
-		bridgeLinkProps["target_name"] = targetBridgeName
-		bridgeLinkProps["source_interface"] = bc.SourceInterface.Name
-		bridgeLinkProps["target_interface"] = bc.TargetInterface.Name
-		bridgeLinkProps["source_interface_type"] = bc.SourceInterface.Type
-		bridgeLinkProps["target_interface_type"] = bc.TargetInterface.Type
-		bridgeLinkProps["source_port"] = bc.SourcePort.Name
-		bridgeLinkProps["target_port"] = bc.TargetPort.Name
-
-		bridgeLink := TopologyLink{
-			Name:   "",
-			Source: sourceBridgeId,
-			Target: targetBridgeId,
-			Color:  "#00FF00",
-			Props:  bridgeLinkProps,
-		}
-		linkList = append(linkList, bridgeLink)
-		linkId++
-	}
-	instanceList := libvirtGetDomainInstances(hypervisor.HostIP)
-	var instanceNodeSetIdList []int
-	for _, instance := range instanceList {
-		instanceNodeProps := make(map[string]interface{})
-		//instanceLinkProps := make(map[string]interface{})
-		instanceNodeProps["uuid"] = instance.UUID
-		instanceNodeProps["name"] = instance.Name
-		instanceNodeProps["hypervisor name"] = instance.HypervisorName
-		instanceNodeViews := make(map[string]string)
-		instanceNodeViews["Networks"] = "http://" + r.Host + "/topology/cloudInstanceLayer3NetworkTopology/" + cloudName + "/" + hypervisor.Name + "/" + instance.InstanceName
-		instanceNodeViews["Linux Bridges"] = "http://" + r.Host + "/topology/cloudInstanceLayer2NetworkTopology/" + cloudName + "/" + hypervisor.Name + "/" + instance.InstanceName
-		instanceNodeViews["OVS Bridges"] = "http://" + r.Host + "/topology/cloudInstanceOvsNetworkTopology/" + cloudName + "/" + hypervisor.Name + "/" + instance.InstanceName
-		instanceNodeId := nodeId
-		instanceNode := TopologyNode{
-			ID:         instanceNodeId,
-			Name:       instance.InstanceName,
-			DeviceType: "server",
-			//X:          800,
-			//Y:          (-200 + (5 * j)),
-			Color: "#0000FF",
-			Props: instanceNodeProps,
-			Views: instanceNodeViews,
-		}
-		nodeList = append(nodeList, instanceNode)
-		//instanceNodeSetIdList = append(instanceNodeSetIdList, instanceNodeId)
-		nodeId++
-		instanceLinkProps := make(map[string]interface{})
-		instanceLinkProps["source_name"] = hypervisorNode.Name
-		instanceLinkProps["target_name"] = instanceNode.Name
-		hypervisorLink := TopologyLink{
-			Name:   "",
-			Source: hypervisorNodeId,
-			Target: instanceNodeId,
-			Color:  "#0000FF",
-			Props:  instanceLinkProps,
-		}
-		linkList = append(linkList, hypervisorLink)
-		linkId++
-		var bridgeNodeSetIdList []int
-		for _, iface := range instance.Interfaces {
-			bridgeNodeProps := make(map[string]interface{})
-			bridgeNodeProps["tap"] = iface.DevName
-			bridgeNodeProps["mac_address"] = iface.MacAddress
-			bridgeNodeProps["network_name"] = iface.NetworkName
-			bridgeNodeId := nodeId
-			bridgeNode := TopologyNode{
-				ID:         bridgeNodeId,
-				Name:       iface.BridgeName,
-				DeviceType: "switch",
-				//X:          700,
-				//Y:          (-500 + (5 * k)),
-				Color: "#FF00FF",
-				Props: bridgeNodeProps,
-			}
-			nodeList = append(nodeList, bridgeNode)
-			//bridgeNodeSetIdList = append(bridgeNodeSetIdList, bridgeNodeId)
-			bridgeLinkProps := make(map[string]interface{})
-			bridgeLinkProps["source_name"] = instanceNode.Name
-			bridgeLinkProps["target_name"] = bridgeNode.Name
-			bridgeLinkProps["interface_type"] = iface.Type
-			for k, v := range iface.Statistics {
-				bridgeLinkProps[k] = v
-			}
-			bridgeLink := TopologyLink{
-				Name:   "",
-				Source: instanceNodeId,
-				Target: bridgeNodeId,
-				Color:  "#0000FF",
-				Props:  bridgeLinkProps,
-			}
-			linkList = append(linkList, bridgeLink)
-			nodeId++
-			linkId++
-			bc := ovsGetBridgeConnection(hypervisor.HostIP, iface.MacAddress)
-			if bc != nil {
-				var targetBridgeId int
-				var targetBridgeName string
-				ovsBridgeLinkProps := make(map[string]interface{})
-				ovsBridgeLinkProps["source_name"] = bridgeNode.Name
-				ovsBridgeLinkProps["target_interface"] = bc.TargetInterface.Name
-				ovsBridgeLinkProps["target_interface_type"] = bc.TargetInterface.Type
-				ovsBridgeLinkProps["target_port"] = bc.TargetPort.Name
-				for k, v := range bc.TargetInterface.Statistics {
-					ovsBridgeLinkProps[k] = v
-				}
-				for _, node := range nodeList {
-					if bc.TargetBridge.Name == node.Name {
-						targetBridgeId = node.ID
-						targetBridgeName = node.Name
-						break
-					}
-				}
-				ovsBridgeLinkProps["target_name"] = targetBridgeName
-				ovsBridgeLink := TopologyLink{
-					Name:   "",
-					Source: bridgeNodeId,
-					Target: targetBridgeId,
-					Color:  "#FF00FF",
-					Props:  ovsBridgeLinkProps,
-				}
-				linkList = append(linkList, ovsBridgeLink)
-				linkId++
-			}
-
-		}
-		if len(bridgeNodeSetIdList) > 0 {
-			nodeSetProps := make(map[string]interface{})
-			nodeSet := TopologyNodeSet{
-				ID:         nodeId,
-				Nodes:      bridgeNodeSetIdList,
-				Name:       "bridge-group",
-				Root:       instanceNodeId,
-				DeviceType: "groups",
-				//X:          (-200 + (100 * j)),
-				//Y:          400,
-				Color: "#0000FF",
-				Props: nodeSetProps,
-			}
-			nodeSetList = append(nodeSetList, nodeSet)
-			nodeId++
-		}
-	}
-	interfaces := libvirtGetPhysicalInterfaces(hypervisor.HostIP)
-	for _, iface := range interfaces {
-		bc := ovsGetPhysicalPortConnection(hypervisor.HostIP, iface.Name, iface.MacAddress)
-		if bc != nil {
-			portNodeProps := make(map[string]interface{})
-			portNodeProps["mac_address"] = iface.MacAddress
-			portNodeId := nodeId
-			portNode := TopologyNode{
-				ID:         portNodeId,
-				Name:       iface.Name,
-				DeviceType: "port",
-				//X:          700,
-				//Y:          (-500 + (5 * k)),
-				Color: "#000000",
-				Props: portNodeProps,
-			}
-			nodeList = append(nodeList, portNode)
-
-			var sourceBridgeId int
-			var sourceBridgeName string
-			ovsBridgeLinkProps := make(map[string]interface{})
-			ovsBridgeLinkProps["source_interface"] = bc.SourceInterface.Name
-			ovsBridgeLinkProps["source_interface_type"] = bc.SourceInterface.Type
-			ovsBridgeLinkProps["source_port"] = bc.SourcePort.Name
-			ovsBridgeLinkProps["target_name"] = iface.Name
-			for k, v := range bc.SourceInterface.Statistics {
-				ovsBridgeLinkProps[k] = v
-			}
-			for _, node := range nodeList {
-				if bc.SourceBridge.Name == node.Name {
-					sourceBridgeId = node.ID
-					sourceBridgeName = node.Name
-					break
-				}
-			}
-			ovsBridgeLinkProps["source_name"] = sourceBridgeName
-			ovsBridgeLink := TopologyLink{
-				Name:   "",
-				Source: sourceBridgeId,
-				Target: portNodeId,
-				Color:  "#000000",
-				Props:  ovsBridgeLinkProps,
-			}
-			linkList = append(linkList, ovsBridgeLink)
-			nodeId++
-			linkId++
-		}
-	}
-
-	if len(instanceNodeSetIdList) > 0 {
-		nodeSetProps := make(map[string]interface{})
-		nodeSet := TopologyNodeSet{
-			ID:         nodeId,
-			Nodes:      instanceNodeSetIdList,
-			Name:       "instance-group",
-			Root:       0,
-			DeviceType: "groups",
-			//X:          500,
-			//Y:          200,
-			Color: "#0000FF",
-			Props: nodeSetProps,
-		}
-		nodeSetList = append(nodeSetList, nodeSet)
-		nodeId++
-	}
-
-	groupList := make([]TopologyGroup, 0)
-
-	viewList := make(map[string]string, 2)
-	viewList["Instance Topology"] = "http://" + r.Host + "/topology/cloudHypervisorInstancesTopology/" + cloudName + "/" + hypervisorName
-	viewList["Linux Bridges"] = "http://" + r.Host + "/topology/cloudHypervisorLayer2NetworkTopology/" + cloudName + "/" + hypervisorName
-	viewList["OVS Bridges"] = "http://" + r.Host + "/topology/cloudHypervisorOvsNetworkTopology/" + cloudName + "/" + hypervisorName
-
-	cloudTopologyData := TopologyData{
-		Title:    topologyTitle,
-		Nodes:    nodeList,
-		Links:    linkList,
-		NodeSets: nodeSetList,
-		Groups:   groupList,
-		Views:    viewList,
-	}
-
-	luddite.WriteResponse(rw, http.StatusOK, cloudTopologyData)
+	q := TopologyQuery{
+		Cloud:             cloudName,
+		Hypervisors:       []string{hypervisorName},
+		Layers:            []string{queryLayerOvs, queryLayerLinuxBridge, queryLayerPhysical},
+		Title:             cloudName + " - " + hypervisorName + " VNF OVS Network Topology",
+		hideBridgeHost:    true,
+		hiddenBridgeLinks: true,
+		hypervisorViews:   queryViewNone,
+	}
+	queryWrite(rw, r, q, newTopologyBuilder(r, cloudName).hypervisorViews(hypervisorName))
 }
 
 func CloudNetworkLayer3NetworkTopology(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
-
 	cloudName := httprouter.ContextParams(ctx).ByName("cloud_name")
-	cloudInfo := cloudGetCloudInfo(cloudName)
 	networkName := httprouter.ContextParams(ctx).ByName("network_name")
-	network := cloudGetNetworkInfo(cloudName, networkName)
-
-	topologyTitle := cloudName + " - " + networkName + " VNF Layer-3 Network Topology"
-
-	hypervisorList := cloudGetHypervisorList(cloudInfo)
-
-	var nodeList []TopologyNode
-	var linkList []TopologyLink
-	var nodeSetList []TopologyNodeSet
-	nodeId := 0
-	linkId := 0
+	g := topologyGetGraph(rw, r, cloudName)
+	if g == nil {
+		return
+	}
+	network := g.FindNetwork(networkName)
+	if network == nil {
+		apiError := APIError{http.StatusNotFound, "Network " + networkName + " for cloud " + cloudName + " Not discovered"}
+		luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+		return
+	}
 
-	networkNodeProps := make(map[string]interface{})
-	networkNodeViews := make(map[string]string)
-	networkNodeProps["id"] = network.ID
-	networkNode := TopologyNode{
-		ID:         nodeId,
-		Name:       network.Name,
-		DeviceType: "router",
-		//X:          400,
-		//Y:          (200 + (5 * i)),
-		Color: "#888888",
-		Props: networkNodeProps,
-		Views: networkNodeViews,
-	}
-	nodeList = append(nodeList, networkNode)
-	nodeId++
-
-	for _, hypervisor := range hypervisorList {
-		instanceList := libvirtGetDomainInstances(hypervisor.HostIP)
-		for _, instance := range instanceList {
-			for _, iface := range instance.Interfaces {
-				for _, node := range nodeList {
-					if node.Name == iface.NetworkName {
-						instanceNodeProps := make(map[string]interface{})
-						instanceNodeProps["uuid"] = instance.UUID
-						instanceNodeProps["name"] = instance.Name
-						instanceNodeProps["hypervisor name"] = instance.HypervisorName
-						instanceNodeViews := make(map[string]string)
-						instanceNodeViews["Networks"] = "http://" + r.Host + "/topology/cloudInstanceLayer3NetworkTopology/" + cloudName + "/" + hypervisor.Name + "/" + instance.InstanceName
-						instanceNodeViews["Linux Bridges"] = "http://" + r.Host + "/topology/cloudInstanceLayer2NetworkTopology/" + cloudName + "/" + hypervisor.Name + "/" + instance.InstanceName
-						instanceNodeViews["OVS Bridges"] = "http://" + r.Host + "/topology/cloudInstanceOvsNetworkTopology/" + cloudName + "/" + hypervisor.Name + "/" + instance.InstanceName
-						instanceNodeId := nodeId
-						instanceNode := TopologyNode{
-							ID:         nodeId,
-							Name:       instance.InstanceName,
-							DeviceType: "server",
-							//X:          300,
-							//Y:          (200 + (5 * j)),
-							Color: "#0000FF",
-							Props: instanceNodeProps,
-							Views: instanceNodeViews,
-						}
-						nodeList = append(nodeList, instanceNode)
-						nodeId++
-						networkLinkProps := make(map[string]interface{})
-						networkLinkProps["source_name"] = node.Name
-						networkLinkProps["target_name"] = instanceNode.Name
-						networkLink := TopologyLink{
-							Name:   "",
-							Source: node.ID,
-							Target: instanceNodeId,
-							Color:  "#0000FF",
-							Props:  networkLinkProps,
-						}
-						linkList = append(linkList, networkLink)
-						linkId++
-						break
-					}
+	b := newGraphTopologyBuilder(r, g)
+	b.addNode(network.Key, topologyNetworkNode(network.Network, make(map[string]string)))
+	for _, hypervisor := range g.Hypervisors() {
+		for _, instance := range g.Children(hypervisor.Key, graphEntityInstance) {
+			for _, vnic := range g.Children(instance.Key, graphEntityVnic) {
+				networkId, networkName, ok := b.findByName(vnic.Vnic.NetworkName)
+				if !ok {
+					continue
 				}
+				instanceNode := b.addNode(instance.Key, topologyInstanceNode(instance.Instance, b.instanceViews(hypervisor.Name, instance.Name)))
+				b.addLink(topologyLink(networkId, networkName, instanceNode.ID, instanceNode.Name, "#0000FF"))
 			}
 		}
 	}
 
-	groupList := make([]TopologyGroup, 0)
-
-	viewList := make(map[string]string, 2)
-	viewList["Network Topology"] = "http://" + r.Host + "/topology/cloudNetworkLayer3NetworkTopology/" + cloudInfo.Name + "/" + networkName
-	cloudTopologyData := TopologyData{
-		Title:    topologyTitle,
-		Nodes:    nodeList,
-		Links:    linkList,
-		NodeSets: nodeSetList,
-		Groups:   groupList,
-		Views:    viewList,
-	}
-
-	luddite.WriteResponse(rw, http.StatusOK, cloudTopologyData)
+	cloudTopologyData := b.data(cloudName+" - "+networkName+" VNF Layer-3 Network Topology", b.networkViews(networkName))
+	topologyWrite(rw, r, cloudTopologyData)
 }
 
 func CloudInstanceLayer3NetworkTopology(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
-
 	cloudName := httprouter.ContextParams(ctx).ByName("cloud_name")
-	cloudInfo := cloudGetCloudInfo(cloudName)
 	hypervisorName := httprouter.ContextParams(ctx).ByName("hypervisor_name")
-	hypervisor := cloudGetHypervisorInfo(cloudName, hypervisorName)
 	instanceName := httprouter.ContextParams(ctx).ByName("instance_name")
-	instance := libvirtGetDomainInstance(hypervisor.HostIP, instanceName)
-
-	networkList := cloudGetNetworkList(cloudInfo)
-
-	topologyTitle := cloudName + " - " + hypervisorName + " - " + instanceName + " VNF Layer-3 Network Topology"
-
-	var nodeList []TopologyNode
-	var linkList []TopologyLink
-	var nodeSetList []TopologyNodeSet
-	nodeId := 0
-	linkId := 0
-
-	instanceNodeProps := make(map[string]interface{})
-	instanceNodeProps["uuid"] = instance.UUID
-	instanceNodeProps["name"] = instance.Name
-	instanceNodeProps["hypervisor name"] = instance.HypervisorName
-	instanceNodeId := nodeId
-	instanceNode := TopologyNode{
-		ID:         nodeId,
-		Name:       instance.InstanceName,
-		DeviceType: "server",
-		//X:          300,
-		//Y:          (200 + (5 * j)),
-		Color: "#0000FF",
-		Props: instanceNodeProps,
-	}
-	nodeList = append(nodeList, instanceNode)
-	nodeId++
-
-	for _, iface := range instance.Interfaces {
-		for _, network := range networkList {
-			if network.Name == iface.NetworkName {
-				networkNodeProps := make(map[string]interface{})
-				networkNodeViews := make(map[string]string)
-				networkNodeProps["id"] = network.ID
-				networkNodeId := nodeId
-				networkNode := TopologyNode{
-					ID:         nodeId,
-					Name:       network.Name,
-					DeviceType: "router",
-					//X:          400,
-					//Y:          (200 + (5 * i)),
-					Color: "#888888",
-					Props: networkNodeProps,
-					Views: networkNodeViews,
-				}
-				nodeList = append(nodeList, networkNode)
-				nodeId++
-
-				networkLinkProps := make(map[string]interface{})
-				networkLinkProps["source_name"] = networkNode.Name
-				networkLinkProps["target_name"] = instanceNode.Name
-				networkLink := TopologyLink{
-					Name:   "",
-					Source: instanceNodeId,
-					Target: networkNodeId,
-					Color:  "#0000FF",
-					Props:  networkLinkProps,
-				}
-				linkList = append(linkList, networkLink)
-				linkId++
-				break
-			}
-		}
+	g := topologyGetGraph(rw, r, cloudName)
+	if g == nil {
+		return
+	}
+	hypervisor := topologyGetHypervisor(rw, g, hypervisorName)
+	if hypervisor == nil {
+		return
+	}
+	instance := topologyGetInstance(rw, g, hypervisor, instanceName)
+	if instance == nil {
+		return
 	}
 
-	groupList := make([]TopologyGroup, 0)
-
-	viewList := make(map[string]string, 2)
-	viewList["Networks"] = "http://" + r.Host + "/topology/cloudInstanceLayer3NetworkTopology/" + cloudName + "/" + hypervisor.Name + "/" + instance.InstanceName
-	viewList["Linux Bridges"] = "http://" + r.Host + "/topology/cloudInstanceLayer2NetworkTopology/" + cloudName + "/" + hypervisor.Name + "/" + instance.InstanceName
-	viewList["OVS Bridges"] = "http://" + r.Host + "/topology/cloudInstanceOvsNetworkTopology/" + cloudName + "/" + hypervisor.Name + "/" + instance.InstanceName
-	cloudTopologyData := TopologyData{
-		Title:    topologyTitle,
-		Nodes:    nodeList,
-		Links:    linkList,
-		NodeSets: nodeSetList,
-		Groups:   groupList,
-		Views:    viewList,
+	b := newGraphTopologyBuilder(r, g)
+	instanceNode := b.addNode(instance.Key, topologyInstanceNode(instance.Instance, nil))
+	for _, vnic := range g.Children(instance.Key, graphEntityVnic) {
+		relation := g.Outgoing(vnic.Key, graphRelationNetwork)
+		if relation == nil {
+			continue
+		}
+		network := g.Entity(relation.Target)
+		networkNode := b.addNode(network.Key, topologyNetworkNode(network.Network, make(map[string]string)))
+		b.addLink(topologyLink(instanceNode.ID, networkNode.Name, networkNode.ID, instanceNode.Name, "#0000FF"))
 	}
 
-	luddite.WriteResponse(rw, http.StatusOK, cloudTopologyData)
+	cloudTopologyData := b.data(cloudName+" - "+hypervisorName+" - "+instanceName+" VNF Layer-3 Network Topology", b.instanceViews(hypervisor.Name, instance.Name))
+	topologyWrite(rw, r, cloudTopologyData)
 }
 
 func CloudInstanceLayer2NetworkTopology(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
-
 	cloudName := httprouter.ContextParams(ctx).ByName("cloud_name")
 	hypervisorName := httprouter.ContextParams(ctx).ByName("hypervisor_name")
-	hypervisor := cloudGetHypervisorInfo(cloudName, hypervisorName)
 	instanceName := httprouter.ContextParams(ctx).ByName("instance_name")
-	instance := libvirtGetDomainInstance(hypervisor.HostIP, instanceName)
-
-	topologyTitle := cloudName + " - " + hypervisorName + " - " + instanceName + " VNF Layer-2 Network Topology"
-
-	var nodeList []TopologyNode
-	var linkList []TopologyLink
-	var nodeSetList []TopologyNodeSet
-	nodeId := 0
-	linkId := 0
-
-	hypervisorNodeProps := make(map[string]interface{})
-	hypervisorNodeProps["id"] = hypervisor.ID
-	hypervisorNodeProps["host_name"] = hypervisor.HostName
-	hypervisorNodeProps["ip_address"] = hypervisor.HostIP
-	hypervisorNodeProps["state"] = hypervisor.State
-	hypervisorNodeColor := "#9C27B0"
-	if hypervisor.State == "down" {
-		hypervisorNodeColor = "#FF0000"
-	}
-	hypervisorNodeId := nodeId
-	hypervisorNode := TopologyNode{
-		ID:         hypervisorNodeId,
-		Name:       hypervisor.Name,
-		DeviceType: "host",
-		//X:          200,
-		//Y:          (200 + (5 * i)),
-		Color: hypervisorNodeColor,
-		Props: hypervisorNodeProps,
-	}
-	nodeList = append(nodeList, hypervisorNode)
-	nodeId++
-
-	instanceNodeProps := make(map[string]interface{})
-	instanceNodeProps["uuid"] = instance.UUID
-	instanceNodeProps["name"] = instance.Name
-	instanceNodeProps["hypervisor name"] = instance.HypervisorName
-	instanceNodeId := nodeId
-	instanceNode := TopologyNode{
-		ID:         instanceNodeId,
-		Name:       instance.InstanceName,
-		DeviceType: "server",
-		//X:          300,
-		//Y:          (200 + (5 * j)),
-		Color: "#0000FF",
-		Props: instanceNodeProps,
-	}
-	nodeList = append(nodeList, instanceNode)
-	instanceLinkProps := make(map[string]interface{})
-	instanceLinkProps["source_name"] = hypervisorNode.Name
-	instanceLinkProps["target_name"] = instanceNode.Name
-	hypervisorLink := TopologyLink{
-		Name:   "",
-		Source: hypervisorNodeId,
-		Target: instanceNodeId,
-		Color:  "#0000FF",
-		Props:  instanceLinkProps,
-	}
-	linkList = append(linkList, hypervisorLink)
-	nodeId++
-	linkId++
-	for _, iface := range instance.Interfaces {
-		bridgeNodeProps := make(map[string]interface{})
-		bridgeNodeProps["tap"] = iface.DevName
-		bridgeNodeProps["mac_address"] = iface.MacAddress
-		bridgeNodeProps["network_name"] = iface.NetworkName
-		bridgeNodeId := nodeId
-		bridgeNode := TopologyNode{
-			ID:         bridgeNodeId,
-			Name:       iface.BridgeName,
-			DeviceType: "switch",
-			//X:          200,
-			//Y:          (200 + (5 * k)),
-			Color: "#FF00FF",
-			Props: bridgeNodeProps,
-		}
-		nodeList = append(nodeList, bridgeNode)
-		bridgeLinkProps := make(map[string]interface{})
-		bridgeLinkProps["source_name"] = instanceNode.Name
-		bridgeLinkProps["target_name"] = bridgeNode.Name
-		bridgeLinkProps["interface_type"] = iface.Type
-		for k, v := range iface.Statistics {
-			bridgeLinkProps[k] = v
-		}
-		bridgeLink := TopologyLink{
-			Name:   "",
-			Source: instanceNodeId,
-			Target: bridgeNodeId,
-			Color:  "#0000FF",
-			Props:  bridgeLinkProps,
-		}
-		linkList = append(linkList, bridgeLink)
-		nodeId++
-		linkId++
-
-		network := cloudGetNetworkInfo(cloudName, iface.NetworkName)
-		if network != nil {
-			networkNodeProps := make(map[string]interface{})
-			networkNodeProps["id"] = network.ID
-			networkNodeViews := make(map[string]string)
-			networkNode := TopologyNode{
-				ID:         nodeId,
-				Name:       network.Name,
-				DeviceType: "router",
-				//X:          400,
-				//Y:          (200 + (5 * i)),
-				Color: "#888888",
-				Props: networkNodeProps,
-				Views: networkNodeViews,
-			}
-			nodeList = append(nodeList, networkNode)
-			networkLinkProps := make(map[string]interface{})
-			networkLinkProps["source_name"] = bridgeNode.Name
-			networkLinkProps["target_name"] = network.Name
-			networkLink := TopologyLink{
-				Name:   "",
-				Source: bridgeNodeId,
-				Target: nodeId,
-				Color:  "#888888",
-				Props:  networkLinkProps,
-			}
-			linkList = append(linkList, networkLink)
-			nodeId++
-			linkId++
-		}
-	}
-
-	groupList := make([]TopologyGroup, 0)
-
-	viewList := make(map[string]string)
-	viewList["Networks"] = "http://" + r.Host + "/topology/cloudInstanceLayer3NetworkTopology/" + cloudName + "/" + hypervisor.Name + "/" + instance.InstanceName
-	viewList["Linux Bridges"] = "http://" + r.Host + "/topology/cloudInstanceLayer2NetworkTopology/" + cloudName + "/" + hypervisorName + "/" + instanceName
-	viewList["OVS Bridges"] = "http://" + r.Host + "/topology/cloudInstanceOvsNetworkTopology/" + cloudName + "/" + hypervisorName + "/" + instanceName
-
-	cloudTopologyData := TopologyData{
-		Title:    topologyTitle,
-		Nodes:    nodeList,
-		Links:    linkList,
-		NodeSets: nodeSetList,
-		Groups:   groupList,
-		Views:    viewList,
-	}
-
-	luddite.WriteResponse(rw, http.StatusOK, cloudTopologyData)
+	q := TopologyQuery{
+		Cloud:           cloudName,
+		Hypervisors:     []string{hypervisorName},
+		Instances:       []string{instanceName},
+		Layers:          []string{queryLayerLinuxBridge, queryLayerL3},
+		Title:           cloudName + " - " + hypervisorName + " - " + instanceName + " VNF Layer-2 Network Topology",
+		vnicNetworks:    true,
+		hypervisorViews: queryViewNone,
+		instanceViews:   queryViewNone,
+		networkViews:    queryViewEmpty,
+	}
+	queryWrite(rw, r, q, newTopologyBuilder(r, cloudName).instanceViews(hypervisorName, instanceName))
 }
 
 func CloudInstanceOvsNetworkTopology(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
 	cloudName := httprouter.ContextParams(ctx).ByName("cloud_name")
 	hypervisorName := httprouter.ContextParams(ctx).ByName("hypervisor_name")
-	hypervisor := cloudGetHypervisorInfo(cloudName, hypervisorName)
 	instanceName := httprouter.ContextParams(ctx).ByName("instance_name")
-	instance := libvirtGetDomainInstance(hypervisor.HostIP, instanceName)
-
-	topologyTitle := cloudName + " - " + hypervisorName + " - " + instanceName + " VNF OVS Network Topology"
-
-	var nodeList []TopologyNode
-	var linkList []TopologyLink
-	var nodeSetList []TopologyNodeSet
-	nodeId := 0
-	linkId := 0
-
-	bridgeList := ovsGetBridges(hypervisor.HostIP)
-	for _, bridge := range bridgeList {
-		bridgeNodeProps := make(map[string]interface{})
-		bridgeNodeProps["uuid"] = bridge.UUID
-		bridgeNodeProps["name"] = bridge.Name
-		bridgeNodeId := nodeId
-		bridgeNode := TopologyNode{
-			ID:         bridgeNodeId,
-			Name:       bridge.Name,
-			DeviceType: "switch",
-			//X:          (-100 + (-300 * j)),
-			//Y:          (-600 + (300 * j)),
-			Color: "#00FF00",
-			Props: bridgeNodeProps,
-		}
-		nodeList = append(nodeList, bridgeNode)
-		nodeId++
-	}
-	bridgeConnections := ovsGetBridgeConnections(hypervisor.HostIP)
-	for _, bc := range bridgeConnections {
-		var sourceBridgeId int
-		var targetBridgeId int
-		var sourceBridgeName string
-		var targetBridgeName string
-		bridgeLinkProps := make(map[string]interface{})
-		for k, v := range bc.SourceInterface.Statistics {
-			bridgeLinkProps[k] = v
-		}
-		for _, node := range nodeList {
-			if bc.SourceBridge.Name == node.Name {
-				sourceBridgeId = node.ID
-				sourceBridgeName = node.Name
-				break
-			}
-		}
-		for _, node := range nodeList {
-			if bc.TargetBridge.Name == node.Name {
-				targetBridgeId = node.ID
-				targetBridgeName = node.Name
-				break
-			}
-		}
-		bridgeLinkProps["source_name"] = sourceBridgeName
-		bridgeLinkProps["target_name"] = targetBridgeName
-		bridgeLinkProps["source_interface"] = bc.SourceInterface.Name
-		bridgeLinkProps["target_interface"] = bc.TargetInterface.Name
-		bridgeLinkProps["source_interface_type"] = bc.SourceInterface.Type
-		bridgeLinkProps["target_interface_type"] = bc.TargetInterface.Type
-		bridgeLinkProps["source_port"] = bc.SourcePort.Name
-		bridgeLinkProps["target_port"] = bc.TargetPort.Name
-		bridgeLink := TopologyLink{
-			Name:   "",
-			Source: sourceBridgeId,
-			Target: targetBridgeId,
-			Color:  "#00FF00",
-			Props:  bridgeLinkProps,
-		}
-		linkList = append(linkList, bridgeLink)
-		linkId++
-	}
-	instanceNodeProps := make(map[string]interface{})
-	instanceNodeProps["uuid"] = instance.UUID
-	instanceNodeProps["name"] = instance.Name
-	instanceNodeProps["hypervisor name"] = instance.HypervisorName
-	instanceNodeId := nodeId
-	instanceNode := TopologyNode{
-		ID:         instanceNodeId,
-		Name:       instance.InstanceName,
-		DeviceType: "server",
-		//X:          800,
-		//Y:          (-200 + (5 * j)),
-		Color: "#0000FF",
-		Props: instanceNodeProps,
-	}
-	nodeList = append(nodeList, instanceNode)
-	nodeId++
-	for _, iface := range instance.Interfaces {
-		bridgeNodeProps := make(map[string]interface{})
-		bridgeNodeProps["tap"] = iface.DevName
-		bridgeNodeProps["mac_address"] = iface.MacAddress
-		bridgeNodeProps["network_name"] = iface.NetworkName
-		bridgeNodeId := nodeId
-		bridgeNode := TopologyNode{
-			ID:         bridgeNodeId,
-			Name:       iface.BridgeName,
-			DeviceType: "switch",
-			//X:          700,
-			//Y:          (-500 + (5 * k)),
-			Color: "#FF00FF",
-			Props: bridgeNodeProps,
-		}
-		nodeList = append(nodeList, bridgeNode)
-		//bridgeNodeSetIdList = append(bridgeNodeSetIdList, bridgeNodeId)
-		bridgeLinkProps := make(map[string]interface{})
-		bridgeLinkProps["source_name"] = instanceNode.Name
-		bridgeLinkProps["target_name"] = bridgeNode.Name
-		bridgeLinkProps["interface_type"] = iface.Type
-		for k, v := range iface.Statistics {
-			bridgeLinkProps[k] = v
-		}
-		bridgeLink := TopologyLink{
-			Name:   "",
-			Source: instanceNodeId,
-			Target: bridgeNodeId,
-			Color:  "#0000FF",
-			Props:  bridgeLinkProps,
-		}
-		linkList = append(linkList, bridgeLink)
-		nodeId++
-		linkId++
-		bc := ovsGetBridgeConnection(hypervisor.HostIP, iface.MacAddress)
-		if bc != nil {
-			var targetBridgeId int
-			var targetBridgeName string
-			ovsBridgeLinkProps := make(map[string]interface{})
-			ovsBridgeLinkProps["source_name"] = bridgeNode.Name
-			ovsBridgeLinkProps["target_interface"] = bc.TargetInterface.Name
-			ovsBridgeLinkProps["target_interface_type"] = bc.TargetInterface.Type
-			ovsBridgeLinkProps["target_port"] = bc.TargetPort.Name
-			for k, v := range bc.TargetInterface.Statistics {
-				ovsBridgeLinkProps[k] = v
-			}
-			for _, node := range nodeList {
-				if bc.TargetBridge.Name == node.Name {
-					targetBridgeId = node.ID
-					targetBridgeName = node.Name
-					break
-				}
-			}
-			ovsBridgeLinkProps["target_name"] = targetBridgeName
-			ovsBridgeLink := TopologyLink{
-				Name:   "",
-				Source: bridgeNodeId,
-				Target: targetBridgeId,
-				Color:  "#FF00FF",
-				Props:  ovsBridgeLinkProps,
-			}
-			linkList = append(linkList, ovsBridgeLink)
-			linkId++
-		}
-
-	}
-	interfaces := libvirtGetPhysicalInterfaces(hypervisor.HostIP)
-	for _, iface := range interfaces {
-		bc := ovsGetPhysicalPortConnection(hypervisor.HostIP, iface.Name, iface.MacAddress)
-		if bc != nil {
-			portNodeProps := make(map[string]interface{})
-			portNodeProps["mac_address"] = iface.MacAddress
-			portNodeId := nodeId
-			portNode := TopologyNode{
-				ID:         portNodeId,
-				Name:       iface.Name,
-				DeviceType: "port",
-				//X:          700,
-				//Y:          (-500 + (5 * k)),
-				Color: "#000000",
-				Props: portNodeProps,
-			}
-			nodeList = append(nodeList, portNode)
-
-			var sourceBridgeId int
-			var sourceBridgeName string
-			ovsBridgeLinkProps := make(map[string]interface{})
-			ovsBridgeLinkProps["source_interface"] = bc.SourceInterface.Name
-			ovsBridgeLinkProps["source_interface_type"] = bc.SourceInterface.Type
-			ovsBridgeLinkProps["source_port"] = bc.SourcePort.Name
-			ovsBridgeLinkProps["target_name"] = iface.Name
-			for k, v := range bc.SourceInterface.Statistics {
-				ovsBridgeLinkProps[k] = v
-			}
-			for _, node := range nodeList {
-				if bc.SourceBridge.Name == node.Name {
-					sourceBridgeId = node.ID
-					sourceBridgeName = node.Name
-					break
-				}
-			}
-			ovsBridgeLinkProps["source_name"] = sourceBridgeName
-			ovsBridgeLink := TopologyLink{
-				Name:   "",
-				Source: sourceBridgeId,
-				Target: portNodeId,
-				Color:  "#000000",
-				Props:  ovsBridgeLinkProps,
-			}
-			linkList = append(linkList, ovsBridgeLink)
-			nodeId++
-			linkId++
-		}
-	}
-
-	groupList := make([]TopologyGroup, 0)
-
-	viewList := make(map[string]string)
-	viewList["Networks"] = "http://" + r.Host + "/topology/cloudInstanceLayer3NetworkTopology/" + cloudName + "/" + hypervisor.Name + "/" + instance.InstanceName
-	viewList["Linux Bridges"] = "http://" + r.Host + "/topology/cloudInstanceLayer2NetworkTopology/" + cloudName + "/" + hypervisorName + "/" + instanceName
-	viewList["OVS Bridges"] = "http://" + r.Host + "/topology/cloudInstanceOvsNetworkTopology/" + cloudName + "/" + hypervisorName + "/" + instanceName
-
-	cloudTopologyData := TopologyData{
-		Title:    topologyTitle,
-		Nodes:    nodeList,
-		Links:    linkList,
-		NodeSets: nodeSetList,
-		Groups:   groupList,
-		Views:    viewList,
-	}
-
-	luddite.WriteResponse(rw, http.StatusOK, cloudTopologyData)
+	q := TopologyQuery{
+		Cloud:             cloudName,
+		Hypervisors:       []string{hypervisorName},
+		Instances:         []string{instanceName},
+		Layers:            []string{queryLayerOvs, queryLayerLinuxBridge, queryLayerPhysical},
+		Title:             cloudName + " - " + hypervisorName + " - " + instanceName + " VNF OVS Network Topology",
+		hideHypervisors:   true,
+		hideBridgeHost:    true,
+		hiddenBridgeLinks: true,
+		instanceViews:     queryViewNone,
+	}
+	queryWrite(rw, r, q, newTopologyBuilder(r, cloudName).instanceViews(hypervisorName, instanceName))
 }
 
 func InitTopology(router *httprouter.Router) {
@@ -3846,21 +1064,28 @@ func InitTopology(router *httprouter.Router) {
 		delete(rw.Header(), luddite.HeaderContentType)
 		content.ServeHTTP(rw, r)
 	}
-	router.GET("/topology/cloudsTopology", CloudsTopology)
-	router.GET("/topology/cloudTopology/:cloud_name", CloudTopology)
-	router.GET("/topology/cloudHypervisorTopology/:cloud_name", CloudHypervisorTopology)
-	router.GET("/topology/cloudLayer3NetworkTopology/:cloud_name", CloudLayer3NetworkTopology)
-	router.GET("/topology/cloudLayer2NetworkTopology/:cloud_name", CloudLayer2NetworkTopology)
-	router.GET("/topology/cloudOvsNetworkTopology/:cloud_name", CloudOvsNetworkTopology)
-	router.GET("/topology/cloudHypervisorsCollapsedFilteredOvsNetworkTopology/:cloud_name", CloudHypervisorsCollapsedFilteredOvsNetworkTopology)
-	router.GET("/topology/cloudHypervisorsExpandedFilteredOvsNetworkTopology/:cloud_name", CloudHypervisorsExpandedFilteredOvsNetworkTopology)
-	router.GET("/topology/cloudHypervisorsCollapsedUnfilteredOvsNetworkTopology/:cloud_name", CloudHypervisorsCollapsedUnfilteredOvsNetworkTopology)
-	router.GET("/topology/cloudHypervisorsExpandedUnfilteredOvsNetworkTopology/:cloud_name", CloudHypervisorsExpandedUnfilteredOvsNetworkTopology)
-	router.GET("/topology/cloudHypervisorInstancesTopology/:cloud_name/:hypervisor_name", CloudHypervisorInstancesTopology)
-	router.GET("/topology/cloudNetworkLayer3NetworkTopology/:cloud_name/:network_name", CloudNetworkLayer3NetworkTopology)
-	router.GET("/topology/cloudHypervisorLayer2NetworkTopology/:cloud_name/:hypervisor_name", CloudHypervisorLayer2NetworkTopology)
-	router.GET("/topology/cloudHypervisorOvsNetworkTopology/:cloud_name/:hypervisor_name", CloudHypervisorOvsNetworkTopology)
-	router.GET("/topology/cloudInstanceLayer3NetworkTopology/:cloud_name/:hypervisor_name/:instance_name", CloudInstanceLayer3NetworkTopology)
-	router.GET("/topology/cloudInstanceLayer2NetworkTopology/:cloud_name/:hypervisor_name/:instance_name", CloudInstanceLayer2NetworkTopology)
-	router.GET("/topology/cloudInstanceOvsNetworkTopology/:cloud_name/:hypervisor_name/:instance_name", CloudInstanceOvsNetworkTopology)
+	router.GET("/topology/cloudsTopology", authorize(authRoleViewer, viewCached(CloudsTopology)))
+	router.GET("/topology/cloudTopology/:cloud_name", authorize(authRoleViewer, viewCached(CloudTopology)))
+	router.GET("/topology/cloudHypervisorTopology/:cloud_name", authorize(authRoleViewer, viewCached(CloudHypervisorTopology)))
+	router.GET("/topology/cloudLayer3NetworkTopology/:cloud_name", authorize(authRoleViewer, viewCached(CloudLayer3NetworkTopology)))
+	router.GET("/topology/cloudLayer2NetworkTopology/:cloud_name", authorize(authRoleViewer, viewCachedStats(CloudLayer2NetworkTopology)))
+	router.GET("/topology/cloudOvsNetworkTopology/:cloud_name", authorize(authRoleViewer, viewCachedStats(CloudOvsNetworkTopology)))
+	router.GET("/topology/cloudHypervisorsCollapsedFilteredOvsNetworkTopology/:cloud_name", authorize(authRoleViewer, viewCachedStats(CloudHypervisorsCollapsedFilteredOvsNetworkTopology)))
+	router.GET("/topology/cloudHypervisorsExpandedFilteredOvsNetworkTopology/:cloud_name", authorize(authRoleViewer, viewCachedStats(CloudHypervisorsExpandedFilteredOvsNetworkTopology)))
+	router.GET("/topology/cloudHypervisorsCollapsedUnfilteredOvsNetworkTopology/:cloud_name", authorize(authRoleViewer, viewCachedStats(CloudHypervisorsCollapsedUnfilteredOvsNetworkTopology)))
+	router.GET("/topology/cloudHypervisorsExpandedUnfilteredOvsNetworkTopology/:cloud_name", authorize(authRoleViewer, viewCachedStats(CloudHypervisorsExpandedUnfilteredOvsNetworkTopology)))
+	router.GET("/topology/cloudHypervisorsOvsNetworkTopology/:cloud_name", authorize(authRoleViewer, viewCachedStats(CloudHypervisorsOvsNetworkTopology)))
+	router.POST("/topology/cloudHypervisorsOvsNetworkTopology/:cloud_name", authorize(authRoleViewer, viewCachedStats(CloudHypervisorsOvsNetworkTopology)))
+	router.POST("/topology/cloudHypervisorsCollapsedFilteredOvsNetworkTopology/:cloud_name", authorize(authRoleViewer, viewCachedStats(CloudHypervisorsCollapsedFilteredOvsNetworkTopology)))
+	router.POST("/topology/cloudHypervisorsExpandedFilteredOvsNetworkTopology/:cloud_name", authorize(authRoleViewer, viewCachedStats(CloudHypervisorsExpandedFilteredOvsNetworkTopology)))
+	router.POST("/topology/cloudHypervisorsCollapsedUnfilteredOvsNetworkTopology/:cloud_name", authorize(authRoleViewer, viewCachedStats(CloudHypervisorsCollapsedUnfilteredOvsNetworkTopology)))
+	router.POST("/topology/cloudHypervisorsExpandedUnfilteredOvsNetworkTopology/:cloud_name", authorize(authRoleViewer, viewCachedStats(CloudHypervisorsExpandedUnfilteredOvsNetworkTopology)))
+	router.GET("/topology/cloudHypervisorInstancesTopology/:cloud_name/:hypervisor_name", authorize(authRoleViewer, viewCached(CloudHypervisorInstancesTopology)))
+	router.GET("/topology/cloudNetworkLayer3NetworkTopology/:cloud_name/:network_name", authorize(authRoleViewer, viewCached(CloudNetworkLayer3NetworkTopology)))
+	router.GET("/topology/cloudHypervisorLayer2NetworkTopology/:cloud_name/:hypervisor_name", authorize(authRoleViewer, viewCachedStats(CloudHypervisorLayer2NetworkTopology)))
+	router.GET("/topology/cloudHypervisorOvsNetworkTopology/:cloud_name/:hypervisor_name", authorize(authRoleViewer, viewCachedStats(CloudHypervisorOvsNetworkTopology)))
+	router.GET("/topology/cloudInstanceLayer3NetworkTopology/:cloud_name/:hypervisor_name/:instance_name", authorize(authRoleViewer, viewCached(CloudInstanceLayer3NetworkTopology)))
+	router.GET("/topology/cloudInstanceLayer2NetworkTopology/:cloud_name/:hypervisor_name/:instance_name", authorize(authRoleViewer, viewCachedStats(CloudInstanceLayer2NetworkTopology)))
+	router.GET("/topology/cloudInstanceOvsNetworkTopology/:cloud_name/:hypervisor_name/:instance_name", authorize(authRoleViewer, viewCachedStats(CloudInstanceOvsNetworkTopology)))
+	router.GET("/topology/cloudNeighborhoodTopology/:cloud_name", authorize(authRoleViewer, viewCachedStats(CloudNeighborhoodTopology)))
 }
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"github.com/SpirentOrion/httprouter"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden views in testdata")
+
+// topologyGoldenViews are the preset views checked against testdata, built
+// from testFixture. The goldens were written by the handlers these views
+// replaced.
+var topologyGoldenViews = []struct {
+	path   string
+	status int
+}{
+	{"/topology/cloudsTopology", http.StatusOK},
+	{"/topology/cloudTopology/c1", http.StatusOK},
+	{"/topology/cloudHypervisorTopology/c1", http.StatusOK},
+	{"/topology/cloudLayer3NetworkTopology/c1", http.StatusOK},
+	{"/topology/cloudLayer2NetworkTopology/c1", http.StatusOK},
+	{"/topology/cloudOvsNetworkTopology/c1", http.StatusOK},
+	{"/topology/cloudHypervisorsCollapsedFilteredOvsNetworkTopology/c1?hypervisor_instances=compute-node.spirent.com:vRouter1", http.StatusOK},
+	{"/topology/cloudHypervisorsExpandedFilteredOvsNetworkTopology/c1?hypervisor_instances=compute-node.spirent.com:vRouter1", http.StatusOK},
+	{"/topology/cloudHypervisorsCollapsedUnfilteredOvsNetworkTopology/c1?hypervisor_instances=compute-node.spirent.com:vRouter1", http.StatusOK},
+	{"/topology/cloudHypervisorsExpandedUnfilteredOvsNetworkTopology/c1?hypervisor_instances=compute-node.spirent.com:vRouter1", http.StatusOK},
+	{"/topology/cloudHypervisorsCollapsedFilteredOvsNetworkTopology/c9", http.StatusNotFound},
+	{"/topology/cloudHypervisorInstancesTopology/c1/hv1", http.StatusOK},
+	{"/topology/cloudHypervisorLayer2NetworkTopology/c1/hv1", http.StatusOK},
+	{"/topology/cloudHypervisorOvsNetworkTopology/c1/hv1", http.StatusOK},
+	{"/topology/cloudHypervisorOvsNetworkTopology/c1/hv3", http.StatusOK},
+	{"/topology/cloudNetworkLayer3NetworkTopology/c1/net-a", http.StatusOK},
+	{"/topology/cloudInstanceLayer3NetworkTopology/c1/hv1/vRouter1", http.StatusOK},
+	{"/topology/cloudInstanceLayer2NetworkTopology/c1/hv1/vRouter1", http.StatusOK},
+	{"/topology/cloudInstanceOvsNetworkTopology/c1/hv1/vRouter1", http.StatusOK},
+	{"/topology/cloudInstanceOvsNetworkTopology/c1/hv2/net-a", http.StatusOK},
+}
+
+// topologyGoldenNormalize leaves out what the views added since the goldens
+// were written: node, link and node set keys, layout positions, neighborhood
+// views, wiring warnings with the stand-ins for missing patch peers, and the
+// filter matches.
+func topologyGoldenNormalize(body []byte) ([]byte, error) {
+	var data TopologyData
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, err
+	}
+	missing := make(map[int]bool)
+	var nodes []TopologyNode
+	for _, node := range data.Nodes {
+		if isMissing, _ := node.Props["missing"].(bool); isMissing {
+			missing[node.ID] = true
+			continue
+		}
+		node.Key, node.X, node.Y = "", 0, 0
+		delete(node.Props, "warnings")
+		delete(node.Views, "Neighborhood")
+		nodes = append(nodes, node)
+	}
+	data.Nodes = nodes
+	for i := range data.Links {
+		link := &data.Links[i]
+		link.Key = ""
+		if _, ok := link.Props["warnings"]; ok {
+			delete(link.Props, "warnings")
+			link.Color = "#00FF00"
+		}
+		if missing[link.Target] {
+			link.Target = 0
+			link.Props["target_name"] = ""
+		}
+	}
+	for i := range data.NodeSets {
+		data.NodeSets[i].Key, data.NodeSets[i].X, data.NodeSets[i].Y = "", 0, 0
+	}
+	delete(data.Views, "Neighborhood")
+	data.Filtered = nil
+	return json.Marshal(data)
+}
+
+// TestTopologyGoldenViews compares the preset views with the ones saved in
+// testdata. Run go test -update to accept changes to them.
+func TestTopologyGoldenViews(t *testing.T) {
+	defer testFixture()()
+	router := httprouter.New()
+	InitTopology(router)
+
+	for _, view := range topologyGoldenViews {
+		r, _ := http.NewRequest("GET", "http://topology"+view.path, nil)
+		rw := httptest.NewRecorder()
+		router.ServeHTTP(rw, r)
+		if rw.Code != view.status {
+			t.Errorf("GET %s = %d, want %d", view.path, rw.Code, view.status)
+		}
+
+		name := strings.NewReplacer("/", "_", "?", "_", ":", "_", "=", "_").Replace(strings.TrimPrefix(view.path, "/topology/")) + ".golden"
+		path := filepath.Join("testdata", name)
+		if *updateGolden {
+			if err := ioutil.WriteFile(path, rw.Body.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		golden, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Errorf("GET %s: %v", view.path, err)
+			continue
+		}
+		body := rw.Body.Bytes()
+		if view.status == http.StatusOK {
+			if golden, err = topologyGoldenNormalize(golden); err != nil {
+				t.Fatalf("%s: %v", path, err)
+			}
+			if body, err = topologyGoldenNormalize(body); err != nil {
+				t.Fatalf("GET %s: %v", view.path, err)
+			}
+		}
+		if !bytes.Equal(body, golden) {
+			t.Errorf("GET %s differs from %s:\n%s", view.path, path, rw.Body.String())
+		}
+	}
+}
+
+func TestTopologyUnknownInstance(t *testing.T) {
+	defer testFixture()()
+	router := httprouter.New()
+	InitTopology(router)
+
+	for _, path := range []string{"/topology/cloudInstanceLayer2NetworkTopology/c1/hv2/vm2", "/topology/cloudInstanceOvsNetworkTopology/c1/hv2/vm2"} {
+		r, _ := http.NewRequest("GET", "http://topology"+path, nil)
+		rw := httptest.NewRecorder()
+		router.ServeHTTP(rw, r)
+		if rw.Code != http.StatusNotFound {
+			t.Errorf("GET %s = %d, want %d", path, rw.Code, http.StatusNotFound)
+		}
+	}
+}
+
+func TestTopologyHypervisorInstancesErrors(t *testing.T) {
+	defer testFixture()()
+	router := httprouter.New()
+	InitTopology(router)
+
+	const host = "compute-node.spirent.com"
+	noHost := HypervisorInstanceError{HostName: "nohost", ErrorMessage: "Hypervisor nohost for cloud c1 Not discovered"}
+	noInstance := HypervisorInstanceError{HostName: host, InstanceName: "ghost", ErrorMessage: "Instance ghost for hypervisor " + host + " and cloud c1 Not discovered"}
+	noHostName := HypervisorInstanceError{ErrorMessage: "Missing host_name"}
+	tests := []struct {
+		method string
+		query  string
+		body   string
+		status int
+		errors []HypervisorInstanceError
+	}{
+		{"GET", "?hypervisor_instances=nohost:vRouter1", "", http.StatusNotFound, []HypervisorInstanceError{noHost}},
+		{"GET", "?hypervisor_instances=" + host + ":vRouter1,ghost%3Bnohost", "", http.StatusNotFound, []HypervisorInstanceError{noInstance, noHost}},
+		{"GET", "?hypervisor_instances=" + host + ":vRouter1&hypervisor_instances=nohost", "", http.StatusNotFound, []HypervisorInstanceError{noHost}},
+		{"GET", "?hypervisor_instances=:vRouter1", "", http.StatusBadRequest, nil},
+		{"GET", "?hypervisor_instances=" + host + ":vRouter1", "", http.StatusOK, nil},
+		{"POST", "", `{"hypervisor_instances":[{"host_name":"` + host + `","instance_names":["ghost"]},{"host_name":"","instance_names":[]}]}`, http.StatusNotFound, []HypervisorInstanceError{noInstance, noHostName}},
+		{"POST", "?hypervisor_instances=nohost", `{"hypervisor_instances":[{"host_name":"` + host + `","instance_names":["vRouter1"]}]}`, http.StatusNotFound, []HypervisorInstanceError{noHost}},
+		{"POST", "", `{"hypervisor_instances":[{"host_name":"` + host + `","instance_names":["vRouter1"]}]}`, http.StatusOK, nil},
+		{"POST", "", `{"hypervisor_instances":`, http.StatusBadRequest, nil},
+	}
+	for _, test := range tests {
+		path := "/topology/cloudHypervisorsCollapsedFilteredOvsNetworkTopology/c1" + test.query
+		if test.method == "GET" {
+			path = "/topology/cloudHypervisorsOvsNetworkTopology/c1" + test.query
+		}
+		r, _ := http.NewRequest(test.method, "http://topology"+path, strings.NewReader(test.body))
+		rw := httptest.NewRecorder()
+		router.ServeHTTP(rw, r)
+		if rw.Code != test.status {
+			t.Errorf("%s %s = %d, want %d", test.method, path, rw.Code, test.status)
+			continue
+		}
+		if test.status != http.StatusNotFound {
+			continue
+		}
+		var apiError HypervisorInstancesError
+		if err := json.Unmarshal(rw.Body.Bytes(), &apiError); err != nil {
+			t.Errorf("%s %s: %v", test.method, path, err)
+			continue
+		}
+		if apiError.ErrorCode != http.StatusNotFound || apiError.ErrorMessage != strconv.Itoa(len(test.errors))+" hypervisor instances selection error(s)" {
+			t.Errorf("%s %s = %d %q, want %d selection errors", test.method, path, apiError.ErrorCode, apiError.ErrorMessage, len(test.errors))
+		}
+		if !reflect.DeepEqual(apiError.Errors, test.errors) {
+			t.Errorf("%s %s errors = %+v, want %+v", test.method, path, apiError.Errors, test.errors)
+		}
+	}
+}
+
+func TestTopologyLinkKeysNameParallelLinks(t *testing.T) {
+	r, _ := http.NewRequest("GET", "http://topology/topology/cloudOvsNetworkTopology/c1", nil)
+	b := newTopologyBuilder(r, "c1")
+	source := b.addNode("bridge/c1/b1", TopologyNode{Name: "br-int"})
+	target := b.addNode("bridge/c1/b2", TopologyNode{Name: "br-tun"})
+	for _, iface := range []string{"patch-tun", "patch-tun2", "", ""} {
+		link := topologyNodeLink(source, target, "#00FF00")
+		if len(iface) > 0 {
+			link.Props["source_interface"] = iface
+		}
+		b.addLink(link)
+	}
+	b.linkKeys()
+
+	want := []string{
+		"bridge/c1/b1|bridge/c1/b2|patch-tun",
+		"bridge/c1/b1|bridge/c1/b2|patch-tun2",
+		"bridge/c1/b1|bridge/c1/b2",
+		"bridge/c1/b1|bridge/c1/b2#2",
+	}
+	for i, link := range b.links {
+		if link.Key != want[i] {
+			t.Errorf("link %d key = %q, want %q", i, link.Key, want[i])
+		}
+	}
+}
+
+func TestTopologyPresetsKeepLegacyLinks(t *testing.T) {
+	defer testFixture()()
+	router := httprouter.New()
+	InitTopology(router)
+	InitQuery(router)
+
+	get := func(path string) TopologyData {
+		r, _ := http.NewRequest("GET", "http://topology"+path, nil)
+		rw := httptest.NewRecorder()
+		router.ServeHTTP(rw, r)
+		var data TopologyData
+		if err := json.Unmarshal(rw.Body.Bytes(), &data); rw.Code != http.StatusOK || err != nil {
+			t.Fatalf("GET %s = %d %s", path, rw.Code, rw.Body.String())
+		}
+		return data
+	}
+	patchLinks := func(data TopologyData) map[string]TopologyLink {
+		links := make(map[string]TopologyLink)
+		for _, link := range data.Links {
+			if iface, _ := link.Props["source_interface"].(string); len(iface) > 0 {
+				links[iface] = link
+			}
+		}
+		return links
+	}
+
+	links := patchLinks(get("/topology/cloudHypervisorsExpandedFilteredOvsNetworkTopology/c1?hypervisor_instances=compute-node.spirent.com:vRouter1"))
+	if link, ok := links["ex-dangling"]; !ok || link.Source != 0 || link.Props["source_name"] != "" {
+		t.Errorf("ex-dangling link %+v, want it drawn from node 0 for the hidden br-ex", link)
+	}
+	for _, iface := range []string{"patch-tun", "patch-int"} {
+		if _, ok := links[iface]; ok {
+			t.Errorf("filtered view draws the %s patch of br-tun", iface)
+		}
+	}
+	if _, ok := patchLinks(get("/topology/query?cloud=c1&hypervisors=hv1&layers=ovs&filtered=true"))["ex-dangling"]; ok {
+		t.Error("query draws the ex-dangling link of the hidden br-ex")
+	}
+
+	networks := 0
+	for _, node := range get("/topology/cloudInstanceLayer2NetworkTopology/c1/hv1/vRouter1").Nodes {
+		if node.DeviceType == "router" {
+			networks++
+		}
+	}
+	if networks != 3 {
+		t.Errorf("%d network nodes, want one for each of the 3 vNICs", networks)
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"github.com/SpirentOrion/httprouter"
+	"github.com/SpirentOrion/luddite"
+	"golang.org/x/net/context"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	viewCacheDefaultSize = 256
+	headerETag           = "ETag"
+	headerIfNoneMatch    = "If-None-Match"
+)
+
+type viewCacheEntry struct {
+	key         string
+	contentType string
+	body        []byte
+}
+
+// viewGeneration counts the snapshots of the discovered data, test beds and
+// saved layouts the views are built from. Built views are cached per
+// generation, least recently used first out.
+var viewGeneration uint64
+var viewGenerationStarted time.Time = time.Now()
+var viewCache map[string]*list.Element = make(map[string]*list.Element)
+var viewCacheOrder *list.List = list.New()
+var viewCacheLock sync.Mutex
+
+func viewCacheSize() int {
+	if cfg.ViewCache.Size > 0 {
+		return cfg.ViewCache.Size
+	}
+	return viewCacheDefaultSize
+}
+
+// viewCacheInvalidate starts a new generation, dropping the cached views.
+func viewCacheInvalidate() {
+	viewCacheLock.Lock()
+	viewCacheReset()
+	viewCacheLock.Unlock()
+}
+
+// viewCacheReset starts a new generation. Callers hold viewCacheLock.
+func viewCacheReset() {
+	viewGeneration++
+	viewGenerationStarted = time.Now()
+	viewCache = make(map[string]*list.Element)
+	viewCacheOrder.Init()
+}
+
+// viewCacheGeneration returns the current generation, starting a new one
+// once it is older than max_age so views of recent events age out.
+func viewCacheGeneration() uint64 {
+	viewCacheLock.Lock()
+	defer viewCacheLock.Unlock()
+
+	maxAge := time.Duration(cfg.ViewCache.MaxAge) * time.Second
+	if maxAge > 0 && time.Since(viewGenerationStarted) > maxAge {
+		viewCacheReset()
+	}
+	return viewGeneration
+}
+
+func viewCacheGet(generation uint64, key string) *viewCacheEntry {
+	viewCacheLock.Lock()
+	defer viewCacheLock.Unlock()
+
+	if generation != viewGeneration {
+		return nil
+	}
+	if e, ok := viewCache[key]; ok {
+		viewCacheOrder.MoveToFront(e)
+		return e.Value.(*viewCacheEntry)
+	}
+	return nil
+}
+
+func viewCachePut(generation uint64, entry *viewCacheEntry) {
+	viewCacheLock.Lock()
+	defer viewCacheLock.Unlock()
+
+	if generation != viewGeneration {
+		return
+	}
+	if e, ok := viewCache[entry.key]; ok {
+		e.Value = entry
+		viewCacheOrder.MoveToFront(e)
+		return
+	}
+	viewCache[entry.key] = viewCacheOrder.PushFront(entry)
+	for viewCacheOrder.Len() > viewCacheSize() {
+		oldest := viewCacheOrder.Back()
+		delete(viewCache, oldest.Value.(*viewCacheEntry).key)
+		viewCacheOrder.Remove(oldest)
+	}
+}
+
+// viewCacheKey identifies a view by the host its links point to, its path,
+// its parameters in canonical order, the media types it may be negotiated
+// to and what the requester may see.
+func viewCacheKey(r *http.Request) string {
+	return r.Host + r.URL.Path + "?" + r.URL.Query().Encode() + " " + r.Header.Get("Accept") + " " + authScope(r)
+}
+
+// viewCacheStatsKey identifies a view whose links carry the rates of the
+// latest stats poll.
+func viewCacheStatsKey(r *http.Request) string {
+	return viewCacheKey(r) + " stats=" + strconv.FormatUint(statsGetGeneration(), 10)
+}
+
+func viewETag(generation uint64, key string) string {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return fmt.Sprintf(`"%x-%016x"`, generation, h.Sum64())
+}
+
+// viewETagMatch reports whether an If-None-Match header names the tag.
+// "*" names none in particular and is handled by viewCachedBy.
+func viewETagMatch(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// viewCacheWriter tags a successful response and keeps a copy of its body.
+// Other responses are not cached, so their bodies are passed through only.
+type viewCacheWriter struct {
+	http.ResponseWriter
+	etag   string
+	status int
+	body   bytes.Buffer
+}
+
+func (w *viewCacheWriter) WriteHeader(status int) {
+	w.status = status
+	if status == http.StatusOK {
+		w.Header().Set(headerETag, w.etag)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *viewCacheWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.status == http.StatusOK {
+		w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// viewCached serves GET requests for a view from the cache of the current
+// generation, or with 304 when the client already holds it, and otherwise
+// builds the view and caches it.
+func viewCached(handle httprouter.Handle) httprouter.Handle {
+	return viewCachedBy(viewCacheKey, handle)
+}
+
+// viewCachedStats caches a view whose links carry interface rates. Stats
+// polls do not change the structure of a cloud, so rather than starting a
+// new generation they only retire the views cached by viewCachedStats.
+func viewCachedStats(handle httprouter.Handle) httprouter.Handle {
+	return viewCachedBy(viewCacheStatsKey, handle)
+}
+
+func viewCachedBy(viewKey func(r *http.Request) string, handle httprouter.Handle) httprouter.Handle {
+	return func(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			handle(ctx, rw, r)
+			return
+		}
+		generation := viewCacheGeneration()
+		key := viewKey(r)
+		etag := viewETag(generation, key)
+		entry := viewCacheGet(generation, key)
+		// "*" matches any current version of the view, but one that is not
+		// cached may not exist, so it is built to find out.
+		header := strings.TrimSpace(r.Header.Get(headerIfNoneMatch))
+		if viewETagMatch(header, etag) || (header == "*" && entry != nil) {
+			rw.Header().Set(headerETag, etag)
+			rw.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if entry != nil {
+			rw.Header().Set(luddite.HeaderContentType, entry.contentType)
+			rw.Header().Set(headerETag, etag)
+			rw.WriteHeader(http.StatusOK)
+			rw.Write(entry.body)
+			return
+		}
+
+		w := &viewCacheWriter{ResponseWriter: rw, etag: etag}
+		handle(ctx, w, r)
+		if w.status == http.StatusOK {
+			viewCachePut(generation, &viewCacheEntry{key, rw.Header().Get(luddite.HeaderContentType), w.body.Bytes()})
+		}
+	}
+}
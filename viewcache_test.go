@@ -0,0 +1,122 @@
+package main
+
+import (
+	"github.com/SpirentOrion/luddite"
+	"golang.org/x/net/context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestViewETagMatch(t *testing.T) {
+	etag := `"1-00000000000000ab"`
+	tests := []struct {
+		header string
+		match  bool
+	}{
+		{"", false},
+		{etag, true},
+		{"W/" + etag, true},
+		{`"0-00000000000000ab", ` + etag, true},
+		{`"1-00000000000000ac"`, false},
+		{"*", false},
+	}
+	for _, test := range tests {
+		if match := viewETagMatch(test.header, etag); match != test.match {
+			t.Errorf("viewETagMatch(%q) = %v, want %v", test.header, match, test.match)
+		}
+	}
+}
+
+// viewTestHandler counts the views it builds, failing with 404 when found
+// is false.
+func viewTestHandler(builds *int, found *bool) func(context.Context, http.ResponseWriter, *http.Request) {
+	return func(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+		*builds++
+		if !*found {
+			apiError := APIError{http.StatusNotFound, "Cloud c9 Not discovered"}
+			luddite.WriteResponse(rw, apiError.ErrorCode, apiError)
+			return
+		}
+		rw.Header().Set(luddite.HeaderContentType, "application/json")
+		rw.Write([]byte(`{"view":true}`))
+	}
+}
+
+func viewTestGet(handle func(context.Context, http.ResponseWriter, *http.Request), ifNoneMatch string) *httptest.ResponseRecorder {
+	r, _ := http.NewRequest("GET", "http://topology/topology/cloudTopology/c1", nil)
+	if len(ifNoneMatch) > 0 {
+		r.Header.Set(headerIfNoneMatch, ifNoneMatch)
+	}
+	rw := httptest.NewRecorder()
+	handle(context.Background(), rw, r)
+	return rw
+}
+
+func TestViewCachedServesCachedViewsAndNotModified(t *testing.T) {
+	defer testFixture()()
+	builds, found := 0, true
+	handle := viewCached(viewTestHandler(&builds, &found))
+
+	first := viewTestGet(handle, "")
+	etag := first.Header().Get(headerETag)
+	if first.Code != http.StatusOK || len(etag) == 0 {
+		t.Fatalf("first GET = %d with ETag %q, want 200 with a tag", first.Code, etag)
+	}
+	if second := viewTestGet(handle, ""); second.Code != http.StatusOK || second.Body.String() != first.Body.String() || builds != 1 {
+		t.Errorf("second GET = %d %q after %d builds, want the cached view", second.Code, second.Body.String(), builds)
+	}
+	if rw := viewTestGet(handle, etag); rw.Code != http.StatusNotModified {
+		t.Errorf("GET with its ETag = %d, want 304", rw.Code)
+	}
+	if rw := viewTestGet(handle, "*"); rw.Code != http.StatusNotModified {
+		t.Errorf("GET of a cached view with * = %d, want 304", rw.Code)
+	}
+
+	graphInvalidate()
+	if rw := viewTestGet(handle, etag); rw.Code != http.StatusOK || rw.Header().Get(headerETag) == etag || builds != 2 {
+		t.Errorf("GET with the old ETag after discovery = %d, want the view rebuilt with a new tag", rw.Code)
+	}
+}
+
+func TestViewCachedStarNeedsAView(t *testing.T) {
+	defer testFixture()()
+	builds, found := 0, false
+	handle := viewCached(viewTestHandler(&builds, &found))
+
+	if rw := viewTestGet(handle, "*"); rw.Code != http.StatusNotFound || builds != 1 {
+		t.Errorf("GET of a missing view with * = %d, want 404", rw.Code)
+	}
+	if len(viewCache) != 0 {
+		t.Errorf("cached %d failed views, want none", len(viewCache))
+	}
+}
+
+func TestViewCachedStatsFollowsPolls(t *testing.T) {
+	defer testFixture()()
+	builds, found := 0, true
+	plain := viewCached(viewTestHandler(&builds, &found))
+	decorated := viewCachedStats(viewTestHandler(&builds, &found))
+
+	plainETag := viewTestGet(plain, "").Header().Get(headerETag)
+	statsETag := viewTestGet(decorated, "").Header().Get(headerETag)
+	// Without clouds the poll reaches no hypervisors.
+	clouds = nil
+	statsPoll()
+
+	if rw := viewTestGet(plain, plainETag); rw.Code != http.StatusNotModified {
+		t.Errorf("plain view after a stats poll = %d, want 304", rw.Code)
+	}
+	if rw := viewTestGet(decorated, statsETag); rw.Code != http.StatusOK || builds != 3 {
+		t.Errorf("stats view after a stats poll = %d after %d builds, want it rebuilt", rw.Code, builds)
+	}
+}
+
+func TestViewCacheWriterSkipsUncacheableBodies(t *testing.T) {
+	w := &viewCacheWriter{ResponseWriter: httptest.NewRecorder(), etag: `"1-0"`}
+	w.WriteHeader(http.StatusNotFound)
+	w.Write([]byte(`{"error_code":404}`))
+	if w.body.Len() != 0 {
+		t.Errorf("kept %d bytes of a 404, want none", w.body.Len())
+	}
+}